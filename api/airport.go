@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
 	"strconv"
 	"sublink/dto"
@@ -8,8 +9,10 @@ import (
 	"sublink/node"
 	"sublink/services/scheduler"
 	"sublink/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/robfig/cron/v3"
 	"gorm.io/gorm"
 )
@@ -21,6 +24,19 @@ func validateCron(expr string) bool {
 	return err == nil
 }
 
+// submittedJSONFields 返回请求体中出现的顶层JSON字段，需先通过 ShouldBindBodyWith 绑定
+func submittedJSONFields(c *gin.Context) map[string]bool {
+	var raw map[string]json.RawMessage
+	if err := c.ShouldBindBodyWith(&raw, binding.JSON); err != nil {
+		return nil
+	}
+	fields := make(map[string]bool, len(raw))
+	for key := range raw {
+		fields[key] = true
+	}
+	return fields
+}
+
 // AirportWithStats 机场数据（包含节点统计）
 type AirportWithStats struct {
 	models.Airport
@@ -70,6 +86,7 @@ func AirportList(c *gin.Context) {
 			if err == nil {
 				airports[i].NodeCount = len(nodes)
 			}
+			airports[i].RequestConfig = models.EncryptedString(airports[i].MaskedRequestConfig())
 			result[i] = AirportWithStats{
 				Airport:   airports[i],
 				NodeStats: models.GetAirportNodeStats(airports[i].ID),
@@ -104,6 +121,7 @@ func AirportList(c *gin.Context) {
 		if err == nil {
 			airports[i].NodeCount = len(nodes)
 		}
+		airports[i].RequestConfig = models.EncryptedString(airports[i].MaskedRequestConfig())
 		result[i] = AirportWithStats{
 			Airport:   airports[i],
 			NodeStats: models.GetAirportNodeStats(airports[i].ID),
@@ -133,6 +151,8 @@ func AirportGet(c *gin.Context) {
 	if err == nil {
 		airport.NodeCount = len(nodes)
 	}
+	// 请求配置中的敏感值不返回给前端
+	airport.RequestConfig = models.EncryptedString(airport.MaskedRequestConfig())
 
 	utils.OkDetailed(c, "获取成功", airport)
 }
@@ -150,6 +170,21 @@ func AirportAdd(c *gin.Context) {
 		return
 	}
 
+	if _, err := models.ParseAirportRequestConfig(req.RequestConfig); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+
+	if _, err := models.ParseAirportScriptIDs(req.ScriptIDs); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+
+	if !models.IsValidDuplicatePolicy(req.DuplicatePolicy) {
+		utils.FailWithMsg(c, "重复节点处理策略无效")
+		return
+	}
+
 	airport := models.Airport{
 		Name:               req.Name,
 		URL:                req.URL,
@@ -159,6 +194,7 @@ func AirportAdd(c *gin.Context) {
 		DownloadWithProxy:  req.DownloadWithProxy,
 		ProxyLink:          req.ProxyLink,
 		UserAgent:          req.UserAgent,
+		RequestConfig:      models.EncryptedString(req.RequestConfig),
 		FetchUsageInfo:     req.FetchUsageInfo,
 		SkipTLSVerify:      req.SkipTLSVerify,
 		Remark:             req.Remark,
@@ -171,6 +207,8 @@ func AirportAdd(c *gin.Context) {
 		DeduplicationRule:  req.DeduplicationRule,
 		NodeNameUniquify:   req.NodeNameUniquify,
 		NodeNamePrefix:     req.NodeNamePrefix,
+		ScriptIDs:          req.ScriptIDs,
+		DuplicatePolicy:    req.DuplicatePolicy,
 	}
 
 	// 检查是否重复
@@ -210,16 +248,33 @@ func AirportUpdate(c *gin.Context) {
 	}
 
 	var req dto.AirportRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
 		utils.FailWithMsg(c, "参数错误: "+err.Error())
 		return
 	}
+	// 编辑表单不会提交所有字段，未提交的字段保留原值
+	submitted := submittedJSONFields(c)
 
 	if !validateCron(req.CronExpr) {
 		utils.FailWithMsg(c, "Cron表达式格式错误")
 		return
 	}
 
+	if _, err := models.ParseAirportRequestConfig(req.RequestConfig); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+
+	if _, err := models.ParseAirportScriptIDs(req.ScriptIDs); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+
+	if submitted["duplicatePolicy"] && !models.IsValidDuplicatePolicy(req.DuplicatePolicy) {
+		utils.FailWithMsg(c, "重复节点处理策略无效")
+		return
+	}
+
 	// 检查是否存在
 	existing, err := models.GetAirportByID(id)
 	if err != nil {
@@ -237,6 +292,16 @@ func AirportUpdate(c *gin.Context) {
 		return
 	}
 
+	// 请求配置中值为占位符的敏感字段保留原值
+	requestConfig := string(existing.RequestConfig)
+	if submitted["requestConfig"] {
+		requestConfig, err = models.MergeAirportRequestConfig(req.RequestConfig, requestConfig)
+		if err != nil {
+			utils.FailWithMsg(c, err.Error())
+			return
+		}
+	}
+
 	// 更新机场
 	existing.Name = req.Name
 	existing.URL = req.URL
@@ -246,6 +311,7 @@ func AirportUpdate(c *gin.Context) {
 	existing.DownloadWithProxy = req.DownloadWithProxy
 	existing.ProxyLink = req.ProxyLink
 	existing.UserAgent = req.UserAgent
+	existing.RequestConfig = models.EncryptedString(requestConfig)
 	existing.FetchUsageInfo = req.FetchUsageInfo
 	existing.SkipTLSVerify = req.SkipTLSVerify
 	existing.Remark = req.Remark
@@ -258,6 +324,12 @@ func AirportUpdate(c *gin.Context) {
 	existing.DeduplicationRule = req.DeduplicationRule
 	existing.NodeNameUniquify = req.NodeNameUniquify
 	existing.NodeNamePrefix = req.NodeNamePrefix
+	if submitted["scriptIds"] {
+		existing.ScriptIDs = req.ScriptIDs
+	}
+	if submitted["duplicatePolicy"] {
+		existing.DuplicatePolicy = req.DuplicatePolicy
+	}
 
 	if err := existing.Update(); err != nil {
 		utils.FailWithMsg(c, "更新失败: "+err.Error())
@@ -365,3 +437,102 @@ func AirportRefreshUsage(c *gin.Context) {
 		"expire":   usageInfo.Expire,
 	})
 }
+
+// AirportUsageHistory 获取机场用量历史和耗尽预测
+func AirportUsageHistory(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+
+	airport, err := models.GetAirportByID(id)
+	if err != nil {
+		utils.FailWithMsg(c, "机场不存在")
+		return
+	}
+
+	days := 30
+	if daysStr := c.Query("days"); daysStr != "" {
+		if d, err := strconv.Atoi(daysStr); err == nil && d > 0 && d <= 180 {
+			days = d
+		}
+	}
+
+	daily, err := models.GetAirportUsageDaily(id, days)
+	if err != nil {
+		utils.FailWithMsg(c, "获取用量历史失败: "+err.Error())
+		return
+	}
+
+	utils.OkDetailed(c, "获取成功", gin.H{
+		"daily":    daily,
+		"forecast": models.GetAirportUsageForecast(airport, 7),
+	})
+}
+
+// parseHealthDays 解析健康度统计天数参数（默认30天，最多90天）
+func parseHealthDays(c *gin.Context) int {
+	days := 30
+	if daysStr := c.Query("days"); daysStr != "" {
+		if d, err := strconv.Atoi(daysStr); err == nil && d > 0 && d <= 90 {
+			days = d
+		}
+	}
+	return days
+}
+
+// AirportHealthList 获取所有机场的健康度汇总，用于横向对比
+func AirportHealthList(c *gin.Context) {
+	days := parseHealthDays(c)
+
+	airports, err := new(models.Airport).List()
+	if err != nil {
+		utils.FailWithMsg(c, "获取机场列表失败: "+err.Error())
+		return
+	}
+
+	result := make([]models.AirportHealth, 0, len(airports))
+	for i := range airports {
+		result = append(result, models.GetAirportHealth(&airports[i], days))
+	}
+
+	utils.OkDetailed(c, "获取成功", result)
+}
+
+// AirportHealthDetail 获取单个机场的健康度汇总及明细记录
+func AirportHealthDetail(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+
+	airport, err := models.GetAirportByID(id)
+	if err != nil {
+		utils.FailWithMsg(c, "机场不存在")
+		return
+	}
+
+	days := parseHealthDays(c)
+	since := time.Now().AddDate(0, 0, -days)
+
+	pullLogs, err := models.ListAirportPullLogs(id, since)
+	if err != nil {
+		utils.FailWithMsg(c, "获取拉取记录失败: "+err.Error())
+		return
+	}
+	qualitySnapshots, err := models.ListAirportQualitySnapshots(id, since)
+	if err != nil {
+		utils.FailWithMsg(c, "获取质量快照失败: "+err.Error())
+		return
+	}
+
+	utils.OkDetailed(c, "获取成功", gin.H{
+		"summary":  models.GetAirportHealth(airport, days),
+		"pullLogs": pullLogs,
+		"quality":  qualitySnapshots,
+	})
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"sublink/database"
+	"sublink/models"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupAirportTestDB 使用内存数据库替换全局数据库连接，并创建机场和节点表
+func setupAirportTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开内存数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Airport{}, &models.Node{}); err != nil {
+		t.Fatalf("创建数据表失败: %v", err)
+	}
+	database.DB = db
+	// 更新定时任务时异步写入运行时间，测试结束后仍可能访问数据库，因此只关闭连接而不恢复原有的全局连接
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// updateAirport 以JSON请求体调用 AirportUpdate 并返回响应中的 code
+func updateAirport(t *testing.T, id string, body map[string]interface{}) int {
+	t.Helper()
+	payload, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("PUT", "/api/v1/airports/"+id, bytes.NewReader(payload))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: id}}
+	AirportUpdate(c)
+
+	var resp struct {
+		Code int `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return resp.Code
+}
+
+// TestAirportUpdateKeepsOmittedFields 测试编辑表单未提交的字段保留原值
+func TestAirportUpdateKeepsOmittedFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("SUBLINK_API_ENCRYPTION_KEY", "0123456789abcdef0123456789abcdef")
+	setupAirportTestDB(t)
+
+	requestConfig := `{"headers":{"X-Token":"abc"}}`
+	airport := &models.Airport{
+		Name:            "测试机场",
+		URL:             "https://example.com/sub",
+		CronExpr:        "0 */12 * * *",
+		RequestConfig:   models.EncryptedString(requestConfig),
+		ScriptIDs:       "3,1",
+		DuplicatePolicy: models.DuplicatePolicyMerge,
+	}
+	if err := airport.Add(); err != nil {
+		t.Fatalf("创建机场失败: %v", err)
+	}
+
+	// 与前端编辑表单一致，不提交 requestConfig
+	code := updateAirport(t, "1", map[string]interface{}{
+		"name":     "测试机场-改名",
+		"url":      "https://example.com/sub",
+		"cronExpr": "0 */6 * * *",
+	})
+	if code != 200 {
+		t.Fatalf("更新失败，code = %d", code)
+	}
+
+	updated, err := models.GetAirportByID(airport.ID)
+	if err != nil {
+		t.Fatalf("读取机场失败: %v", err)
+	}
+	if updated.Name != "测试机场-改名" {
+		t.Errorf("Name = %q, want 测试机场-改名", updated.Name)
+	}
+	if string(updated.RequestConfig) != requestConfig {
+		t.Errorf("RequestConfig = %q, want %q", updated.RequestConfig, requestConfig)
+	}
+	if updated.ScriptIDs != "3,1" {
+		t.Errorf("ScriptIDs = %q, want 3,1", updated.ScriptIDs)
+	}
+	if updated.DuplicatePolicy != models.DuplicatePolicyMerge {
+		t.Errorf("DuplicatePolicy = %q, want %q", updated.DuplicatePolicy, models.DuplicatePolicyMerge)
+	}
+
+	// 提交无效的重复节点策略时拒绝更新
+	code = updateAirport(t, "1", map[string]interface{}{
+		"name":            "测试机场-改名",
+		"url":             "https://example.com/sub",
+		"cronExpr":        "0 */6 * * *",
+		"duplicatePolicy": "unknown",
+	})
+	if code == 200 {
+		t.Error("无效的 duplicatePolicy 应被拒绝")
+	}
+
+	// 显式提交空值时清空
+	code = updateAirport(t, "1", map[string]interface{}{
+		"name":          "测试机场-改名",
+		"url":           "https://example.com/sub",
+		"cronExpr":      "0 */6 * * *",
+		"requestConfig": "",
+		"scriptIds":     "",
+	})
+	if code != 200 {
+		t.Fatalf("更新失败，code = %d", code)
+	}
+	updated, _ = models.GetAirportByID(airport.ID)
+	if updated.RequestConfig != "" {
+		t.Errorf("RequestConfig = %q, want empty", updated.RequestConfig)
+	}
+	if updated.ScriptIDs != "" {
+		t.Errorf("ScriptIDs = %q, want empty", updated.ScriptIDs)
+	}
+}
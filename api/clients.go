@@ -4,16 +4,20 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sublink/models"
 	"sublink/node"
 	"sublink/node/protocol"
+	"sublink/services/geoip"
 	"sublink/utils"
 	"time"
+	"unicode"
 
 	"github.com/gin-gonic/gin"
 )
@@ -27,10 +31,19 @@ func Md5(src string) string {
 	res := hex.EncodeToString(m.Sum(nil))
 	return res
 }
+
+// clientCountry 请求IP所在国家代码，GeoIP 数据库不可用时返回空
+func clientCountry(c *gin.Context) string {
+	code, err := geoip.GetCountryISOCode(c.ClientIP())
+	if err != nil {
+		return ""
+	}
+	return code
+}
+
 func GetClient(c *gin.Context) {
 	// 获取协议头
 	token := c.Query("token")
-	ClientIndex := c.Query("client") // 客户端标识
 	if token == "" {
 		utils.Warn("token为空")
 		c.Writer.WriteString("Not Found")
@@ -52,6 +65,13 @@ func GetClient(c *gin.Context) {
 		return
 	}
 
+	// 检查可用时段
+	if !share.InAccessWindow(time.Now()) {
+		utils.Warn("分享链接不在可用时段内: %s", token)
+		c.Writer.WriteString("分享链接当前不在可用时段内")
+		return
+	}
+
 	// 获取关联订阅
 	var sub models.Subcription
 	sub.ID = share.SubscriptionID
@@ -81,47 +101,83 @@ func GetClient(c *gin.Context) {
 
 	// 保存 ShareID 到上下文，供IP日志记录使用
 	c.Set("shareID", share.ID)
+	// 保存分享名称，供模板渲染使用
+	c.Set("shareName", share.Name)
 
-	// 判断是否带客户端参数
-	switch ClientIndex {
+	client := requestClient(c)
+
+	// 分享固定到快照时输出快照内容
+	snapshot, err := share.PinnedSnapshot()
+	if err != nil {
+		utils.Warn("分享固定的快照不存在，使用实时渲染: %s: %v", token, err)
+	}
+	if snapshot != nil && snapshot.Content(client) != "" {
+		writeSnapshotContent(c, snapshot, client)
+		return
+	}
+
+	switch client {
 	case "clash":
 		GetClash(c)
-		return
 	case "surge":
 		GetSurge(c)
-		return
-	case "v2ray":
+	default:
 		GetV2ray(c)
-		return
 	}
+}
 
-	// 自动识别客户端
-	ClientList := []string{"clash", "surge"}
-	for k, v := range c.Request.Header {
-		if k == "User-Agent" {
-			for _, UserAgent := range v {
-				if UserAgent == "" {
-					fmt.Println("User-Agent为空")
-				}
-				for _, client := range ClientList {
-					if strings.Contains(strings.ToLower(UserAgent), strings.ToLower(client)) {
-						switch client {
-						case "clash":
-							GetClash(c)
-							return
-						case "surge":
-							GetSurge(c)
-							return
-						default:
-							fmt.Println("未知客户端")
-						}
-					}
-				}
-				GetV2ray(c)
-			}
+// requestClient 识别请求的客户端类型：优先使用 client 参数，其次按 User-Agent 识别，默认 v2ray
+func requestClient(c *gin.Context) string {
+	switch client := c.Query("client"); client {
+	case "clash", "surge", "v2ray":
+		return client
+	}
+	userAgent := strings.ToLower(c.GetHeader("User-Agent"))
+	for _, client := range []string{"clash", "surge"} {
+		if strings.Contains(userAgent, client) {
+			return client
 		}
 	}
+	return "v2ray"
+}
+
+// writeSnapshotContent 输出快照中指定客户端的订阅内容
+func writeSnapshotContent(c *gin.Context, snapshot *models.SubscriptionSnapshot, client string) {
+	c.Writer.Header().Set("X-Sublink-Snapshot", strconv.Itoa(snapshot.Version))
+	writeStoredContent(c, client, snapshot.Content(client), snapshot.NodeSummaries())
+}
+
+// writeStoredContent 输出已保存的订阅内容（快照、最近正常输出），流量信息按保存时的节点所属机场计算
+func writeStoredContent(c *gin.Context, client, content string, summaries []models.SnapshotNode) {
+	nodes := make([]models.Node, 0, len(summaries))
+	for _, n := range summaries {
+		nodes = append(nodes, models.Node{Source: n.Source, SourceID: n.SourceID})
+	}
+	c.Writer.Header().Set("subscription-userinfo", getSubscriptionUsage(nodes))
+	// 如果是HEAD请求将不进行订阅内容相关输出
+	if c.Request.Method == "HEAD" {
+		return
+	}
+
+	c.Set("subname", SunName)
+	ext, contentType := "txt", "text/html; charset=utf-8"
+	switch client {
+	case "clash":
+		ext, contentType = "yaml", "text/plain; charset=utf-8"
+	case "surge":
+		ext, contentType = "conf", "text/plain; charset=utf-8"
+	}
+	encodedFilename := url.QueryEscape(fmt.Sprintf("%s.%s", SunName, ext))
+	c.Writer.Header().Set("Content-Disposition", "inline; filename*=utf-8''"+encodedFilename)
+	c.Writer.Header().Set("Content-Type", contentType)
+
+	if client == "surge" {
+		writeSurgeContent(c, content)
+		return
+	}
+	c.Writer.WriteString(content)
 }
+
 func GetV2ray(c *gin.Context) {
 	var sub models.Subcription
 	if SunName == "" {
@@ -137,99 +193,45 @@ func GetV2ray(c *gin.Context) {
 		c.Writer.WriteString("找不到这个订阅:" + SunName)
 		return
 	}
+	sub.ClientCountry = clientCountry(c)
 	err = sub.GetSub("v2ray")
 	if err != nil {
 		c.Writer.WriteString("读取错误")
 		return
 	}
-	baselist := ""
 
 	// 根据配置决定是否实时刷新用量信息
 	if sub.RefreshUsageOnRequest {
 		node.RefreshUsageForSubscriptionNodes(sub.Nodes)
 	}
-	c.Writer.Header().Set("subscription-userinfo", getSubscriptionUsage(sub.Nodes))
-	// 如果是HEAD请求将不进行订阅内容相关输出
-	if c.Request.Method == "HEAD" {
+	usage := getSubscriptionUsage(sub.Nodes)
+	// 如果是HEAD请求将不进行订阅内容相关输出（配置了健康门槛时需要渲染后才能检查）
+	if c.Request.Method == "HEAD" && sub.HealthGate == "" {
+		c.Writer.Header().Set("subscription-userinfo", usage)
 		return
 	}
 
-	for idx, v := range sub.Nodes {
-		// 应用预处理规则到 LinkName
-		processedLinkName := utils.PreprocessNodeName(sub.NodeNamePreprocess, v.LinkName)
-		// 应用重命名规则
-		nodeLink := v.Link
-		if sub.NodeNameRule != "" {
-			newName := utils.RenameNode(sub.NodeNameRule, utils.NodeInfo{
-				Name:        v.Name,
-				LinkName:    processedLinkName,
-				LinkCountry: v.LinkCountry,
-				Speed:       v.Speed,
-				DelayTime:   v.DelayTime,
-				Group:       v.Group,
-				Source:      v.Source,
-				Index:       idx + 1,
-				Protocol:    protocol.GetProtocolFromLink(v.Link),
-				Tags:        v.Tags,
-			})
-			nodeLink = utils.RenameNodeLink(v.Link, newName)
-		}
-		switch {
-		// 如果包含多条节点
-		case strings.Contains(v.Link, ","):
-			links := strings.Split(v.Link, ",")
-			// 对每个链接应用重命名
-			if sub.NodeNameRule != "" {
-				for i, link := range links {
-					newName := utils.RenameNode(sub.NodeNameRule, utils.NodeInfo{
-						Name:        v.Name,
-						LinkName:    processedLinkName,
-						LinkCountry: v.LinkCountry,
-						Speed:       v.Speed,
-						DelayTime:   v.DelayTime,
-						Group:       v.Group,
-						Source:      v.Source,
-						Index:       idx + 1,
-						Protocol:    protocol.GetProtocolFromLink(link),
-						Tags:        v.Tags,
-					})
-					links[i] = utils.RenameNodeLink(link, newName)
-				}
-			}
-			baselist += strings.Join(links, "\n") + "\n"
-			continue
-		//如果是订阅转换（以 http:// 或 https:// 开头，但不是HTTP/HTTPS代理节点）
-		case (strings.HasPrefix(v.Link, "http://") || strings.HasPrefix(v.Link, "https://")) && !protocol.IsHTTPLink(v.Link):
-			resp, err := http.Get(v.Link)
-			if err != nil {
-				utils.Error("Error getting link: %v", err)
-				return
-			}
-			defer resp.Body.Close()
-			body, _ := io.ReadAll(resp.Body)
-			nodes := utils.Base64Decode(string(body))
-			baselist += nodes + "\n"
-		// 默认
-		default:
-			baselist += nodeLink + "\n"
-		}
+	content, err := renderV2rayContent(&sub)
+	if err != nil {
+		utils.Error("生成订阅内容失败: %v", err)
+		return
 	}
+	// 渲染结果未通过健康门槛时输出最近一次正常的内容
+	if serveHealthFallback(c, &sub, "v2ray", content) {
+		return
+	}
+	c.Writer.Header().Set("subscription-userinfo", usage)
+	if c.Request.Method == "HEAD" {
+		return
+	}
+	rememberLastGood(&sub, "v2ray")
 	c.Set("subname", SunName)
 	filename := fmt.Sprintf("%s.txt", SunName)
 	encodedFilename := url.QueryEscape(filename)
 	c.Writer.Header().Set("Content-Disposition", "inline; filename*=utf-8''"+encodedFilename)
 	c.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
 
-	// 执行脚本
-	for _, script := range sub.ScriptsWithSort {
-		res, err := utils.RunScript(script.Content, baselist, "v2ray")
-		if err != nil {
-			utils.Error("Script execution failed: %v", err)
-			continue
-		}
-		baselist = res
-	}
-	c.Writer.WriteString(utils.Base64Encode(baselist))
+	c.Writer.WriteString(content)
 }
 func GetClash(c *gin.Context) {
 	var sub models.Subcription
@@ -241,228 +243,45 @@ func GetClash(c *gin.Context) {
 		c.Writer.WriteString("找不到这个订阅:" + SunName)
 		return
 	}
+	sub.ClientCountry = clientCountry(c)
 	err = sub.GetSub("clash")
 	if err != nil {
 		c.Writer.WriteString("读取错误")
 		return
 	}
-	var urls []protocol.Urls
 
 	// 根据配置决定是否实时刷新用量信息
 	if sub.RefreshUsageOnRequest {
 		node.RefreshUsageForSubscriptionNodes(sub.Nodes)
 	}
-	c.Writer.Header().Set("subscription-userinfo", getSubscriptionUsage(sub.Nodes))
-	// 如果是HEAD请求将不进行订阅内容相关输出
-	if c.Request.Method == "HEAD" {
+	usage := subscriptionUsage(sub.Nodes)
+	// 如果是HEAD请求将不进行订阅内容相关输出（配置了健康门槛时需要渲染后才能检查）
+	if c.Request.Method == "HEAD" && sub.HealthGate == "" {
+		c.Writer.Header().Set("subscription-userinfo", formatSubscriptionUsage(usage))
 		return
 	}
 
-	// 获取链式代理规则
-	chainRules := models.GetEnabledChainRulesBySubscriptionID(sub.ID)
-
-	// 构建节点ID到最终名称的映射（用于链式代理规则解析）
-	nodeNameMap := make(map[int]string)
-	for idx, v := range sub.Nodes {
-		// 计算节点最终名称
-		processedLinkName := utils.PreprocessNodeName(sub.NodeNamePreprocess, v.LinkName)
-		finalName := v.LinkName // 默认使用原始名称
-		if sub.NodeNameRule != "" {
-			finalName = utils.RenameNode(sub.NodeNameRule, utils.NodeInfo{
-				Name:        v.Name,
-				LinkName:    processedLinkName,
-				LinkCountry: v.LinkCountry,
-				Speed:       v.Speed,
-				DelayTime:   v.DelayTime,
-				Group:       v.Group,
-				Source:      v.Source,
-				Index:       idx + 1,
-				Protocol:    protocol.GetProtocolFromLink(v.Link),
-				Tags:        v.Tags,
-			})
-		}
-		nodeNameMap[v.ID] = finalName
-	}
-
-	// 收集自定义代理组
-	customGroups := models.CollectCustomProxyGroups(chainRules, sub.Nodes, nodeNameMap)
-
-	// ========== 第一阶段：预先收集所有链路的中间节点 dialer-proxy 映射 ==========
-	// key: 节点名称, value: 该节点应设置的 dialer-proxy
-	chainNodeDialerMap := make(map[string]string)
-	// 同时记录每个目标节点应使用的 FinalDialer
-	targetNodeDialerMap := make(map[int]string)
-
-	if len(chainRules) > 0 {
-		for _, v := range sub.Nodes {
-			// 检查该节点是否匹配任何链式规则
-			chainResult := models.ApplyChainRulesToNodeV2(v, chainRules, sub.Nodes, nodeNameMap)
-			if chainResult != nil && chainResult.FinalDialer != "" {
-				// 记录目标节点的 dialer-proxy
-				targetNodeDialerMap[v.ID] = chainResult.FinalDialer
-				// 收集链路中间节点的 dialer-proxy 映射
-				for _, link := range chainResult.Links {
-					// 只处理非代理组类型的中间节点（代理组类型的 dialer-proxy 由组本身处理）
-					if !link.IsGroup && link.DialerProxy != "" {
-						// 如果同一节点在多个规则中作为中间节点，使用最先匹配的
-						if _, exists := chainNodeDialerMap[link.ProxyName]; !exists {
-							chainNodeDialerMap[link.ProxyName] = link.DialerProxy
-						}
-					}
-				}
-				// 收集中间节点自定义代理组内节点的 dialer-proxy 映射
-				for memberName, dialerProxy := range chainResult.GroupMemberDialerMap {
-					if _, exists := chainNodeDialerMap[memberName]; !exists {
-						chainNodeDialerMap[memberName] = dialerProxy
-					}
-				}
-			}
-		}
-		utils.Debug("[ChainProxy] 收集完成: 目标节点=%d, 中间节点=%d", len(targetNodeDialerMap), len(chainNodeDialerMap))
-	}
-
-	// ========== 第二阶段：遍历节点生成配置 ==========
-	for idx, v := range sub.Nodes {
-		// 应用预处理规则到 LinkName
-		processedLinkName := utils.PreprocessNodeName(sub.NodeNamePreprocess, v.LinkName)
-		// 应用重命名规则
-		nodeLink := v.Link
-		if sub.NodeNameRule != "" {
-			newName := utils.RenameNode(sub.NodeNameRule, utils.NodeInfo{
-				Name:        v.Name,
-				LinkName:    processedLinkName,
-				LinkCountry: v.LinkCountry,
-				Speed:       v.Speed,
-				DelayTime:   v.DelayTime,
-				Group:       v.Group,
-				Source:      v.Source,
-				Index:       idx + 1,
-				Protocol:    protocol.GetProtocolFromLink(v.Link),
-				Tags:        v.Tags,
-			})
-			nodeLink = utils.RenameNodeLink(v.Link, newName)
-		}
-
-		// 计算 dialer-proxy（链式代理规则）
-		dialerProxy := strings.TrimSpace(v.DialerProxyName)
-
-		// 优先级：中间节点映射 > 目标节点映射 > 节点自身设置
-		finalNodeName := nodeNameMap[v.ID]
-
-		// 检查是否作为链路中间节点（最高优先级）
-		if chainDialer, exists := chainNodeDialerMap[finalNodeName]; exists {
-			dialerProxy = chainDialer
-		} else if targetDialer, exists := targetNodeDialerMap[v.ID]; exists && dialerProxy == "" {
-			// 作为目标节点
-			dialerProxy = targetDialer
-		}
-
-		switch {
-		// 如果包含多条节点
-		case strings.Contains(v.Link, ","):
-			links := strings.Split(v.Link, ",")
-			for i, link := range links {
-				renamedLink := link
-				if sub.NodeNameRule != "" {
-					newName := utils.RenameNode(sub.NodeNameRule, utils.NodeInfo{
-						Name:        v.Name,
-						LinkName:    processedLinkName,
-						LinkCountry: v.LinkCountry,
-						Speed:       v.Speed,
-						DelayTime:   v.DelayTime,
-						Group:       v.Group,
-						Source:      v.Source,
-						Index:       idx + 1,
-						Protocol:    protocol.GetProtocolFromLink(link),
-						Tags:        v.Tags,
-					})
-					renamedLink = utils.RenameNodeLink(link, newName)
-				}
-				links[i] = renamedLink
-				urls = append(urls, protocol.Urls{
-					Url:             renamedLink,
-					DialerProxyName: dialerProxy,
-				})
-			}
-			continue
-		//如果是订阅转换（以 http:// 或 https:// 开头，但不是HTTP/HTTPS代理节点）
-		case (strings.HasPrefix(v.Link, "http://") || strings.HasPrefix(v.Link, "https://")) && !protocol.IsHTTPLink(v.Link):
-			resp, err := http.Get(v.Link)
-			if err != nil {
-				utils.Error("获取包含链接失败: %v", err)
-				continue
-			}
-			defer resp.Body.Close()
-			body, _ := io.ReadAll(resp.Body)
-			nodes := utils.Base64Decode(string(body))
-			links := strings.Split(nodes, "\n")
-			for _, link := range links {
-				urls = append(urls, protocol.Urls{
-					Url:             link,
-					DialerProxyName: dialerProxy,
-				})
-			}
-		// 默认
-		default:
-			urls = append(urls, protocol.Urls{
-				Url:             nodeLink,
-				DialerProxyName: dialerProxy,
-			})
-		}
-	}
-
-	var configs protocol.OutputConfig
-	err = json.Unmarshal([]byte(sub.Config), &configs)
+	content, err := renderClashContent(&sub, requestTemplateContext(c, &sub, "clash", usage))
 	if err != nil {
-		c.Writer.WriteString("配置读取错误")
+		c.Writer.WriteString(err.Error())
 		return
 	}
-
-	// 如果启用 Host 替换，填充 HostMap
-	if configs.ReplaceServerWithHost {
-		configs.HostMap = models.GetHostMap()
-	}
-
-	// 添加自定义代理组到配置
-	if len(customGroups) > 0 {
-		configs.CustomProxyGroups = make([]protocol.CustomProxyGroup, 0, len(customGroups))
-		for _, g := range customGroups {
-			cpg := protocol.CustomProxyGroup{
-				Name:    g.Name,
-				Type:    g.Type,
-				Proxies: g.Proxies,
-			}
-			if g.URLTestConfig != nil {
-				cpg.URL = g.URLTestConfig.URL
-				cpg.Interval = g.URLTestConfig.Interval
-				cpg.Tolerance = g.URLTestConfig.Tolerance
-				cpg.Strategy = g.URLTestConfig.Strategy
-			}
-			configs.CustomProxyGroups = append(configs.CustomProxyGroups, cpg)
-		}
+	// 渲染结果未通过健康门槛时输出最近一次正常的内容
+	if serveHealthFallback(c, &sub, "clash", content) {
+		return
 	}
-
-	DecodeClash, err := protocol.EncodeClash(urls, configs)
-	if err != nil {
-		c.Writer.WriteString(err.Error())
+	c.Writer.Header().Set("subscription-userinfo", formatSubscriptionUsage(usage))
+	if c.Request.Method == "HEAD" {
 		return
 	}
+	rememberLastGood(&sub, "clash")
 	c.Set("subname", SunName)
 	filename := fmt.Sprintf("%s.yaml", SunName)
 	encodedFilename := url.QueryEscape(filename)
 	c.Writer.Header().Set("Content-Disposition", "inline; filename*=utf-8''"+encodedFilename)
 	c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
-	// 执行脚本
-	for _, script := range sub.ScriptsWithSort {
-		res, err := utils.RunScript(script.Content, string(DecodeClash), "clash")
-		if err != nil {
-			utils.Error("Script execution failed: %v", err)
-			continue
-		}
-		DecodeClash = []byte(res)
-	}
-	c.Writer.WriteString(string(DecodeClash))
+	c.Writer.WriteString(content)
 }
 
 func GetSurge(c *gin.Context) {
@@ -475,88 +294,176 @@ func GetSurge(c *gin.Context) {
 		c.Writer.WriteString("找不到这个订阅:" + SunName)
 		return
 	}
+	sub.ClientCountry = clientCountry(c)
 	err = sub.GetSub("surge")
 	if err != nil {
 		c.Writer.WriteString("读取错误")
 		return
 	}
-	urls := []string{}
 
 	// 根据配置决定是否实时刷新用量信息
 	if sub.RefreshUsageOnRequest {
 		node.RefreshUsageForSubscriptionNodes(sub.Nodes)
 	}
-	c.Writer.Header().Set("subscription-userinfo", getSubscriptionUsage(sub.Nodes))
-	// 如果是HEAD请求将不进行订阅内容相关输出
+	usage := subscriptionUsage(sub.Nodes)
+	// 如果是HEAD请求将不进行订阅内容相关输出（配置了健康门槛时需要渲染后才能检查）
+	if c.Request.Method == "HEAD" && sub.HealthGate == "" {
+		c.Writer.Header().Set("subscription-userinfo", formatSubscriptionUsage(usage))
+		return
+	}
+
+	content, err := renderSurgeContent(&sub, requestTemplateContext(c, &sub, "surge", usage))
+	if err != nil {
+		c.Writer.WriteString(err.Error())
+		return
+	}
+	// 渲染结果未通过健康门槛时输出最近一次正常的内容
+	if serveHealthFallback(c, &sub, "surge", content) {
+		return
+	}
+	c.Writer.Header().Set("subscription-userinfo", formatSubscriptionUsage(usage))
 	if c.Request.Method == "HEAD" {
 		return
 	}
+	rememberLastGood(&sub, "surge")
+	c.Set("subname", SunName)
+	filename := fmt.Sprintf("%s.conf", SunName)
+	encodedFilename := url.QueryEscape(filename)
+	c.Writer.Header().Set("Content-Disposition", "inline; filename*=utf-8''"+encodedFilename)
+	c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	writeSurgeContent(c, content)
+}
+
+// renderV2rayContent 生成 V2Ray（Base64 链接）订阅内容，sub 需已通过 GetSub 加载节点
+func renderV2rayContent(sub *models.Subcription) (string, error) {
+	baselist, err := encodeV2rayContent(sub)
+	if err != nil {
+		return "", err
+	}
+	return utils.Base64Encode(runSubModScripts(sub, "v2ray", baselist)), nil
+}
+
+// encodeV2rayContent 生成执行订阅脚本前的 V2Ray 节点链接列表（未编码）
+func encodeV2rayContent(sub *models.Subcription) (string, error) {
+	baselist := ""
 	for idx, v := range sub.Nodes {
-		// 应用预处理规则到 LinkName
-		processedLinkName := utils.PreprocessNodeName(sub.NodeNamePreprocess, v.LinkName)
-		// 应用重命名规则
-		nodeLink := v.Link
-		if sub.NodeNameRule != "" {
-			newName := utils.RenameNode(sub.NodeNameRule, utils.NodeInfo{
-				Name:        v.Name,
-				LinkName:    processedLinkName,
-				LinkCountry: v.LinkCountry,
-				Speed:       v.Speed,
-				DelayTime:   v.DelayTime,
-				Group:       v.Group,
-				Source:      v.Source,
-				Index:       idx + 1,
-				Protocol:    protocol.GetProtocolFromLink(v.Link),
-				Tags:        v.Tags,
-			})
-			nodeLink = utils.RenameNodeLink(v.Link, newName)
+		//如果是订阅转换（以 http:// 或 https:// 开头，但不是HTTP/HTTPS代理节点）
+		if isRemoteSubscriptionLink(v.Link) {
+			nodes, err := fetchRemoteSubscription(v.Link)
+			if err != nil {
+				return "", fmt.Errorf("获取订阅转换链接失败: %v", err)
+			}
+			baselist += nodes + "\n"
+			continue
 		}
-		switch {
-		// 如果包含多条节点
-		case strings.Contains(v.Link, ","):
-			links := strings.Split(v.Link, ",")
-			for i, link := range links {
-				if sub.NodeNameRule != "" {
-					newName := utils.RenameNode(sub.NodeNameRule, utils.NodeInfo{
-						Name:        v.Name,
-						LinkName:    processedLinkName,
-						LinkCountry: v.LinkCountry,
-						Speed:       v.Speed,
-						DelayTime:   v.DelayTime,
-						Group:       v.Group,
-						Source:      v.Source,
-						Index:       idx + 1,
-						Protocol:    protocol.GetProtocolFromLink(link),
-						Tags:        v.Tags,
-					})
-					links[i] = utils.RenameNodeLink(link, newName)
-				}
+		// 应用预处理和重命名规则，包含多条节点时逐条处理
+		baselist += strings.Join(sub.RenamedLinks(idx), "\n") + "\n"
+	}
+	return baselist, nil
+}
+
+// renderClashContent 生成 Clash 订阅内容，sub 需已通过 GetSub 加载节点，ctx 为模板渲染上下文
+func renderClashContent(sub *models.Subcription, ctx *protocol.TemplateContext) (string, error) {
+	content, err := encodeClashContent(sub, ctx)
+	if err != nil {
+		return "", err
+	}
+	return runSubModScripts(sub, "clash", content), nil
+}
+
+// encodeClashContent 生成执行订阅脚本前的 Clash 订阅内容
+func encodeClashContent(sub *models.Subcription, ctx *protocol.TemplateContext) (string, error) {
+	// 解析链式代理规则：计算每个节点的 dialer-proxy 和需要生成的自定义代理组
+	chainPlan := models.BuildChainRenderPlan(sub, models.GetEnabledChainRulesBySubscriptionID(sub.ID))
+
+	var urls []protocol.Urls
+	for idx, v := range sub.Nodes {
+		//如果是订阅转换（以 http:// 或 https:// 开头，但不是HTTP/HTTPS代理节点）
+		if isRemoteSubscriptionLink(v.Link) {
+			nodes, err := fetchRemoteSubscription(v.Link)
+			if err != nil {
+				utils.Error("获取包含链接失败: %v", err)
+				continue
+			}
+			// 远程订阅中的节点不是链式代理规则匹配的节点，不设置 dialer-proxy
+			for _, link := range strings.Split(nodes, "\n") {
+				urls = append(urls, protocol.Urls{Url: link})
 			}
-			urls = append(urls, links...)
 			continue
+		}
+		// 应用预处理和重命名规则，包含多条节点时逐条处理
+		dialerProxy := strings.TrimSpace(chainPlan.NodeDialers[v.ID])
+		for _, link := range sub.RenamedLinks(idx) {
+			urls = append(urls, protocol.Urls{
+				Url:             link,
+				DialerProxyName: dialerProxy,
+			})
+		}
+	}
+
+	configs, err := subscriptionOutputConfig(sub, ctx, chainPlan, models.ChainClientClash)
+	if err != nil {
+		return "", err
+	}
+	DecodeClash, err := protocol.EncodeClash(urls, configs)
+	if err != nil {
+		return "", err
+	}
+	return string(DecodeClash), nil
+}
+
+// renderSurgeContent 生成 Surge 订阅内容（不含托管配置头部），sub 需已通过 GetSub 加载节点，ctx 为模板渲染上下文
+func renderSurgeContent(sub *models.Subcription, ctx *protocol.TemplateContext) (string, error) {
+	content, err := encodeSurgeContent(sub, ctx)
+	if err != nil {
+		return "", err
+	}
+	// 模板已包含托管配置头部时原样输出
+	if strings.Contains(content, "#!MANAGED-CONFIG") {
+		return content, nil
+	}
+	return runSubModScripts(sub, "surge", content), nil
+}
+
+// encodeSurgeContent 生成执行订阅脚本前的 Surge 订阅内容
+func encodeSurgeContent(sub *models.Subcription, ctx *protocol.TemplateContext) (string, error) {
+	// 解析链式代理规则：计算每个节点的 underlying-proxy 和需要生成的自定义代理组
+	chainPlan := models.BuildChainRenderPlan(sub, models.GetEnabledChainRulesBySubscriptionID(sub.ID))
+
+	var urls []protocol.Urls
+	for idx, v := range sub.Nodes {
 		//如果是订阅转换（以 http:// 或 https:// 开头，但不是HTTP/HTTPS代理节点）
-		case (strings.HasPrefix(v.Link, "http://") || strings.HasPrefix(v.Link, "https://")) && !protocol.IsHTTPLink(v.Link):
-			resp, err := http.Get(v.Link)
+		if isRemoteSubscriptionLink(v.Link) {
+			nodes, err := fetchRemoteSubscription(v.Link)
 			if err != nil {
-				utils.Error("Error getting link: %v", err)
-				return
+				return "", fmt.Errorf("获取订阅转换链接失败: %v", err)
 			}
-			defer resp.Body.Close()
-			body, _ := io.ReadAll(resp.Body)
-			nodes := utils.Base64Decode(string(body))
-			links := strings.Split(nodes, "\n")
-			urls = append(urls, links...)
-		// 默认
-		default:
-			urls = append(urls, nodeLink)
+			// 远程订阅中的节点不是链式代理规则匹配的节点，不设置上级代理
+			for _, link := range strings.Split(nodes, "\n") {
+				urls = append(urls, protocol.Urls{Url: link})
+			}
+			continue
+		}
+		// 应用预处理和重命名规则，包含多条节点时逐条处理
+		dialerProxy := strings.TrimSpace(chainPlan.NodeDialers[v.ID])
+		for _, link := range sub.RenamedLinks(idx) {
+			urls = append(urls, protocol.Urls{Url: link, DialerProxyName: dialerProxy})
 		}
 	}
 
-	var configs protocol.OutputConfig
-	err = json.Unmarshal([]byte(sub.Config), &configs)
+	configs, err := subscriptionOutputConfig(sub, ctx, chainPlan, models.ChainClientSurge)
 	if err != nil {
-		c.Writer.WriteString("配置读取错误")
-		return
+		return "", err
+	}
+	return protocol.EncodeSurge(urls, configs)
+}
+
+// subscriptionOutputConfig 读取订阅的输出配置，并填充 Host 替换、自定义代理组和模板渲染上下文
+func subscriptionOutputConfig(sub *models.Subcription, ctx *protocol.TemplateContext, chainPlan *models.ChainRenderPlan, client string) (protocol.OutputConfig, error) {
+	var configs protocol.OutputConfig
+	if err := json.Unmarshal([]byte(sub.Config), &configs); err != nil {
+		return configs, errors.New("配置读取错误")
 	}
 
 	// 如果启用 Host 替换，填充 HostMap
@@ -564,23 +471,82 @@ func GetSurge(c *gin.Context) {
 		configs.HostMap = models.GetHostMap()
 	}
 
-	// log.Println("surge路径:", configs)
-	DecodeClash, err := protocol.EncodeSurge(urls, configs)
+	// 添加自定义代理组到配置
+	configs.CustomProxyGroups = chainPlan.ProtocolGroups()
+	// 添加按国家/标签组自动生成的代理组，跳过与模板代理组同名的分组
+	var templateGroups []string
+	if sub.AutoGroupRule != "" {
+		templateGroups = outputTemplateGroups(&configs, ctx, client)
+	}
+	autoGroups := sub.AutoProxyGroups(client, chainPlan.NodeNameMap, configs.CustomProxyGroups, templateGroups)
+	configs.CustomProxyGroups = append(configs.CustomProxyGroups, autoGroups...)
+	// 模板变量和条件段落的渲染上下文
+	ctx.AutoGroups = protocol.CustomGroupNames(autoGroups)
+	configs.TemplateContext = ctx
+	return configs, nil
+}
+
+// outputTemplateGroups 读取 client 输出模板并返回按 ctx 渲染后的代理组名称
+// 读取到的模板内容写入 configs.TemplateContent，生成配置时不再重复读取
+func outputTemplateGroups(configs *protocol.OutputConfig, ctx *protocol.TemplateContext, client string) []string {
+	templatePath := configs.Clash
+	if client == models.ChainClientSurge {
+		templatePath = configs.Surge
+	}
+	content, ok := readTemplateContent(templatePath)
+	if !ok {
+		return nil
+	}
+	configs.TemplateContent = content
+	if rendered, err := protocol.RenderTemplate(content, ctx); err == nil {
+		content = rendered
+	}
+	return parseTemplateProxyGroupNames(content, client)
+}
+
+// runSubModScripts 依次执行订阅的 subMod 脚本，执行失败时跳过该脚本，使用脚本处理前的内容
+func runSubModScripts(sub *models.Subcription, client, content string) string {
+	for _, script := range sub.ScriptsWithSort {
+		res, err := utils.RunScript(script.Content, content, client, &utils.ScriptEnv{ScriptID: script.ID, ScriptName: script.Name})
+		if err != nil {
+			if !models.IsScriptEntryMissing(err) {
+				utils.Error("Script execution failed: %v", err)
+				models.RecordScriptFailure(script.ID, err)
+			}
+			continue
+		}
+		content = res
+	}
+	return content
+}
+
+// isRemoteSubscriptionLink 判断节点链接是否为订阅转换链接（以 http:// 或 https:// 开头，但不是HTTP/HTTPS代理节点）
+// 包含多条节点的链接不是订阅转换链接
+func isRemoteSubscriptionLink(link string) bool {
+	if strings.Contains(link, ",") {
+		return false
+	}
+	return (strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://")) && !protocol.IsHTTPLink(link)
+}
+
+// fetchRemoteSubscription 拉取订阅转换链接的内容并 Base64 解码
+func fetchRemoteSubscription(link string) (string, error) {
+	resp, err := http.Get(link)
 	if err != nil {
-		c.Writer.WriteString(err.Error())
-		return
+		return "", err
 	}
-	c.Set("subname", SunName)
-	filename := fmt.Sprintf("%s.conf", SunName)
-	encodedFilename := url.QueryEscape(filename)
-	c.Writer.Header().Set("Content-Disposition", "inline; filename*=utf-8''"+encodedFilename)
-	c.Writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return utils.Base64Decode(string(body)), nil
+}
 
+// writeSurgeContent 输出 Surge 订阅内容，内容不含托管配置头部时按请求地址插入
+func writeSurgeContent(c *gin.Context, content string) {
 	host := c.Request.Host
 	url := c.Request.URL.String()
 	// 如果包含头部更新信息
-	if strings.Contains(DecodeClash, "#!MANAGED-CONFIG") {
-		c.Writer.WriteString(DecodeClash)
+	if strings.Contains(content, "#!MANAGED-CONFIG") {
+		c.Writer.WriteString(content)
 		return
 	}
 	var domain string
@@ -600,20 +566,23 @@ func GetSurge(c *gin.Context) {
 	}
 	// 否则就插入头部更新信息
 	interval := fmt.Sprintf("#!MANAGED-CONFIG %s interval=86400 strict=false", domain+url)
-	// 执行脚本
-	for _, script := range sub.ScriptsWithSort {
-		res, err := utils.RunScript(script.Content, DecodeClash, "surge")
-		if err != nil {
-			utils.Error("Script execution failed: %v", err)
-			continue
-		}
-		DecodeClash = res
-	}
-	c.Writer.WriteString(string(interval + "\n" + DecodeClash))
+	c.Writer.WriteString(interval + "\n" + content)
 }
 
-// getSubscriptionUsage 计算订阅的流量使用情况
+// getSubscriptionUsage 计算订阅的流量使用情况，返回 subscription-userinfo 响应头的值
 func getSubscriptionUsage(nodes []models.Node) string {
+	return formatSubscriptionUsage(subscriptionUsage(nodes))
+}
+
+// formatSubscriptionUsage 格式化 subscription-userinfo 响应头
+func formatSubscriptionUsage(usage protocol.TemplateUsage) string {
+	result := fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d", usage.Upload, usage.Download, usage.Total, usage.Expire)
+	utils.Debug("完成机场用量信息 subscription-userinfo构造: %s", result)
+	return result
+}
+
+// subscriptionUsage 汇总订阅节点所属机场的流量使用情况
+func subscriptionUsage(nodes []models.Node) protocol.TemplateUsage {
 	airportIDs := make(map[int]bool)
 	for _, node := range nodes {
 		if node.Source != "manual" && node.SourceID > 0 {
@@ -668,7 +637,45 @@ func getSubscriptionUsage(nodes []models.Node) string {
 		}
 	}
 
-	result := fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d", upload, download, total, expire)
-	utils.Debug("完成机场用量信息 subscription-userinfo构造: %s", result)
-	return result
+	return protocol.TemplateUsage{Upload: upload, Download: download, Total: total, Expire: expire}
+}
+
+// newTemplateContext 根据订阅当前的节点构建模板渲染上下文
+func newTemplateContext(sub *models.Subcription, client string) *protocol.TemplateContext {
+	ctx := &protocol.TemplateContext{
+		Subscription: sub.Name,
+		Client:       client,
+		NodeCount:    len(sub.Nodes),
+		Countries:    make(map[string]int),
+		Tags:         make(map[string]int),
+		Params:       make(map[string]string),
+	}
+	for _, n := range sub.Nodes {
+		if n.LinkCountry != "" {
+			ctx.Countries[strings.ToUpper(n.LinkCountry)]++
+		}
+		for _, tag := range n.GetTagNames() {
+			ctx.Tags[tag]++
+		}
+	}
+	return ctx
+}
+
+// requestTemplateContext 构建订阅请求的模板渲染上下文，包含分享名称、流量信息和请求参数（不含 token）
+func requestTemplateContext(c *gin.Context, sub *models.Subcription, client string, usage protocol.TemplateUsage) *protocol.TemplateContext {
+	ctx := newTemplateContext(sub, client)
+	ctx.Share = c.GetString("shareName")
+	ctx.Usage = usage
+	for key, values := range c.Request.URL.Query() {
+		if key == "token" || len(values) == 0 {
+			continue
+		}
+		// 含换行等控制字符的参数值会破坏 YAML / INI 结构，直接忽略
+		if strings.IndexFunc(values[0], unicode.IsControl) >= 0 {
+			utils.Warn("订阅【%s】请求参数 %s 包含控制字符，已忽略", sub.Name, key)
+			continue
+		}
+		ctx.Params[key] = values[0]
+	}
+	return ctx
 }
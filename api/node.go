@@ -711,6 +711,22 @@ func GetSources(c *gin.Context) {
 	utils.OkDetailed(c, "获取来源列表成功", sources)
 }
 
+// GetNodeSourceList 获取节点的全部来源机场（主来源与附加来源）
+// GET /api/v1/nodes/source-list?id=xxx
+func GetNodeSourceList(c *gin.Context) {
+	nodeID, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		utils.FailWithMsg(c, "节点ID格式错误")
+		return
+	}
+	node, ok := models.GetNodeByID(nodeID)
+	if !ok {
+		utils.FailWithMsg(c, "节点不存在")
+		return
+	}
+	utils.OkWithData(c, models.GetNodeSources(node))
+}
+
 // FastestSpeedNode 获取最快速度节点
 func FastestSpeedNode(c *gin.Context) {
 	node := models.GetFastestSpeedNode()
@@ -3,10 +3,10 @@ package api
 import (
 	"encoding/json"
 	"net/http"
-	"sort"
 	"sublink/database"
 	"sublink/models"
 	"sublink/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -35,6 +35,19 @@ type PreviewRequest struct {
 	NodeNamePreprocess string   `json:"NodeNamePreprocess"` // 原名预处理规则
 	NodeNameRule       string   `json:"NodeNameRule"`       // 节点命名规则模板
 	DeduplicationRule  string   `json:"DeduplicationRule"`  // 去重规则配置
+	SelectionRule      string   `json:"SelectionRule"`      // 分组精选规则配置
+	NodeQuery          string   `json:"NodeQuery"`          // 动态节点条件
+	OrderRule          string   `json:"OrderRule"`          // 输出排序规则配置
+	TimeRule           string   `json:"TimeRule"`           // 时间窗口规则配置
+
+	Includes []models.SubcriptionInclude `json:"Includes"` // 引用的子订阅（按 Sort 与节点、分组混合排序）
+
+	// 是否返回过滤过程解释（各阶段节点数量、被排除的节点及原因）
+	Explain bool `json:"Explain"`
+	// 模拟客户端所在国家代码（输出排序就近使用），为空时使用请求IP所在国家
+	ClientCountry string `json:"ClientCountry"`
+	// 模拟渲染时间（RFC3339 或 2006-01-02 15:04:05），用于测试时间窗口规则，为空时使用当前时间
+	RenderAt string `json:"RenderAt"`
 
 	// 兼容旧版本：节点名称列表（已废弃，保留向后兼容）
 	Nodes []interface{} `json:"Nodes"` // 可以是节点ID或节点名称
@@ -51,15 +64,25 @@ func PreviewSubscriptionNodes(c *gin.Context) {
 		})
 		return
 	}
+	if req.ClientCountry == "" {
+		req.ClientCountry = clientCountry(c)
+	}
+	renderAt, err := parseRenderAt(req.RenderAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"msg":  "渲染时间格式错误",
+		})
+		return
+	}
 
 	var result *models.PreviewResult
-	var err error
 
 	// 如果提供了 SubscriptionID，直接从数据库加载并使用 GetSub 逻辑
 	if req.SubscriptionID > 0 {
-		result, err = previewSavedSubscription(req.SubscriptionID)
+		result, err = previewSavedSubscription(req, renderAt)
 	} else {
-		result, err = previewFormSubscription(req)
+		result, err = previewFormSubscription(req, renderAt)
 	}
 
 	if err != nil {
@@ -77,13 +100,33 @@ func PreviewSubscriptionNodes(c *gin.Context) {
 	})
 }
 
+// parseRenderAt 解析预览的模拟渲染时间，为空时返回零值（使用当前时间）
+func parseRenderAt(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		parsed, err = time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+		if err != nil {
+			parsed, err = time.ParseInLocation("2006-01-02T15:04", value, time.Local)
+		}
+	}
+	return parsed, err
+}
+
 // previewSavedSubscription 预览已保存的订阅
 // 使用与实际拉取完全相同的 GetSub 逻辑，确保预览结果与拉取结果一致
-func previewSavedSubscription(subID int) (*models.PreviewResult, error) {
-	sub, err := models.GetSubcriptionByID(subID)
+func previewSavedSubscription(req PreviewRequest, renderAt time.Time) (*models.PreviewResult, error) {
+	sub, err := models.GetSubcriptionByID(req.SubscriptionID)
 	if err != nil {
 		return nil, err
 	}
+	sub.ClientCountry = req.ClientCountry
+	sub.RenderAt = renderAt
+	if req.Explain {
+		sub.FilterTrace = models.NewFilterTrace()
+	}
 
 	// 使用与 GetSub 完全相同的逻辑获取节点
 	// GetSub 已包含：节点/分组混合排序、过滤规则、脚本执行
@@ -137,18 +180,21 @@ func previewSavedSubscription(subID int) (*models.PreviewResult, error) {
 	}
 
 	return &models.PreviewResult{
-		Nodes:         previewNodes,
-		TotalCount:    totalCount,
-		FilteredCount: filteredCount,
-		UsageUpload:   upload,
-		UsageDownload: download,
-		UsageTotal:    total,
-		UsageExpire:   expire,
+		Nodes:               previewNodes,
+		TotalCount:          totalCount,
+		FilteredCount:       filteredCount,
+		Deduplicated:        sub.DeduplicationDrops,
+		AirportDeduplicated: models.AirportDeduplicationDropsForNodes(sub.Nodes),
+		Explain:             sub.FilterTrace,
+		UsageUpload:         upload,
+		UsageDownload:       download,
+		UsageTotal:          total,
+		UsageExpire:         expire,
 	}, nil
 }
 
 // previewFormSubscription 预览表单中的订阅（未保存）
-func previewFormSubscription(req PreviewRequest) (*models.PreviewResult, error) {
+func previewFormSubscription(req PreviewRequest, renderAt time.Time) (*models.PreviewResult, error) {
 	// 构建临时订阅对象
 	tempSub := &models.Subcription{
 		DelayTime:          req.DelayTime,
@@ -164,10 +210,22 @@ func previewFormSubscription(req PreviewRequest) (*models.PreviewResult, error)
 		NodeNamePreprocess: req.NodeNamePreprocess,
 		NodeNameRule:       req.NodeNameRule,
 		DeduplicationRule:  req.DeduplicationRule,
+		SelectionRule:      req.SelectionRule,
+		NodeQuery:          req.NodeQuery,
+		OrderRule:          req.OrderRule,
+		TimeRule:           req.TimeRule,
+		ClientCountry:      req.ClientCountry,
+		RenderAt:           renderAt,
+	}
+	if req.Explain {
+		tempSub.FilterTrace = models.NewFilterTrace()
 	}
 
 	// 使用与 GetSub 相同的混合排序逻辑构建节点列表
-	allNodes := buildNodesWithMixedSort(req)
+	allNodes, err := buildNodesWithMixedSort(req, tempSub)
+	if err != nil {
+		return nil, err
+	}
 	totalCount := len(allNodes)
 
 	// 应用脚本处理（filterNode 脚本）
@@ -183,7 +241,7 @@ func previewFormSubscription(req PreviewRequest) (*models.PreviewResult, error)
 				continue
 			}
 
-			resultJSON, err := utils.RunNodeFilterScript(script.Content, nodesJSON, "preview")
+			resultJSON, err := utils.RunNodeFilterScript(script.Content, nodesJSON, "preview", &utils.ScriptEnv{ScriptID: script.ID, ScriptName: script.Name})
 			if err != nil {
 				continue
 			}
@@ -193,6 +251,7 @@ func previewFormSubscription(req PreviewRequest) (*models.PreviewResult, error)
 				continue
 			}
 
+			tempSub.FilterTrace.RecordScript(script.Name, allNodes, processedNodes)
 			allNodes = processedNodes
 		}
 	}
@@ -212,36 +271,23 @@ func previewFormSubscription(req PreviewRequest) (*models.PreviewResult, error)
 }
 
 // buildNodesWithMixedSort 使用与 GetSub 相同的混合排序逻辑构建节点列表
-func buildNodesWithMixedSort(req PreviewRequest) []models.Node {
-	// 定义混合排序项
-	type MixedItem struct {
-		Node    *models.Node
-		Group   string
-		Sort    int
-		IsGroup bool
-	}
-
-	var mixedItems []MixedItem
+// sub 为预览使用的临时订阅，子订阅沿用它的请求上下文
+func buildNodesWithMixedSort(req PreviewRequest, sub *models.Subcription) ([]models.Node, error) {
+	var sources []models.SubcriptionSource
 
 	// 处理节点ID列表（带排序）
-	if len(req.NodeIDs) > 0 {
-		for i, nodeID := range req.NodeIDs {
-			if node, ok := models.GetNodeByID(nodeID); ok {
-				sortVal := i // 默认使用索引作为排序值
-				if i < len(req.NodeSorts) {
-					sortVal = req.NodeSorts[i]
-				}
-				mixedItems = append(mixedItems, MixedItem{
-					Node:    node,
-					Sort:    sortVal,
-					IsGroup: false,
-				})
+	for i, nodeID := range req.NodeIDs {
+		if node, ok := models.GetNodeByID(nodeID); ok {
+			sortVal := i // 默认使用索引作为排序值
+			if i < len(req.NodeSorts) {
+				sortVal = req.NodeSorts[i]
 			}
+			sources = append(sources, models.SubcriptionSource{Node: node, Sort: sortVal})
 		}
 	}
 
 	// 兼容旧版本：处理 Nodes 字段（可能是节点ID或节点名称）
-	if len(req.Nodes) > 0 && len(req.NodeIDs) == 0 {
+	if len(req.NodeIDs) == 0 {
 		for i, nodeVal := range req.Nodes {
 			var node *models.Node
 			var ok bool
@@ -257,74 +303,26 @@ func buildNodesWithMixedSort(req PreviewRequest) []models.Node {
 			}
 
 			if ok && node != nil {
-				mixedItems = append(mixedItems, MixedItem{
-					Node:    node,
-					Sort:    i, // 旧版本没有排序信息，使用索引
-					IsGroup: false,
-				})
+				// 旧版本没有排序信息，使用索引
+				sources = append(sources, models.SubcriptionSource{Node: node, Sort: i})
 			}
 		}
 	}
 
 	// 处理分组（带排序）
-	if len(req.Groups) > 0 {
-		for i, groupName := range req.Groups {
-			sortVal := len(mixedItems) + i // 默认在节点后面
-			if i < len(req.GroupSorts) {
-				sortVal = req.GroupSorts[i]
-			}
-			mixedItems = append(mixedItems, MixedItem{
-				Group:   groupName,
-				Sort:    sortVal,
-				IsGroup: true,
-			})
+	nodeCount := len(sources)
+	for i, groupName := range req.Groups {
+		sortVal := nodeCount + i // 默认在节点后面
+		if i < len(req.GroupSorts) {
+			sortVal = req.GroupSorts[i]
 		}
+		sources = append(sources, models.SubcriptionSource{Group: groupName, Sort: sortVal})
 	}
 
-	// 验证至少有节点或分组
-	if len(mixedItems) == 0 {
-		return nil
-	}
-
-	// 按排序值排序混合列表
-	sort.Slice(mixedItems, func(i, j int) bool {
-		return mixedItems[i].Sort < mixedItems[j].Sort
-	})
-
-	// 获取分组节点映射
-	groupNodeMap := make(map[string][]models.Node)
-	for _, item := range mixedItems {
-		if item.IsGroup {
-			var groupNodes []models.Node
-			node := &models.Node{}
-			groupNodes, _ = node.ListByGroups([]string{item.Group})
-			groupNodeMap[item.Group] = groupNodes
-		}
-	}
-
-	// 按排序后的顺序构建最终节点列表（与 GetSub 逻辑一致）
-	nodeMap := make(map[string]bool) // 用于按名称去重
-	var result []models.Node
-
-	for _, item := range mixedItems {
-		if item.IsGroup {
-			// 添加分组中的所有节点
-			if nodes, exists := groupNodeMap[item.Group]; exists {
-				for _, node := range nodes {
-					if !nodeMap[node.Name] {
-						result = append(result, node)
-						nodeMap[node.Name] = true
-					}
-				}
-			}
-		} else {
-			// 添加单个节点
-			if item.Node != nil && !nodeMap[item.Node.Name] {
-				result = append(result, *item.Node)
-				nodeMap[item.Node.Name] = true
-			}
-		}
+	// 处理子订阅（带排序）
+	for i := range req.Includes {
+		sources = append(sources, models.SubcriptionSource{Include: &req.Includes[i], Sort: req.Includes[i].Sort})
 	}
 
-	return result
+	return sub.LoadSourceNodes(sources, "preview")
 }
@@ -22,6 +22,7 @@ type ConvertRulesRequest struct {
 	UseProxy         bool   `json:"useProxy"`         // 是否使用代理
 	ProxyLink        string `json:"proxyLink"`        // 代理节点链接（可选）
 	EnableIncludeAll bool   `json:"enableIncludeAll"` // 是否启用 include-all 模式
+	LocalRuleSet     bool   `json:"localRuleSet"`     // 是否通过本地缓存提供规则集（不展开时生效）
 }
 
 // ConvertRulesResponse 规则转换响应
@@ -86,14 +87,20 @@ func ConvertRules(c *gin.Context) {
 	// 解析 ACL 配置
 	rulesets, proxyGroups := parseACLConfig(aclContent)
 
+	// 使用本地规则集时，规则集地址指向本服务
+	localBaseURL := ""
+	if req.LocalRuleSet && !req.Expand {
+		localBaseURL = ruleSetBaseURL(c)
+	}
+
 	// 根据类型生成配置
 	var proxyGroupsStr, rulesStr string
 	if req.Category == "surge" {
 		proxyGroupsStr = generateSurgeProxyGroups(proxyGroups, req.EnableIncludeAll)
-		rulesStr, err = generateSurgeRules(rulesets, req.Expand, req.UseProxy, req.ProxyLink)
+		rulesStr, err = generateSurgeRules(rulesets, req.Expand, req.UseProxy, req.ProxyLink, localBaseURL)
 	} else {
 		proxyGroupsStr = generateClashProxyGroups(proxyGroups, req.EnableIncludeAll)
-		rulesStr, err = generateClashRules(rulesets, req.Expand, req.UseProxy, req.ProxyLink)
+		rulesStr, err = generateClashRules(rulesets, req.Expand, req.UseProxy, req.ProxyLink, localBaseURL)
 	}
 
 	if err != nil {
@@ -325,7 +332,8 @@ func mergeRegexFilters(filters []string) string {
 }
 
 // generateClashRules 生成 Clash 格式的规则
-func generateClashRules(rulesets []ACLRuleset, expand bool, useProxy bool, proxyLink string) (string, error) {
+// localBaseURL 不为空时，rule-providers 的地址使用本地规则集
+func generateClashRules(rulesets []ACLRuleset, expand bool, useProxy bool, proxyLink string, localBaseURL string) (string, error) {
 	var rules []string
 	var providers []string // rule-providers
 	providerIndex := make(map[string]bool)
@@ -360,7 +368,8 @@ func generateClashRules(rulesets []ACLRuleset, expand bool, useProxy bool, proxy
 				// 添加 provider 定义（避免重复）
 				if !providerIndex[providerName] {
 					providerIndex[providerName] = true
-					providers = append(providers, generateProvider(providerName, rs.RuleURL, behavior, behavior))
+					providerURL := localRuleSetURL(localBaseURL, rs.RuleURL, useProxy, proxyLink)
+					providers = append(providers, generateProvider(providerName, providerURL, behavior, behavior))
 				}
 			}
 		}
@@ -419,6 +428,7 @@ func generateProvider(name, url, ruleType, behavior string) string {
 }
 
 // expandRulesParallel 并发展开规则
+// 远程规则列表通过本地规则集获取：缓存未过期时不再下载，远程不可用时使用缓存
 func expandRulesParallel(rulesets []ACLRuleset, useProxy bool, proxyLink string) []string {
 	type ruleResult struct {
 		index int
@@ -449,7 +459,7 @@ func expandRulesParallel(rulesets []ACLRuleset, useProxy bool, proxyLink string)
 				}
 			} else if strings.HasPrefix(ruleset.RuleURL, "http") {
 				// 获取远程规则
-				content, err := fetchRemoteContent(ruleset.RuleURL, useProxy, proxyLink)
+				content, err := models.ResolveRuleSetContent(ruleset.RuleURL, useProxy, proxyLink)
 				if err != nil {
 					utils.Error("获取规则失败 %s: %v", ruleset.RuleURL, err)
 					results <- ruleResult{idx, rules}
@@ -660,7 +670,8 @@ func extractSurgeRegexFilter(filters []string) string {
 }
 
 // generateSurgeRules 生成 Surge 格式的规则
-func generateSurgeRules(rulesets []ACLRuleset, expand bool, useProxy bool, proxyLink string) (string, error) {
+// localBaseURL 不为空时，RULE-SET 的地址使用本地规则集
+func generateSurgeRules(rulesets []ACLRuleset, expand bool, useProxy bool, proxyLink string, localBaseURL string) (string, error) {
 	var lines []string
 	lines = append(lines, "[Rule]")
 
@@ -688,7 +699,8 @@ func generateSurgeRules(rulesets []ACLRuleset, expand bool, useProxy bool, proxy
 					lines = append(lines, fmt.Sprintf("%s,%s", rule, rs.Group))
 				}
 			} else if strings.HasPrefix(rs.RuleURL, "http") {
-				lines = append(lines, fmt.Sprintf("RULE-SET,%s,%s,update-interval=86400", rs.RuleURL, rs.Group))
+				ruleURL := localRuleSetURL(localBaseURL, rs.RuleURL, useProxy, proxyLink)
+				lines = append(lines, fmt.Sprintf("RULE-SET,%s,%s,update-interval=86400", ruleURL, rs.Group))
 			}
 		}
 	}
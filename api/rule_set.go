@@ -0,0 +1,206 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sublink/models"
+	"sublink/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RuleSetList 获取本地规则集列表
+func RuleSetList(c *gin.Context) {
+	utils.OkWithData(c, models.ListRuleSets())
+}
+
+// RuleSetAdd 登记远程规则集并立即下载
+func RuleSetAdd(c *gin.Context) {
+	var req struct {
+		URL       string `json:"url"`
+		Name      string `json:"name"`
+		Behavior  string `json:"behavior"`
+		UseProxy  bool   `json:"useProxy"`
+		ProxyLink string `json:"proxyLink"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+	ruleSet, err := models.RegisterRuleSet(req.URL, req.Name, req.Behavior, req.UseProxy, req.ProxyLink)
+	if err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	if err := ruleSet.Refresh(); err != nil {
+		utils.FailWithMsg(c, "规则集已登记，但下载失败: "+err.Error())
+		return
+	}
+	utils.OkDetailed(c, "添加成功", ruleSet)
+}
+
+// RuleSetUpdate 更新规则集名称、刷新间隔和代理设置
+func RuleSetUpdate(c *gin.Context) {
+	var req models.RuleSet
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+	ruleSet, err := models.GetRuleSetByID(req.ID)
+	if err != nil {
+		utils.FailWithMsg(c, "规则集不存在")
+		return
+	}
+	if strings.TrimSpace(req.Name) != "" {
+		ruleSet.Name = strings.TrimSpace(req.Name)
+	}
+	if req.Behavior != "" {
+		ruleSet.Behavior = req.Behavior
+	}
+	ruleSet.RefreshInterval = req.RefreshInterval
+	ruleSet.UseProxy = req.UseProxy
+	ruleSet.ProxyLink = req.ProxyLink
+	if err := ruleSet.UpdateSettings(); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkWithMsg(c, "更新成功")
+}
+
+// RuleSetRefresh 立即刷新规则集，未指定 id 时刷新全部规则集
+func RuleSetRefresh(c *gin.Context) {
+	idStr := c.Query("id")
+	if idStr == "" {
+		refreshed, failed := 0, 0
+		for _, item := range models.ListRuleSets() {
+			r := item
+			if err := r.Refresh(); err != nil {
+				utils.Warn("刷新规则集【%s】失败: %v", r.Name, err)
+				failed++
+				continue
+			}
+			refreshed++
+		}
+		utils.OkWithData(c, gin.H{"refreshed": refreshed, "failed": failed})
+		return
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.FailWithMsg(c, "规则集ID格式错误")
+		return
+	}
+	ruleSet, err := models.GetRuleSetByID(id)
+	if err != nil {
+		utils.FailWithMsg(c, "规则集不存在")
+		return
+	}
+	if err := ruleSet.Refresh(); err != nil {
+		utils.FailWithMsg(c, "刷新失败（已保留原有缓存）: "+err.Error())
+		return
+	}
+	utils.OkWithData(c, ruleSet)
+}
+
+// RuleSetDel 删除规则集及其缓存文件
+func RuleSetDel(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		utils.FailWithMsg(c, "规则集ID格式错误")
+		return
+	}
+	ruleSet, err := models.GetRuleSetByID(id)
+	if err != nil {
+		utils.FailWithMsg(c, "规则集不存在")
+		return
+	}
+	if err := ruleSet.Del(); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkWithMsg(c, "删除成功")
+}
+
+// GetRuleSetContent 向客户端提供本地缓存的规则集（rule-provider / RULE-SET 地址）
+// 缓存过期时先返回现有缓存并在后台刷新；从未下载成功时同步下载
+func GetRuleSetContent(c *gin.Context) {
+	key := strings.TrimSuffix(c.Param("key"), ".list")
+	ruleSet, err := models.GetRuleSetByKey(key)
+	if err != nil {
+		c.String(http.StatusNotFound, "规则集不存在")
+		return
+	}
+
+	content, err := ruleSet.ReadContent()
+	if err != nil {
+		// 刚下载失败时不重复下载，避免公开地址被反复请求时持续访问远程
+		if ruleSet.InRetryBackoff() {
+			c.String(http.StatusBadGateway, "规则集下载失败，稍后重试: "+ruleSet.FetchError)
+			return
+		}
+		if refreshErr := ruleSet.Refresh(); refreshErr != nil {
+			c.String(http.StatusBadGateway, "规则集下载失败: "+refreshErr.Error())
+			return
+		}
+		if content, err = ruleSet.ReadContent(); err != nil {
+			c.String(http.StatusInternalServerError, "读取规则集失败")
+			return
+		}
+	} else if ruleSet.IsStale() && !ruleSet.InRetryBackoff() {
+		go func(r models.RuleSet) {
+			if _, err := r.RefreshIfStale(); err != nil {
+				utils.Warn("后台刷新规则集【%s】失败: %v", r.Name, err)
+			}
+		}(*ruleSet)
+	}
+
+	etag := `"` + ruleSet.Checksum + `"`
+	if ruleSet.Checksum != "" {
+		c.Header("ETag", etag)
+		if c.GetHeader("If-None-Match") == etag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(content))
+}
+
+// ruleSetBaseURL 计算客户端访问本地规则集使用的地址前缀
+// 优先使用系统设置的 system_domain，否则使用当前请求的地址
+func ruleSetBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	baseURL := scheme + "://" + c.Request.Host
+	if domain, _ := models.GetSetting("system_domain"); domain != "" {
+		if !strings.HasPrefix(domain, "http") {
+			baseURL = "https://" + domain
+		} else {
+			baseURL = domain
+		}
+	}
+	return strings.TrimRight(baseURL, "/") + "/c/rules/"
+}
+
+// localRuleSetURL 登记远程规则集，返回本地访问地址；登记失败时返回原地址
+// 缓存在后台预先下载，客户端首次请求时未下载完成会同步下载
+func localRuleSetURL(baseURL, url string, useProxy bool, proxyLink string) string {
+	if baseURL == "" {
+		return url
+	}
+	name, behavior := parseProviderInfo(url)
+	ruleSet, err := models.RegisterRuleSet(url, name, behavior, useProxy, proxyLink)
+	if err != nil {
+		utils.Warn("登记规则集失败 %s: %v", url, err)
+		return url
+	}
+	if ruleSet.IsStale() {
+		go func(r models.RuleSet) {
+			if err := r.Refresh(); err != nil {
+				utils.Warn("下载规则集【%s】失败: %v", r.Name, err)
+			}
+		}(*ruleSet)
+	}
+	return baseURL + ruleSet.Key + ".list"
+}
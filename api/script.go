@@ -1,6 +1,7 @@
 package api
 
 import (
+	"fmt"
 	"strconv"
 	"sublink/models"
 	"sublink/utils"
@@ -64,7 +65,25 @@ func ScriptUpdate(c *gin.Context) {
 		utils.FailWithMsg(c, err.Error())
 		return
 	}
-	utils.OkDetailed(c, "更新成功", data)
+	// 脚本已修改，清除之前的执行失败记录
+	if err := models.ClearScriptFailure(data.ID); err != nil {
+		utils.Warn("清除脚本失败记录失败 ID: %d: %v", data.ID, err)
+	}
+	// 执行测试用例，结果随响应返回
+	msg := "更新成功"
+	if script, err := models.GetScriptByID(data.ID); err == nil {
+		data.FixtureResults = models.RunScriptFixtures(script)
+		failed := 0
+		for _, r := range data.FixtureResults {
+			if !r.Passed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			msg = fmt.Sprintf("更新成功，%d 个测试用例未通过", failed)
+		}
+	}
+	utils.OkDetailed(c, msg, data)
 }
 
 // ScriptList 获取脚本列表
@@ -114,3 +133,24 @@ func ScriptList(c *gin.Context) {
 	}
 	utils.OkDetailed(c, "获取成功", list)
 }
+
+// ScriptLogs 获取脚本最近的 console 输出
+func ScriptLogs(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		utils.FailWithMsg(c, "脚本ID格式错误")
+		return
+	}
+	utils.OkWithData(c, utils.GetScriptLogs(id))
+}
+
+// ScriptLogsClear 清空脚本的 console 输出
+func ScriptLogsClear(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		utils.FailWithMsg(c, "脚本ID格式错误")
+		return
+	}
+	utils.ClearScriptLogs(id)
+	utils.OkWithMsg(c, "清空成功")
+}
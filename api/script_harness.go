@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sublink/models"
+	"sublink/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScriptTestRequest 脚本试运行请求
+type ScriptTestRequest struct {
+	ScriptID       int    `json:"scriptId"`       // 已保存的脚本ID
+	Content        string `json:"content"`        // 脚本内容，不为空时使用该内容（可测试未保存的修改）
+	Entry          string `json:"entry"`          // subMod / filterNode
+	ClientType     string `json:"clientType"`     // v2ray / clash / surge，默认 clash
+	SubscriptionID int    `json:"subscriptionId"` // 使用该订阅当前的节点作为输入
+	Input          string `json:"input"`          // 手动输入，filterNode 为节点 JSON 数组
+}
+
+// ScriptTest 试运行脚本，返回输出、差异、console 输出、执行耗时和错误
+// 试运行不记录脚本失败信息，kv 写入不会保存
+func ScriptTest(c *gin.Context) {
+	var req ScriptTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+	if req.Entry == "" {
+		req.Entry = models.ScriptEntrySubMod
+	}
+	if !models.IsValidScriptEntry(req.Entry) {
+		utils.FailWithMsg(c, "不支持的脚本入口: "+req.Entry)
+		return
+	}
+	if req.ClientType == "" {
+		req.ClientType = "clash"
+	}
+
+	content := req.Content
+	scriptName := ""
+	if req.ScriptID > 0 {
+		script, err := models.GetScriptByID(req.ScriptID)
+		if err != nil {
+			utils.FailWithMsg(c, "脚本不存在")
+			return
+		}
+		scriptName = script.Name
+		if content == "" {
+			content = script.Content
+		}
+	}
+	if strings.TrimSpace(content) == "" {
+		utils.FailWithMsg(c, "脚本内容不能为空")
+		return
+	}
+
+	input := req.Input
+	if req.SubscriptionID > 0 {
+		var err error
+		input, err = buildScriptTestInput(req.SubscriptionID, req.Entry, req.ClientType)
+		if err != nil {
+			utils.FailWithMsg(c, "获取订阅输入失败: "+err.Error())
+			return
+		}
+	}
+
+	result := models.RunScriptTest(content, req.ScriptID, scriptName, req.Entry, req.ClientType, input)
+	utils.OkWithData(c, gin.H{
+		"input":  input,
+		"result": result,
+	})
+}
+
+// buildScriptTestInput 根据订阅当前的节点生成脚本输入（订阅自身的脚本不会执行）
+// filterNode 为过滤后的节点 JSON 数组；subMod 为对应客户端执行订阅脚本前的订阅内容，与实际输出的渲染过程一致
+func buildScriptTestInput(subID int, entry string, clientType string) (string, error) {
+	sub, err := models.GetSubcriptionByID(subID)
+	if err != nil {
+		return "", fmt.Errorf("订阅不存在")
+	}
+	if err := sub.LoadFilteredNodes(); err != nil {
+		return "", err
+	}
+
+	if entry == models.ScriptEntryFilterNode {
+		data, err := json.Marshal(sub.Nodes)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	switch clientType {
+	case "v2ray":
+		return encodeV2rayContent(sub)
+	case "surge":
+		ctx := newTemplateContext(sub, clientType)
+		ctx.Usage = subscriptionUsage(sub.Nodes)
+		return encodeSurgeContent(sub, ctx)
+	default:
+		ctx := newTemplateContext(sub, clientType)
+		ctx.Usage = subscriptionUsage(sub.Nodes)
+		return encodeClashContent(sub, ctx)
+	}
+}
+
+// ScriptFixtureList 获取脚本的测试用例
+func ScriptFixtureList(c *gin.Context) {
+	scriptID, err := strconv.Atoi(c.Query("scriptId"))
+	if err != nil {
+		utils.FailWithMsg(c, "脚本ID格式错误")
+		return
+	}
+	fixtures, err := models.ListScriptFixtures(scriptID)
+	if err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkWithData(c, fixtures)
+}
+
+// ScriptFixtureAdd 添加测试用例
+func ScriptFixtureAdd(c *gin.Context) {
+	var data models.ScriptFixture
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+	if err := validateScriptFixture(&data); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	if _, err := models.GetScriptByID(data.ScriptID); err != nil {
+		utils.FailWithMsg(c, "脚本不存在")
+		return
+	}
+	if err := data.Add(); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkDetailed(c, "添加成功", data)
+}
+
+// ScriptFixtureUpdate 更新测试用例
+func ScriptFixtureUpdate(c *gin.Context) {
+	var data models.ScriptFixture
+	if err := c.ShouldBindJSON(&data); err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+	if _, err := models.GetScriptFixtureByID(data.ID); err != nil {
+		utils.FailWithMsg(c, "测试用例不存在")
+		return
+	}
+	if err := validateScriptFixture(&data); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	if err := data.Update(); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkWithMsg(c, "更新成功")
+}
+
+// ScriptFixtureDel 删除测试用例
+func ScriptFixtureDel(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		utils.FailWithMsg(c, "测试用例ID格式错误")
+		return
+	}
+	fixture := models.ScriptFixture{ID: id}
+	if err := fixture.Del(); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkWithMsg(c, "删除成功")
+}
+
+// ScriptFixtureRun 执行脚本的全部测试用例
+func ScriptFixtureRun(c *gin.Context) {
+	scriptID, err := strconv.Atoi(c.Query("scriptId"))
+	if err != nil {
+		utils.FailWithMsg(c, "脚本ID格式错误")
+		return
+	}
+	script, err := models.GetScriptByID(scriptID)
+	if err != nil {
+		utils.FailWithMsg(c, "脚本不存在")
+		return
+	}
+	utils.OkWithData(c, models.RunScriptFixtures(script))
+}
+
+// validateScriptFixture 校验测试用例参数
+func validateScriptFixture(data *models.ScriptFixture) error {
+	if strings.TrimSpace(data.Name) == "" {
+		return fmt.Errorf("名称不能为空")
+	}
+	if data.Entry == "" {
+		data.Entry = models.ScriptEntrySubMod
+	}
+	if !models.IsValidScriptEntry(data.Entry) {
+		return fmt.Errorf("不支持的脚本入口: %s", data.Entry)
+	}
+	if data.Entry == models.ScriptEntryFilterNode {
+		var nodes []models.Node
+		if err := json.Unmarshal([]byte(data.Input), &nodes); err != nil {
+			return fmt.Errorf("filterNode 的输入必须是节点 JSON 数组")
+		}
+	}
+	return nil
+}
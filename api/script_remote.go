@@ -0,0 +1,136 @@
+package api
+
+import (
+	"strconv"
+	"sublink/models"
+	"sublink/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScriptImport 从远程地址导入脚本
+func ScriptImport(c *gin.Context) {
+	var req struct {
+		URL      string `json:"url"`
+		Name     string `json:"name"`
+		Checksum string `json:"checksum"`
+		Pinned   bool   `json:"pinned"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.URL == "" {
+		utils.FailWithMsg(c, "远程地址不能为空")
+		return
+	}
+	script, err := models.ImportRemoteScript(req.URL, req.Name, req.Checksum, req.Pinned)
+	if err != nil {
+		utils.FailWithMsg(c, "导入失败: "+err.Error())
+		return
+	}
+	utils.OkDetailed(c, "导入成功", script)
+}
+
+// ScriptCheckUpdate 检查远程脚本更新，不传 id 时检查所有远程脚本
+func ScriptCheckUpdate(c *gin.Context) {
+	idStr := c.Query("id")
+	if idStr == "" {
+		utils.OkWithData(c, models.CheckAllScriptUpdates())
+		return
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.FailWithMsg(c, "脚本ID格式错误")
+		return
+	}
+	script, err := models.GetScriptByID(id)
+	if err != nil {
+		utils.FailWithMsg(c, "脚本不存在")
+		return
+	}
+	if err := script.CheckRemoteUpdate(); err != nil {
+		utils.FailWithMsg(c, "检查更新失败: "+err.Error())
+		return
+	}
+	utils.OkWithData(c, script)
+}
+
+// ScriptUpgrade 升级远程脚本到最新内容
+func ScriptUpgrade(c *gin.Context) {
+	var req struct {
+		ID       int    `json:"id"`
+		Checksum string `json:"checksum"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+	script, err := models.GetScriptByID(req.ID)
+	if err != nil {
+		utils.FailWithMsg(c, "脚本不存在")
+		return
+	}
+	if err := models.UpgradeRemoteScript(script, req.Checksum); err != nil {
+		utils.FailWithMsg(c, "升级失败: "+err.Error())
+		return
+	}
+	script.FixtureResults = models.RunScriptFixtures(script)
+	utils.OkDetailed(c, "升级成功", script)
+}
+
+// ScriptPin 固定或取消固定脚本版本
+func ScriptPin(c *gin.Context) {
+	var req struct {
+		ID     int  `json:"id"`
+		Pinned bool `json:"pinned"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+	script, err := models.GetScriptByID(req.ID)
+	if err != nil {
+		utils.FailWithMsg(c, "脚本不存在")
+		return
+	}
+	if err := models.SetScriptPinned(script, req.Pinned); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkDetailed(c, "保存成功", script)
+}
+
+// ScriptVersions 获取脚本历史版本
+func ScriptVersions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Query("id"))
+	if err != nil {
+		utils.FailWithMsg(c, "脚本ID格式错误")
+		return
+	}
+	versions, err := models.ListScriptVersions(id)
+	if err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkWithData(c, versions)
+}
+
+// ScriptRollback 回滚脚本到历史版本
+func ScriptRollback(c *gin.Context) {
+	var req struct {
+		ID        int `json:"id"`
+		VersionID int `json:"versionId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+	script, err := models.GetScriptByID(req.ID)
+	if err != nil {
+		utils.FailWithMsg(c, "脚本不存在")
+		return
+	}
+	if err := models.RollbackScript(script, req.VersionID); err != nil {
+		utils.FailWithMsg(c, "回滚失败: "+err.Error())
+		return
+	}
+	script.FixtureResults = models.RunScriptFixtures(script)
+	utils.OkDetailed(c, "回滚成功", script)
+}
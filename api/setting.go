@@ -191,3 +191,36 @@ func UpdateSystemDomain(c *gin.Context) {
 	}
 	utils.OkWithMsg(c, "保存成功")
 }
+
+// GetScriptRuntimeConfig 获取脚本运行时配置
+func GetScriptRuntimeConfig(c *gin.Context) {
+	utils.OkWithData(c, gin.H{
+		"fetchAllowlist": models.GetScriptFetchAllowList(),
+		"limits":         models.NewScriptLimitsConfig(utils.GetScriptLimits()),
+		"defaultLimits":  models.NewScriptLimitsConfig(utils.DefaultScriptLimits),
+	})
+}
+
+// UpdateScriptRuntimeConfig 更新脚本运行时配置（fetch 允许访问的域名列表、执行限制）
+// limits 未提供时保持当前执行限制不变
+func UpdateScriptRuntimeConfig(c *gin.Context) {
+	var req struct {
+		FetchAllowlist []string                   `json:"fetchAllowlist"`
+		Limits         *models.ScriptLimitsConfig `json:"limits"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+	if err := models.SetScriptFetchAllowList(req.FetchAllowlist); err != nil {
+		utils.FailWithMsg(c, "保存失败: "+err.Error())
+		return
+	}
+	if req.Limits != nil {
+		if err := models.SetScriptLimits(*req.Limits); err != nil {
+			utils.FailWithMsg(c, "保存失败: "+err.Error())
+			return
+		}
+	}
+	utils.OkWithMsg(c, "保存成功")
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"sublink/models"
@@ -22,18 +23,22 @@ type ShareCreateReq struct {
 	Token          string `json:"token"` // 可选，为空则自动生成
 	ExpireType     int    `json:"expire_type"`
 	ExpireDays     int    `json:"expire_days"`
-	ExpireAt       string `json:"expire_at"` // ISO格式日期时间字符串
+	ExpireAt       string `json:"expire_at"`       // ISO格式日期时间字符串
+	AccessSchedule string `json:"access_schedule"` // 可用时段（JSON），为空表示不限制
+	SnapshotID     int    `json:"snapshot_id"`     // 固定的快照：0 实时渲染，-1 最新发布的快照，其他为快照ID
 }
 
 // ShareUpdateReq 更新分享请求
 type ShareUpdateReq struct {
-	ID         int    `json:"id" binding:"required"`
-	Name       string `json:"name"`
-	Token      string `json:"token"`
-	ExpireType int    `json:"expire_type"`
-	ExpireDays int    `json:"expire_days"`
-	ExpireAt   string `json:"expire_at"`
-	Enabled    bool   `json:"enabled"`
+	ID             int    `json:"id" binding:"required"`
+	Name           string `json:"name"`
+	Token          string `json:"token"`
+	ExpireType     int    `json:"expire_type"`
+	ExpireDays     int    `json:"expire_days"`
+	ExpireAt       string `json:"expire_at"`
+	Enabled        bool   `json:"enabled"`
+	AccessSchedule string `json:"access_schedule"`
+	SnapshotID     int    `json:"snapshot_id"`
 }
 
 // ShareGet 获取订阅的所有分享列表
@@ -74,6 +79,17 @@ func ShareAdd(c *gin.Context) {
 		expireAt = parsed
 	}
 
+	if req.AccessSchedule != "" {
+		if _, err := models.ParseTimeSchedule(req.AccessSchedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "可用时段格式错误: " + err.Error()})
+			return
+		}
+	}
+	if err := validateShareSnapshot(req.SubscriptionID, req.SnapshotID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+
 	share := &models.SubscriptionShare{
 		SubscriptionID: req.SubscriptionID,
 		Name:           req.Name,
@@ -82,6 +98,8 @@ func ShareAdd(c *gin.Context) {
 		ExpireDays:     req.ExpireDays,
 		ExpireAt:       expireAt,
 		Enabled:        true,
+		AccessSchedule: req.AccessSchedule,
+		SnapshotID:     req.SnapshotID,
 	}
 
 	if err := share.Add(); err != nil {
@@ -125,6 +143,17 @@ func ShareUpdate(c *gin.Context) {
 		expireAt = parsed
 	}
 
+	if req.AccessSchedule != "" {
+		if _, err := models.ParseTimeSchedule(req.AccessSchedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "可用时段格式错误: " + err.Error()})
+			return
+		}
+	}
+	if err := validateShareSnapshot(share.SubscriptionID, req.SnapshotID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+
 	// 更新字段
 	share.Name = req.Name
 	share.Token = req.Token
@@ -132,6 +161,8 @@ func ShareUpdate(c *gin.Context) {
 	share.ExpireDays = req.ExpireDays
 	share.ExpireAt = expireAt
 	share.Enabled = req.Enabled
+	share.AccessSchedule = req.AccessSchedule
+	share.SnapshotID = req.SnapshotID
 
 	if err := share.Update(); err != nil {
 		utils.Error("更新分享失败: %v", err)
@@ -216,3 +247,17 @@ func ShareLogs(c *gin.Context) {
 	logs := models.GetSubLogsByShareID(shareId)
 	c.JSON(http.StatusOK, gin.H{"code": 200, "data": logs})
 }
+
+// validateShareSnapshot 校验分享固定的快照属于该订阅
+func validateShareSnapshot(subID, snapshotID int) error {
+	switch {
+	case snapshotID == models.ShareSnapshotLive || snapshotID == models.ShareSnapshotLatest:
+		return nil
+	case snapshotID < 0:
+		return errors.New("固定的快照无效")
+	}
+	if _, err := models.GetSubscriptionSnapshot(subID, snapshotID); err != nil {
+		return err
+	}
+	return nil
+}
@@ -96,13 +96,61 @@ func SubAdd(c *gin.Context) {
 	protocolWhitelist := c.PostForm("ProtocolWhitelist")
 	protocolBlacklist := c.PostForm("ProtocolBlacklist")
 	deduplicationRule := c.PostForm("DeduplicationRule")
+	selectionRule := c.PostForm("SelectionRule")
+	nodeQuery := c.PostForm("NodeQuery")
+	orderRule := c.PostForm("OrderRule")
+	autoGroupRule := c.PostForm("AutoGroupRule")
+	timeRule := c.PostForm("TimeRule")
+	snapshotRule := c.PostForm("SnapshotRule")
+	healthGate := c.PostForm("HealthGate")
+	includes, includesErr := models.ParseSubcriptionIncludes(c.PostForm("includes"))
 	refreshUsageOnRequestStr := c.PostForm("RefreshUsageOnRequest")
 	refreshUsageOnRequest := refreshUsageOnRequestStr != "false" // 默认为 true
 
-	if name == "" || (nodeIds == "" && groups == "") {
-		utils.FailWithMsg(c, "订阅名称不能为空，且节点或分组至少选择一项")
+	if includesErr != nil {
+		utils.FailWithMsg(c, "子订阅格式错误: "+includesErr.Error())
 		return
 	}
+	if name == "" || (nodeIds == "" && groups == "" && nodeQuery == "" && len(includes) == 0) {
+		utils.FailWithMsg(c, "订阅名称不能为空，且节点、分组、动态条件或子订阅至少选择一项")
+		return
+	}
+	if nodeQuery != "" {
+		if _, err := models.ParseNodeQuery(nodeQuery); err != nil {
+			utils.FailWithMsg(c, "动态节点条件格式错误: "+err.Error())
+			return
+		}
+	}
+	if orderRule != "" {
+		if _, err := models.ParseOrderRule(orderRule); err != nil {
+			utils.FailWithMsg(c, "输出排序规则格式错误: "+err.Error())
+			return
+		}
+	}
+	if autoGroupRule != "" {
+		if _, err := models.ParseAutoGroupRule(autoGroupRule); err != nil {
+			utils.FailWithMsg(c, "自动代理组规则格式错误: "+err.Error())
+			return
+		}
+	}
+	if timeRule != "" {
+		if _, err := models.ParseTimeRule(timeRule); err != nil {
+			utils.FailWithMsg(c, "时间窗口规则格式错误: "+err.Error())
+			return
+		}
+	}
+	if snapshotRule != "" {
+		if _, err := models.ParseSnapshotRule(snapshotRule); err != nil {
+			utils.FailWithMsg(c, "快照发布规则格式错误: "+err.Error())
+			return
+		}
+	}
+	if healthGate != "" {
+		if _, err := models.ParseHealthGate(healthGate); err != nil {
+			utils.FailWithMsg(c, "健康门槛格式错误: "+err.Error())
+			return
+		}
+	}
 	if ipWhitelist != "" {
 		ok := utils.IpFormatValidation(ipWhitelist)
 		if !ok {
@@ -125,6 +173,10 @@ func SubAdd(c *gin.Context) {
 		utils.FailWithMsg(c, "订阅名称不能重复")
 		return
 	}
+	if err := models.CheckSubcriptionIncludes(0, includes); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
 
 	sub.Nodes = []models.Node{}
 	if nodeIds != "" {
@@ -169,6 +221,13 @@ func SubAdd(c *gin.Context) {
 	sub.ProtocolWhitelist = protocolWhitelist
 	sub.ProtocolBlacklist = protocolBlacklist
 	sub.DeduplicationRule = deduplicationRule
+	sub.SelectionRule = selectionRule
+	sub.NodeQuery = nodeQuery
+	sub.OrderRule = orderRule
+	sub.AutoGroupRule = autoGroupRule
+	sub.TimeRule = timeRule
+	sub.SnapshotRule = snapshotRule
+	sub.HealthGate = healthGate
 	sub.RefreshUsageOnRequest = refreshUsageOnRequest
 	sub.CreateDate = time.Now().Format("2006-01-02 15:04:05")
 
@@ -196,6 +255,14 @@ func SubAdd(c *gin.Context) {
 		}
 	}
 
+	// 添加子订阅关系
+	if len(includes) > 0 {
+		if err := sub.UpdateIncludes(includes); err != nil {
+			utils.FailWithMsg(c, err.Error())
+			return
+		}
+	}
+
 	// 添加脚本关系
 	if scripts != "" {
 		scriptIDs := make([]int, 0)
@@ -251,10 +318,79 @@ func SubUpdate(c *gin.Context) {
 	refreshUsageOnRequestStr := c.PostForm("RefreshUsageOnRequest")
 	refreshUsageOnRequest := refreshUsageOnRequestStr != "false" // 默认为 true
 
-	if name == "" || (nodeIds == "" && groups == "") {
-		utils.FailWithMsg(c, "订阅名称不能为空，且节点或分组至少选择一项")
+	if name == "" {
+		utils.FailWithMsg(c, "订阅名称不能为空")
+		return
+	}
+
+	// 查找旧节点
+	sub.Name = oldname
+	if err := sub.Find(); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+
+	// 较新的规则字段和子订阅未提交时保留原值，避免旧版本客户端保存时清空
+	selectionRule := postFormOr(c, "SelectionRule", sub.SelectionRule)
+	nodeQuery := postFormOr(c, "NodeQuery", sub.NodeQuery)
+	orderRule := postFormOr(c, "OrderRule", sub.OrderRule)
+	autoGroupRule := postFormOr(c, "AutoGroupRule", sub.AutoGroupRule)
+	timeRule := postFormOr(c, "TimeRule", sub.TimeRule)
+	snapshotRule := postFormOr(c, "SnapshotRule", sub.SnapshotRule)
+	healthGate := postFormOr(c, "HealthGate", sub.HealthGate)
+	var includes []models.SubcriptionInclude
+	var includesErr error
+	if rawIncludes, ok := c.GetPostForm("includes"); ok {
+		includes, includesErr = models.ParseSubcriptionIncludes(rawIncludes)
+		if includesErr != nil {
+			utils.FailWithMsg(c, "子订阅格式错误: "+includesErr.Error())
+			return
+		}
+	} else if includes, includesErr = models.GetSubcriptionIncludes(sub.ID); includesErr != nil {
+		utils.FailWithMsg(c, includesErr.Error())
 		return
 	}
+
+	if nodeIds == "" && groups == "" && nodeQuery == "" && len(includes) == 0 {
+		utils.FailWithMsg(c, "节点、分组、动态条件或子订阅至少选择一项")
+		return
+	}
+	if nodeQuery != "" {
+		if _, err := models.ParseNodeQuery(nodeQuery); err != nil {
+			utils.FailWithMsg(c, "动态节点条件格式错误: "+err.Error())
+			return
+		}
+	}
+	if orderRule != "" {
+		if _, err := models.ParseOrderRule(orderRule); err != nil {
+			utils.FailWithMsg(c, "输出排序规则格式错误: "+err.Error())
+			return
+		}
+	}
+	if autoGroupRule != "" {
+		if _, err := models.ParseAutoGroupRule(autoGroupRule); err != nil {
+			utils.FailWithMsg(c, "自动代理组规则格式错误: "+err.Error())
+			return
+		}
+	}
+	if timeRule != "" {
+		if _, err := models.ParseTimeRule(timeRule); err != nil {
+			utils.FailWithMsg(c, "时间窗口规则格式错误: "+err.Error())
+			return
+		}
+	}
+	if snapshotRule != "" {
+		if _, err := models.ParseSnapshotRule(snapshotRule); err != nil {
+			utils.FailWithMsg(c, "快照发布规则格式错误: "+err.Error())
+			return
+		}
+	}
+	if healthGate != "" {
+		if _, err := models.ParseHealthGate(healthGate); err != nil {
+			utils.FailWithMsg(c, "健康门槛格式错误: "+err.Error())
+			return
+		}
+	}
 	if ipWhitelist != "" {
 		ok := utils.IpFormatValidation(ipWhitelist)
 		if !ok {
@@ -280,10 +416,7 @@ func SubUpdate(c *gin.Context) {
 		}
 	}
 
-	// 查找旧节点
-	sub.Name = oldname
-	err := sub.Find()
-	if err != nil {
+	if err := models.CheckSubcriptionIncludes(sub.ID, includes); err != nil {
 		utils.FailWithMsg(c, err.Error())
 		return
 	}
@@ -331,8 +464,15 @@ func SubUpdate(c *gin.Context) {
 	sub.ProtocolWhitelist = protocolWhitelist
 	sub.ProtocolBlacklist = protocolBlacklist
 	sub.DeduplicationRule = deduplicationRule
+	sub.SelectionRule = selectionRule
+	sub.NodeQuery = nodeQuery
+	sub.OrderRule = orderRule
+	sub.AutoGroupRule = autoGroupRule
+	sub.TimeRule = timeRule
+	sub.SnapshotRule = snapshotRule
+	sub.HealthGate = healthGate
 	sub.RefreshUsageOnRequest = refreshUsageOnRequest
-	err = sub.Update()
+	err := sub.Update()
 	if err != nil {
 		utils.FailWithMsg(c, "更新失败")
 		return
@@ -356,6 +496,12 @@ func SubUpdate(c *gin.Context) {
 		return
 	}
 
+	// 更新子订阅关系
+	if err := sub.UpdateIncludes(includes); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+
 	// 更新脚本关系
 	if scripts != "" {
 		scriptIDs := make([]int, 0)
@@ -377,6 +523,14 @@ func SubUpdate(c *gin.Context) {
 	utils.OkWithMsg(c, "更新成功")
 }
 
+// postFormOr 获取表单字段，请求未提交该字段时返回 current
+func postFormOr(c *gin.Context, key, current string) string {
+	if value, ok := c.GetPostForm(key); ok {
+		return value
+	}
+	return current
+}
+
 // 删除节点
 func SubDel(c *gin.Context) {
 	var sub models.Subcription
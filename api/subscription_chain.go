@@ -10,6 +10,7 @@ import (
 	"strings"
 	"sublink/cache"
 	"sublink/models"
+	"sublink/node/protocol"
 	"sublink/utils"
 
 	"github.com/gin-gonic/gin"
@@ -53,6 +54,12 @@ func CreateChainRule(c *gin.Context) {
 
 	rule.SubscriptionID = subID
 
+	// 校验规则，存在错误时拒绝保存
+	diagnostics, ok := validateChainRuleSave(c, rule)
+	if !ok {
+		return
+	}
+
 	// 设置默认排序值（最后一个）
 	existingRules := models.GetChainRulesBySubscriptionID(subID)
 	rule.Sort = len(existingRules)
@@ -62,7 +69,7 @@ func CreateChainRule(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": rule})
+	c.JSON(http.StatusOK, gin.H{"data": rule, "diagnostics": diagnostics})
 }
 
 // UpdateChainRule 更新链式代理规则
@@ -112,13 +119,19 @@ func UpdateChainRule(c *gin.Context) {
 	utils.Debug("[ChainRule] ChainConfig: %s", existingRule.ChainConfig)
 	utils.Debug("[ChainRule] TargetConfig: %s", existingRule.TargetConfig)
 
+	// 校验规则，存在错误时拒绝保存
+	diagnostics, ok := validateChainRuleSave(c, existingRule)
+	if !ok {
+		return
+	}
+
 	if err := existingRule.Update(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新规则失败: " + err.Error()})
 		return
 	}
 
 	utils.Debug("[ChainRule] 规则更新成功，返回数据: ID=%d", existingRule.ID)
-	c.JSON(http.StatusOK, gin.H{"data": existingRule})
+	c.JSON(http.StatusOK, gin.H{"data": existingRule, "diagnostics": diagnostics})
 }
 
 // DeleteChainRule 删除链式代理规则
@@ -215,7 +228,7 @@ func GetChainOptions(c *gin.Context) {
 	}
 
 	// 获取订阅关联的节点
-	if err := sub.GetSub("none"); err != nil {
+	if err := sub.LoadFilteredNodes(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订阅节点失败: " + err.Error()})
 		return
 	}
@@ -246,6 +259,8 @@ func GetChainOptions(c *gin.Context) {
 		{"value": "speed_status", "label": "测速状态"},
 		{"value": "delay_status", "label": "延迟状态"},
 		{"value": "tags", "label": "标签"},
+		{"value": "tag", "label": "标签（按名称匹配）"},
+		{"value": "source_id", "label": "来源机场ID"},
 		{"value": "link_address", "label": "地址"},
 		{"value": "link_host", "label": "主机名"},
 		{"value": "link_port", "label": "端口"},
@@ -273,7 +288,7 @@ func GetChainOptions(c *gin.Context) {
 	}
 
 	// 从订阅配置中读取模板代理组列表
-	templateGroups := parseTemplateProxyGroups(sub.Config)
+	templateGroups := parseTemplateProxyGroups(&sub)
 
 	c.JSON(http.StatusOK, gin.H{
 		"data": gin.H{
@@ -318,78 +333,142 @@ func ToggleChainRule(c *gin.Context) {
 	// 切换状态
 	existingRule.Enabled = !existingRule.Enabled
 
+	// 启用规则前校验，禁用规则不校验
+	diagnostics := []models.ChainDiagnostic{}
+	if existingRule.Enabled {
+		var ok bool
+		if diagnostics, ok = validateChainRuleSave(c, existingRule); !ok {
+			return
+		}
+	}
+
 	if err := existingRule.Update(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新规则失败: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": existingRule})
+	c.JSON(http.StatusOK, gin.H{"data": existingRule, "diagnostics": diagnostics})
+}
+
+// ValidateChainRules 校验订阅的全部链式代理规则，返回结构化诊断信息
+func ValidateChainRules(c *gin.Context) {
+	subIDStr := c.Param("id")
+	subID, err := strconv.Atoi(subIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订阅ID"})
+		return
+	}
+
+	var sub models.Subcription
+	sub.ID = subID
+	if err := sub.Find(); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订阅不存在"})
+		return
+	}
+	if err := sub.LoadFilteredNodes(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订阅节点失败: " + err.Error()})
+		return
+	}
+
+	diagnostics := models.ValidateChainRules(&sub, models.GetChainRulesBySubscriptionID(subID), chainTemplateGroups(&sub))
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"valid":       !models.HasChainErrors(diagnostics),
+			"diagnostics": diagnostics,
+		},
+	})
+}
+
+// validateChainRuleSave 在规则所属订阅的上下文中校验待保存的规则
+// 存在错误级别的诊断时直接返回 400 响应，ok 为 false
+func validateChainRuleSave(c *gin.Context, rule models.SubscriptionChainRule) ([]models.ChainDiagnostic, bool) {
+	var sub models.Subcription
+	sub.ID = rule.SubscriptionID
+	if err := sub.Find(); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订阅不存在"})
+		return nil, false
+	}
+	if err := sub.LoadFilteredNodes(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订阅节点失败: " + err.Error()})
+		return nil, false
+	}
+
+	diagnostics := models.ValidateChainRuleSave(&sub, rule, chainTemplateGroups(&sub))
+	if models.HasChainErrors(diagnostics) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "规则校验失败", "diagnostics": diagnostics})
+		return nil, false
+	}
+	return diagnostics, true
+}
+
+// chainTemplateGroups 获取 Clash 和 Surge 模板中的代理组名称，未配置模板的客户端为 nil
+func chainTemplateGroups(sub *models.Subcription) map[string][]string {
+	return map[string][]string{
+		models.ChainClientClash: templateProxyGroupsFor(sub, models.ChainClientClash),
+		models.ChainClientSurge: templateProxyGroupsFor(sub, models.ChainClientSurge),
+	}
 }
 
 // parseTemplateProxyGroups 从订阅配置中解析模板代理组列表
-// configStr: 订阅的 Config 字段（JSON 格式）
 // 返回: 代理组名称列表
-func parseTemplateProxyGroups(configStr string) []string {
-	if configStr == "" {
+func parseTemplateProxyGroups(sub *models.Subcription) []string {
+	groupNames := templateProxyGroupsFor(sub, models.ChainClientClash)
+	if groupNames == nil {
 		return []string{}
 	}
+	return groupNames
+}
+
+// templateProxyGroupsFor 解析订阅配置中指定客户端模板的代理组名称
+// 模板包含变量时按订阅当前节点渲染（不含请求参数），未配置模板或读取失败时返回 nil
+func templateProxyGroupsFor(sub *models.Subcription, client string) []string {
+	if sub.Config == "" {
+		return nil
+	}
 
 	// 解析订阅配置 JSON
 	var config struct {
 		Clash string `json:"clash"`
 		Surge string `json:"surge"`
 	}
-	if err := json.Unmarshal([]byte(configStr), &config); err != nil {
-		return []string{}
+	if err := json.Unmarshal([]byte(sub.Config), &config); err != nil {
+		return nil
 	}
 
-	// 获取 Clash 模板路径
-	clashTemplate := config.Clash
-	if clashTemplate == "" {
-		return []string{}
+	templatePath := config.Clash
+	if client == models.ChainClientSurge {
+		templatePath = config.Surge
+	}
+	templateContent, ok := readTemplateContent(templatePath)
+	if !ok {
+		return nil
+	}
+	if rendered, err := protocol.RenderTemplate(templateContent, newTemplateContext(sub, client)); err == nil {
+		templateContent = rendered
 	}
 
-	// 读取模板内容
-	var templateContent string
-	if strings.Contains(clashTemplate, "://") {
-		// 远程模板，通过 HTTP 获取
-		resp, err := http.Get(clashTemplate)
-		if err != nil {
-			return []string{}
-		}
-		defer resp.Body.Close()
-		data, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return []string{}
-		}
-		templateContent = string(data)
-	} else {
-		// 本地模板，优先从缓存读取
-		filename := filepath.Base(clashTemplate)
-		if cached, ok := cache.GetTemplateContent(filename); ok {
-			templateContent = cached
-		} else {
-			data, err := os.ReadFile(clashTemplate)
-			if err != nil {
-				return []string{}
-			}
-			templateContent = string(data)
-		}
+	return parseTemplateProxyGroupNames(templateContent, client)
+}
+
+// parseTemplateProxyGroupNames 提取 client（clash / surge）模板内容中的代理组名称
+func parseTemplateProxyGroupNames(templateContent, client string) []string {
+	if client == models.ChainClientSurge {
+		return parseSurgeProxyGroupNames(templateContent)
 	}
 
 	// 解析 YAML 获取代理组列表
 	var clashConfig map[string]interface{}
 	if err := yaml.Unmarshal([]byte(templateContent), &clashConfig); err != nil {
-		return []string{}
+		return nil
 	}
 
 	// 提取 proxy-groups 中的 name 字段
 	proxyGroups, ok := clashConfig["proxy-groups"].([]interface{})
 	if !ok {
-		return []string{}
+		return nil
 	}
 
-	var groupNames []string
+	groupNames := make([]string, 0, len(proxyGroups))
 	for _, pg := range proxyGroups {
 		if group, ok := pg.(map[string]interface{}); ok {
 			if name, ok := group["name"].(string); ok && name != "" {
@@ -401,6 +480,54 @@ func parseTemplateProxyGroups(configStr string) []string {
 	return groupNames
 }
 
+// readTemplateContent 读取模板内容，远程模板通过 HTTP 获取，本地模板优先从缓存读取
+func readTemplateContent(templatePath string) (string, bool) {
+	if templatePath == "" {
+		return "", false
+	}
+	if strings.Contains(templatePath, "://") {
+		resp, err := http.Get(templatePath)
+		if err != nil {
+			return "", false
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", false
+		}
+		return string(data), true
+	}
+	filename := filepath.Base(templatePath)
+	if cached, ok := cache.GetTemplateContent(filename); ok {
+		return cached, true
+	}
+	data, err := os.ReadFile(templatePath)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// parseSurgeProxyGroupNames 提取 Surge 模板 [Proxy Group] 中的代理组名称
+func parseSurgeProxyGroupNames(content string) []string {
+	groupNames := make([]string, 0)
+	inGroupSection := false
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			inGroupSection = trimmed == "[Proxy Group]"
+			continue
+		}
+		if !inGroupSection || trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//") {
+			continue
+		}
+		if idx := strings.Index(trimmed, "="); idx > 0 {
+			groupNames = append(groupNames, strings.TrimSpace(trimmed[:idx]))
+		}
+	}
+	return groupNames
+}
+
 // ChainLinkPreviewNode 链路预览中的节点信息
 type ChainLinkPreviewNode struct {
 	Name        string  `json:"name"`
@@ -438,10 +565,12 @@ type ChainPreviewResult struct {
 
 // SubscriptionChainPreviewResult 订阅链式代理整体预览结果
 type SubscriptionChainPreviewResult struct {
-	SubscriptionName string               `json:"subscriptionName"`
-	TotalNodes       int                  `json:"totalNodes"`   // 订阅总节点数
-	Rules            []ChainPreviewResult `json:"rules"`        // 所有规则预览
-	MatchSummary     []NodeMatchSummary   `json:"matchSummary"` // 节点匹配摘要
+	SubscriptionName string                      `json:"subscriptionName"`
+	TotalNodes       int                         `json:"totalNodes"`   // 订阅总节点数
+	Rules            []ChainPreviewResult        `json:"rules"`        // 所有规则预览
+	MatchSummary     []NodeMatchSummary          `json:"matchSummary"` // 节点匹配摘要
+	Clients          []models.ChainClientPreview `json:"clients"`      // 各客户端的渲染结果和警告
+	Diagnostics      []models.ChainDiagnostic    `json:"diagnostics"`  // 规则校验结果
 }
 
 // NodeMatchSummary 节点匹配摘要
@@ -472,7 +601,7 @@ func PreviewChainLinks(c *gin.Context) {
 		return
 	}
 
-	if err := sub.GetSub("none"); err != nil {
+	if err := sub.LoadFilteredNodes(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取订阅节点失败: " + err.Error()})
 		return
 	}
@@ -540,11 +669,21 @@ func PreviewChainLinks(c *gin.Context) {
 	// 构建节点匹配摘要
 	matchSummary := buildNodeMatchSummary(sub.Nodes, enabledRules, nodeNameMap)
 
+	// 各客户端的渲染结果（使用输出中的最终节点名称）
+	chainPlan := models.BuildChainRenderPlan(&sub, enabledRules)
+	templateGroups := chainTemplateGroups(&sub)
+	clients := make([]models.ChainClientPreview, 0, 3)
+	for _, client := range []string{models.ChainClientClash, models.ChainClientSurge, models.ChainClientV2ray} {
+		clients = append(clients, models.PreviewChainRender(&sub, enabledRules, chainPlan, client, templateGroups[client]))
+	}
+
 	result := SubscriptionChainPreviewResult{
 		SubscriptionName: sub.Name,
 		TotalNodes:       len(sub.Nodes),
 		Rules:            rulesPreview,
 		MatchSummary:     matchSummary,
+		Clients:          clients,
+		Diagnostics:      models.ValidateChainRules(&sub, rules, templateGroups),
 	}
 
 	c.JSON(http.StatusOK, gin.H{"data": result})
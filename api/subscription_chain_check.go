@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sublink/models"
+	"sublink/services/scheduler"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RunChainCheck 对订阅执行链式代理端到端检测
+// POST /api/v1/subcription/:id/chain-check
+func RunChainCheck(c *gin.Context) {
+	subID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订阅ID"})
+		return
+	}
+
+	var req struct {
+		ProfileID int `json:"profileId"` // 节点检测策略ID，决定检测模式、URL、超时等参数
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.ProfileID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误：必须指定检测策略"})
+		return
+	}
+	if _, err := models.GetNodeCheckProfileByID(req.ProfileID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "策略不存在"})
+		return
+	}
+
+	var sub models.Subcription
+	sub.ID = subID
+	if err := sub.Find(); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "订阅不存在"})
+		return
+	}
+
+	go scheduler.RunChainCheck(subID, req.ProfileID, models.TaskTriggerManual)
+	c.JSON(http.StatusOK, gin.H{"message": "链式代理检测任务已启动"})
+}
+
+// GetChainCheckResults 获取订阅的链式代理检测结果
+// GET /api/v1/subcription/:id/chain-check
+func GetChainCheckResults(c *gin.Context) {
+	subID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的订阅ID"})
+		return
+	}
+
+	results, err := models.ListSubscriptionChainChecks(subID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取检测结果失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": results})
+}
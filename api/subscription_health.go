@@ -0,0 +1,197 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"sublink/models"
+	"sublink/services/sse"
+	"sublink/utils"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// healthStateKey 健康状态按订阅和客户端分别记录，同一订阅各客户端的渲染结果可能不同
+type healthStateKey struct {
+	subID  int
+	client string
+}
+
+// degradedSubscriptions 当前未通过健康门槛的订阅和客户端，状态变化时才发送通知，避免每次请求都通知
+var degradedSubscriptions = struct {
+	sync.Mutex
+	keys map[healthStateKey]bool
+}{keys: make(map[healthStateKey]bool)}
+
+// setSubscriptionDegraded 更新订阅在该客户端下的健康状态，返回状态是否发生变化
+func setSubscriptionDegraded(subID int, client string, degraded bool) bool {
+	key := healthStateKey{subID: subID, client: client}
+	degradedSubscriptions.Lock()
+	defer degradedSubscriptions.Unlock()
+	if degradedSubscriptions.keys[key] == degraded {
+		return false
+	}
+	if degraded {
+		degradedSubscriptions.keys[key] = true
+	} else {
+		delete(degradedSubscriptions.keys, key)
+	}
+	return true
+}
+
+// serveHealthFallback 渲染结果中的节点未通过健康门槛时输出最近一次正常的内容，返回是否已输出
+// content 为执行订阅脚本后的渲染结果；没有保存过正常内容时仍使用实时渲染的结果
+func serveHealthFallback(c *gin.Context, sub *models.Subcription, client, content string) bool {
+	gateErr := sub.CheckHealthGate(renderedNodes(sub, client, content))
+	if gateErr == nil {
+		markSubscriptionHealthy(sub, client)
+		return false
+	}
+
+	lastGood, err := models.GetSubscriptionLastGood(sub.ID, client)
+	markSubscriptionDegraded(sub, client, gateErr, err == nil)
+	if err != nil {
+		utils.Warn("订阅【%s】未通过健康门槛且没有最近正常输出，使用实时渲染: %v", sub.Name, gateErr)
+		return false
+	}
+	utils.Warn("订阅【%s】未通过健康门槛，输出 %s 的内容: %v", sub.Name, lastGood.UpdatedAt.Format("2006-01-02 15:04:05"), gateErr)
+	c.Writer.Header().Set("X-Sublink-Fallback", "last-good")
+	c.Writer.Header().Set("X-Sublink-Fallback-At", lastGood.UpdatedAt.Format(time.RFC3339))
+	writeStoredContent(c, client, lastGood.Content, lastGood.NodeSummaries())
+	return true
+}
+
+// renderedNodes 返回订阅节点中仍出现在渲染结果里的节点（subMod 脚本可能删除节点），无法解析渲染结果时返回全部节点
+// V2Ray 按链接比较，Clash / Surge 按节点在输出中的最终名称比较；订阅转换链接无法确定节点，视为存在
+func renderedNodes(sub *models.Subcription, client, content string) []models.Node {
+	present := make(map[string]bool)
+	switch client {
+	case "v2ray":
+		for _, line := range strings.Split(utils.Base64Decode(content), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				present[line] = true
+			}
+		}
+	case "clash":
+		var config struct {
+			Proxies []struct {
+				Name string `yaml:"name"`
+			} `yaml:"proxies"`
+		}
+		if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+			return sub.Nodes
+		}
+		for _, proxy := range config.Proxies {
+			present[proxy.Name] = true
+		}
+	case "surge":
+		section := ""
+		for _, line := range strings.Split(content, "\n") {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+				section = trimmed
+				continue
+			}
+			if idx := strings.Index(trimmed, "="); section == "[Proxy]" && idx > 0 && !strings.HasPrefix(trimmed, "#") {
+				present[strings.TrimSpace(trimmed[:idx])] = true
+			}
+		}
+	default:
+		return sub.Nodes
+	}
+
+	nodeNameMap := sub.FinalNodeNames()
+	nodes := make([]models.Node, 0, len(sub.Nodes))
+	for idx, node := range sub.Nodes {
+		found := isRemoteSubscriptionLink(node.Link)
+		if client == "v2ray" {
+			for _, link := range sub.RenamedLinks(idx) {
+				found = found || present[strings.TrimSpace(link)]
+			}
+		} else {
+			found = found || present[nodeNameMap[node.ID]]
+		}
+		if found {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// rememberLastGood 在后台保存订阅的最近正常输出，未配置健康门槛的订阅不保存
+// 同一订阅同一客户端在保存间隔内只保存一次
+func rememberLastGood(sub *models.Subcription, client string) {
+	if sub.HealthGate == "" || !models.ClaimSubscriptionLastGoodSave(sub.ID, client) {
+		return
+	}
+	go saveLastGood(sub.ID, client)
+}
+
+// saveLastGood 不带请求上下文（分享名称、请求参数、客户端所在国家）重新渲染订阅并保存为最近正常输出
+// 保存的内容会输出给所有分享，因此不能包含某个请求的个性化内容；渲染结果未通过健康门槛时不保存
+func saveLastGood(subID int, client string) {
+	sub, err := models.GetSubcriptionByID(subID)
+	if err != nil {
+		return
+	}
+	if err := sub.GetSub(client); err != nil {
+		utils.Warn("保存订阅【%s】最近正常输出时读取节点失败: %v", sub.Name, err)
+		return
+	}
+	content, err := renderSnapshotContent(sub, client)
+	if err != nil {
+		utils.Warn("保存订阅【%s】最近正常输出时渲染失败: %v", sub.Name, err)
+		return
+	}
+	if sub.CheckHealthGate(renderedNodes(sub, client, content)) != nil {
+		return
+	}
+	if err := models.SaveSubscriptionLastGood(sub, client, content); err != nil {
+		utils.Warn("保存订阅【%s】最近正常输出失败: %v", sub.Name, err)
+	}
+}
+
+// markSubscriptionDegraded 记录订阅在该客户端下未通过健康门槛，从正常变为异常时发送通知
+func markSubscriptionDegraded(sub *models.Subcription, client string, gateErr error, fallback bool) {
+	if !setSubscriptionDegraded(sub.ID, client, true) {
+		return
+	}
+
+	message := fmt.Sprintf("订阅【%s】%s 输出未通过健康门槛（%v），已改为输出最近一次正常的内容", sub.Name, client, gateErr)
+	if !fallback {
+		message = fmt.Sprintf("订阅【%s】%s 输出未通过健康门槛（%v），且没有最近正常输出，仍使用实时渲染的内容", sub.Name, client, gateErr)
+	}
+	sse.GetSSEBroker().BroadcastEvent("task_update", sse.NotificationPayload{
+		Event:   "subscription_health",
+		Title:   "订阅健康检查未通过",
+		Message: message,
+		Data: map[string]interface{}{
+			"status":         "error",
+			"subscriptionId": sub.ID,
+			"client":         client,
+			"nodes":          len(sub.Nodes),
+			"fallback":       fallback,
+		},
+	})
+}
+
+// markSubscriptionHealthy 记录订阅在该客户端下通过健康门槛，从异常恢复时发送通知
+func markSubscriptionHealthy(sub *models.Subcription, client string) {
+	if !setSubscriptionDegraded(sub.ID, client, false) {
+		return
+	}
+
+	sse.GetSSEBroker().BroadcastEvent("task_update", sse.NotificationPayload{
+		Event:   "subscription_health",
+		Title:   "订阅已恢复正常",
+		Message: fmt.Sprintf("订阅【%s】%s 输出已通过健康门槛（节点 %d 个），恢复输出实时内容", sub.Name, client, len(sub.Nodes)),
+		Data: map[string]interface{}{
+			"status":         "success",
+			"subscriptionId": sub.ID,
+			"client":         client,
+			"nodes":          len(sub.Nodes),
+		},
+	})
+}
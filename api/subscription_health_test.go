@@ -0,0 +1,183 @@
+package api
+
+import (
+	"net/http/httptest"
+	"sublink/database"
+	"sublink/models"
+	"sublink/utils"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupHealthTestDB 使用内存数据库替换全局数据库连接，并创建最近正常输出表
+func setupHealthTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开内存数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.SubscriptionLastGood{}); err != nil {
+		t.Fatalf("创建数据表失败: %v", err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+func healthTestSub(id int) *models.Subcription {
+	return &models.Subcription{
+		ID:         id,
+		Name:       "健康门槛测试",
+		HealthGate: `{"minNodes":2}`,
+		Nodes: []models.Node{
+			{ID: 1, Name: "香港01", LinkName: "香港01", Link: "trojan://pass@hk.example.com:443#%E9%A6%99%E6%B8%AF01", Source: "manual"},
+			{ID: 2, Name: "日本01", LinkName: "日本01", Link: "trojan://pass@jp.example.com:443#%E6%97%A5%E6%9C%AC01", Source: "manual"},
+		},
+	}
+}
+
+// TestRenderedNodes 测试按渲染结果确定输出的节点（订阅脚本删除的节点不计入）
+func TestRenderedNodes(t *testing.T) {
+	sub := healthTestSub(1)
+	cases := []struct {
+		name    string
+		client  string
+		content string
+		want    int
+	}{
+		{"V2Ray 全部输出", "v2ray", utils.Base64Encode(sub.Nodes[0].Link + "\n" + sub.Nodes[1].Link + "\n"), 2},
+		{"V2Ray 脚本删除节点", "v2ray", utils.Base64Encode(sub.Nodes[1].Link + "\n"), 1},
+		{"Clash 全部输出", "clash", "proxies:\n  - name: 香港01\n  - name: 日本01\nproxy-groups: []\n", 2},
+		{"Clash 脚本删除节点", "clash", "proxies:\n  - name: 日本01\n", 1},
+		{"Clash 无法解析", "clash", "proxies: [", 2},
+		{"Surge 只统计 Proxy 段", "surge", "[Proxy]\n香港01 = trojan, hk.example.com, 443\n[Proxy Group]\n日本01 = select, DIRECT\n", 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := renderedNodes(sub, tc.client, tc.content); len(got) != tc.want {
+				t.Errorf("renderedNodes() = %d 个节点, want %d", len(got), tc.want)
+			}
+		})
+	}
+}
+
+// TestServeHealthFallback 测试渲染结果未通过健康门槛时输出最近正常输出
+func TestServeHealthFallback(t *testing.T) {
+	setupHealthTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	// 通过门槛时不输出保存的内容
+	passed := healthTestSub(9101)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/c/?token=test", nil)
+	if serveHealthFallback(c, passed, "clash", "proxies:\n  - name: 香港01\n  - name: 日本01\n") {
+		t.Fatal("通过健康门槛时不应输出最近正常输出")
+	}
+
+	// 未通过门槛且没有最近正常输出时使用实时渲染的内容
+	sub := healthTestSub(9102)
+	setSubscriptionDegraded(sub.ID, "clash", true) // 已处于异常状态，不再发送通知
+	t.Cleanup(func() { setSubscriptionDegraded(sub.ID, "clash", false) })
+	scripted := "proxies:\n  - name: 香港01\n"
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/c/?token=test", nil)
+	if serveHealthFallback(c, sub, "clash", scripted) {
+		t.Fatal("没有最近正常输出时应使用实时渲染的内容")
+	}
+
+	// 未通过门槛时输出最近正常输出
+	lastGood := "proxies:\n  - name: 香港01\n  - name: 日本01\n"
+	if err := models.SaveSubscriptionLastGood(sub, "clash", lastGood); err != nil {
+		t.Fatalf("保存最近正常输出失败: %v", err)
+	}
+	t.Cleanup(func() { models.DeleteSubscriptionLastGoods(sub.ID) })
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/c/?token=test", nil)
+	if !serveHealthFallback(c, sub, "clash", scripted) {
+		t.Fatal("未通过健康门槛时应输出最近正常输出")
+	}
+	if got := w.Header().Get("X-Sublink-Fallback"); got != "last-good" {
+		t.Errorf("X-Sublink-Fallback = %q, want last-good", got)
+	}
+	if w.Body.String() != lastGood {
+		t.Errorf("输出内容 = %q, want %q", w.Body.String(), lastGood)
+	}
+}
+
+// TestSubscriptionHealthStatePerClient 测试同一订阅不同客户端的健康状态分别记录
+// Clash 未通过、Surge 通过交替出现时，不应反复发送异常和恢复通知
+func TestSubscriptionHealthStatePerClient(t *testing.T) {
+	const subID = 9201
+	t.Cleanup(func() {
+		setSubscriptionDegraded(subID, "clash", false)
+		setSubscriptionDegraded(subID, "surge", false)
+	})
+
+	steps := []struct {
+		client   string
+		degraded bool
+		changed  bool
+	}{
+		{"clash", true, true},   // Clash 首次未通过，发送异常通知
+		{"surge", false, false}, // Surge 一直正常，不发送恢复通知
+		{"clash", true, false},  // Clash 仍未通过，不重复通知
+		{"surge", false, false},
+		{"clash", true, false},
+		{"clash", false, true}, // Clash 恢复，发送恢复通知
+		{"surge", true, true},  // Surge 未通过与 Clash 状态无关
+	}
+	for i, step := range steps {
+		if got := setSubscriptionDegraded(subID, step.client, step.degraded); got != step.changed {
+			t.Errorf("第 %d 步 %s degraded=%v: changed = %v, want %v", i+1, step.client, step.degraded, got, step.changed)
+		}
+	}
+}
+
+// TestServeHealthFallbackInterleavedClients 测试 Clash 未通过、Surge 通过的渲染交替出现时各自保持状态
+func TestServeHealthFallbackInterleavedClients(t *testing.T) {
+	setupHealthTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	sub := healthTestSub(9202)
+	setSubscriptionDegraded(sub.ID, "clash", true) // 已处于异常状态，不再发送通知
+	t.Cleanup(func() {
+		setSubscriptionDegraded(sub.ID, "clash", false)
+		setSubscriptionDegraded(sub.ID, "surge", false)
+	})
+
+	clashFailed := "proxies:\n  - name: 香港01\n"
+	surgeOK := "[Proxy]\n香港01 = trojan, hk.example.com, 443\n日本01 = trojan, jp.example.com, 443\n"
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/c/?token=test", nil)
+		serveHealthFallback(c, sub, "clash", clashFailed)
+
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/c/?token=test", nil)
+		if serveHealthFallback(c, sub, "surge", surgeOK) {
+			t.Fatal("Surge 通过健康门槛时不应输出最近正常输出")
+		}
+
+		// Surge 通过不应清除 Clash 的异常状态，否则下一次 Clash 渲染会再次发送异常通知
+		if setSubscriptionDegraded(sub.ID, "clash", true) {
+			t.Fatalf("第 %d 轮: Surge 通过后 Clash 的异常状态被清除", i+1)
+		}
+		if setSubscriptionDegraded(sub.ID, "surge", false) {
+			t.Fatalf("第 %d 轮: Surge 不应处于异常状态", i+1)
+		}
+	}
+}
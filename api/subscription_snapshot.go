@@ -0,0 +1,250 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sublink/models"
+	"sublink/services/sse"
+	"sublink/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// snapshotClients 快照中渲染的客户端类型
+var snapshotClients = []string{"v2ray", "clash", "surge"}
+
+// SubscriptionSnapshots 获取订阅的快照列表
+func SubscriptionSnapshots(c *gin.Context) {
+	subID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.FailWithMsg(c, "无效的订阅ID")
+		return
+	}
+	snapshots, err := models.ListSubscriptionSnapshots(subID)
+	if err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkWithData(c, snapshots)
+}
+
+// PublishSubscriptionSnapshot 发布订阅快照
+// 发布前按订阅的快照发布规则校验节点数量和健康比例，force 为 true 时跳过校验
+func PublishSubscriptionSnapshot(c *gin.Context) {
+	subID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.FailWithMsg(c, "无效的订阅ID")
+		return
+	}
+	var req struct {
+		Note  string `json:"note"`
+		Force bool   `json:"force"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+	snapshot, err := publishSubscriptionSnapshot(subID, models.SnapshotTriggerManual, req.Note, req.Force)
+	if err != nil {
+		utils.FailWithMsg(c, "发布失败: "+err.Error())
+		return
+	}
+	utils.OkDetailed(c, "发布成功", snapshot)
+}
+
+// SubscriptionSnapshotDiff 比较订阅的两个快照
+// from / to 为已发布的快照ID；client 为比较内容的客户端类型，默认 clash
+func SubscriptionSnapshotDiff(c *gin.Context) {
+	subID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.FailWithMsg(c, "无效的订阅ID")
+		return
+	}
+	client := c.DefaultQuery("client", "clash")
+	if !isSnapshotClient(client) {
+		utils.FailWithMsg(c, "不支持的客户端类型")
+		return
+	}
+	before, err := snapshotForDiff(subID, c.Query("from"))
+	if err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	after, err := snapshotForDiff(subID, c.Query("to"))
+	if err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkWithData(c, gin.H{
+		"nodes":   models.DiffSnapshotNodes(before.NodeSummaries(), after.NodeSummaries()),
+		"content": models.DiffTemplateContent(before.Content(client), after.Content(client)),
+	})
+}
+
+// SubscriptionSnapshotContent 获取快照的节点摘要和指定客户端的订阅内容
+func SubscriptionSnapshotContent(c *gin.Context) {
+	subID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.FailWithMsg(c, "无效的订阅ID")
+		return
+	}
+	snapshotID, err := strconv.Atoi(c.Param("snapshotId"))
+	if err != nil {
+		utils.FailWithMsg(c, "无效的快照ID")
+		return
+	}
+	client := c.DefaultQuery("client", "clash")
+	if !isSnapshotClient(client) {
+		utils.FailWithMsg(c, "不支持的客户端类型")
+		return
+	}
+	snapshot, err := models.GetSubscriptionSnapshot(subID, snapshotID)
+	if err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkWithData(c, gin.H{
+		"snapshot": snapshot,
+		"nodes":    snapshot.NodeSummaries(),
+		"content":  snapshot.Content(client),
+	})
+}
+
+// DeleteSubscriptionSnapshot 删除订阅快照
+func DeleteSubscriptionSnapshot(c *gin.Context) {
+	subID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.FailWithMsg(c, "无效的订阅ID")
+		return
+	}
+	snapshotID, err := strconv.Atoi(c.Param("snapshotId"))
+	if err != nil {
+		utils.FailWithMsg(c, "无效的快照ID")
+		return
+	}
+	if err := models.DeleteSubscriptionSnapshot(subID, snapshotID); err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkWithMsg(c, "删除成功")
+}
+
+// AutoPublishSubscriptionSnapshot 自动发布订阅快照，未通过校验时不发布并发送通知
+func AutoPublishSubscriptionSnapshot(subID int) {
+	name := strconv.Itoa(subID)
+	if sub, err := models.GetSubcriptionByID(subID); err == nil {
+		name = sub.Name
+	}
+	snapshot, err := publishSubscriptionSnapshot(subID, models.SnapshotTriggerAuto, "", false)
+	if errors.Is(err, models.ErrSnapshotUnchanged) {
+		utils.Debug("订阅【%s】内容未变化，跳过自动发布快照", name)
+		return
+	}
+	if err != nil {
+		utils.Warn("订阅【%s】自动发布快照失败: %v", name, err)
+		sse.GetSSEBroker().BroadcastEvent("task_update", sse.NotificationPayload{
+			Event:   "subscription_snapshot",
+			Title:   "订阅快照未发布",
+			Message: fmt.Sprintf("订阅【%s】自动发布快照失败: %v", name, err),
+			Data: map[string]interface{}{
+				"status":         "error",
+				"subscriptionId": subID,
+			},
+		})
+		return
+	}
+	utils.Info("订阅【%s】已自动发布快照 v%d（节点 %d 个）", name, snapshot.Version, snapshot.NodeCount)
+}
+
+// publishSubscriptionSnapshot 按客户端类型分别渲染订阅并保存为快照，force 为 false 时需通过快照发布规则的校验
+// 自动发布时内容与最新快照相同则不保存，返回 models.ErrSnapshotUnchanged
+func publishSubscriptionSnapshot(subID int, trigger, note string, force bool) (*models.SubscriptionSnapshot, error) {
+	snapshot, err := renderSubscriptionSnapshot(subID, trigger, note, !force)
+	if err != nil {
+		return nil, err
+	}
+	if err := snapshot.Publish(trigger == models.SnapshotTriggerAuto); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// renderSubscriptionSnapshot 实时渲染订阅的各客户端内容并构建快照（不保存），gate 为 true 时按快照发布规则校验节点
+// 节点只加载一次，节点摘要、校验和各客户端内容都基于同一组节点
+func renderSubscriptionSnapshot(subID int, trigger, note string, gate bool) (*models.SubscriptionSnapshot, error) {
+	sub, err := models.GetSubcriptionByID(subID)
+	if err != nil {
+		return nil, fmt.Errorf("订阅不存在")
+	}
+	if err := sub.GetSub("snapshot"); err != nil {
+		return nil, fmt.Errorf("读取订阅节点失败: %v", err)
+	}
+	if gate && sub.SnapshotRule != "" {
+		config, err := models.ParseSnapshotRule(sub.SnapshotRule)
+		if err != nil {
+			return nil, fmt.Errorf("快照发布规则格式错误: %v", err)
+		}
+		if err := config.Check(sub.Nodes); err != nil {
+			return nil, fmt.Errorf("未通过发布校验: %v", err)
+		}
+	}
+	snapshot := models.NewSubscriptionSnapshot(sub, trigger, note)
+
+	rendered := 0
+	for _, client := range snapshotClients {
+		// 每个客户端使用节点列表的副本渲染，避免渲染过程互相影响
+		clientSub := *sub
+		clientSub.Nodes = append([]models.Node(nil), sub.Nodes...)
+		content, err := renderSnapshotContent(&clientSub, client)
+		if err != nil {
+			// 未配置对应客户端模板等情况下跳过，分享固定到该快照时此客户端使用实时渲染
+			utils.Warn("订阅【%s】快照渲染 %s 内容失败: %v", sub.Name, client, err)
+			continue
+		}
+		switch client {
+		case "v2ray":
+			snapshot.V2ray = content
+		case "clash":
+			snapshot.Clash = content
+		case "surge":
+			snapshot.Surge = content
+		}
+		rendered++
+	}
+	if rendered == 0 {
+		return nil, fmt.Errorf("所有客户端的订阅内容都渲染失败")
+	}
+	return snapshot, nil
+}
+
+// renderSnapshotContent 不带请求上下文渲染指定客户端的订阅内容（快照和最近正常输出使用），sub 需已通过 GetSub 加载节点
+func renderSnapshotContent(sub *models.Subcription, client string) (string, error) {
+	if client == "v2ray" {
+		return renderV2rayContent(sub)
+	}
+	ctx := newTemplateContext(sub, client)
+	ctx.Usage = subscriptionUsage(sub.Nodes)
+	if client == "surge" {
+		return renderSurgeContent(sub, ctx)
+	}
+	return renderClashContent(sub, ctx)
+}
+
+// snapshotForDiff 获取用于比较的已发布快照
+func snapshotForDiff(subID int, idStr string) (*models.SubscriptionSnapshot, error) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("请选择要比较的快照")
+	}
+	return models.GetSubscriptionSnapshot(subID, id)
+}
+
+func isSnapshotClient(client string) bool {
+	for _, c := range snapshotClients {
+		if c == client {
+			return true
+		}
+	}
+	return false
+}
@@ -271,6 +271,22 @@ func UpdateTemp(c *gin.Context) {
 		return
 	}
 
+	// 发布前校验模板，force 为 true 时跳过
+	if c.PostForm("force") != "true" && isSubscriptionTemplateFile(filename) {
+		if result := validateTemplateContent(text, category); !result.Valid {
+			utils.FailWithData(c, "模板校验失败", result)
+			return
+		}
+	}
+
+	// 读取修改前的内容，保存为历史版本
+	oldContent, err := os.ReadFile(oldFullPath)
+	if err != nil {
+		utils.Error("读取模板内容失败: %v", err)
+		utils.FailWithMsg(c, "服务器错误：读取模板失败")
+		return
+	}
+
 	// 如果新旧文件名不同，则检查新文件是否已存在
 	if oldFullPath != newFullPath {
 		if _, err := os.Stat(newFullPath); err == nil {
@@ -335,6 +351,11 @@ func UpdateTemp(c *gin.Context) {
 			utils.Error("更新模板元数据失败: %v", err)
 		}
 	}
+	if tmpl.ID > 0 && string(oldContent) != text {
+		if err := models.SaveTemplateRevision(tmpl.ID, oldname, string(oldContent), models.TemplateRevisionReasonUpdate); err != nil {
+			utils.Error("保存模板历史版本失败: %v", err)
+		}
+	}
 
 	utils.OkWithMsg(c, "修改成功")
 }
@@ -383,6 +404,14 @@ func AddTemp(c *gin.Context) {
 		return
 	}
 
+	// 发布前校验模板，force 为 true 时跳过
+	if c.PostForm("force") != "true" && isSubscriptionTemplateFile(filename) {
+		if result := validateTemplateContent(text, category); !result.Valid {
+			utils.FailWithData(c, "模板校验失败", result)
+			return
+		}
+	}
+
 	// 写入文件
 	err = os.WriteFile(fullPath, []byte(text), 0666)
 	if err != nil {
@@ -452,6 +481,9 @@ func DelTemp(c *gin.Context) {
 		if err := tmpl.Delete(); err != nil {
 			utils.Error("删除模板元数据失败: %v", err)
 		}
+		if err := models.DeleteTemplateRevisions(tmpl.ID); err != nil {
+			utils.Error("删除模板历史版本失败: %v", err)
+		}
 	}
 
 	utils.OkWithMsg(c, "删除成功")
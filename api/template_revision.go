@@ -0,0 +1,327 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sublink/cache"
+	"sublink/models"
+	"sublink/node/protocol"
+	"sublink/utils"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateValidateResult 模板发布前校验结果
+type TemplateValidateResult struct {
+	Valid   bool     `json:"valid"`
+	Errors  []string `json:"errors"`
+	Preview string   `json:"preview"` // 使用示例节点渲染的订阅内容
+}
+
+// TemplateValidate 校验模板内容：解析 YAML / conf，并使用示例节点渲染订阅
+func TemplateValidate(c *gin.Context) {
+	var req struct {
+		Text     string `json:"text"`
+		Category string `json:"category"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+	utils.OkWithData(c, validateTemplateContent(req.Text, req.Category))
+}
+
+// TemplateRevisions 获取模板的历史版本
+func TemplateRevisions(c *gin.Context) {
+	var tmpl models.Template
+	if err := tmpl.FindByName(c.Query("filename")); err != nil {
+		utils.FailWithMsg(c, "模板不存在")
+		return
+	}
+	revisions, err := models.ListTemplateRevisions(tmpl.ID)
+	if err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkWithData(c, revisions)
+}
+
+// TemplateRevisionDiff 比较模板的两个版本
+// from / to 为历史版本ID，为空或 0 表示当前内容
+func TemplateRevisionDiff(c *gin.Context) {
+	filename := c.Query("filename")
+	var tmpl models.Template
+	if err := tmpl.FindByName(filename); err != nil {
+		utils.FailWithMsg(c, "模板不存在")
+		return
+	}
+	before, err := templateRevisionContent(&tmpl, c.Query("from"))
+	if err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	after, err := templateRevisionContent(&tmpl, c.Query("to"))
+	if err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	utils.OkWithData(c, models.DiffTemplateContent(before, after))
+}
+
+// TemplateRollback 将模板回滚到指定历史版本，回滚前的内容同样保存为历史版本
+// 回滚的内容需要通过校验，force 为 true 时跳过校验
+func TemplateRollback(c *gin.Context) {
+	var req struct {
+		Filename   string `json:"filename"`
+		RevisionID int    `json:"revisionId"`
+		Force      bool   `json:"force"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.FailWithMsg(c, "参数错误")
+		return
+	}
+	var tmpl models.Template
+	if err := tmpl.FindByName(req.Filename); err != nil {
+		utils.FailWithMsg(c, "模板不存在")
+		return
+	}
+	revision, err := models.GetTemplateRevision(tmpl.ID, req.RevisionID)
+	if err != nil {
+		utils.FailWithMsg(c, err.Error())
+		return
+	}
+	if !req.Force && isSubscriptionTemplateFile(tmpl.Name) {
+		if result := validateTemplateContent(revision.Content, tmpl.Category); !result.Valid {
+			utils.FailWithData(c, "模板校验失败", result)
+			return
+		}
+	}
+
+	fullPath, err := safeFilePath(tmpl.Name)
+	if err != nil {
+		utils.FailWithMsg(c, "文件名非法: "+err.Error())
+		return
+	}
+	current, err := os.ReadFile(fullPath)
+	if err != nil {
+		utils.FailWithMsg(c, "读取模板失败")
+		return
+	}
+	if err := models.SaveTemplateRevision(tmpl.ID, tmpl.Name, string(current), models.TemplateRevisionReasonRollback); err != nil {
+		utils.FailWithMsg(c, "保存历史版本失败: "+err.Error())
+		return
+	}
+	if err := os.WriteFile(fullPath, []byte(revision.Content), 0666); err != nil {
+		utils.Error("回滚模板内容失败: %v", err)
+		utils.FailWithMsg(c, "回滚失败")
+		return
+	}
+	cache.SetTemplateContent(tmpl.Name, revision.Content)
+	// 更新模板记录的修改时间
+	if err := tmpl.Update(); err != nil {
+		utils.Error("更新模板元数据失败: %v", err)
+	}
+	utils.OkWithMsg(c, "回滚成功")
+}
+
+// templateRevisionContent 获取模板指定版本的内容，idStr 为空或 0 时返回当前内容
+func templateRevisionContent(tmpl *models.Template, idStr string) (string, error) {
+	if idStr == "" || idStr == "0" {
+		fullPath, err := safeFilePath(tmpl.Name)
+		if err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(fullPath)
+		if err != nil {
+			return "", fmt.Errorf("读取模板失败")
+		}
+		return string(data), nil
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return "", fmt.Errorf("历史版本ID格式错误")
+	}
+	revision, err := models.GetTemplateRevision(tmpl.ID, id)
+	if err != nil {
+		return "", err
+	}
+	return revision.Content, nil
+}
+
+// isSubscriptionTemplateFile 是否为订阅模板文件（模板目录中还有节点上报脚本等其他文件，不做校验）
+func isSubscriptionTemplateFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".conf":
+		return true
+	}
+	return false
+}
+
+// validateTemplateContent 发布前校验模板
+// 依次检查模板变量语法、YAML / conf 结构，再使用示例节点完整渲染一次订阅并检查输出
+func validateTemplateContent(text, category string) TemplateValidateResult {
+	result := TemplateValidateResult{Errors: []string{}}
+	if category == "" {
+		category = "clash"
+	}
+	if strings.TrimSpace(text) == "" {
+		result.Errors = append(result.Errors, "模板内容不能为空")
+		return result
+	}
+
+	ctx := sampleTemplateContext(category)
+	rendered, err := protocol.RenderTemplate(text, ctx)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result
+	}
+
+	if category == "surge" {
+		result.Errors = append(result.Errors, checkSurgeTemplate(rendered)...)
+	} else {
+		result.Errors = append(result.Errors, checkClashTemplate(rendered)...)
+	}
+	if len(result.Errors) > 0 {
+		return result
+	}
+
+	config := protocol.OutputConfig{
+		Clash:           "validate.yaml",
+		Surge:           "validate.conf",
+		Udp:             true,
+		TemplateContext: ctx,
+		TemplateContent: text,
+	}
+	urls := sampleTemplateUrls()
+	if category == "surge" {
+		preview, err := protocol.EncodeSurge(urls, config)
+		if err != nil {
+			result.Errors = append(result.Errors, "渲染示例订阅失败: "+err.Error())
+			return result
+		}
+		result.Preview = preview
+	} else {
+		data, err := protocol.EncodeClash(urls, config)
+		if err != nil {
+			result.Errors = append(result.Errors, "渲染示例订阅失败: "+err.Error())
+			return result
+		}
+		var output map[string]interface{}
+		if err := yaml.Unmarshal(data, &output); err != nil {
+			result.Errors = append(result.Errors, "示例订阅不是有效的 YAML: "+err.Error())
+			return result
+		}
+		result.Preview = string(data)
+	}
+	result.Valid = true
+	return result
+}
+
+// checkClashTemplate 检查 Clash 模板的 YAML 结构
+func checkClashTemplate(content string) []string {
+	var errs []string
+	var config map[string]interface{}
+	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+		return []string{"YAML 解析失败: " + err.Error()}
+	}
+	if groups, exists := config["proxy-groups"]; exists && groups != nil {
+		list, ok := groups.([]interface{})
+		if !ok {
+			return []string{"proxy-groups 必须是列表"}
+		}
+		for i, item := range list {
+			group, ok := item.(map[string]interface{})
+			if !ok {
+				errs = append(errs, fmt.Sprintf("proxy-groups 第 %d 项格式错误", i+1))
+				continue
+			}
+			name, _ := group["name"].(string)
+			if name == "" {
+				errs = append(errs, fmt.Sprintf("proxy-groups 第 %d 项缺少 name", i+1))
+			}
+			if groupType, _ := group["type"].(string); groupType == "" {
+				errs = append(errs, fmt.Sprintf("代理组【%s】缺少 type", name))
+			}
+		}
+	}
+	if rules, exists := config["rules"]; exists && rules != nil {
+		list, ok := rules.([]interface{})
+		if !ok {
+			return append(errs, "rules 必须是列表")
+		}
+		for i, item := range list {
+			if rule, ok := item.(string); !ok || !strings.Contains(rule, ",") {
+				errs = append(errs, fmt.Sprintf("rules 第 %d 项格式错误: %v", i+1, item))
+			}
+		}
+	}
+	return errs
+}
+
+// checkSurgeTemplate 检查 Surge 模板的 conf 结构
+func checkSurgeTemplate(content string) []string {
+	var errs []string
+	section := ""
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "//") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			if !strings.HasSuffix(trimmed, "]") {
+				errs = append(errs, fmt.Sprintf("第 %d 行: section 标记不完整: %s", i+1, trimmed))
+				continue
+			}
+			section = trimmed
+			continue
+		}
+		switch section {
+		case "":
+			errs = append(errs, fmt.Sprintf("第 %d 行: 内容不在任何 section 中: %s", i+1, trimmed))
+		case "[Proxy Group]":
+			parts := strings.SplitN(trimmed, "=", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+				errs = append(errs, fmt.Sprintf("第 %d 行: 代理组格式应为 名称 = 类型, ...: %s", i+1, trimmed))
+			}
+		case "[Rule]":
+			if !strings.Contains(trimmed, ",") {
+				errs = append(errs, fmt.Sprintf("第 %d 行: 规则格式错误: %s", i+1, trimmed))
+			}
+		}
+	}
+	return errs
+}
+
+// sampleTemplateContext 校验模板时使用的示例渲染上下文
+func sampleTemplateContext(client string) *protocol.TemplateContext {
+	return &protocol.TemplateContext{
+		Subscription: "示例订阅",
+		Client:       client,
+		Share:        "示例分享",
+		NodeCount:    2,
+		Countries:    map[string]int{"HK": 1, "US": 1},
+		Tags:         map[string]int{},
+		Usage:        protocol.TemplateUsage{Upload: 1 << 30, Download: 2 << 30, Total: 100 << 30},
+		Params:       map[string]string{},
+	}
+}
+
+// sampleTemplateUrls 校验模板时使用的示例节点
+func sampleTemplateUrls() []protocol.Urls {
+	newSS := func(name, server string) protocol.Urls {
+		return protocol.Urls{Url: protocol.EncodeSSURL(protocol.Ss{
+			Name:   name,
+			Server: server,
+			Port:   8388,
+			Param:  protocol.Param{Cipher: "aes-256-gcm", Password: "password"},
+		})}
+	}
+	return []protocol.Urls{
+		newSS("🇭🇰 示例香港 01", "hk.example.com"),
+		newSS("🇺🇸 示例美国 01", "us.example.com"),
+	}
+}
@@ -33,6 +33,7 @@ type AirportRequest struct {
 	DownloadWithProxy bool   `json:"downloadWithProxy"`
 	ProxyLink         string `json:"proxyLink"`
 	UserAgent         string `json:"userAgent"`
+	RequestConfig     string `json:"requestConfig"`  // 请求配置(JSON)：请求头、Basic Auth、Cookie、登录流程
 	FetchUsageInfo    bool   `json:"fetchUsageInfo"` // 是否获取用量信息
 	SkipTLSVerify     bool   `json:"skipTLSVerify"`  // 是否跳过TLS证书验证
 	Remark            string `json:"remark"`         // 备注信息
@@ -49,6 +50,10 @@ type AirportRequest struct {
 	// 节点名称唯一化
 	NodeNameUniquify bool   `json:"nodeNameUniquify"` // 是否开启节点名称唯一化
 	NodeNamePrefix   string `json:"nodeNamePrefix"`   // 自定义名称前缀（可选）
+	// 导入脚本
+	ScriptIDs string `json:"scriptIds"` // 导入脚本ID（逗号分隔，按顺序执行）
+	// 跨机场重复节点处理策略
+	DuplicatePolicy string `json:"duplicatePolicy"` // first, merge, healthier
 }
 
 // BatchSortRequest 批量排序请求
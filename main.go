@@ -368,6 +368,15 @@ func Run() {
 		return node.Link, node.Name, nil
 	}
 
+	// 初始化脚本运行时依赖
+	utils.ScriptFetchAllowListFunc = models.GetScriptFetchAllowList
+	utils.ScriptKVGetFunc = models.GetScriptKV
+	utils.ScriptKVSetFunc = models.SetScriptKV
+	utils.ScriptKVDeleteFunc = models.DeleteScriptKV
+	utils.ScriptKVKeysFunc = models.ListScriptKVKeys
+	utils.ScriptLookupFunc = models.ScriptLookup
+	models.LoadScriptLimits()
+
 	// 初始化 GeoIP 数据库
 	if err := geoip.InitGeoIP(); err != nil {
 		utils.Warn("初始化 GeoIP 数据库失败: %v", err)
@@ -423,6 +432,9 @@ func Run() {
 	}
 	// 初始化模板内容缓存
 	cache.InitTemplateContentCache()
+	if err := models.InitRuleSetCache(); err != nil {
+		utils.Error("加载规则集到缓存失败: %v", err)
+	}
 	if err := models.InitTagCache(); err != nil {
 		utils.Error("加载标签到缓存失败: %v", err)
 	}
@@ -458,6 +470,8 @@ func Run() {
 	if err := mihomo.SyncHostsFromDB(); err != nil {
 		utils.Warn("初始化Host同步到mihomo失败: %v", err)
 	}
+	// 注册快照自动发布：机场更新或测速完成后为开启自动发布的订阅发布快照
+	models.RegisterSnapshotAutoPublisher(api.AutoPublishSubscriptionSnapshot)
 
 	// 初始化去重字段元数据缓存（通过反射扫描协议结构体和Node模型）
 	protocol.InitProtocolMeta()
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"sublink/cache"
@@ -48,6 +49,12 @@ type Airport struct {
 	// 节点名称唯一化（拉取时生效）
 	NodeNameUniquify bool   `gorm:"default:false" json:"nodeNameUniquify"` // 是否开启节点名称唯一化
 	NodeNamePrefix   string `json:"nodeNamePrefix"`                        // 自定义名称前缀（可选）
+	// 请求配置（拉取时生效，加密存储）
+	RequestConfig EncryptedString `gorm:"type:text" json:"requestConfig"` // 请求头、Basic Auth、Cookie、登录流程 (JSON)
+	// 导入脚本（拉取时生效）
+	ScriptIDs string `json:"scriptIds"` // 导入脚本ID（逗号分隔，按顺序执行）
+	// 跨机场重复节点处理策略（拉取时生效）
+	DuplicatePolicy string `gorm:"default:'first'" json:"duplicatePolicy"` // first: 保留先导入, merge: 合并来源, healthier: 归属健康度更好的机场
 }
 
 // TableName 指定表名
@@ -93,10 +100,10 @@ func (a *Airport) Add() error {
 func (a *Airport) Update() error {
 	err := database.DB.Model(a).Select(
 		"Name", "URL", "CronExpr", "Enabled", "LastRunTime", "NextRunTime",
-		"SuccessCount", "Group", "DownloadWithProxy", "ProxyLink", "UserAgent",
+		"SuccessCount", "Group", "DownloadWithProxy", "ProxyLink", "UserAgent", "RequestConfig",
 		"FetchUsageInfo", "SkipTLSVerify", "Remark", "Logo",
 		"NodeNameWhitelist", "NodeNameBlacklist", "ProtocolWhitelist", "ProtocolBlacklist", "NodeNamePreprocess",
-		"DeduplicationRule", "NodeNameUniquify", "NodeNamePrefix",
+		"DeduplicationRule", "NodeNameUniquify", "NodeNamePrefix", "ScriptIDs", "DuplicatePolicy",
 	).Updates(a).Error
 	if err != nil {
 		return err
@@ -217,6 +224,15 @@ func (a *Airport) Del() error {
 		return err
 	}
 	airportCache.Delete(a.ID)
+	if err := DeleteNodeSourcesByAirport(a.ID); err != nil {
+		utils.Warn("删除机场节点来源记录失败 ID: %d: %v", a.ID, err)
+	}
+	if err := DeleteAirportUsageSnapshots(a.ID); err != nil {
+		utils.Warn("删除机场用量快照失败 ID: %d: %v", a.ID, err)
+	}
+	if err := DeleteAirportHealthRecords(a.ID); err != nil {
+		utils.Warn("删除机场健康记录失败 ID: %d: %v", a.ID, err)
+	}
 	return nil
 }
 
@@ -274,7 +290,16 @@ func (a *Airport) IncrementSuccessCount() error {
 }
 
 // DeleteAirportNodes 删除机场关联的所有节点
+// 其他机场同样提供的节点转移给其他机场，不会被删除
 func DeleteAirportNodes(airportID int) error {
+	nodes := nodeCache.GetByIndex("sourceID", strconv.Itoa(airportID))
+	nodeIDs := make([]int, 0, len(nodes))
+	for _, n := range nodes {
+		nodeIDs = append(nodeIDs, n.ID)
+	}
+	if transferred := HandoverNodesFromAirport(nodeIDs); len(transferred) > 0 {
+		utils.Info("机场 ID: %d 的 %d 个节点已转移给其他提供相同节点的机场", airportID, len(transferred))
+	}
 	return DeleteAutoSubscriptionNodes(airportID)
 }
 
@@ -307,9 +332,53 @@ func (a *Airport) UpdateUsageInfo(upload, download, total, expire int64) error {
 		cached.UsageExpire = expire
 		airportCache.Set(a.ID, cached)
 	}
+	// 记录用量快照（-1 表示机场不支持用量信息，不记录）
+	if total > 0 {
+		if err := RecordAirportUsageSnapshot(a.ID, upload, download, total, expire); err != nil {
+			utils.Warn("记录机场用量快照失败 ID: %d: %v", a.ID, err)
+		}
+	}
 	return nil
 }
 
+// ParseAirportScriptIDs 解析逗号分隔的导入脚本ID列表，并校验脚本是否存在
+func ParseAirportScriptIDs(raw string) ([]int, error) {
+	ids := make([]int, 0)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("脚本ID格式错误: %s", part)
+		}
+		if _, err := GetScriptByID(id); err != nil {
+			return nil, fmt.Errorf("脚本不存在: %d", id)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// GetImportScripts 获取机场配置的导入脚本（按配置顺序），已删除的脚本会被跳过
+func (a *Airport) GetImportScripts() []Script {
+	scripts := make([]Script, 0)
+	for _, part := range strings.Split(a.ScriptIDs, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		script, err := GetScriptByID(id)
+		if err != nil {
+			utils.Warn("机场【%s】导入脚本 %d 不存在，已跳过", a.Name, id)
+			continue
+		}
+		scripts = append(scripts, *script)
+	}
+	return scripts
+}
+
 // containsIgnoreCase 忽略大小写的字符串包含检查
 func containsIgnoreCase(s, substr string) bool {
 	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
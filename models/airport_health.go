@@ -0,0 +1,251 @@
+package models
+
+import (
+	"sort"
+	"sublink/database"
+	"time"
+)
+
+// airportHealthRetentionDays 机场健康记录保留天数
+const airportHealthRetentionDays = 90
+
+// AirportPullLog 机场拉取记录
+// 每次拉取订阅（无论成功失败）记录一条，用于统计拉取成功率和节点数量变化
+type AirportPullLog struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	AirportID int       `gorm:"index" json:"airportId"`                // 关联的机场ID
+	Success   bool      `json:"success"`                               // 是否拉取成功
+	NodeCount int       `json:"nodeCount"`                             // 拉取后的节点数量
+	Duration  int64     `json:"duration"`                              // 耗时（毫秒）
+	Error     string    `gorm:"size:512" json:"error"`                 // 失败原因
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"createdAt"` // 拉取时间
+}
+
+// TableName 指定表名
+func (AirportPullLog) TableName() string {
+	return "airport_pull_logs"
+}
+
+// AirportQualitySnapshot 机场节点质量快照
+// 每次节点检测完成后按机场记录一条，用于统计节点质量随时间的变化
+type AirportQualitySnapshot struct {
+	ID             int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	AirportID      int       `gorm:"index" json:"airportId"`                // 关联的机场ID
+	NodeCount      int       `json:"nodeCount"`                             // 节点总数
+	DelayPassCount int       `json:"delayPassCount"`                        // 延迟检测通过数量
+	SpeedPassCount int       `json:"speedPassCount"`                        // 速度检测通过数量
+	MedianDelay    int       `json:"medianDelay"`                           // 延迟中位数(ms)
+	CountryCount   int       `json:"countryCount"`                          // 落地国家数量
+	CreatedAt      time.Time `gorm:"autoCreateTime;index" json:"createdAt"` // 快照时间
+}
+
+// TableName 指定表名
+func (AirportQualitySnapshot) TableName() string {
+	return "airport_quality_snapshots"
+}
+
+// AirportHealth 机场健康度汇总
+type AirportHealth struct {
+	AirportID     int      `json:"airportId"`
+	AirportName   string   `json:"airportName"`
+	Days          int      `json:"days"`          // 统计天数
+	PullTotal     int      `json:"pullTotal"`     // 拉取总次数
+	PullSuccess   int      `json:"pullSuccess"`   // 拉取成功次数
+	PullFailed    int      `json:"pullFailed"`    // 拉取失败次数
+	SuccessRate   float64  `json:"successRate"`   // 拉取成功率 (0-1)
+	AvgNodeCount  float64  `json:"avgNodeCount"`  // 平均节点数量（成功拉取）
+	DelayPassRate float64  `json:"delayPassRate"` // 延迟检测通过率 (0-1)，按质量快照平均
+	SpeedPassRate float64  `json:"speedPassRate"` // 速度检测通过率 (0-1)，按质量快照平均
+	MedianDelay   int      `json:"medianDelay"`   // 当前节点延迟中位数(ms)
+	Countries     []string `json:"countries"`     // 当前节点的落地国家（去重）
+	LastError     string   `json:"lastError"`     // 最近一次失败原因
+	LastFailAt    *int64   `json:"lastFailAt"`    // 最近一次失败时间（Unix时间戳）
+}
+
+// RecordAirportPull 记录一次机场拉取结果
+func RecordAirportPull(airportID int, success bool, duration time.Duration, errMsg string) error {
+	log := AirportPullLog{
+		AirportID: airportID,
+		Success:   success,
+		Duration:  duration.Milliseconds(),
+		Error:     truncateString(errMsg, 512),
+	}
+	if success {
+		if nodes, err := ListBySourceID(airportID); err == nil {
+			log.NodeCount = len(nodes)
+		}
+	}
+	if err := database.DB.Create(&log).Error; err != nil {
+		return err
+	}
+	before := time.Now().AddDate(0, 0, -airportHealthRetentionDays)
+	return database.DB.Where("airport_id = ? AND created_at < ?", airportID, before).Delete(&AirportPullLog{}).Error
+}
+
+// RecordAirportQualitySnapshots 为给定节点所属的机场记录质量快照
+// 节点检测完成后调用，统计的是机场当前全部节点而非仅本次检测的节点
+func RecordAirportQualitySnapshots(nodes []Node) {
+	airportIDs := make(map[int]bool)
+	for _, n := range nodes {
+		if n.Source != "manual" && n.SourceID > 0 {
+			airportIDs[n.SourceID] = true
+		}
+	}
+
+	before := time.Now().AddDate(0, 0, -airportHealthRetentionDays)
+	for id := range airportIDs {
+		if _, err := GetAirportByID(id); err != nil {
+			continue
+		}
+		airportNodes, err := ListBySourceID(id)
+		if err != nil || len(airportNodes) == 0 {
+			continue
+		}
+		stats := GetAirportNodeStats(id)
+		snapshot := AirportQualitySnapshot{
+			AirportID:      id,
+			NodeCount:      len(airportNodes),
+			DelayPassCount: stats.DelayPassCount,
+			SpeedPassCount: stats.SpeedPassCount,
+			MedianDelay:    medianNodeDelay(airportNodes),
+			CountryCount:   len(uniqueNodeCountries(airportNodes)),
+		}
+		if err := database.DB.Create(&snapshot).Error; err != nil {
+			continue
+		}
+		database.DB.Where("airport_id = ? AND created_at < ?", id, before).Delete(&AirportQualitySnapshot{})
+	}
+}
+
+// ListAirportPullLogs 获取机场指定时间之后的拉取记录（按时间倒序）
+func ListAirportPullLogs(airportID int, since time.Time) ([]AirportPullLog, error) {
+	var logs []AirportPullLog
+	err := database.DB.Where("airport_id = ? AND created_at >= ?", airportID, since).
+		Order("created_at DESC").Find(&logs).Error
+	return logs, err
+}
+
+// ListAirportQualitySnapshots 获取机场指定时间之后的质量快照（按时间升序）
+func ListAirportQualitySnapshots(airportID int, since time.Time) ([]AirportQualitySnapshot, error) {
+	var snapshots []AirportQualitySnapshot
+	err := database.DB.Where("airport_id = ? AND created_at >= ?", airportID, since).
+		Order("created_at ASC").Find(&snapshots).Error
+	return snapshots, err
+}
+
+// DeleteAirportHealthRecords 删除机场的所有拉取记录和质量快照
+func DeleteAirportHealthRecords(airportID int) error {
+	if err := database.DB.Where("airport_id = ?", airportID).Delete(&AirportPullLog{}).Error; err != nil {
+		return err
+	}
+	return database.DB.Where("airport_id = ?", airportID).Delete(&AirportQualitySnapshot{}).Error
+}
+
+// GetAirportHealth 获取机场最近 days 天的健康度汇总
+func GetAirportHealth(airport *Airport, days int) AirportHealth {
+	if days <= 0 {
+		days = 30
+	}
+	health := AirportHealth{
+		AirportID:   airport.ID,
+		AirportName: airport.Name,
+		Days:        days,
+		Countries:   []string{},
+	}
+	since := time.Now().AddDate(0, 0, -days)
+
+	// 拉取成功率与平均节点数
+	if logs, err := ListAirportPullLogs(airport.ID, since); err == nil {
+		var nodeCountSum int
+		for _, l := range logs {
+			health.PullTotal++
+			if l.Success {
+				health.PullSuccess++
+				nodeCountSum += l.NodeCount
+				continue
+			}
+			health.PullFailed++
+			// logs 按时间倒序，第一条失败记录即最近一次失败
+			if health.LastFailAt == nil {
+				failAt := l.CreatedAt.Unix()
+				health.LastFailAt = &failAt
+				health.LastError = l.Error
+			}
+		}
+		if health.PullTotal > 0 {
+			health.SuccessRate = float64(health.PullSuccess) / float64(health.PullTotal)
+		}
+		if health.PullSuccess > 0 {
+			health.AvgNodeCount = float64(nodeCountSum) / float64(health.PullSuccess)
+		}
+	}
+
+	// 节点检测通过率（各次快照通过率的平均值）
+	if snapshots, err := ListAirportQualitySnapshots(airport.ID, since); err == nil {
+		var delayRateSum, speedRateSum float64
+		var counted int
+		for _, s := range snapshots {
+			if s.NodeCount == 0 {
+				continue
+			}
+			delayRateSum += float64(s.DelayPassCount) / float64(s.NodeCount)
+			speedRateSum += float64(s.SpeedPassCount) / float64(s.NodeCount)
+			counted++
+		}
+		if counted > 0 {
+			health.DelayPassRate = delayRateSum / float64(counted)
+			health.SpeedPassRate = speedRateSum / float64(counted)
+		}
+	}
+
+	// 当前节点的延迟中位数与落地国家
+	if nodes, err := ListBySourceID(airport.ID); err == nil {
+		health.MedianDelay = medianNodeDelay(nodes)
+		health.Countries = uniqueNodeCountries(nodes)
+	}
+
+	return health
+}
+
+// medianNodeDelay 计算延迟检测通过节点的延迟中位数
+func medianNodeDelay(nodes []Node) int {
+	delays := make([]int, 0, len(nodes))
+	for _, n := range nodes {
+		if n.DelayStatus == "success" && n.DelayTime > 0 {
+			delays = append(delays, n.DelayTime)
+		}
+	}
+	if len(delays) == 0 {
+		return 0
+	}
+	sort.Ints(delays)
+	mid := len(delays) / 2
+	if len(delays)%2 == 0 {
+		return (delays[mid-1] + delays[mid]) / 2
+	}
+	return delays[mid]
+}
+
+// uniqueNodeCountries 获取节点的落地国家列表（去重、排序）
+func uniqueNodeCountries(nodes []Node) []string {
+	seen := make(map[string]bool)
+	countries := make([]string, 0)
+	for _, n := range nodes {
+		if n.LinkCountry == "" || seen[n.LinkCountry] {
+			continue
+		}
+		seen[n.LinkCountry] = true
+		countries = append(countries, n.LinkCountry)
+	}
+	sort.Strings(countries)
+	return countries
+}
+
+// truncateString 按字符数截断字符串
+func truncateString(s string, maxLen int) string {
+	runes := []rune(s)
+	if len(runes) > maxLen {
+		return string(runes[:maxLen])
+	}
+	return s
+}
@@ -0,0 +1,223 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sublink/config"
+	"sublink/utils"
+)
+
+// EncryptedString 数据库中加密存储的字符串
+// 写入时使用 APIEncryptionKey 加密，读取时自动解密，内存与接口中均为明文
+type EncryptedString string
+
+// Value 实现 driver.Valuer，写入数据库前加密
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	return utils.EncryptString(string(s), []byte(config.GetAPIEncryptionKey()))
+}
+
+// Scan 实现 sql.Scanner，从数据库读取后解密
+func (s *EncryptedString) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("不支持的加密字段类型: %T", value)
+	}
+	plain, err := utils.DecryptString(raw, []byte(config.GetAPIEncryptionKey()))
+	if err != nil {
+		// 密钥变更等原因导致无法解密时置空，避免整行记录读取失败
+		utils.Warn("加密字段解密失败，已忽略: %v", err)
+		*s = ""
+		return nil
+	}
+	*s = EncryptedString(plain)
+	return nil
+}
+
+// 登录 Token 提取方式
+const (
+	TokenFromJSON   = "json"   // 从 JSON 响应体按路径提取（如 data.token）
+	TokenFromHeader = "header" // 从响应头提取
+	TokenFromCookie = "cookie" // 从响应 Cookie 提取
+	TokenFromRegex  = "regex"  // 从响应体按正则提取（取第一个捕获组）
+)
+
+// 登录 Token 注入方式
+const (
+	TokenInjectHeader = "header" // 注入为请求头
+	TokenInjectQuery  = "query"  // 注入为 URL 查询参数
+	TokenInjectURL    = "url"    // 替换订阅地址中的 {token} 占位符
+)
+
+// AirportBasicAuth HTTP Basic 认证
+type AirportBasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// AirportLoginConfig 拉取前的登录流程配置
+// 先请求登录地址获取 Token，再将 Token 注入订阅请求
+// 登录响应设置的 Cookie 会通过 Cookie Jar 自动带入订阅请求
+type AirportLoginConfig struct {
+	URL          string            `json:"url"`          // 登录地址
+	Method       string            `json:"method"`       // 请求方法，默认 POST
+	Headers      map[string]string `json:"headers"`      // 登录请求头
+	ContentType  string            `json:"contentType"`  // 请求体类型，默认 application/json
+	Body         string            `json:"body"`         // 请求体
+	TokenFrom    string            `json:"tokenFrom"`    // Token 提取方式: json, header, cookie, regex；为空则仅依赖 Cookie
+	TokenKey     string            `json:"tokenKey"`     // JSON 路径 / 响应头名 / Cookie 名 / 正则表达式
+	InjectTo     string            `json:"injectTo"`     // Token 注入方式: header, query, url
+	InjectName   string            `json:"injectName"`   // 注入的请求头名或查询参数名
+	InjectFormat string            `json:"injectFormat"` // 注入格式，{token} 为占位符，默认 {token}
+}
+
+// AirportRequestConfig 机场拉取请求配置
+type AirportRequestConfig struct {
+	Headers   map[string]string   `json:"headers"`   // 自定义请求头
+	BasicAuth *AirportBasicAuth   `json:"basicAuth"` // HTTP Basic 认证
+	Cookies   string              `json:"cookies"`   // 初始 Cookie，格式 k1=v1; k2=v2
+	Login     *AirportLoginConfig `json:"login"`     // 登录流程
+}
+
+// ParseAirportRequestConfig 解析并校验机场请求配置 JSON
+// 空字符串返回 nil
+func ParseAirportRequestConfig(raw string) (*AirportRequestConfig, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var cfg AirportRequestConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return nil, fmt.Errorf("请求配置格式错误: %v", err)
+	}
+
+	if cfg.Login != nil {
+		login := cfg.Login
+		if login.URL == "" {
+			return nil, fmt.Errorf("登录地址不能为空")
+		}
+		switch login.TokenFrom {
+		case "", TokenFromJSON, TokenFromHeader, TokenFromCookie, TokenFromRegex:
+		default:
+			return nil, fmt.Errorf("不支持的 Token 提取方式: %s", login.TokenFrom)
+		}
+		if login.TokenFrom != "" {
+			if login.TokenKey == "" {
+				return nil, fmt.Errorf("Token 提取键不能为空")
+			}
+			switch login.InjectTo {
+			case TokenInjectHeader, TokenInjectQuery:
+				if login.InjectName == "" {
+					return nil, fmt.Errorf("Token 注入名称不能为空")
+				}
+			case TokenInjectURL:
+			default:
+				return nil, fmt.Errorf("不支持的 Token 注入方式: %s", login.InjectTo)
+			}
+		}
+	}
+
+	return &cfg, nil
+}
+
+// GetRequestConfig 获取机场的请求配置，未配置或解析失败时返回 nil
+func (a *Airport) GetRequestConfig() *AirportRequestConfig {
+	cfg, err := ParseAirportRequestConfig(string(a.RequestConfig))
+	if err != nil {
+		utils.Warn("机场【%s】请求配置解析失败: %v", a.Name, err)
+		return nil
+	}
+	return cfg
+}
+
+// AirportSecretMask 接口返回请求配置时替代敏感值的占位符，更新时收到占位符表示保留原值
+const AirportSecretMask = "******"
+
+// MaskedRequestConfig 返回隐藏敏感值（请求头值、Basic Auth 密码、Cookie、登录请求体和请求头值）后的请求配置 JSON
+func (a *Airport) MaskedRequestConfig() string {
+	cfg, err := ParseAirportRequestConfig(string(a.RequestConfig))
+	if err != nil || cfg == nil {
+		return ""
+	}
+	maskSecret := func(value *string) {
+		if *value != "" {
+			*value = AirportSecretMask
+		}
+	}
+	for key := range cfg.Headers {
+		value := cfg.Headers[key]
+		maskSecret(&value)
+		cfg.Headers[key] = value
+	}
+	if cfg.BasicAuth != nil {
+		maskSecret(&cfg.BasicAuth.Password)
+	}
+	maskSecret(&cfg.Cookies)
+	if cfg.Login != nil {
+		maskSecret(&cfg.Login.Body)
+		for key := range cfg.Login.Headers {
+			value := cfg.Login.Headers[key]
+			maskSecret(&value)
+			cfg.Login.Headers[key] = value
+		}
+	}
+	data, _ := json.Marshal(cfg)
+	return string(data)
+}
+
+// MergeAirportRequestConfig 合并提交的请求配置与已保存的请求配置：值为占位符的敏感字段使用已保存的原值
+func MergeAirportRequestConfig(submitted, stored string) (string, error) {
+	cfg, err := ParseAirportRequestConfig(submitted)
+	if err != nil || cfg == nil {
+		return submitted, err
+	}
+	old, _ := ParseAirportRequestConfig(stored)
+	if old == nil {
+		old = &AirportRequestConfig{}
+	}
+	restore := func(value *string, original string) {
+		if *value == AirportSecretMask {
+			*value = original
+		}
+	}
+	for key, value := range cfg.Headers {
+		restore(&value, old.Headers[key])
+		cfg.Headers[key] = value
+	}
+	if cfg.BasicAuth != nil {
+		original := ""
+		if old.BasicAuth != nil {
+			original = old.BasicAuth.Password
+		}
+		restore(&cfg.BasicAuth.Password, original)
+	}
+	restore(&cfg.Cookies, old.Cookies)
+	if cfg.Login != nil {
+		oldLogin := old.Login
+		if oldLogin == nil {
+			oldLogin = &AirportLoginConfig{}
+		}
+		restore(&cfg.Login.Body, oldLogin.Body)
+		for key, value := range cfg.Login.Headers {
+			restore(&value, oldLogin.Headers[key])
+			cfg.Login.Headers[key] = value
+		}
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
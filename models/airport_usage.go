@@ -0,0 +1,180 @@
+package models
+
+import (
+	"sort"
+	"sublink/database"
+	"time"
+)
+
+// airportUsageRetentionDays 用量快照保留天数
+const airportUsageRetentionDays = 180
+
+// AirportUsageSnapshot 机场用量快照
+// 每次刷新用量信息时记录一条，用于统计消耗趋势和预测流量耗尽时间
+type AirportUsageSnapshot struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	AirportID int       `gorm:"index" json:"airportId"`                // 关联的机场ID
+	Upload    int64     `json:"upload"`                                // 已上传流量（字节）
+	Download  int64     `json:"download"`                              // 已下载流量（字节）
+	Total     int64     `json:"total"`                                 // 总流量配额（字节）
+	Expire    int64     `json:"expire"`                                // 订阅过期时间（Unix时间戳）
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"createdAt"` // 快照时间
+}
+
+// TableName 指定表名
+func (AirportUsageSnapshot) TableName() string {
+	return "airport_usage_snapshots"
+}
+
+// Used 已使用流量（上传+下载）
+func (s AirportUsageSnapshot) Used() int64 {
+	return s.Upload + s.Download
+}
+
+// AirportUsageDaily 机场每日用量
+type AirportUsageDaily struct {
+	Date     string `json:"date"`     // 日期 (2006-01-02)
+	Used     int64  `json:"used"`     // 当日结束时的已用流量（字节）
+	Total    int64  `json:"total"`    // 当日结束时的总配额（字节）
+	Consumed int64  `json:"consumed"` // 当日消耗流量（字节）
+}
+
+// AirportUsageForecast 机场流量耗尽预测
+type AirportUsageForecast struct {
+	DailyRate           int64   `json:"dailyRate"`           // 日均消耗（字节）
+	Remaining           int64   `json:"remaining"`           // 剩余流量（字节）
+	SampleDays          float64 `json:"sampleDays"`          // 参与计算的样本天数
+	ExhaustAt           int64   `json:"exhaustAt"`           // 预计耗尽时间（Unix时间戳，0 表示无法预测）
+	ExpireAt            int64   `json:"expireAt"`            // 订阅过期时间（Unix时间戳）
+	ExhaustBeforeExpire bool    `json:"exhaustBeforeExpire"` // 是否会在过期前耗尽
+}
+
+// RecordAirportUsageSnapshot 记录机场用量快照，并清理超出保留期的历史快照
+func RecordAirportUsageSnapshot(airportID int, upload, download, total, expire int64) error {
+	snapshot := AirportUsageSnapshot{
+		AirportID: airportID,
+		Upload:    upload,
+		Download:  download,
+		Total:     total,
+		Expire:    expire,
+	}
+	if err := database.DB.Create(&snapshot).Error; err != nil {
+		return err
+	}
+	before := time.Now().AddDate(0, 0, -airportUsageRetentionDays)
+	return database.DB.Where("airport_id = ? AND created_at < ?", airportID, before).Delete(&AirportUsageSnapshot{}).Error
+}
+
+// ListAirportUsageSnapshots 获取机场指定时间之后的用量快照（按时间升序）
+func ListAirportUsageSnapshots(airportID int, since time.Time) ([]AirportUsageSnapshot, error) {
+	var snapshots []AirportUsageSnapshot
+	err := database.DB.Where("airport_id = ? AND created_at >= ?", airportID, since).
+		Order("created_at ASC").Find(&snapshots).Error
+	return snapshots, err
+}
+
+// DeleteAirportUsageSnapshots 删除机场的所有用量快照
+func DeleteAirportUsageSnapshots(airportID int) error {
+	return database.DB.Where("airport_id = ?", airportID).Delete(&AirportUsageSnapshot{}).Error
+}
+
+// usageDelta 计算两次快照之间的消耗量
+// 已用流量减少说明机场重置了流量，此时以当前已用流量作为消耗
+func usageDelta(prev, cur AirportUsageSnapshot) int64 {
+	delta := cur.Used() - prev.Used()
+	if delta < 0 {
+		return cur.Used()
+	}
+	return delta
+}
+
+// GetAirportUsageDaily 获取机场最近 days 天的每日消耗序列
+func GetAirportUsageDaily(airportID int, days int) ([]AirportUsageDaily, error) {
+	if days <= 0 {
+		days = 30
+	}
+	// 多取一天作为首日消耗的基准：从 days 天前的零点开始查询，共 days+1 个自然日
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	since := today.AddDate(0, 0, -days)
+	firstDate := today.AddDate(0, 0, -(days - 1)).Format("2006-01-02")
+	snapshots, err := ListAirportUsageSnapshots(airportID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	// 取每天最后一条快照
+	lastOfDay := make(map[string]AirportUsageSnapshot)
+	var dates []string
+	for _, s := range snapshots {
+		date := s.CreatedAt.Local().Format("2006-01-02")
+		if _, exists := lastOfDay[date]; !exists {
+			dates = append(dates, date)
+		}
+		lastOfDay[date] = s
+	}
+	sort.Strings(dates)
+
+	result := make([]AirportUsageDaily, 0, len(dates))
+	for i, date := range dates {
+		cur := lastOfDay[date]
+		daily := AirportUsageDaily{
+			Date:  date,
+			Used:  cur.Used(),
+			Total: cur.Total,
+		}
+		if i > 0 {
+			daily.Consumed = usageDelta(lastOfDay[dates[i-1]], cur)
+		}
+		result = append(result, daily)
+	}
+
+	// 多取的一天仅作为基准，不返回
+	for len(result) > 0 && result[0].Date < firstDate {
+		result = result[1:]
+	}
+	return result, nil
+}
+
+// GetAirportUsageForecast 根据最近 windowDays 天的快照预测机场流量耗尽时间
+func GetAirportUsageForecast(airport *Airport, windowDays int) AirportUsageForecast {
+	forecast := AirportUsageForecast{}
+	if airport == nil || airport.UsageTotal <= 0 {
+		return forecast
+	}
+	if windowDays <= 0 {
+		windowDays = 7
+	}
+
+	forecast.ExpireAt = airport.UsageExpire
+	forecast.Remaining = airport.UsageTotal - (airport.UsageUpload + airport.UsageDownload)
+	if forecast.Remaining < 0 {
+		forecast.Remaining = 0
+	}
+
+	snapshots, err := ListAirportUsageSnapshots(airport.ID, time.Now().AddDate(0, 0, -windowDays))
+	if err != nil || len(snapshots) < 2 {
+		return forecast
+	}
+
+	var consumed int64
+	for i := 1; i < len(snapshots); i++ {
+		consumed += usageDelta(snapshots[i-1], snapshots[i])
+	}
+	elapsed := snapshots[len(snapshots)-1].CreatedAt.Sub(snapshots[0].CreatedAt)
+	// 样本跨度不足1小时，数据不具备参考价值
+	if elapsed < time.Hour {
+		return forecast
+	}
+
+	forecast.SampleDays = elapsed.Hours() / 24
+	forecast.DailyRate = int64(float64(consumed) / forecast.SampleDays)
+	if forecast.DailyRate <= 0 {
+		return forecast
+	}
+
+	daysLeft := float64(forecast.Remaining) / float64(forecast.DailyRate)
+	forecast.ExhaustAt = time.Now().Unix() + int64(daysLeft*86400)
+	forecast.ExhaustBeforeExpire = forecast.ExpireAt > 0 && forecast.ExhaustAt < forecast.ExpireAt
+	return forecast
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sublink/node/protocol"
+	"sublink/utils"
+)
+
+// AutoGroupConfig 自动代理组规则配置
+// 按字段将订阅节点分组，每组生成一个测速/故障转移/负载均衡代理组，输出到 Clash 和 Surge 配置
+type AutoGroupConfig struct {
+	GroupBy    string `json:"groupBy"`            // 分组方式：country（默认）、tag_group、source、protocol、group
+	TagGroup   string `json:"tagGroup"`           // GroupBy 为 tag_group 时使用的标签组
+	Type       string `json:"type"`               // 代理组类型：url-test（默认）、fallback、load-balance
+	NameFormat string `json:"nameFormat"`         // 代理组名称格式，{name} 为分组名称，{flag} 为国旗（仅按国家分组），{count} 为节点数量
+	URL        string `json:"url"`                // 测速 URL
+	Interval   int    `json:"interval"`           // 测速间隔（秒）
+	Tolerance  int    `json:"tolerance"`          // 容差（毫秒），仅 url-test
+	Strategy   string `json:"strategy,omitempty"` // 负载均衡策略，仅 load-balance
+	MinNodes   int    `json:"minNodes"`           // 节点数少于该值的分组不生成代理组，默认 1
+}
+
+// ParseAutoGroupRule 解析订阅的自动代理组规则
+func ParseAutoGroupRule(rule string) (*AutoGroupConfig, error) {
+	var config AutoGroupConfig
+	if err := json.Unmarshal([]byte(rule), &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// AutoProxyGroups 按自动代理组规则生成 client（clash / surge）输出的代理组，nodeNameMap 为节点在输出中的最终名称
+// 与 reserved（链式代理规则生成的代理组）、templateGroups（模板中的代理组）或节点同名的分组不生成，分组按节点首次出现的顺序排列
+// Surge 输出时跳过不支持的协议，避免生成没有可用节点的代理组
+func (sub *Subcription) AutoProxyGroups(client string, nodeNameMap map[int]string, reserved []protocol.CustomProxyGroup, templateGroups []string) []protocol.CustomProxyGroup {
+	if sub.AutoGroupRule == "" || len(sub.Nodes) == 0 {
+		return nil
+	}
+	config, err := ParseAutoGroupRule(sub.AutoGroupRule)
+	if err != nil {
+		utils.Warn("解析自动代理组规则失败: %v", err)
+		return nil
+	}
+
+	groupBy := config.GroupBy
+	if groupBy == "" {
+		groupBy = SelectionGroupByCountry
+	}
+	selection := SelectionConfig{GroupBy: groupBy, TagGroup: config.TagGroup}
+	tagGroupTags := selection.tagGroupTags()
+
+	var order []string
+	members := make(map[string][]string)
+	for i := range sub.Nodes {
+		key := selection.partitionKey(&sub.Nodes[i], tagGroupTags)
+		name, ok := nodeNameMap[sub.Nodes[i].ID]
+		if key == "" || !ok {
+			continue
+		}
+		if client == ChainClientSurge && !protocol.IsSurgeSupportedLink(sub.Nodes[i].Link) {
+			continue
+		}
+		if _, exists := members[key]; !exists {
+			order = append(order, key)
+		}
+		members[key] = append(members[key], name)
+	}
+
+	used := make(map[string]bool, len(reserved)+len(templateGroups)+len(nodeNameMap))
+	for _, g := range reserved {
+		used[g.Name] = true
+	}
+	for _, name := range templateGroups {
+		used[name] = true
+	}
+	for _, name := range nodeNameMap {
+		used[name] = true
+	}
+
+	groups := make([]protocol.CustomProxyGroup, 0, len(order))
+	for _, key := range order {
+		proxies := members[key]
+		if len(proxies) < config.MinNodes {
+			continue
+		}
+		name := config.groupName(key, groupBy, len(proxies))
+		if used[name] {
+			utils.Warn("自动代理组【%s】与已有代理组或节点同名，已跳过", name)
+			continue
+		}
+		used[name] = true
+		groups = append(groups, protocol.CustomProxyGroup{
+			Name:      name,
+			Type:      config.groupType(),
+			Proxies:   proxies,
+			URL:       config.URL,
+			Interval:  config.Interval,
+			Tolerance: config.Tolerance,
+			Strategy:  config.Strategy,
+		})
+	}
+	return groups
+}
+
+// groupType 代理组类型，不支持的类型按 url-test 处理
+func (c *AutoGroupConfig) groupType() string {
+	switch c.Type {
+	case "fallback", "load-balance":
+		return c.Type
+	}
+	return "url-test"
+}
+
+// groupName 按名称格式生成代理组名称
+func (c *AutoGroupConfig) groupName(key, groupBy string, count int) string {
+	format := c.NameFormat
+	if format == "" {
+		format = "{name}"
+		if groupBy == SelectionGroupByCountry {
+			format = "{flag} {name}"
+		}
+	}
+	flag := ""
+	if groupBy == SelectionGroupByCountry {
+		flag = utils.ISOToFlag(key)
+	}
+	name := strings.NewReplacer("{name}", key, "{flag}", flag, "{count}", strconv.Itoa(count)).Replace(format)
+	return strings.TrimSpace(name)
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"reflect"
+	"sublink/node/protocol"
+	"testing"
+)
+
+// TestAutoProxyGroupsSkipsExistingNames 测试与模板代理组、链式代理组或节点同名的自动代理组不生成
+func TestAutoProxyGroupsSkipsExistingNames(t *testing.T) {
+	sub := &Subcription{
+		AutoGroupRule: `{"groupBy":"country","nameFormat":"{name}"}`,
+		Nodes: []Node{
+			{ID: 1, Link: "ss://hk1", LinkCountry: "HK"},
+			{ID: 2, Link: "ss://jp1", LinkCountry: "JP"},
+			{ID: 3, Link: "ss://us1", LinkCountry: "US"},
+			{ID: 4, Link: "ss://sg1", LinkCountry: "SG"},
+			{ID: 5, Link: "ss://hk2", LinkCountry: "HK"},
+		},
+	}
+	nodeNameMap := map[int]string{1: "香港01", 2: "日本01", 3: "美国01", 4: "SG", 5: "香港02"}
+	reserved := []protocol.CustomProxyGroup{{Name: "US", Type: "select"}}
+
+	groups := sub.AutoProxyGroups(ChainClientClash, nodeNameMap, reserved, []string{"节点选择", "JP"})
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+	if want := []string{"HK"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("代理组 = %v, want %v", names, want)
+	}
+	if want := []string{"香港01", "香港02"}; !reflect.DeepEqual(groups[0].Proxies, want) {
+		t.Errorf("代理组节点 = %v, want %v", groups[0].Proxies, want)
+	}
+}
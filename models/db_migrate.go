@@ -93,6 +93,11 @@ func RunMigrations() {
 	} else {
 		utils.Info("数据表SubcriptionScript创建成功")
 	}
+	if err := db.AutoMigrate(&SubcriptionInclude{}); err != nil {
+		utils.Error("基础数据表SubcriptionInclude迁移失败: %v", err)
+	} else {
+		utils.Info("数据表SubcriptionInclude创建成功")
+	}
 	if err := db.AutoMigrate(&Template{}); err != nil {
 		utils.Error("基础数据表Template迁移失败: %v", err)
 	} else {
@@ -148,6 +153,66 @@ func RunMigrations() {
 	} else {
 		utils.Info("数据表NodeCheckProfile创建成功")
 	}
+	if err := db.AutoMigrate(&AirportUsageSnapshot{}); err != nil {
+		utils.Error("基础数据表AirportUsageSnapshot迁移失败: %v", err)
+	} else {
+		utils.Info("数据表AirportUsageSnapshot创建成功")
+	}
+	if err := db.AutoMigrate(&AirportPullLog{}); err != nil {
+		utils.Error("基础数据表AirportPullLog迁移失败: %v", err)
+	} else {
+		utils.Info("数据表AirportPullLog创建成功")
+	}
+	if err := db.AutoMigrate(&AirportQualitySnapshot{}); err != nil {
+		utils.Error("基础数据表AirportQualitySnapshot迁移失败: %v", err)
+	} else {
+		utils.Info("数据表AirportQualitySnapshot创建成功")
+	}
+	if err := db.AutoMigrate(&NodeSource{}); err != nil {
+		utils.Error("基础数据表NodeSource迁移失败: %v", err)
+	} else {
+		utils.Info("数据表NodeSource创建成功")
+	}
+	if err := db.AutoMigrate(&ScriptKV{}); err != nil {
+		utils.Error("基础数据表ScriptKV迁移失败: %v", err)
+	} else {
+		utils.Info("数据表ScriptKV创建成功")
+	}
+	if err := db.AutoMigrate(&ScriptFixture{}); err != nil {
+		utils.Error("基础数据表ScriptFixture迁移失败: %v", err)
+	} else {
+		utils.Info("数据表ScriptFixture创建成功")
+	}
+	if err := db.AutoMigrate(&ScriptVersion{}); err != nil {
+		utils.Error("基础数据表ScriptVersion迁移失败: %v", err)
+	} else {
+		utils.Info("数据表ScriptVersion创建成功")
+	}
+	if err := db.AutoMigrate(&SubscriptionChainCheck{}); err != nil {
+		utils.Error("基础数据表SubscriptionChainCheck迁移失败: %v", err)
+	} else {
+		utils.Info("数据表SubscriptionChainCheck创建成功")
+	}
+	if err := db.AutoMigrate(&RuleSet{}); err != nil {
+		utils.Error("基础数据表RuleSet迁移失败: %v", err)
+	} else {
+		utils.Info("数据表RuleSet创建成功")
+	}
+	if err := db.AutoMigrate(&TemplateRevision{}); err != nil {
+		utils.Error("基础数据表TemplateRevision迁移失败: %v", err)
+	} else {
+		utils.Info("数据表TemplateRevision创建成功")
+	}
+	if err := db.AutoMigrate(&SubscriptionSnapshot{}); err != nil {
+		utils.Error("基础数据表SubscriptionSnapshot迁移失败: %v", err)
+	} else {
+		utils.Info("数据表SubscriptionSnapshot创建成功")
+	}
+	if err := db.AutoMigrate(&SubscriptionLastGood{}); err != nil {
+		utils.Error("基础数据表SubscriptionLastGood迁移失败: %v", err)
+	} else {
+		utils.Info("数据表SubscriptionLastGood创建成功")
+	}
 
 	// 检查并删除 idx_name_id 索引
 	// 0000_drop_idx_name_id
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 重复节点保留策略
+const (
+	DedupKeepFirst        = "first"         // 保留先出现的节点（默认）
+	DedupKeepLowestDelay  = "lowest_delay"  // 保留延迟最低的节点
+	DedupKeepHighestSpeed = "highest_speed" // 保留速度最高的节点
+	DedupKeepLatestCheck  = "latest_check"  // 保留最近检测过的节点
+	DedupKeepSourceOrder  = "source_order"  // 按来源优先顺序保留
+	DedupKeepPreferredTag = "preferred_tag" // 按标签优先顺序保留
+)
+
+// DeduplicationDrop 去重时去掉的重复节点
+type DeduplicationDrop struct {
+	Name       string `json:"Name"`       // 被去掉的节点名称
+	Source     string `json:"Source"`     // 被去掉的节点来源
+	KeptName   string `json:"KeptName"`   // 保留的节点名称
+	KeptSource string `json:"KeptSource"` // 保留的节点来源
+	Key        string `json:"Key"`        // 去重Key
+	Reason     string `json:"Reason"`     // 保留原因
+	Index      int    `json:"-"`          // 被去掉的节点在去重前列表中的下标
+}
+
+// airportDeduplicationDrops 各机场最近一次拉取时高级去重去掉的节点（机场ID -> []DeduplicationDrop）
+var airportDeduplicationDrops sync.Map
+
+// SetAirportDeduplicationDrops 记录机场最近一次拉取时去重去掉的节点
+func SetAirportDeduplicationDrops(airportID int, drops []DeduplicationDrop) {
+	if len(drops) == 0 {
+		airportDeduplicationDrops.Delete(airportID)
+		return
+	}
+	airportDeduplicationDrops.Store(airportID, drops)
+}
+
+// AirportDeduplicationDropsForNodes 获取提供这些节点的机场最近一次拉取时去重去掉的节点
+func AirportDeduplicationDropsForNodes(nodes []Node) []DeduplicationDrop {
+	seen := make(map[int]bool)
+	var result []DeduplicationDrop
+	for _, node := range nodes {
+		if node.SourceID <= 0 || node.Source == "manual" || seen[node.SourceID] {
+			continue
+		}
+		seen[node.SourceID] = true
+		if drops, ok := airportDeduplicationDrops.Load(node.SourceID); ok {
+			result = append(result, drops.([]DeduplicationDrop)...)
+		}
+	}
+	return result
+}
+
+// SelectDuplicates 按去重Key分组，每组按保留策略选出一个节点
+// keys[i] 为空表示该节点不参与去重；返回保留节点在 nodes 中的下标（保留节点占据该组首次出现的位置）以及被去掉的节点
+// 各项质量相同时保留先出现的节点
+func (c *DeduplicationConfig) SelectDuplicates(nodes []Node, keys []string) ([]int, []DeduplicationDrop) {
+	kept := make([]int, 0, len(nodes))
+	position := make(map[string]int)  // 去重Key -> 在 kept 中的位置
+	members := make(map[string][]int) // 去重Key -> 组内全部节点下标
+	var order []string                // 出现重复的Key，按首次出现顺序
+
+	for i, key := range keys {
+		if key == "" {
+			kept = append(kept, i)
+			continue
+		}
+		pos, exists := position[key]
+		if !exists {
+			position[key] = len(kept)
+			kept = append(kept, i)
+			members[key] = []int{i}
+			continue
+		}
+		if len(members[key]) == 1 {
+			order = append(order, key)
+		}
+		members[key] = append(members[key], i)
+		if c.compareDuplicate(&nodes[i], &nodes[kept[pos]]) < 0 {
+			kept[pos] = i
+		}
+	}
+
+	var drops []DeduplicationDrop
+	for _, key := range order {
+		winner := &nodes[kept[position[key]]]
+		for _, idx := range members[key] {
+			if idx == kept[position[key]] {
+				continue
+			}
+			loser := &nodes[idx]
+			drops = append(drops, DeduplicationDrop{
+				Name:       loser.Name,
+				Source:     loser.Source,
+				KeptName:   winner.Name,
+				KeptSource: winner.Source,
+				Key:        key,
+				Reason:     c.keepReason(winner, loser),
+				Index:      idx,
+			})
+		}
+	}
+	return kept, drops
+}
+
+// compareDuplicate 按保留策略比较两个重复节点，a 更优时返回负数，b 更优时返回正数，相同返回 0
+func (c *DeduplicationConfig) compareDuplicate(a, b *Node) int {
+	switch c.KeepStrategy {
+	case DedupKeepLowestDelay:
+		return compareRank(nodeDelayRank(a), nodeDelayRank(b))
+	case DedupKeepHighestSpeed:
+		return compareRank(-nodeSpeedRank(a), -nodeSpeedRank(b))
+	case DedupKeepLatestCheck:
+		return -strings.Compare(dedupLastCheck(a), dedupLastCheck(b))
+	case DedupKeepSourceOrder:
+		return compareRank(float64(c.sourceRank(a)), float64(c.sourceRank(b)))
+	case DedupKeepPreferredTag:
+		return compareRank(float64(c.tagRank(a)), float64(c.tagRank(b)))
+	}
+	return 0
+}
+
+// keepReason 说明保留 winner 而去掉 loser 的原因
+func (c *DeduplicationConfig) keepReason(winner, loser *Node) string {
+	if c.compareDuplicate(winner, loser) == 0 {
+		if c.KeepStrategy == "" || c.KeepStrategy == DedupKeepFirst {
+			return fmt.Sprintf("与【%s】重复，保留先出现的节点", winner.Name)
+		}
+		return fmt.Sprintf("与【%s】重复且质量相同，保留先出现的节点", winner.Name)
+	}
+	switch c.KeepStrategy {
+	case DedupKeepLowestDelay:
+		return fmt.Sprintf("与【%s】重复，保留延迟更低的节点（%s / %s）", winner.Name, dedupDelayLabel(winner), dedupDelayLabel(loser))
+	case DedupKeepHighestSpeed:
+		return fmt.Sprintf("与【%s】重复，保留速度更高的节点（%s / %s）", winner.Name, dedupSpeedLabel(winner), dedupSpeedLabel(loser))
+	case DedupKeepLatestCheck:
+		return fmt.Sprintf("与【%s】重复，保留最近检测的节点（%s / %s）", winner.Name, dedupCheckLabel(winner), dedupCheckLabel(loser))
+	case DedupKeepSourceOrder:
+		return fmt.Sprintf("与【%s】重复，来源【%s】优先于【%s】", winner.Name, winner.Source, loser.Source)
+	case DedupKeepPreferredTag:
+		return fmt.Sprintf("与【%s】重复，保留带有优先标签的节点", winner.Name)
+	}
+	return fmt.Sprintf("与【%s】重复", winner.Name)
+}
+
+// sourceRank 节点来源在优先顺序中的位置，未列出的来源排在最后
+func (c *DeduplicationConfig) sourceRank(node *Node) int {
+	for i, source := range c.PreferredSources {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		if source == node.Source || (node.SourceID > 0 && source == strconv.Itoa(node.SourceID)) {
+			return i
+		}
+	}
+	return len(c.PreferredSources)
+}
+
+// tagRank 节点最优先的标签在优先顺序中的位置，没有优先标签时排在最后
+func (c *DeduplicationConfig) tagRank(node *Node) int {
+	for i, tag := range c.PreferredTags {
+		if tag = strings.TrimSpace(tag); tag != "" && node.HasTagName(tag) {
+			return i
+		}
+	}
+	return len(c.PreferredTags)
+}
+
+// compareRank 比较两个排名值，值越小越优先
+func compareRank(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// nodeDelayRank 延迟排名值，未测试或测试失败的节点排在所有可用节点之后
+func nodeDelayRank(node *Node) float64 {
+	if node.DelayStatus == "success" && node.DelayTime > 0 {
+		return float64(node.DelayTime)
+	}
+	if node.DelayStatus == "" || node.DelayStatus == "untested" {
+		return 1 << 30
+	}
+	return 1 << 31
+}
+
+// nodeSpeedRank 速度排名值，测速失败视为 0
+func nodeSpeedRank(node *Node) float64 {
+	if node.SpeedStatus == "success" && node.Speed > 0 {
+		return node.Speed
+	}
+	return 0
+}
+
+// dedupLastCheck 最近一次延迟测试或测速的时间（格式 2006-01-02 15:04:05，可直接按字符串比较）
+func dedupLastCheck(node *Node) string {
+	if node.SpeedCheckAt > node.LatencyCheckAt {
+		return node.SpeedCheckAt
+	}
+	return node.LatencyCheckAt
+}
+
+func dedupDelayLabel(node *Node) string {
+	switch {
+	case node.DelayStatus == "success" && node.DelayTime > 0:
+		return fmt.Sprintf("%dms", node.DelayTime)
+	case node.DelayStatus == "timeout":
+		return "超时"
+	case node.DelayStatus == "error":
+		return "失败"
+	}
+	return "未测试"
+}
+
+func dedupSpeedLabel(node *Node) string {
+	if node.SpeedStatus == "success" && node.Speed > 0 {
+		return fmt.Sprintf("%.2fMB/s", node.Speed)
+	}
+	if node.SpeedStatus == "" || node.SpeedStatus == "untested" {
+		return "未测速"
+	}
+	return "测速失败"
+}
+
+func dedupCheckLabel(node *Node) string {
+	if t := dedupLastCheck(node); t != "" {
+		return t
+	}
+	return "未检测"
+}
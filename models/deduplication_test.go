@@ -0,0 +1,99 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSelectDuplicatesKeepStrategy 测试各保留策略选出质量最好的重复节点
+func TestSelectDuplicatesKeepStrategy(t *testing.T) {
+	nodes := []Node{
+		{Name: "A1", Source: "机场A", DelayStatus: "timeout", SpeedStatus: "error", LatencyCheckAt: "2026-01-01 10:00:00"},
+		{Name: "B1", Source: "机场B", DelayStatus: "success", DelayTime: 80, SpeedStatus: "success", Speed: 5, LatencyCheckAt: "2026-01-02 10:00:00", Tags: "家宽"},
+		{Name: "C1", Source: "机场C", DelayStatus: "success", DelayTime: 120, SpeedStatus: "success", Speed: 12, SpeedCheckAt: "2026-01-03 10:00:00"},
+		{Name: "独立", Source: "机场A"},
+	}
+	keys := []string{"k", "k", "k", ""}
+
+	cases := []struct {
+		name   string
+		config DeduplicationConfig
+		kept   []int
+	}{
+		{"默认保留先出现的节点", DeduplicationConfig{}, []int{0, 3}},
+		{"延迟最低", DeduplicationConfig{KeepStrategy: DedupKeepLowestDelay}, []int{1, 3}},
+		{"速度最高", DeduplicationConfig{KeepStrategy: DedupKeepHighestSpeed}, []int{2, 3}},
+		{"最近检测", DeduplicationConfig{KeepStrategy: DedupKeepLatestCheck}, []int{2, 3}},
+		{"来源顺序", DeduplicationConfig{KeepStrategy: DedupKeepSourceOrder, PreferredSources: []string{"机场C", "机场B"}}, []int{2, 3}},
+		{"优先标签", DeduplicationConfig{KeepStrategy: DedupKeepPreferredTag, PreferredTags: []string{"家宽"}}, []int{1, 3}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			kept, drops := tc.config.SelectDuplicates(nodes, keys)
+			if !reflect.DeepEqual(kept, tc.kept) {
+				t.Fatalf("保留 = %v, want %v", kept, tc.kept)
+			}
+			if len(drops) != 2 {
+				t.Fatalf("去掉的节点数 = %d, want 2", len(drops))
+			}
+			winner := nodes[tc.kept[0]].Name
+			for _, drop := range drops {
+				if drop.KeptName != winner || drop.Name == winner || drop.Key != "k" {
+					t.Errorf("去掉的节点记录错误: %+v", drop)
+				}
+				if !strings.Contains(drop.Reason, winner) {
+					t.Errorf("原因应包含保留的节点名称: %s", drop.Reason)
+				}
+			}
+		})
+	}
+}
+
+// TestSelectDuplicatesTies 测试质量相同时保留先出现的节点，且保留节点占据该组首次出现的位置
+func TestSelectDuplicatesTies(t *testing.T) {
+	nodes := []Node{
+		{Name: "X", DelayStatus: "success", DelayTime: 100},
+		{Name: "Y1", DelayStatus: "success", DelayTime: 50},
+		{Name: "X2", DelayStatus: "success", DelayTime: 100},
+		{Name: "Y2", DelayStatus: "success", DelayTime: 50},
+		{Name: "X3", DelayStatus: "success", DelayTime: 30},
+	}
+	keys := []string{"x", "y", "x", "y", "x"}
+	config := DeduplicationConfig{KeepStrategy: DedupKeepLowestDelay}
+
+	kept, drops := config.SelectDuplicates(nodes, keys)
+	// x 组保留延迟最低的 X3（位置在 x 首次出现处），y 组延迟相同保留先出现的 Y1
+	if want := []int{4, 1}; !reflect.DeepEqual(kept, want) {
+		t.Fatalf("保留 = %v, want %v", kept, want)
+	}
+	dropped := make(map[string]string)
+	for _, drop := range drops {
+		dropped[drop.Name] = drop.Reason
+	}
+	if len(dropped) != 3 || dropped["X"] == "" || dropped["X2"] == "" || dropped["Y2"] == "" {
+		t.Fatalf("去掉的节点 = %v", dropped)
+	}
+	if !strings.Contains(dropped["Y2"], "质量相同") {
+		t.Errorf("质量相同时应说明保留先出现的节点: %s", dropped["Y2"])
+	}
+	if !strings.Contains(dropped["X"], "延迟更低") {
+		t.Errorf("应说明保留延迟更低的节点: %s", dropped["X"])
+	}
+}
+
+// TestSelectDuplicatesUntestedOrder 测试未测试的节点优先于测试失败的节点，可用节点优先于两者
+func TestSelectDuplicatesUntestedOrder(t *testing.T) {
+	config := DeduplicationConfig{KeepStrategy: DedupKeepLowestDelay}
+	nodes := []Node{
+		{Name: "失败", DelayStatus: "timeout"},
+		{Name: "未测试", DelayStatus: "untested"},
+	}
+	if kept, _ := config.SelectDuplicates(nodes, []string{"k", "k"}); !reflect.DeepEqual(kept, []int{1}) {
+		t.Errorf("未测试的节点应优先于测试失败的节点: %v", kept)
+	}
+	nodes = append(nodes, Node{Name: "可用", DelayStatus: "success", DelayTime: 900})
+	if kept, _ := config.SelectDuplicates(nodes, []string{"k", "k", "k"}); !reflect.DeepEqual(kept, []int{2}) {
+		t.Errorf("可用节点应优先: %v", kept)
+	}
+}
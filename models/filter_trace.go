@@ -0,0 +1,113 @@
+package models
+
+import "fmt"
+
+// 过滤阶段
+const (
+	FilterStageSource        = "source"        // 合并节点来源
+	FilterStageDelaySpeed    = "delay_speed"   // 延迟、速度过滤
+	FilterStageCountry       = "country"       // 国家黑白名单
+	FilterStageTag           = "tag"           // 标签黑白名单
+	FilterStageNodeName      = "node_name"     // 节点名称黑白名单
+	FilterStageProtocol      = "protocol"      // 协议黑白名单
+	FilterStageTime          = "time"          // 时间窗口规则
+	FilterStageDeduplication = "deduplication" // 去重规则
+	FilterStageSelection     = "selection"     // 分组精选
+	FilterStageScript        = "script"        // 节点过滤脚本
+	FilterStageInclude       = "include"       // 子订阅内部排除
+)
+
+// FilterTrace 订阅过滤过程记录，用于在预览中解释节点被排除的原因
+// 只有设置了 sub.FilterTrace 时才记录，获取订阅时不产生额外开销
+type FilterTrace struct {
+	Stages   []FilterStageCount `json:"Stages"`   // 各阶段的节点数量变化
+	Excluded []ExcludedNode     `json:"Excluded"` // 被排除的节点及排除规则
+}
+
+// FilterStageCount 单个过滤阶段的节点数量变化
+type FilterStageCount struct {
+	Stage  string `json:"Stage"`  // 阶段标识
+	Name   string `json:"Name"`   // 阶段名称（脚本阶段为脚本名称）
+	Before int    `json:"Before"` // 处理前节点数
+	After  int    `json:"After"`  // 处理后节点数
+}
+
+// ExcludedNode 被排除的节点，Rule 为第一个排除该节点的规则
+type ExcludedNode struct {
+	ID          int    `json:"ID"`
+	Name        string `json:"Name"`
+	LinkName    string `json:"LinkName"`
+	LinkCountry string `json:"LinkCountry"`
+	Source      string `json:"Source"`
+	Stage       string `json:"Stage"` // 排除该节点的阶段
+	Rule        string `json:"Rule"`  // 排除原因
+}
+
+// NewFilterTrace 创建过滤过程记录
+func NewFilterTrace() *FilterTrace {
+	return &FilterTrace{Stages: []FilterStageCount{}, Excluded: []ExcludedNode{}}
+}
+
+// stage 记录一个阶段的节点数量变化
+func (t *FilterTrace) stage(stage, name string, before, after int) {
+	if t == nil {
+		return
+	}
+	t.Stages = append(t.Stages, FilterStageCount{Stage: stage, Name: name, Before: before, After: after})
+}
+
+// exclude 记录被排除的节点
+func (t *FilterTrace) exclude(node *Node, stage, rule string) {
+	if t == nil {
+		return
+	}
+	t.Excluded = append(t.Excluded, ExcludedNode{
+		ID:          node.ID,
+		Name:        node.Name,
+		LinkName:    node.LinkName,
+		LinkCountry: node.LinkCountry,
+		Source:      node.Source,
+		Stage:       stage,
+		Rule:        rule,
+	})
+}
+
+// RecordScript 记录节点过滤脚本的处理结果，脚本处理后不存在的节点视为被脚本移除
+// 节点按 ID 对应（脚本可能修改节点名称），没有 ID 的节点按名称对应
+func (t *FilterTrace) RecordScript(scriptName string, before, after []Node) {
+	if t == nil {
+		return
+	}
+	t.stage(FilterStageScript, scriptName, len(before), len(after))
+	remaining := make(map[string]int, len(after))
+	for i := range after {
+		remaining[filterTraceKey(&after[i])]++
+	}
+	for i := range before {
+		key := filterTraceKey(&before[i])
+		if remaining[key] > 0 {
+			remaining[key]--
+			continue
+		}
+		t.exclude(&before[i], FilterStageScript, fmt.Sprintf("被脚本【%s】移除", scriptName))
+	}
+}
+
+// recordInclude 记录子订阅内部排除的节点，原阶段和原因写入 Rule
+func (t *FilterTrace) recordInclude(childName string, child *FilterTrace) {
+	if t == nil || child == nil {
+		return
+	}
+	for _, excluded := range child.Excluded {
+		excluded.Rule = fmt.Sprintf("在子订阅【%s】中被排除（%s）：%s", childName, excluded.Stage, excluded.Rule)
+		excluded.Stage = FilterStageInclude
+		t.Excluded = append(t.Excluded, excluded)
+	}
+}
+
+func filterTraceKey(node *Node) string {
+	if node.ID > 0 {
+		return fmt.Sprintf("id:%d", node.ID)
+	}
+	return "name:" + node.Name
+}
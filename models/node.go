@@ -875,6 +875,10 @@ func (node *Node) Del() error {
 	if err := database.DB.Exec("DELETE FROM subcription_nodes WHERE node_id = ?", node.ID).Error; err != nil {
 		return err
 	}
+	// 清除节点的附加来源记录
+	if err := database.DB.Exec("DELETE FROM node_sources WHERE node_id = ?", node.ID).Error; err != nil {
+		return err
+	}
 	// Write-Through: 先删除数据库
 	err := database.DB.Delete(node).Error
 	if err != nil {
@@ -919,6 +923,9 @@ func DeleteAutoSubscriptionNodes(sourceId int) error {
 		if err := database.DB.Exec("DELETE FROM subcription_nodes WHERE node_id IN ?", nodeIDs).Error; err != nil {
 			return err
 		}
+		if err := database.DB.Exec("DELETE FROM node_sources WHERE node_id IN ?", nodeIDs).Error; err != nil {
+			return err
+		}
 	}
 
 	// Write-Through: 先删除数据库
@@ -947,6 +954,9 @@ func BatchDel(ids []int) error {
 			if err := tx.Exec("DELETE FROM subcription_nodes WHERE node_id IN ?", ids).Error; err != nil {
 				return err
 			}
+			if err := tx.Exec("DELETE FROM node_sources WHERE node_id IN ?", ids).Error; err != nil {
+				return err
+			}
 		}
 
 		// 删除节点
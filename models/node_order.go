@@ -0,0 +1,167 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sublink/utils"
+)
+
+// 输出排序的排序键
+const (
+	OrderKeyCountry  = "country"  // 按国家优先顺序
+	OrderKeyDelay    = "delay"    // 延迟从低到高
+	OrderKeySpeed    = "speed"    // 速度从高到低
+	OrderKeyName     = "name"     // 名称
+	OrderKeySource   = "source"   // 来源
+	OrderKeyProtocol = "protocol" // 协议
+)
+
+// OrderConfig 输出排序规则配置
+// 获取订阅时实时排序，不修改订阅中保存的节点排序；依次比较：置顶节点、客户端就近、各排序键，都相同时保持原有顺序
+type OrderConfig struct {
+	Keys            []string `json:"keys"`            // 排序键，按顺序依次比较
+	CountryPriority []string `json:"countryPriority"` // 国家优先顺序，未列出的国家排在后面
+	PinnedNodes     []int    `json:"pinnedNodes"`     // 置顶节点ID，按列表顺序排在最前
+	NearbyFirst     bool     `json:"nearbyFirst"`     // 按请求IP所在国家就近排序：同国家、同地区、其他
+}
+
+// ParseOrderRule 解析订阅的输出排序规则
+func ParseOrderRule(rule string) (*OrderConfig, error) {
+	var config OrderConfig
+	if err := json.Unmarshal([]byte(rule), &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// ApplyOrder 按输出排序规则对节点排序，就近排序使用 sub.ClientCountry（请求IP所在国家）
+func (sub *Subcription) ApplyOrder(nodes []Node) []Node {
+	if sub.OrderRule == "" || len(nodes) < 2 {
+		return nodes
+	}
+	config, err := ParseOrderRule(sub.OrderRule)
+	if err != nil {
+		utils.Warn("解析输出排序规则失败: %v", err)
+		return nodes
+	}
+	config.Sort(nodes, sub.ClientCountry)
+	return nodes
+}
+
+// Sort 按规则就地排序节点
+func (c *OrderConfig) Sort(nodes []Node, clientCountry string) {
+	pinned := make(map[int]int, len(c.PinnedNodes))
+	for i, id := range c.PinnedNodes {
+		if _, exists := pinned[id]; !exists {
+			pinned[id] = i
+		}
+	}
+	countries := make(map[string]int, len(c.CountryPriority))
+	for i, code := range c.CountryPriority {
+		code = normalizeCountryCode(code)
+		if _, exists := countries[code]; code != "" && !exists {
+			countries[code] = i
+		}
+	}
+	clientCountry = normalizeCountryCode(clientCountry)
+	nearby := c.NearbyFirst && clientCountry != ""
+
+	pinRank := func(node *Node) int {
+		if rank, ok := pinned[node.ID]; ok && node.ID > 0 {
+			return rank
+		}
+		return len(pinned)
+	}
+	countryRank := func(node *Node) int {
+		if rank, ok := countries[normalizeCountryCode(node.LinkCountry)]; ok {
+			return rank
+		}
+		return len(countries)
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := &nodes[i], &nodes[j]
+		if ra, rb := pinRank(a), pinRank(b); ra != rb {
+			return ra < rb
+		}
+		if nearby {
+			if ra, rb := countryDistance(clientCountry, a.LinkCountry), countryDistance(clientCountry, b.LinkCountry); ra != rb {
+				return ra < rb
+			}
+		}
+		for _, key := range c.Keys {
+			var cmp int
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case OrderKeyCountry:
+				cmp = compareRank(float64(countryRank(a)), float64(countryRank(b)))
+			case OrderKeyDelay:
+				cmp = compareRank(nodeDelayRank(a), nodeDelayRank(b))
+			case OrderKeySpeed:
+				cmp = compareRank(-nodeSpeedRank(a), -nodeSpeedRank(b))
+			case OrderKeyName:
+				cmp = strings.Compare(a.Name, b.Name)
+			case OrderKeySource:
+				cmp = strings.Compare(a.Source, b.Source)
+			case OrderKeyProtocol:
+				cmp = strings.Compare(strings.ToLower(a.Protocol), strings.ToLower(b.Protocol))
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+}
+
+// countryDistance 节点国家与客户端国家的距离：0 同国家，1 同地区，2 其他地区，3 节点国家未知
+func countryDistance(clientCountry, nodeCountry string) int {
+	nodeCountry = normalizeCountryCode(nodeCountry)
+	switch {
+	case nodeCountry == "":
+		return 3
+	case nodeCountry == clientCountry:
+		return 0
+	}
+	if region, ok := countryRegions[nodeCountry]; ok && region == countryRegions[clientCountry] {
+		return 1
+	}
+	return 2
+}
+
+func normalizeCountryCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "UK" {
+		return "GB"
+	}
+	return code
+}
+
+// countryRegions 国家代码所属地区，用于就近排序
+var countryRegions = map[string]string{
+	// 东亚
+	"CN": "east_asia", "HK": "east_asia", "MO": "east_asia", "TW": "east_asia", "JP": "east_asia", "KR": "east_asia", "MN": "east_asia",
+	// 东南亚
+	"SG": "southeast_asia", "MY": "southeast_asia", "TH": "southeast_asia", "VN": "southeast_asia", "PH": "southeast_asia",
+	"ID": "southeast_asia", "KH": "southeast_asia", "LA": "southeast_asia", "MM": "southeast_asia", "BN": "southeast_asia",
+	// 南亚
+	"IN": "south_asia", "PK": "south_asia", "BD": "south_asia", "LK": "south_asia", "NP": "south_asia",
+	// 中东
+	"AE": "middle_east", "SA": "middle_east", "IL": "middle_east", "TR": "middle_east", "QA": "middle_east", "IR": "middle_east",
+	"IQ": "middle_east", "JO": "middle_east", "KW": "middle_east", "BH": "middle_east", "OM": "middle_east",
+	// 欧洲
+	"GB": "europe", "IE": "europe", "DE": "europe", "FR": "europe", "NL": "europe", "BE": "europe", "LU": "europe", "CH": "europe",
+	"AT": "europe", "IT": "europe", "ES": "europe", "PT": "europe", "SE": "europe", "NO": "europe", "FI": "europe", "DK": "europe",
+	"IS": "europe", "PL": "europe", "CZ": "europe", "SK": "europe", "HU": "europe", "RO": "europe", "BG": "europe", "GR": "europe",
+	"HR": "europe", "SI": "europe", "RS": "europe", "EE": "europe", "LV": "europe", "LT": "europe", "MD": "europe", "CY": "europe",
+	// 俄罗斯及中亚
+	"RU": "cis", "UA": "cis", "BY": "cis", "KZ": "cis", "UZ": "cis", "KG": "cis", "GE": "cis", "AM": "cis", "AZ": "cis",
+	// 北美
+	"US": "north_america", "CA": "north_america", "MX": "north_america",
+	// 南美
+	"BR": "south_america", "AR": "south_america", "CL": "south_america", "CO": "south_america", "PE": "south_america",
+	// 大洋洲
+	"AU": "oceania", "NZ": "oceania",
+	// 非洲
+	"ZA": "africa", "EG": "africa", "NG": "africa", "KE": "africa", "MA": "africa",
+}
@@ -0,0 +1,206 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sublink/utils"
+)
+
+// 分组精选的分组方式
+const (
+	SelectionGroupByCountry  = "country"   // 按落地国家
+	SelectionGroupBySource   = "source"    // 按来源机场
+	SelectionGroupByProtocol = "protocol"  // 按协议
+	SelectionGroupByGroup    = "group"     // 按节点分组
+	SelectionGroupByTagGroup = "tag_group" // 按标签组中的标签（同组标签互斥）
+)
+
+// 分组精选的排序指标
+const (
+	SelectionMetricDelay     = "delay"     // 延迟从低到高
+	SelectionMetricSpeed     = "speed"     // 速度从高到低
+	SelectionMetricStability = "stability" // 稳定性从高到低
+)
+
+// SelectionConfig 分组精选规则配置
+// 按字段将节点分组，每组按指标保留前 TopN 个，再按总数上限轮流从各组选取，保证每个分组都有节点
+type SelectionConfig struct {
+	GroupBy  string `json:"groupBy"`  // 分组方式，为空时所有节点为一组
+	TagGroup string `json:"tagGroup"` // GroupBy 为 tag_group 时使用的标签组
+	TopN     int    `json:"topN"`     // 每组保留数量，0 表示不限制
+	Metric   string `json:"metric"`   // 排序指标，默认 delay
+	MaxTotal int    `json:"maxTotal"` // 节点总数上限，0 表示不限制
+}
+
+// ApplySelection 应用分组精选规则，保留的节点保持原有顺序
+func (sub *Subcription) ApplySelection(nodes []Node) []Node {
+	if sub.SelectionRule == "" || len(nodes) == 0 {
+		return nodes
+	}
+
+	var config SelectionConfig
+	if err := json.Unmarshal([]byte(sub.SelectionRule), &config); err != nil {
+		utils.Warn("解析分组精选规则失败: %v", err)
+		return nodes
+	}
+	if config.TopN <= 0 && config.MaxTotal <= 0 {
+		return nodes
+	}
+
+	result, dropped := config.Select(nodes)
+	for i := range nodes {
+		if reason, ok := dropped[i]; ok {
+			sub.FilterTrace.exclude(&nodes[i], FilterStageSelection, reason)
+		}
+	}
+	sub.FilterTrace.stage(FilterStageSelection, "分组精选", len(nodes), len(result))
+	utils.Info("分组精选: 原%d个 -> %d个", len(nodes), len(result))
+	return result
+}
+
+// Select 按规则选出节点，保留的节点保持原有顺序
+// 同时返回未入选节点的下标及原因
+func (c *SelectionConfig) Select(nodes []Node) ([]Node, map[int]string) {
+	// 按分组首次出现的顺序划分节点
+	var partitionOrder []string
+	partitions := make(map[string][]int)
+	tagGroupTags := c.tagGroupTags()
+	for i := range nodes {
+		key := c.partitionKey(&nodes[i], tagGroupTags)
+		if _, exists := partitions[key]; !exists {
+			partitionOrder = append(partitionOrder, key)
+		}
+		partitions[key] = append(partitions[key], i)
+	}
+
+	// 每组按指标排序并截取前 TopN 个，指标相同时保持原有顺序
+	dropped := make(map[int]string)
+	scores := c.scores(nodes)
+	for _, key := range partitionOrder {
+		members := partitions[key]
+		sort.SliceStable(members, func(i, j int) bool {
+			return scores[members[i]] < scores[members[j]]
+		})
+		if c.TopN > 0 && len(members) > c.TopN {
+			label := key
+			if label == "" {
+				label = "其他"
+			}
+			for rank, idx := range members[c.TopN:] {
+				dropped[idx] = fmt.Sprintf("分组【%s】内排名第 %d，超过每组保留数量 %d", label, c.TopN+rank+1, c.TopN)
+			}
+			members = members[:c.TopN]
+		}
+		partitions[key] = members
+	}
+
+	// 按排名轮流从各组选取，直到达到总数上限
+	selected := make(map[int]bool)
+	for rank := 0; ; rank++ {
+		picked := false
+		for _, key := range partitionOrder {
+			if c.MaxTotal > 0 && len(selected) >= c.MaxTotal {
+				break
+			}
+			if members := partitions[key]; rank < len(members) {
+				selected[members[rank]] = true
+				picked = true
+			}
+		}
+		if !picked || (c.MaxTotal > 0 && len(selected) >= c.MaxTotal) {
+			break
+		}
+	}
+
+	result := make([]Node, 0, len(selected))
+	for i, node := range nodes {
+		if selected[i] {
+			result = append(result, node)
+		} else if _, ok := dropped[i]; !ok {
+			dropped[i] = fmt.Sprintf("超过节点总数上限 %d", c.MaxTotal)
+		}
+	}
+	return result, dropped
+}
+
+// partitionKey 节点所属分组
+func (c *SelectionConfig) partitionKey(node *Node, tagGroupTags map[string]bool) string {
+	switch c.GroupBy {
+	case SelectionGroupByCountry:
+		return strings.ToUpper(node.LinkCountry)
+	case SelectionGroupBySource:
+		return node.Source
+	case SelectionGroupByProtocol:
+		if node.Protocol != "" {
+			return strings.ToLower(node.Protocol)
+		}
+		return utils.GetProtocolFromLink(node.Link)
+	case SelectionGroupByGroup:
+		return node.Group
+	case SelectionGroupByTagGroup:
+		for _, name := range node.GetTagNames() {
+			if tagGroupTags[name] {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// tagGroupTags 按标签组分组时，标签组下的全部标签
+func (c *SelectionConfig) tagGroupTags() map[string]bool {
+	tags := make(map[string]bool)
+	if c.GroupBy == SelectionGroupByTagGroup {
+		for _, name := range GetTagNamesByGroupName(c.TagGroup) {
+			tags[name] = true
+		}
+	}
+	return tags
+}
+
+// scores 计算每个节点的排名值，值越小越优先
+func (c *SelectionConfig) scores(nodes []Node) []float64 {
+	scores := make([]float64, len(nodes))
+	switch c.Metric {
+	case SelectionMetricSpeed:
+		for i := range nodes {
+			scores[i] = -nodeSpeedRank(&nodes[i])
+		}
+	case SelectionMetricStability:
+		healthScores := make(map[int]float64)
+		for i := range nodes {
+			scores[i] = -nodeStability(&nodes[i], healthScores)
+		}
+	default:
+		for i := range nodes {
+			scores[i] = nodeDelayRank(&nodes[i])
+		}
+	}
+	return scores
+}
+
+// nodeStability 节点稳定性评分 (0-1)
+// 节点最近一次延迟测试、测速的通过情况占 60%，来源机场近期的健康度占 40%；手动添加的节点只看自身检测结果
+// healthScores 缓存机场健康度评分，避免重复统计
+func nodeStability(node *Node, healthScores map[int]float64) float64 {
+	var own float64
+	if node.DelayStatus == "success" {
+		own += 0.5
+	}
+	if node.SpeedStatus == "success" {
+		own += 0.5
+	}
+	if node.Source == "manual" || node.SourceID <= 0 {
+		return own
+	}
+	health, ok := healthScores[node.SourceID]
+	if !ok {
+		if airport, err := GetAirportByID(node.SourceID); err == nil && airport != nil {
+			health = GetAirportHealthScore(airport)
+		}
+		healthScores[node.SourceID] = health
+	}
+	return own*0.6 + health*0.4
+}
@@ -0,0 +1,195 @@
+package models
+
+import (
+	"sublink/database"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// 跨机场重复节点处理策略（机场 DuplicatePolicy 字段）
+const (
+	DuplicatePolicyFirst     = "first"     // 保留先导入的节点，跳过其他机场的重复节点（默认）
+	DuplicatePolicyMerge     = "merge"     // 保留一条节点记录，并记录所有提供该节点的机场
+	DuplicatePolicyHealthier = "healthier" // 同 merge，且节点归属健康度更好的机场
+)
+
+// duplicatePolicyHealthDays 比较机场健康度时的统计天数
+const duplicatePolicyHealthDays = 7
+
+// duplicatePolicyHealthMargin 转移节点归属所需的最小健康度领先幅度
+// 健康度接近时保持当前归属，避免两个机场轮流拉取时节点来回转移
+const duplicatePolicyHealthMargin = 0.1
+
+// NodeSource 节点的附加来源机场
+// 多个机场提供相同内容（ContentHash 相同）的节点时只保留一条节点记录，
+// Node.SourceID 为主来源，其他同样提供该节点的机场记录在此表中
+// 主来源不再提供该节点时，节点转移给附加来源而不是被删除
+type NodeSource struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	NodeID    int       `gorm:"uniqueIndex:idx_node_source" json:"nodeId"`          // 节点ID
+	AirportID int       `gorm:"uniqueIndex:idx_node_source;index" json:"airportId"` // 附加来源机场ID
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// TableName 指定表名
+func (NodeSource) TableName() string {
+	return "node_sources"
+}
+
+// NodeSourceInfo 节点来源信息（用于展示）
+type NodeSourceInfo struct {
+	AirportID int    `json:"airportId"`
+	Name      string `json:"name"`
+	Primary   bool   `json:"primary"` // 是否为主来源
+}
+
+// IsValidDuplicatePolicy 检查重复节点策略是否有效
+func IsValidDuplicatePolicy(policy string) bool {
+	switch policy {
+	case "", DuplicatePolicyFirst, DuplicatePolicyMerge, DuplicatePolicyHealthier:
+		return true
+	}
+	return false
+}
+
+// AddNodeSource 为节点添加附加来源机场（已存在则忽略）
+func AddNodeSource(nodeID, airportID int) error {
+	return database.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&NodeSource{NodeID: nodeID, AirportID: airportID}).Error
+}
+
+// RemoveNodeSource 移除节点的附加来源机场
+func RemoveNodeSource(nodeID, airportID int) error {
+	return database.DB.Where("node_id = ? AND airport_id = ?", nodeID, airportID).Delete(&NodeSource{}).Error
+}
+
+// ListNodeSourcesByAirport 获取机场作为附加来源的所有记录
+func ListNodeSourcesByAirport(airportID int) ([]NodeSource, error) {
+	var sources []NodeSource
+	err := database.DB.Where("airport_id = ?", airportID).Find(&sources).Error
+	return sources, err
+}
+
+// ListNodeSourceAirportIDs 获取节点的附加来源机场ID（按添加顺序）
+func ListNodeSourceAirportIDs(nodeID int) []int {
+	var ids []int
+	database.DB.Model(&NodeSource{}).Where("node_id = ?", nodeID).Order("id ASC").Pluck("airport_id", &ids)
+	return ids
+}
+
+// DeleteNodeSourcesByAirport 删除机场的所有附加来源记录
+func DeleteNodeSourcesByAirport(airportID int) error {
+	return database.DB.Where("airport_id = ?", airportID).Delete(&NodeSource{}).Error
+}
+
+// GetNodeSources 获取节点的全部来源机场（主来源在前）
+func GetNodeSources(node *Node) []NodeSourceInfo {
+	sources := make([]NodeSourceInfo, 0)
+	if node.Source != "manual" && node.SourceID > 0 {
+		sources = append(sources, NodeSourceInfo{AirportID: node.SourceID, Name: node.Source, Primary: true})
+	}
+	for _, airportID := range ListNodeSourceAirportIDs(node.ID) {
+		info := NodeSourceInfo{AirportID: airportID}
+		if airport, err := GetAirportByID(airportID); err == nil {
+			info.Name = airport.Name
+		}
+		sources = append(sources, info)
+	}
+	return sources
+}
+
+// TransferNodeSource 将节点的主来源转移到指定机场
+// 目标机场从附加来源中移除；keepOld 为 true 时原主来源成为附加来源
+func TransferNodeSource(node *Node, airport *Airport, group string, keepOld bool) error {
+	oldSourceID := node.SourceID
+	updates := map[string]interface{}{
+		"source":    airport.Name,
+		"source_id": airport.ID,
+		"group":     group,
+	}
+	if err := database.DB.Model(&Node{}).Where("id = ?", node.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	node.Source = airport.Name
+	node.SourceID = airport.ID
+	node.Group = group
+	nodeCache.Set(node.ID, *node)
+
+	if err := RemoveNodeSource(node.ID, airport.ID); err != nil {
+		return err
+	}
+	if keepOld && oldSourceID > 0 && oldSourceID != airport.ID {
+		return AddNodeSource(node.ID, oldSourceID)
+	}
+	return nil
+}
+
+// HandoverNodesFromAirport 主来源机场不再提供节点时，将仍有附加来源的节点转移给附加来源
+// 优先转移给健康度最好的附加来源机场，返回已转移的节点ID
+func HandoverNodesFromAirport(nodeIDs []int) []int {
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+	var sources []NodeSource
+	if err := database.DB.Where("node_id IN ?", nodeIDs).Order("id ASC").Find(&sources).Error; err != nil || len(sources) == 0 {
+		return nil
+	}
+
+	candidates := make(map[int][]int)
+	for _, s := range sources {
+		candidates[s.NodeID] = append(candidates[s.NodeID], s.AirportID)
+	}
+
+	scores := make(map[int]float64)
+	transferred := make([]int, 0)
+	for _, nodeID := range nodeIDs {
+		airportIDs := candidates[nodeID]
+		if len(airportIDs) == 0 {
+			continue
+		}
+		node, ok := GetNodeByID(nodeID)
+		if !ok {
+			continue
+		}
+		var target *Airport
+		var bestScore float64
+		for _, airportID := range airportIDs {
+			airport, err := GetAirportByID(airportID)
+			if err != nil {
+				// 机场已删除，清理无效的来源记录
+				RemoveNodeSource(nodeID, airportID)
+				continue
+			}
+			score, ok := scores[airportID]
+			if !ok {
+				score = GetAirportHealthScore(airport)
+				scores[airportID] = score
+			}
+			if target == nil || score > bestScore {
+				target = airport
+				bestScore = score
+			}
+		}
+		if target == nil {
+			continue
+		}
+		if err := TransferNodeSource(node, target, target.Group, false); err != nil {
+			continue
+		}
+		transferred = append(transferred, nodeID)
+	}
+	return transferred
+}
+
+// IsHealthierSource 判断候选机场的健康度是否明显好于节点当前归属的机场
+func IsHealthierSource(candidateScore, currentScore float64) bool {
+	return candidateScore > currentScore+duplicatePolicyHealthMargin
+}
+
+// GetAirportHealthScore 计算机场健康度评分 (0-1)，用于重复节点归属比较
+// 拉取成功率与延迟检测通过率各占一半
+func GetAirportHealthScore(airport *Airport) float64 {
+	health := GetAirportHealth(airport, duplicatePolicyHealthDays)
+	return health.SuccessRate*0.5 + health.DelayPassRate*0.5
+}
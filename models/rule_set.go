@@ -0,0 +1,413 @@
+package models
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sublink/cache"
+	"sublink/config"
+	"sublink/database"
+	"sublink/utils"
+	"sync"
+	"time"
+)
+
+const (
+	ruleSetFetchTimeout          = 30 * time.Second
+	ruleSetMaxSize               = 10 << 20
+	RuleSetDefaultRefreshSeconds = 86400            // 默认刷新间隔（秒）
+	ruleSetMinRefreshSeconds     = 600              // 最小刷新间隔（秒）
+	ruleSetRetryInterval         = 10 * time.Minute // 下载失败后的重试间隔，期间展开规则直接使用缓存
+)
+
+// RuleSet 本地规则集
+// 远程规则列表下载后缓存在 {db_path}/rulesets 目录，按刷新间隔定时更新
+// 展开规则时优先使用缓存，远程不可用时回退到缓存；客户端可通过 /c/rules/{key} 获取缓存内容作为 rule-provider
+type RuleSet struct {
+	ID              int        `gorm:"primaryKey" json:"id"`
+	Key             string     `gorm:"size:32;uniqueIndex;not null" json:"key"` // URL 的 SHA256 前16位，用于文件名和访问地址
+	Name            string     `json:"name"`                                    // 规则集名称（默认为 URL 文件名）
+	URL             string     `gorm:"type:text;not null" json:"url"`           // 远程地址
+	Behavior        string     `gorm:"default:'classical'" json:"behavior"`     // rule-provider behavior
+	UseProxy        bool       `gorm:"default:false" json:"useProxy"`           // 下载时是否使用代理
+	ProxyLink       string     `gorm:"type:text" json:"proxyLink"`              // 代理节点链接（可选）
+	RefreshInterval int        `gorm:"default:86400" json:"refreshInterval"`    // 刷新间隔（秒）
+	Checksum        string     `json:"checksum"`                                // 缓存内容的 SHA256
+	Size            int        `json:"size"`                                    // 缓存内容字节数
+	RuleCount       int        `json:"ruleCount"`                               // 规则条数（不含注释和空行）
+	LastFetchAt     *time.Time `json:"lastFetchAt"`                             // 最近一次下载成功的时间
+	LastCheckAt     *time.Time `json:"lastCheckAt"`                             // 最近一次尝试下载的时间
+	FetchError      string     `gorm:"type:text" json:"fetchError"`             // 最近一次下载失败的原因，成功后清空
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+var ruleSetCache *cache.MapCache[int, RuleSet]
+
+// ruleSetLocks 按 Key 串行化同一规则集的注册和下载，避免并发展开时重复下载
+var ruleSetLocks sync.Map
+
+func init() {
+	ruleSetCache = cache.NewMapCache(func(r RuleSet) int { return r.ID })
+	ruleSetCache.AddIndex("key", func(r RuleSet) string { return r.Key })
+}
+
+// InitRuleSetCache 初始化规则集缓存
+func InitRuleSetCache() error {
+	utils.Info("开始加载规则集到缓存")
+	var ruleSets []RuleSet
+	if err := database.DB.Find(&ruleSets).Error; err != nil {
+		return err
+	}
+	ruleSetCache.LoadAll(ruleSets)
+	utils.Info("规则集缓存初始化完成，共加载 %d 条记录", ruleSetCache.Count())
+	cache.Manager.Register("ruleset", ruleSetCache)
+	return nil
+}
+
+// RuleSetKey 计算远程地址对应的规则集标识
+func RuleSetKey(url string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(url)))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// lockRuleSet 获取规则集的互斥锁
+func lockRuleSet(key string) func() {
+	v, _ := ruleSetLocks.LoadOrStore(key, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// ruleSetDir 规则集缓存目录
+func ruleSetDir() string {
+	return filepath.Join(config.GetDBPath(), "rulesets")
+}
+
+// FilePath 缓存文件路径
+func (r *RuleSet) FilePath() string {
+	return filepath.Join(ruleSetDir(), r.Key+".list")
+}
+
+// ReadContent 读取缓存内容
+func (r *RuleSet) ReadContent() (string, error) {
+	data, err := os.ReadFile(r.FilePath())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// IsStale 缓存是否需要刷新（从未下载成功或超过刷新间隔）
+func (r *RuleSet) IsStale() bool {
+	if r.LastFetchAt == nil {
+		return true
+	}
+	interval := r.RefreshInterval
+	if interval <= 0 {
+		interval = RuleSetDefaultRefreshSeconds
+	}
+	return time.Since(*r.LastFetchAt) >= time.Duration(interval)*time.Second
+}
+
+// InRetryBackoff 最近一次下载失败且距离上次尝试不足重试间隔，此时不再重复下载
+func (r *RuleSet) InRetryBackoff() bool {
+	return r.FetchError != "" && r.LastCheckAt != nil && time.Since(*r.LastCheckAt) < ruleSetRetryInterval
+}
+
+// GetRuleSetByID 根据 ID 获取规则集
+func GetRuleSetByID(id int) (*RuleSet, error) {
+	if r, ok := ruleSetCache.Get(id); ok {
+		return &r, nil
+	}
+	var r RuleSet
+	if err := database.DB.First(&r, id).Error; err != nil {
+		return nil, err
+	}
+	ruleSetCache.Set(r.ID, r)
+	return &r, nil
+}
+
+// GetRuleSetByKey 根据标识获取规则集
+func GetRuleSetByKey(key string) (*RuleSet, error) {
+	if list := ruleSetCache.GetByIndex("key", key); len(list) > 0 {
+		r := list[0]
+		return &r, nil
+	}
+	return nil, fmt.Errorf("规则集不存在")
+}
+
+// ListRuleSets 获取全部规则集，按创建顺序排列
+func ListRuleSets() []RuleSet {
+	return ruleSetCache.GetAllSorted(func(a, b RuleSet) bool { return a.ID < b.ID })
+}
+
+// RegisterRuleSet 登记远程规则集，已存在时返回现有记录（保留用户修改过的设置）
+func RegisterRuleSet(url, name, behavior string, useProxy bool, proxyLink string) (*RuleSet, error) {
+	url = strings.TrimSpace(url)
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("规则集地址必须以 http:// 或 https:// 开头")
+	}
+	key := RuleSetKey(url)
+	unlock := lockRuleSet(key)
+	defer unlock()
+	return registerRuleSetLocked(key, url, name, behavior, useProxy, proxyLink)
+}
+
+// registerRuleSetLocked 登记规则集，调用方需持有该 Key 的锁
+func registerRuleSetLocked(key, url, name, behavior string, useProxy bool, proxyLink string) (*RuleSet, error) {
+	if r, err := GetRuleSetByKey(key); err == nil {
+		return r, nil
+	}
+	if name == "" {
+		parts := strings.Split(strings.TrimRight(url, "/"), "/")
+		name = strings.TrimSuffix(parts[len(parts)-1], ".list")
+	}
+	if behavior == "" {
+		behavior = "classical"
+	}
+	r := &RuleSet{
+		Key:             key,
+		Name:            name,
+		URL:             url,
+		Behavior:        behavior,
+		UseProxy:        useProxy,
+		ProxyLink:       proxyLink,
+		RefreshInterval: RuleSetDefaultRefreshSeconds,
+	}
+	if err := database.DB.Create(r).Error; err != nil {
+		return nil, err
+	}
+	ruleSetCache.Set(r.ID, *r)
+	return r, nil
+}
+
+// UpdateSettings 更新规则集名称、刷新间隔和代理设置
+func (r *RuleSet) UpdateSettings() error {
+	if r.RefreshInterval <= 0 {
+		r.RefreshInterval = RuleSetDefaultRefreshSeconds
+	}
+	if r.RefreshInterval < ruleSetMinRefreshSeconds {
+		return fmt.Errorf("刷新间隔不能小于 %d 秒", ruleSetMinRefreshSeconds)
+	}
+	err := database.DB.Model(&RuleSet{}).Where("id = ?", r.ID).Updates(map[string]interface{}{
+		"name":             r.Name,
+		"behavior":         r.Behavior,
+		"refresh_interval": r.RefreshInterval,
+		"use_proxy":        r.UseProxy,
+		"proxy_link":       r.ProxyLink,
+	}).Error
+	if err != nil {
+		return err
+	}
+	var updated RuleSet
+	if err := database.DB.First(&updated, r.ID).Error; err == nil {
+		ruleSetCache.Set(r.ID, updated)
+	}
+	return nil
+}
+
+// Del 删除规则集及其缓存文件
+func (r *RuleSet) Del() error {
+	unlock := lockRuleSet(r.Key)
+	defer unlock()
+	if err := database.DB.Delete(&RuleSet{}, r.ID).Error; err != nil {
+		return err
+	}
+	ruleSetCache.Delete(r.ID)
+	if err := os.Remove(r.FilePath()); err != nil && !os.IsNotExist(err) {
+		utils.Warn("删除规则集缓存文件失败 %s: %v", r.FilePath(), err)
+	}
+	return nil
+}
+
+// Refresh 下载远程规则集并更新缓存
+// 下载失败时保留原有缓存，只记录失败原因
+func (r *RuleSet) Refresh() error {
+	unlock := lockRuleSet(r.Key)
+	defer unlock()
+	return r.refreshLocked()
+}
+
+// RefreshIfStale 缓存过期且不在失败重试间隔内时下载远程规则集，返回是否实际下载
+// 在锁内以数据库中的最新记录重新判断，并发请求只会触发一次下载
+func (r *RuleSet) RefreshIfStale() (bool, error) {
+	unlock := lockRuleSet(r.Key)
+	defer unlock()
+	var current RuleSet
+	if err := database.DB.First(&current, r.ID).Error; err != nil {
+		ruleSetCache.Delete(r.ID)
+		return false, fmt.Errorf("规则集不存在")
+	}
+	if !current.IsStale() || current.InRetryBackoff() {
+		*r = current
+		return false, nil
+	}
+	return true, r.refreshLocked()
+}
+
+// refreshLocked 下载并写入缓存，调用方需持有该 Key 的锁
+// 以数据库中的最新记录为准（调用方持有的可能是过期副本），规则集已删除时不再下载；完成后 r 更新为最新记录
+func (r *RuleSet) refreshLocked() error {
+	var current RuleSet
+	if err := database.DB.First(&current, r.ID).Error; err != nil {
+		ruleSetCache.Delete(r.ID)
+		return fmt.Errorf("规则集不存在")
+	}
+
+	now := time.Now()
+	content, err := fetchRuleSetContent(current.URL, current.UseProxy, current.ProxyLink)
+	if err == nil {
+		checksum := ScriptChecksum(content)
+		if checksum != current.Checksum || !ruleSetFileExists(current.FilePath()) {
+			err = writeRuleSetFile(current.FilePath(), content)
+			if err == nil && current.Checksum != "" {
+				utils.Info("规则集【%s】内容已更新: %s → %s", current.Name, current.Checksum[:8], checksum[:8])
+			}
+		}
+		if err == nil {
+			return r.saveFetchState(map[string]interface{}{
+				"checksum":      checksum,
+				"size":          len(content),
+				"rule_count":    countRuleSetRules(content),
+				"last_fetch_at": &now,
+				"last_check_at": &now,
+				"fetch_error":   "",
+			})
+		}
+	}
+
+	// 下载或写入失败时保留原有缓存，只记录失败原因
+	if saveErr := r.saveFetchState(map[string]interface{}{
+		"last_check_at": &now,
+		"fetch_error":   truncateString(err.Error(), 512),
+	}); saveErr != nil {
+		utils.Warn("保存规则集【%s】下载结果失败: %v", current.Name, saveErr)
+	}
+	return err
+}
+
+// saveFetchState 只更新下载相关字段，并以重新读取的记录刷新缓存（不覆盖同时修改的其他设置）
+func (r *RuleSet) saveFetchState(updates map[string]interface{}) error {
+	if err := database.DB.Model(&RuleSet{}).Where("id = ?", r.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	var updated RuleSet
+	if err := database.DB.First(&updated, r.ID).Error; err != nil {
+		ruleSetCache.Delete(r.ID)
+		return fmt.Errorf("规则集不存在")
+	}
+	ruleSetCache.Set(updated.ID, updated)
+	*r = updated
+	return nil
+}
+
+// ResolveRuleSetContent 获取远程规则列表内容（用于展开规则）
+// 缓存未过期时直接使用缓存；否则下载并更新缓存，下载失败时回退到已有缓存
+// 下载失败后的重试间隔内不再下载，避免远程不可用时每次展开规则都等待下载超时
+func ResolveRuleSetContent(url string, useProxy bool, proxyLink string) (string, error) {
+	url = strings.TrimSpace(url)
+	key := RuleSetKey(url)
+	unlock := lockRuleSet(key)
+	defer unlock()
+
+	r, err := registerRuleSetLocked(key, url, "", "", useProxy, proxyLink)
+	if err != nil {
+		// 无法登记时直接下载，不影响规则转换
+		utils.Warn("登记规则集失败 %s: %v", url, err)
+		return fetchRuleSetContent(url, useProxy, proxyLink)
+	}
+	if !r.IsStale() || r.InRetryBackoff() {
+		if content, err := r.ReadContent(); err == nil {
+			return content, nil
+		}
+		// 没有缓存且刚下载失败，不重复下载
+		if r.InRetryBackoff() {
+			return "", fmt.Errorf("规则集【%s】下载失败，稍后重试: %s", r.Name, r.FetchError)
+		}
+	}
+	fetchErr := r.refreshLocked()
+	content, err := r.ReadContent()
+	if err != nil {
+		if fetchErr != nil {
+			return "", fetchErr
+		}
+		return "", err
+	}
+	if fetchErr != nil {
+		utils.Warn("下载规则集【%s】失败，使用本地缓存: %v", r.Name, fetchErr)
+	}
+	return content, nil
+}
+
+// RefreshDueRuleSets 刷新所有超过刷新间隔的规则集，返回成功和失败的数量
+func RefreshDueRuleSets() (refreshed int, failed int) {
+	for _, item := range ListRuleSets() {
+		r := item
+		if !r.IsStale() || r.InRetryBackoff() {
+			continue
+		}
+		if err := r.Refresh(); err != nil {
+			utils.Warn("刷新规则集【%s】失败: %v", r.Name, err)
+			failed++
+			continue
+		}
+		refreshed++
+	}
+	return refreshed, failed
+}
+
+// fetchRuleSetContent 下载远程规则列表
+func fetchRuleSetContent(url string, useProxy bool, proxyLink string) (string, error) {
+	data, err := utils.FetchWithProxy(url, useProxy, proxyLink, ruleSetFetchTimeout, "")
+	if err != nil {
+		return "", err
+	}
+	if len(data) > ruleSetMaxSize {
+		return "", fmt.Errorf("规则集超过 %d 字节", ruleSetMaxSize)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", fmt.Errorf("规则集内容为空")
+	}
+	return string(data), nil
+}
+
+// writeRuleSetFile 写入缓存文件（先写临时文件再替换，避免读取到不完整的内容）
+func writeRuleSetFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建规则集目录失败: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0644); err != nil {
+		return fmt.Errorf("写入规则集缓存失败: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入规则集缓存失败: %v", err)
+	}
+	return nil
+}
+
+// countRuleSetRules 统计规则条数（不含注释和空行）
+func countRuleSetRules(content string) int {
+	count := 0
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// ruleSetFileExists 缓存文件是否存在
+func ruleSetFileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
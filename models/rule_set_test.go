@@ -0,0 +1,198 @@
+package models
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sublink/database"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setupRuleSetTest 准备规则集测试环境：内存数据库、临时缓存目录和空的规则集缓存
+func setupRuleSetTest(t *testing.T) {
+	t.Helper()
+	setupTestDB(t, &RuleSet{})
+	t.Setenv("SUBLINK_DB_PATH", t.TempDir())
+	ruleSetCache.LoadAll(nil)
+}
+
+// TestRuleSetRefreshKeepsConcurrentSettings 测试刷新使用过期副本时不会覆盖期间修改的设置
+func TestRuleSetRefreshKeepsConcurrentSettings(t *testing.T) {
+	setupRuleSetTest(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# comment\nDOMAIN,example.com\nDOMAIN-SUFFIX,example.org\n"))
+	}))
+	defer server.Close()
+
+	r, err := RegisterRuleSet(server.URL+"/rules.list", "", "", false, "")
+	if err != nil {
+		t.Fatalf("登记规则集失败: %v", err)
+	}
+	stale := *r
+
+	// 刷新前修改设置，stale 仍是修改前的副本
+	r.Name = "新名称"
+	r.RefreshInterval = 3600
+	if err := r.UpdateSettings(); err != nil {
+		t.Fatalf("更新设置失败: %v", err)
+	}
+
+	if err := stale.Refresh(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	cached, err := GetRuleSetByID(r.ID)
+	if err != nil {
+		t.Fatalf("获取规则集失败: %v", err)
+	}
+	if cached.Name != "新名称" || cached.RefreshInterval != 3600 {
+		t.Errorf("刷新覆盖了期间修改的设置: name=%s interval=%d", cached.Name, cached.RefreshInterval)
+	}
+	if cached.RuleCount != 2 || cached.LastFetchAt == nil || cached.FetchError != "" {
+		t.Errorf("下载结果未保存: ruleCount=%d lastFetchAt=%v fetchError=%q", cached.RuleCount, cached.LastFetchAt, cached.FetchError)
+	}
+	var stored RuleSet
+	if err := database.DB.First(&stored, r.ID).Error; err != nil || stored.Name != "新名称" {
+		t.Errorf("数据库中的设置被覆盖: %+v, %v", stored, err)
+	}
+}
+
+// TestRuleSetRefreshDeleted 测试规则集删除后使用旧副本刷新不会重新写入缓存
+func TestRuleSetRefreshDeleted(t *testing.T) {
+	setupRuleSetTest(t)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte("DOMAIN,example.com\n"))
+	}))
+	defer server.Close()
+
+	r, err := RegisterRuleSet(server.URL+"/rules.list", "", "", false, "")
+	if err != nil {
+		t.Fatalf("登记规则集失败: %v", err)
+	}
+	stale := *r
+	if err := r.Del(); err != nil {
+		t.Fatalf("删除规则集失败: %v", err)
+	}
+
+	if err := stale.Refresh(); err == nil {
+		t.Error("已删除的规则集刷新应返回错误")
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Errorf("已删除的规则集不应下载，实际请求 %d 次", requests)
+	}
+	if _, err := GetRuleSetByID(r.ID); err == nil {
+		t.Error("已删除的规则集不应重新出现在缓存中")
+	}
+	if ruleSetFileExists(stale.FilePath()) {
+		t.Error("已删除的规则集不应写入缓存文件")
+	}
+}
+
+// TestResolveRuleSetContentBackoff 测试下载失败后在重试间隔内使用缓存，不重复下载
+func TestResolveRuleSetContentBackoff(t *testing.T) {
+	setupRuleSetTest(t)
+	var requests int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("DOMAIN,example.com\n"))
+	}))
+	defer server.Close()
+	url := server.URL + "/rules.list"
+
+	content, err := ResolveRuleSetContent(url, false, "")
+	if err != nil || content != "DOMAIN,example.com\n" {
+		t.Fatalf("首次获取失败: %q, %v", content, err)
+	}
+
+	// 缓存过期且远程不可用：下载一次失败后回退到缓存
+	failing.Store(true)
+	expired := time.Now().Add(-48 * time.Hour)
+	r, _ := GetRuleSetByKey(RuleSetKey(url))
+	if err := r.saveFetchState(map[string]interface{}{"last_fetch_at": &expired}); err != nil {
+		t.Fatalf("修改下载时间失败: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		content, err = ResolveRuleSetContent(url, false, "")
+		if err != nil || content != "DOMAIN,example.com\n" {
+			t.Fatalf("下载失败时应回退到缓存: %q, %v", content, err)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("重试间隔内不应重复下载，期望请求 2 次，实际 %d 次", got)
+	}
+
+	// 超过重试间隔后再次尝试下载
+	lastCheck := time.Now().Add(-ruleSetRetryInterval - time.Minute)
+	r, _ = GetRuleSetByKey(RuleSetKey(url))
+	if err := r.saveFetchState(map[string]interface{}{"last_check_at": &lastCheck}); err != nil {
+		t.Fatalf("修改检查时间失败: %v", err)
+	}
+	failing.Store(false)
+	if _, err := ResolveRuleSetContent(url, false, ""); err != nil {
+		t.Fatalf("重试下载失败: %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Errorf("超过重试间隔后应重新下载，期望请求 3 次，实际 %d 次", got)
+	}
+	if r, _ = GetRuleSetByKey(RuleSetKey(url)); r.FetchError != "" || r.InRetryBackoff() {
+		t.Errorf("下载成功后应清除失败记录: %q", r.FetchError)
+	}
+}
+
+// TestRuleSetRefreshIfStale 测试过期副本并发刷新只下载一次，失败重试间隔内不下载
+func TestRuleSetRefreshIfStale(t *testing.T) {
+	setupRuleSetTest(t)
+	var requests int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("DOMAIN,example.com\n"))
+	}))
+	defer server.Close()
+
+	r, err := RegisterRuleSet(server.URL+"/rules.list", "", "", false, "")
+	if err != nil {
+		t.Fatalf("登记规则集失败: %v", err)
+	}
+	stale := *r
+
+	// 多个请求持有同一个过期副本，锁内重新判断后只下载一次
+	for i := 0; i < 3; i++ {
+		rs := stale
+		if _, err := rs.RefreshIfStale(); err != nil {
+			t.Fatalf("刷新失败: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("过期副本应只触发一次下载，实际 %d 次", got)
+	}
+
+	// 下载失败后的重试间隔内不再下载
+	failing.Store(true)
+	expired := time.Now().Add(-48 * time.Hour)
+	if err := r.saveFetchState(map[string]interface{}{"last_fetch_at": &expired}); err != nil {
+		t.Fatalf("修改下载时间失败: %v", err)
+	}
+	if refreshed, err := r.RefreshIfStale(); !refreshed || err == nil {
+		t.Fatalf("过期缓存应尝试下载并返回失败: refreshed=%v err=%v", refreshed, err)
+	}
+	for i := 0; i < 3; i++ {
+		if refreshed, err := r.RefreshIfStale(); refreshed || err != nil {
+			t.Errorf("重试间隔内不应下载: refreshed=%v err=%v", refreshed, err)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("期望请求 2 次，实际 %d 次", got)
+	}
+}
@@ -2,10 +2,13 @@ package models
 
 import (
 	"sort"
+	"strings"
 	"sublink/cache"
 	"sublink/database"
 	"sublink/utils"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Script struct {
@@ -15,6 +18,21 @@ type Script struct {
 	Content   string    `json:"content" gorm:"not null"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// 最近一次执行失败信息
+	FailCount   int        `json:"fail_count" gorm:"default:0"`        // 连续失败次数，脚本更新后清零
+	LastError   string     `json:"last_error" gorm:"size:1024"`        // 最近一次失败原因
+	LastErrorAt *time.Time `json:"last_error_at" gorm:"type:datetime"` // 最近一次失败时间
+	// 远程脚本
+	SourceURL      string     `json:"source_url"`                         // 远程地址，为空表示本地脚本
+	Pinned         bool       `json:"pinned" gorm:"default:false"`        // 固定版本，不提示升级
+	Checksum       string     `json:"checksum"`                           // 当前内容的 SHA256
+	LatestVersion  string     `json:"latest_version"`                     // 远程最新版本（脚本头部 @version）
+	LatestChecksum string     `json:"latest_checksum"`                    // 远程最新内容的 SHA256
+	UpdateType     string     `json:"update_type"`                        // 升级提示：major / minor / patch / changed，为空表示无需升级
+	LastCheckAt    *time.Time `json:"last_check_at" gorm:"type:datetime"` // 最近一次检查更新时间
+	CheckError     string     `json:"check_error" gorm:"size:512"`        // 最近一次检查更新失败原因
+	// 脚本更新后自动执行测试用例的结果（不保存）
+	FixtureResults []ScriptFixtureResult `json:"fixture_results,omitempty" gorm:"-"`
 }
 
 // scriptCache 使用新的泛型缓存
@@ -42,6 +60,7 @@ func InitScriptCache() error {
 
 // Add 添加脚本 (Write-Through)
 func (s *Script) Add() error {
+	s.Checksum = ScriptChecksum(s.Content)
 	err := database.DB.Create(s).Error
 	if err != nil {
 		return err
@@ -51,7 +70,16 @@ func (s *Script) Add() error {
 }
 
 // Update 更新脚本 (Write-Through)
+// 内容有变化时保存修改前的内容为历史版本
 func (s *Script) Update() error {
+	if s.Content != "" {
+		if old, ok := scriptCache.Get(s.ID); ok && old.Content != s.Content {
+			if err := SaveScriptVersion(&old, ScriptVersionReasonUpdate); err != nil {
+				utils.Warn("保存脚本历史版本失败 ID: %d: %v", s.ID, err)
+			}
+		}
+		s.Checksum = ScriptChecksum(s.Content)
+	}
 	err := database.DB.Model(s).Updates(s).Error
 	if err != nil {
 		return err
@@ -60,6 +88,12 @@ func (s *Script) Update() error {
 	var updated Script
 	if err := database.DB.First(&updated, s.ID).Error; err == nil {
 		scriptCache.Set(s.ID, updated)
+		// 内容变化后重新计算升级提示
+		if updated.scriptUpdateType() != updated.UpdateType {
+			if err := updated.saveRemoteState(); err != nil {
+				utils.Warn("更新脚本升级提示失败 ID: %d: %v", s.ID, err)
+			}
+		}
 	}
 	return nil
 }
@@ -71,6 +105,15 @@ func (s *Script) Del() error {
 		return err
 	}
 	scriptCache.Delete(s.ID)
+	if err := DeleteScriptKVByScript(s.ID); err != nil {
+		utils.Warn("删除脚本 KV 存储失败 ID: %d: %v", s.ID, err)
+	}
+	if err := DeleteScriptFixturesByScript(s.ID); err != nil {
+		utils.Warn("删除脚本测试用例失败 ID: %d: %v", s.ID, err)
+	}
+	if err := DeleteScriptVersionsByScript(s.ID); err != nil {
+		utils.Warn("删除脚本历史版本失败 ID: %d: %v", s.ID, err)
+	}
 	return nil
 }
 
@@ -131,5 +174,53 @@ func GetScriptByID(id int) (*Script, error) {
 	return &script, nil
 }
 
+// RecordScriptFailure 记录脚本执行失败（超时、超出内存或输出限制、运行时错误等）
+func RecordScriptFailure(id int, execErr error) {
+	if id == 0 || execErr == nil {
+		return
+	}
+	now := time.Now()
+	errMsg := truncateString(execErr.Error(), 1024)
+	err := database.DB.Model(&Script{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"fail_count":    gorm.Expr("fail_count + 1"),
+		"last_error":    errMsg,
+		"last_error_at": &now,
+	}).Error
+	if err != nil {
+		utils.Warn("记录脚本执行失败信息失败 ID: %d: %v", id, err)
+		return
+	}
+	if cached, ok := scriptCache.Get(id); ok {
+		cached.FailCount++
+		cached.LastError = errMsg
+		cached.LastErrorAt = &now
+		scriptCache.Set(id, cached)
+	}
+}
+
+// ClearScriptFailure 清除脚本的失败记录（脚本内容更新后调用）
+func ClearScriptFailure(id int) error {
+	err := database.DB.Model(&Script{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"fail_count":    0,
+		"last_error":    "",
+		"last_error_at": nil,
+	}).Error
+	if err != nil {
+		return err
+	}
+	if cached, ok := scriptCache.Get(id); ok {
+		cached.FailCount = 0
+		cached.LastError = ""
+		cached.LastErrorAt = nil
+		scriptCache.Set(id, cached)
+	}
+	return nil
+}
+
+// IsScriptEntryMissing 判断错误是否为脚本未定义对应入口函数（不视为执行失败）
+func IsScriptEntryMissing(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "function not found in script")
+}
+
 // Ensure sort is used
 var _ = sort.Slice
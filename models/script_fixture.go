@@ -0,0 +1,302 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sublink/database"
+	"sublink/utils"
+	"time"
+)
+
+// 脚本入口函数
+const (
+	ScriptEntrySubMod     = "subMod"     // 订阅内容处理 subMod(input, clientType)
+	ScriptEntryFilterNode = "filterNode" // 节点过滤 filterNode(nodes, clientType)
+)
+
+// 测试用例执行状态
+const (
+	ScriptFixturePassed = "passed"
+	ScriptFixtureFailed = "failed"
+)
+
+// ScriptFixture 脚本测试用例
+// 保存固定输入和期望输出，脚本更新后自动执行
+type ScriptFixture struct {
+	ID         int    `gorm:"primaryKey;autoIncrement" json:"id"`
+	ScriptID   int    `gorm:"index" json:"scriptId"`
+	Name       string `json:"name"`
+	Entry      string `gorm:"default:'subMod'" json:"entry"` // subMod / filterNode
+	ClientType string `json:"clientType"`
+	Input      string `gorm:"type:text" json:"input"`
+	// Expected 期望输出，为空时只检查执行成功
+	// subMod 为完整输出内容；filterNode 为输出节点名称，每行一个
+	Expected    string     `gorm:"type:text" json:"expected"`
+	LastStatus  string     `json:"lastStatus"`                     // passed / failed
+	LastMessage string     `gorm:"size:1024" json:"lastMessage"`   // 失败原因
+	LastRunAt   *time.Time `gorm:"type:datetime" json:"lastRunAt"` // 最近执行时间
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// TableName 指定表名
+func (ScriptFixture) TableName() string {
+	return "script_fixtures"
+}
+
+// ScriptTestDiff 脚本输出与输入的差异
+// subMod 按行比较；filterNode 按节点名称比较，Changed 为字段被修改的节点
+type ScriptTestDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// ScriptTestResult 脚本试运行结果
+type ScriptTestResult struct {
+	Output      string                 `json:"output"`
+	InputCount  int                    `json:"inputCount"`  // 输入行数或节点数
+	OutputCount int                    `json:"outputCount"` // 输出行数或节点数
+	Diff        ScriptTestDiff         `json:"diff"`
+	Logs        []utils.ScriptLogEntry `json:"logs"`
+	DurationMs  int64                  `json:"durationMs"`
+	Error       string                 `json:"error,omitempty"`
+}
+
+// ScriptFixtureResult 测试用例执行结果
+type ScriptFixtureResult struct {
+	FixtureID int              `json:"fixtureId"`
+	Name      string           `json:"name"`
+	Passed    bool             `json:"passed"`
+	Message   string           `json:"message,omitempty"`
+	Result    ScriptTestResult `json:"result"`
+}
+
+// IsValidScriptEntry 检查脚本入口是否有效
+func IsValidScriptEntry(entry string) bool {
+	return entry == ScriptEntrySubMod || entry == ScriptEntryFilterNode
+}
+
+// RunScriptTest 试运行脚本（不记录失败信息，kv 写入不会保存）
+// filterNode 的 input 为节点 JSON 数组
+func RunScriptTest(content string, scriptID int, scriptName string, entry string, clientType string, input string) ScriptTestResult {
+	env := &utils.ScriptEnv{ScriptID: scriptID, ScriptName: scriptName, DryRun: true}
+	var result ScriptTestResult
+	start := time.Now()
+
+	switch entry {
+	case ScriptEntryFilterNode:
+		var inputNodes []Node
+		if err := json.Unmarshal([]byte(input), &inputNodes); err != nil {
+			result.Error = fmt.Sprintf("输入不是节点数组: %v", err)
+			return result
+		}
+		result.InputCount = len(inputNodes)
+		resJSON, err := utils.RunNodeFilterScript(content, []byte(input), clientType, env)
+		result.DurationMs = time.Since(start).Milliseconds()
+		result.Logs = env.Logs
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		var outputNodes []Node
+		if err := json.Unmarshal(resJSON, &outputNodes); err != nil {
+			result.Error = fmt.Sprintf("返回值不是节点数组: %v", err)
+			return result
+		}
+		output, _ := json.MarshalIndent(outputNodes, "", "  ")
+		result.Output = string(output)
+		result.OutputCount = len(outputNodes)
+		result.Diff = diffScriptNodes(inputNodes, outputNodes)
+	default:
+		output, err := utils.RunScript(content, input, clientType, env)
+		result.DurationMs = time.Since(start).Milliseconds()
+		result.Logs = env.Logs
+		result.InputCount = countLines(input)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Output = output
+		result.OutputCount = countLines(output)
+		result.Diff = diffScriptLines(input, output)
+	}
+	if result.Logs == nil {
+		result.Logs = []utils.ScriptLogEntry{}
+	}
+	return result
+}
+
+// diffScriptNodes 按节点名称比较脚本处理前后的节点
+func diffScriptNodes(before, after []Node) ScriptTestDiff {
+	diff := ScriptTestDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	beforeMap := make(map[string]string, len(before))
+	for _, n := range before {
+		data, _ := json.Marshal(n)
+		beforeMap[n.Name] = string(data)
+	}
+	afterNames := make(map[string]bool, len(after))
+	for _, n := range after {
+		afterNames[n.Name] = true
+		old, exists := beforeMap[n.Name]
+		if !exists {
+			diff.Added = append(diff.Added, n.Name)
+			continue
+		}
+		if data, _ := json.Marshal(n); string(data) != old {
+			diff.Changed = append(diff.Changed, n.Name)
+		}
+	}
+	for _, n := range before {
+		if !afterNames[n.Name] {
+			diff.Removed = append(diff.Removed, n.Name)
+		}
+	}
+	return diff
+}
+
+// diffScriptLines 按行比较脚本处理前后的内容（忽略行顺序）
+func diffScriptLines(before, after string) ScriptTestDiff {
+	diff := ScriptTestDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	counts := make(map[string]int)
+	for _, line := range strings.Split(before, "\n") {
+		counts[line]++
+	}
+	for _, line := range strings.Split(after, "\n") {
+		if counts[line] > 0 {
+			counts[line]--
+			continue
+		}
+		diff.Added = append(diff.Added, line)
+	}
+	for _, line := range strings.Split(before, "\n") {
+		if counts[line] > 0 {
+			counts[line]--
+			diff.Removed = append(diff.Removed, line)
+		}
+	}
+	return diff
+}
+
+// countLines 统计非空行数
+func countLines(content string) int {
+	count := 0
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// Add 添加测试用例
+func (f *ScriptFixture) Add() error {
+	return database.DB.Create(f).Error
+}
+
+// Update 更新测试用例
+func (f *ScriptFixture) Update() error {
+	return database.DB.Model(f).Select("Name", "Entry", "ClientType", "Input", "Expected").Updates(f).Error
+}
+
+// Del 删除测试用例
+func (f *ScriptFixture) Del() error {
+	return database.DB.Delete(f).Error
+}
+
+// ListScriptFixtures 获取脚本的测试用例
+func ListScriptFixtures(scriptID int) ([]ScriptFixture, error) {
+	fixtures := make([]ScriptFixture, 0)
+	err := database.DB.Where("script_id = ?", scriptID).Order("id ASC").Find(&fixtures).Error
+	return fixtures, err
+}
+
+// GetScriptFixtureByID 根据ID获取测试用例
+func GetScriptFixtureByID(id int) (*ScriptFixture, error) {
+	var fixture ScriptFixture
+	if err := database.DB.First(&fixture, id).Error; err != nil {
+		return nil, err
+	}
+	return &fixture, nil
+}
+
+// DeleteScriptFixturesByScript 删除脚本的全部测试用例
+func DeleteScriptFixturesByScript(scriptID int) error {
+	return database.DB.Where("script_id = ?", scriptID).Delete(&ScriptFixture{}).Error
+}
+
+// Run 执行测试用例并保存结果
+func (f *ScriptFixture) Run(script *Script) ScriptFixtureResult {
+	clientType := f.ClientType
+	if clientType == "" {
+		clientType = "clash"
+	}
+	result := ScriptFixtureResult{
+		FixtureID: f.ID,
+		Name:      f.Name,
+		Result:    RunScriptTest(script.Content, script.ID, script.Name, f.Entry, clientType, f.Input),
+	}
+	result.Passed, result.Message = f.check(result.Result)
+
+	now := time.Now()
+	status := ScriptFixtureFailed
+	if result.Passed {
+		status = ScriptFixturePassed
+	}
+	err := database.DB.Model(f).Updates(map[string]interface{}{
+		"last_status":  status,
+		"last_message": truncateString(result.Message, 1024),
+		"last_run_at":  &now,
+	}).Error
+	if err != nil {
+		utils.Warn("保存脚本测试结果失败 ID: %d: %v", f.ID, err)
+	}
+	return result
+}
+
+// check 比较执行结果与期望输出
+func (f *ScriptFixture) check(res ScriptTestResult) (bool, string) {
+	if res.Error != "" {
+		return false, res.Error
+	}
+	if strings.TrimSpace(f.Expected) == "" {
+		return true, ""
+	}
+	if f.Entry == ScriptEntryFilterNode {
+		var nodes []Node
+		json.Unmarshal([]byte(res.Output), &nodes)
+		names := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			names = append(names, n.Name)
+		}
+		expected := make([]string, 0)
+		for _, line := range strings.Split(f.Expected, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				expected = append(expected, line)
+			}
+		}
+		if strings.Join(names, "\n") != strings.Join(expected, "\n") {
+			return false, fmt.Sprintf("输出节点与期望不一致: 期望 %d 个，实际 %d 个", len(expected), len(names))
+		}
+		return true, ""
+	}
+	if strings.TrimSpace(res.Output) != strings.TrimSpace(f.Expected) {
+		return false, "输出内容与期望不一致"
+	}
+	return true, ""
+}
+
+// RunScriptFixtures 执行脚本的全部测试用例
+func RunScriptFixtures(script *Script) []ScriptFixtureResult {
+	fixtures, err := ListScriptFixtures(script.ID)
+	if err != nil {
+		utils.Warn("获取脚本测试用例失败 ID: %d: %v", script.ID, err)
+		return []ScriptFixtureResult{}
+	}
+	results := make([]ScriptFixtureResult, 0, len(fixtures))
+	for i := range fixtures {
+		results = append(results, fixtures[i].Run(script))
+	}
+	return results
+}
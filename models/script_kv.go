@@ -0,0 +1,108 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"sublink/database"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// 脚本 KV 存储限制
+const (
+	scriptKVMaxKeyLength   = 255
+	scriptKVMaxValueLength = 64 << 10
+	scriptKVMaxKeys        = 1000
+)
+
+// ScriptKV 脚本持久化键值存储
+// 每个脚本拥有独立的命名空间，供脚本通过运行时 kv 对象跨次执行保存数据
+type ScriptKV struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ScriptID  int       `gorm:"uniqueIndex:idx_script_kv_key" json:"scriptId"`
+	Key       string    `gorm:"uniqueIndex:idx_script_kv_key;size:255" json:"key"`
+	Value     string    `gorm:"type:text" json:"value"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// TableName 指定表名
+func (ScriptKV) TableName() string {
+	return "script_kvs"
+}
+
+// GetScriptKV 获取脚本存储的值
+func GetScriptKV(scriptID int, key string) (string, bool, error) {
+	var kv ScriptKV
+	result := database.DB.Where("script_id = ? AND key = ?", scriptID, key).Limit(1).Find(&kv)
+	if result.Error != nil {
+		return "", false, result.Error
+	}
+	return kv.Value, result.RowsAffected > 0, nil
+}
+
+// SetScriptKV 保存脚本的键值（已存在则覆盖）
+func SetScriptKV(scriptID int, key string, value string) error {
+	if strings.TrimSpace(key) == "" || len(key) > scriptKVMaxKeyLength {
+		return fmt.Errorf("键名不能为空且不能超过 %d 字节", scriptKVMaxKeyLength)
+	}
+	if len(value) > scriptKVMaxValueLength {
+		return fmt.Errorf("值不能超过 %d 字节", scriptKVMaxValueLength)
+	}
+	if _, exists, err := GetScriptKV(scriptID, key); err != nil {
+		return err
+	} else if !exists {
+		var count int64
+		database.DB.Model(&ScriptKV{}).Where("script_id = ?", scriptID).Count(&count)
+		if count >= scriptKVMaxKeys {
+			return fmt.Errorf("每个脚本最多保存 %d 个键", scriptKVMaxKeys)
+		}
+	}
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "script_id"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&ScriptKV{ScriptID: scriptID, Key: key, Value: value}).Error
+}
+
+// DeleteScriptKV 删除脚本的键
+func DeleteScriptKV(scriptID int, key string) error {
+	return database.DB.Where("script_id = ? AND key = ?", scriptID, key).Delete(&ScriptKV{}).Error
+}
+
+// ListScriptKVKeys 获取脚本的所有键
+func ListScriptKVKeys(scriptID int) ([]string, error) {
+	keys := make([]string, 0)
+	err := database.DB.Model(&ScriptKV{}).Where("script_id = ?", scriptID).Order("key ASC").Pluck("key", &keys).Error
+	return keys, err
+}
+
+// DeleteScriptKVByScript 删除脚本的全部键值
+func DeleteScriptKVByScript(scriptID int) error {
+	return database.DB.Where("script_id = ?", scriptID).Delete(&ScriptKV{}).Error
+}
+
+// scriptFetchAllowListKey 脚本 fetch 允许访问的域名列表（系统设置，逗号或换行分隔）
+const scriptFetchAllowListKey = "script_fetch_allowlist"
+
+// GetScriptFetchAllowList 获取脚本 fetch 允许访问的域名列表
+func GetScriptFetchAllowList() []string {
+	value, _ := GetSetting(scriptFetchAllowListKey)
+	hosts := make([]string, 0)
+	for _, host := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// SetScriptFetchAllowList 保存脚本 fetch 允许访问的域名列表
+func SetScriptFetchAllowList(hosts []string) error {
+	cleaned := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if host = strings.TrimSpace(host); host != "" {
+			cleaned = append(cleaned, host)
+		}
+	}
+	return SetSetting(scriptFetchAllowListKey, strings.Join(cleaned, ","))
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sublink/utils"
+	"time"
+)
+
+// scriptLimitsKey 脚本执行限制（系统设置，JSON）
+const scriptLimitsKey = "script_limits"
+
+// ScriptLimitsConfig 脚本执行限制配置，字段为 0 时使用默认值
+type ScriptLimitsConfig struct {
+	TimeoutMs      int64 `json:"timeoutMs"`
+	MaxOutputSize  int   `json:"maxOutputSize"`
+	MaxArrayLength int   `json:"maxArrayLength"`
+	MaxCallStack   int   `json:"maxCallStack"`
+	MaxRuntimeData int   `json:"maxRuntimeData"`
+}
+
+// NewScriptLimitsConfig 将执行限制转换为配置
+func NewScriptLimitsConfig(limits utils.ScriptLimits) ScriptLimitsConfig {
+	return ScriptLimitsConfig{
+		TimeoutMs:      limits.Timeout.Milliseconds(),
+		MaxOutputSize:  limits.MaxOutputSize,
+		MaxArrayLength: limits.MaxArrayLength,
+		MaxCallStack:   limits.MaxCallStack,
+		MaxRuntimeData: limits.MaxRuntimeData,
+	}
+}
+
+// Limits 转换为执行限制，未设置的字段使用默认值
+func (c ScriptLimitsConfig) Limits() utils.ScriptLimits {
+	limits := utils.DefaultScriptLimits
+	if c.TimeoutMs > 0 {
+		limits.Timeout = time.Duration(c.TimeoutMs) * time.Millisecond
+	}
+	if c.MaxOutputSize > 0 {
+		limits.MaxOutputSize = c.MaxOutputSize
+	}
+	if c.MaxArrayLength > 0 {
+		limits.MaxArrayLength = c.MaxArrayLength
+	}
+	if c.MaxCallStack > 0 {
+		limits.MaxCallStack = c.MaxCallStack
+	}
+	if c.MaxRuntimeData > 0 {
+		limits.MaxRuntimeData = c.MaxRuntimeData
+	}
+	return limits
+}
+
+// LoadScriptLimits 读取系统设置中的脚本执行限制并应用，未设置或格式错误时使用默认值
+func LoadScriptLimits() {
+	value, _ := GetSetting(scriptLimitsKey)
+	if value == "" {
+		return
+	}
+	var config ScriptLimitsConfig
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		utils.Warn("脚本执行限制配置格式错误，使用默认值: %v", err)
+		return
+	}
+	if err := utils.SetScriptLimits(config.Limits()); err != nil {
+		utils.Warn("脚本执行限制配置无效，使用默认值: %v", err)
+	}
+}
+
+// SetScriptLimits 保存脚本执行限制并立即生效
+func SetScriptLimits(config ScriptLimitsConfig) error {
+	if config.TimeoutMs < 0 || config.MaxOutputSize < 0 || config.MaxArrayLength < 0 || config.MaxCallStack < 0 || config.MaxRuntimeData < 0 {
+		return fmt.Errorf("执行限制不能为负数")
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if err := SetSetting(scriptLimitsKey, string(data)); err != nil {
+		return err
+	}
+	return utils.SetScriptLimits(config.Limits())
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// scriptLookupMaxNodes 单次节点查询返回的最大数量
+const scriptLookupMaxNodes = 5000
+
+// ScriptAirportInfo 脚本可读取的机场信息（不包含订阅地址和请求配置等敏感信息）
+type ScriptAirportInfo struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Group         string `json:"group"`
+	Enabled       bool   `json:"enabled"`
+	Remark        string `json:"remark"`
+	NodeCount     int    `json:"nodeCount"`
+	UsageUpload   int64  `json:"usageUpload"`
+	UsageDownload int64  `json:"usageDownload"`
+	UsageTotal    int64  `json:"usageTotal"`
+	UsageExpire   int64  `json:"usageExpire"`
+}
+
+// ScriptLookup 脚本运行时的只读数据查询
+// kind: nodes（按 NodeFilter 字段过滤，如 group、source、countries、tags）、node（按 name 查询）、tags、airports
+func ScriptLookup(kind string, query map[string]interface{}) (interface{}, error) {
+	switch kind {
+	case "nodes":
+		var filter NodeFilter
+		if len(query) > 0 {
+			data, err := json.Marshal(query)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(data, &filter); err != nil {
+				return nil, fmt.Errorf("节点查询条件错误: %v", err)
+			}
+		}
+		var node Node
+		nodes, err := node.ListWithFilters(filter)
+		if err != nil {
+			return nil, err
+		}
+		if len(nodes) > scriptLookupMaxNodes {
+			nodes = nodes[:scriptLookupMaxNodes]
+		}
+		return nodes, nil
+	case "node":
+		name, _ := query["name"].(string)
+		if node, ok := GetNodeByName(name); ok {
+			return node, nil
+		}
+		return nil, nil
+	case "tags":
+		var tag Tag
+		return tag.List()
+	case "airports":
+		var airport Airport
+		airports, err := airport.List()
+		if err != nil {
+			return nil, err
+		}
+		infos := make([]ScriptAirportInfo, 0, len(airports))
+		for _, a := range airports {
+			infos = append(infos, ScriptAirportInfo{
+				ID:            a.ID,
+				Name:          a.Name,
+				Group:         a.Group,
+				Enabled:       a.Enabled,
+				Remark:        a.Remark,
+				NodeCount:     len(nodeCache.GetByIndex("sourceID", strconv.Itoa(a.ID))),
+				UsageUpload:   a.UsageUpload,
+				UsageDownload: a.UsageDownload,
+				UsageTotal:    a.UsageTotal,
+				UsageExpire:   a.UsageExpire,
+			})
+		}
+		return infos, nil
+	}
+	return nil, fmt.Errorf("不支持的查询类型: %s", kind)
+}
@@ -0,0 +1,288 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sublink/database"
+	"sublink/utils"
+	"time"
+)
+
+const (
+	scriptRemoteTimeout = 30 * time.Second
+	scriptRemoteMaxSize = 1 << 20
+)
+
+// ScriptUpdateChanged 远程脚本未声明可比较的版本号，但内容已变化
+const ScriptUpdateChanged = "changed"
+
+var (
+	errScriptVersionNotFound = errors.New("历史版本不存在")
+	errScriptNotRemote       = errors.New("脚本未配置远程地址")
+	errScriptPinned          = errors.New("脚本已固定版本，请先取消固定")
+)
+
+// scriptMetaPattern 匹配脚本头部注释中的元信息，如 // @version 1.2.0
+var scriptMetaPattern = regexp.MustCompile(`^\s*(?://|\*|/\*\*?)\s*@(\w+)\s+(.+?)\s*$`)
+
+// ScriptMeta 脚本头部注释声明的元信息
+type ScriptMeta struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+// ParseScriptMeta 解析脚本开头注释中的 @name、@version、@description
+func ParseScriptMeta(content string) ScriptMeta {
+	var meta ScriptMeta
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if !strings.HasPrefix(trimmed, "//") && !strings.HasPrefix(trimmed, "/*") && !strings.HasPrefix(trimmed, "*") {
+			break // 头部注释结束
+		}
+		m := scriptMetaPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		value := strings.TrimSuffix(strings.TrimSpace(m[2]), "*/")
+		switch strings.ToLower(m[1]) {
+		case "name":
+			meta.Name = strings.TrimSpace(value)
+		case "version":
+			meta.Version = strings.TrimSpace(value)
+		case "description":
+			meta.Description = strings.TrimSpace(value)
+		}
+	}
+	return meta
+}
+
+// FetchRemoteScript 下载远程脚本内容
+func FetchRemoteScript(url string) (string, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return "", fmt.Errorf("远程地址必须以 http:// 或 https:// 开头")
+	}
+	client, _, err := utils.CreateProxyHTTPClient(false, "", scriptRemoteTimeout)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("下载脚本失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("下载脚本失败: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, scriptRemoteMaxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("读取脚本失败: %v", err)
+	}
+	if len(data) > scriptRemoteMaxSize {
+		return "", fmt.Errorf("脚本超过 %d 字节", scriptRemoteMaxSize)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", fmt.Errorf("脚本内容为空")
+	}
+	return string(data), nil
+}
+
+// verifyScriptChecksum 校验脚本内容的 SHA256，expected 为空时不校验
+func verifyScriptChecksum(content, expected string) error {
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if expected == "" {
+		return nil
+	}
+	if actual := ScriptChecksum(content); actual != expected {
+		return fmt.Errorf("校验和不匹配: 期望 %s，实际 %s", expected, actual)
+	}
+	return nil
+}
+
+// ImportRemoteScript 从远程地址导入脚本
+// 名称和版本优先使用参数，否则使用脚本头部注释声明的 @name / @version
+func ImportRemoteScript(url, name, checksum string, pinned bool) (*Script, error) {
+	content, err := FetchRemoteScript(url)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyScriptChecksum(content, checksum); err != nil {
+		return nil, err
+	}
+	meta := ParseScriptMeta(content)
+	if name == "" {
+		name = meta.Name
+	}
+	if name == "" {
+		return nil, fmt.Errorf("脚本未声明 @name，请填写名称")
+	}
+	version := meta.Version
+	if version == "" {
+		version = "0.0.0"
+	}
+
+	now := time.Now()
+	script := &Script{
+		Name:           name,
+		Version:        version,
+		Content:        content,
+		SourceURL:      url,
+		Pinned:         pinned,
+		LatestVersion:  meta.Version,
+		LatestChecksum: ScriptChecksum(content),
+		LastCheckAt:    &now,
+	}
+	if script.CheckNameVersion() {
+		return nil, fmt.Errorf("该名称和版本的脚本已存在")
+	}
+	if err := script.Add(); err != nil {
+		return nil, err
+	}
+	return script, nil
+}
+
+// scriptUpdateType 根据最近一次检查结果计算升级提示类型
+func (s *Script) scriptUpdateType() string {
+	if s.SourceURL == "" || s.Pinned || s.LatestChecksum == "" || s.LatestChecksum == s.Checksum {
+		return ""
+	}
+	if _, ok := utils.ParseSemver(s.LatestVersion); ok {
+		return utils.SemverUpdateType(s.Version, s.LatestVersion)
+	}
+	return ScriptUpdateChanged
+}
+
+// saveRemoteState 保存远程检查相关字段并刷新缓存
+func (s *Script) saveRemoteState() error {
+	s.UpdateType = s.scriptUpdateType()
+	err := database.DB.Model(&Script{}).Where("id = ?", s.ID).Updates(map[string]interface{}{
+		"pinned":          s.Pinned,
+		"latest_version":  s.LatestVersion,
+		"latest_checksum": s.LatestChecksum,
+		"update_type":     s.UpdateType,
+		"last_check_at":   s.LastCheckAt,
+		"check_error":     s.CheckError,
+	}).Error
+	if err != nil {
+		return err
+	}
+	scriptCache.Set(s.ID, *s)
+	return nil
+}
+
+// CheckRemoteUpdate 检查远程脚本是否有新版本（只记录结果，不自动升级）
+func (s *Script) CheckRemoteUpdate() error {
+	if s.SourceURL == "" {
+		return errScriptNotRemote
+	}
+	now := time.Now()
+	s.LastCheckAt = &now
+	content, err := FetchRemoteScript(s.SourceURL)
+	if err != nil {
+		s.CheckError = truncateString(err.Error(), 512)
+		if saveErr := s.saveRemoteState(); saveErr != nil {
+			utils.Warn("保存脚本更新检查结果失败 ID: %d: %v", s.ID, saveErr)
+		}
+		return err
+	}
+	s.CheckError = ""
+	s.LatestVersion = ParseScriptMeta(content).Version
+	s.LatestChecksum = ScriptChecksum(content)
+	return s.saveRemoteState()
+}
+
+// UpgradeRemoteScript 将脚本升级为远程最新内容
+// checksum 不为空时校验下载内容，否则校验与最近一次检查到的内容一致，避免升级到未经确认的内容
+func UpgradeRemoteScript(s *Script, checksum string) error {
+	if s.SourceURL == "" {
+		return errScriptNotRemote
+	}
+	if s.Pinned {
+		return errScriptPinned
+	}
+	content, err := FetchRemoteScript(s.SourceURL)
+	if err != nil {
+		return err
+	}
+	if checksum == "" {
+		checksum = s.LatestChecksum
+	}
+	if err := verifyScriptChecksum(content, checksum); err != nil {
+		return fmt.Errorf("%v，远程脚本可能已变化，请重新检查更新", err)
+	}
+	newChecksum := ScriptChecksum(content)
+	if newChecksum == s.Checksum {
+		return fmt.Errorf("已是最新版本")
+	}
+	version := ParseScriptMeta(content).Version
+	if version == "" {
+		version = s.Version
+	}
+	now := time.Now()
+	s.LatestVersion = ParseScriptMeta(content).Version
+	s.LatestChecksum = newChecksum
+	s.LastCheckAt = &now
+	s.CheckError = ""
+	return s.applyContent(content, version, ScriptVersionReasonUpgrade)
+}
+
+// SetScriptPinned 固定或取消固定脚本版本，固定后不再提示升级
+func SetScriptPinned(s *Script, pinned bool) error {
+	s.Pinned = pinned
+	return s.saveRemoteState()
+}
+
+// applyContent 替换脚本内容和版本（升级、回滚时使用），原内容保存为历史版本，并清除失败记录
+func (s *Script) applyContent(content, version, reason string) error {
+	if version != s.Version {
+		for _, other := range scriptCache.GetByIndex("name", s.Name) {
+			if other.ID != s.ID && other.Version == version {
+				return fmt.Errorf("该名称和版本的脚本已存在")
+			}
+		}
+	}
+	if err := SaveScriptVersion(s, reason); err != nil {
+		return err
+	}
+	s.Content = content
+	s.Version = version
+	s.Checksum = ScriptChecksum(content)
+	err := database.DB.Model(&Script{}).Where("id = ?", s.ID).Updates(map[string]interface{}{
+		"content":  s.Content,
+		"version":  s.Version,
+		"checksum": s.Checksum,
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err := s.saveRemoteState(); err != nil {
+		return err
+	}
+	return ClearScriptFailure(s.ID)
+}
+
+// CheckAllScriptUpdates 检查所有远程脚本的更新，返回有可用升级的脚本
+func CheckAllScriptUpdates() []Script {
+	updatable := make([]Script, 0)
+	for _, script := range scriptCache.GetAll() {
+		if script.SourceURL == "" {
+			continue
+		}
+		s := script
+		if err := s.CheckRemoteUpdate(); err != nil {
+			utils.Warn("检查脚本【%s】更新失败: %v", s.Name, err)
+			continue
+		}
+		if s.UpdateType != "" {
+			updatable = append(updatable, s)
+		}
+	}
+	return updatable
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sublink/database"
+	"sublink/utils"
+	"time"
+)
+
+// scriptVersionKeep 每个脚本保留的历史版本数量
+const scriptVersionKeep = 20
+
+// ScriptVersion 脚本历史版本
+// 脚本内容被修改或从远程升级前保存旧内容，用于回滚
+type ScriptVersion struct {
+	ID        int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ScriptID  int       `gorm:"index" json:"scriptId"`
+	Version   string    `json:"version"`
+	Content   string    `gorm:"type:text" json:"content"`
+	Checksum  string    `json:"checksum"`
+	Reason    string    `json:"reason"` // update / upgrade / rollback
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TableName 指定表名
+func (ScriptVersion) TableName() string {
+	return "script_versions"
+}
+
+// 保存历史版本的原因
+const (
+	ScriptVersionReasonUpdate   = "update"   // 手动编辑
+	ScriptVersionReasonUpgrade  = "upgrade"  // 远程升级
+	ScriptVersionReasonRollback = "rollback" // 回滚
+)
+
+// ScriptChecksum 计算脚本内容的 SHA256 校验和
+func ScriptChecksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// SaveScriptVersion 保存脚本当前内容为历史版本，并清理超出保留数量的旧版本
+func SaveScriptVersion(script *Script, reason string) error {
+	version := ScriptVersion{
+		ScriptID: script.ID,
+		Version:  script.Version,
+		Content:  script.Content,
+		Checksum: ScriptChecksum(script.Content),
+		Reason:   reason,
+	}
+	if err := database.DB.Create(&version).Error; err != nil {
+		return err
+	}
+
+	var staleIDs []int
+	database.DB.Model(&ScriptVersion{}).Where("script_id = ?", script.ID).
+		Order("id DESC").Offset(scriptVersionKeep).Pluck("id", &staleIDs)
+	if len(staleIDs) > 0 {
+		if err := database.DB.Where("id IN ?", staleIDs).Delete(&ScriptVersion{}).Error; err != nil {
+			utils.Warn("清理脚本历史版本失败 ID: %d: %v", script.ID, err)
+		}
+	}
+	return nil
+}
+
+// ListScriptVersions 获取脚本的历史版本（最新的在前）
+func ListScriptVersions(scriptID int) ([]ScriptVersion, error) {
+	versions := make([]ScriptVersion, 0)
+	err := database.DB.Where("script_id = ?", scriptID).Order("id DESC").Find(&versions).Error
+	return versions, err
+}
+
+// GetScriptVersionByID 根据ID获取历史版本
+func GetScriptVersionByID(id int) (*ScriptVersion, error) {
+	var version ScriptVersion
+	if err := database.DB.First(&version, id).Error; err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// DeleteScriptVersionsByScript 删除脚本的全部历史版本
+func DeleteScriptVersionsByScript(scriptID int) error {
+	return database.DB.Where("script_id = ?", scriptID).Delete(&ScriptVersion{}).Error
+}
+
+// RollbackScript 将脚本回滚到指定历史版本，回滚前的内容同样保存为历史版本
+func RollbackScript(script *Script, versionID int) error {
+	version, err := GetScriptVersionByID(versionID)
+	if err != nil || version.ScriptID != script.ID {
+		return errScriptVersionNotFound
+	}
+	return script.applyContent(version.Content, version.Version, ScriptVersionReasonRollback)
+}
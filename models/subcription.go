@@ -50,10 +50,23 @@ type Subcription struct {
 	ProtocolWhitelist     string           `json:"ProtocolWhitelist"`                         // 协议白名单（逗号分隔）
 	ProtocolBlacklist     string           `json:"ProtocolBlacklist"`                         // 协议黑名单（逗号分隔）
 	DeduplicationRule     string           `json:"DeduplicationRule"`                         // 去重规则配置(JSON)
+	SelectionRule         string           `json:"SelectionRule"`                             // 分组精选规则配置(JSON)
+	NodeQuery             string           `json:"NodeQuery"`                                 // 动态节点条件(TagConditions JSON)，满足条件的节点自动加入订阅
+	OrderRule             string           `json:"OrderRule"`                                 // 输出排序规则配置(JSON)
+	AutoGroupRule         string           `json:"AutoGroupRule"`                             // 自动代理组规则配置(JSON)
+	TimeRule              string           `json:"TimeRule"`                                  // 时间窗口规则配置(JSON)
+	SnapshotRule          string           `json:"SnapshotRule"`                              // 快照发布规则配置(JSON)
+	HealthGate            string           `json:"HealthGate"`                                // 健康门槛配置(JSON)，未通过时输出最近一次正常的内容
 	RefreshUsageOnRequest bool             `gorm:"default:true" json:"RefreshUsageOnRequest"` // 获取订阅时是否实时刷新用量信息
 	CreatedAt             time.Time        `json:"CreatedAt"`
 	UpdatedAt             time.Time        `json:"UpdatedAt"`
 	DeletedAt             gorm.DeletedAt   `gorm:"index" json:"DeletedAt"`
+
+	Includes           []SubcriptionInclude `gorm:"-" json:"Includes"` // 引用的子订阅（带Sort）
+	DeduplicationDrops []DeduplicationDrop  `gorm:"-" json:"-"`        // 最近一次去重去掉的重复节点（预览使用）
+	FilterTrace        *FilterTrace         `gorm:"-" json:"-"`        // 非空时记录过滤过程（预览使用）
+	ClientCountry      string               `gorm:"-" json:"-"`        // 请求IP所在国家代码（输出排序就近使用）
+	RenderAt           time.Time            `gorm:"-" json:"-"`        // 渲染时间（时间窗口规则使用），为空时使用当前时间
 }
 
 type GroupWithSort struct {
@@ -186,6 +199,13 @@ func (sub *Subcription) Update() error {
 		"protocol_whitelist":       sub.ProtocolWhitelist,
 		"protocol_blacklist":       sub.ProtocolBlacklist,
 		"deduplication_rule":       sub.DeduplicationRule,
+		"selection_rule":           sub.SelectionRule,
+		"node_query":               sub.NodeQuery,
+		"order_rule":               sub.OrderRule,
+		"auto_group_rule":          sub.AutoGroupRule,
+		"time_rule":                sub.TimeRule,
+		"snapshot_rule":            sub.SnapshotRule,
+		"health_gate":              sub.HealthGate,
 		"refresh_usage_on_request": sub.RefreshUsageOnRequest,
 	}
 	err := database.DB.Model(&Subcription{}).Where("id = ? or name = ?", sub.ID, sub.Name).Updates(updates).Error
@@ -309,23 +329,31 @@ func GetSubcriptionByID(id int) (*Subcription, error) {
 // 返回过滤后的节点列表
 func (sub *Subcription) ApplyFilters(nodes []Node) []Node {
 	result := nodes
+	trace := sub.FilterTrace
 
 	// 1. 延迟和速度过滤
 	if sub.DelayTime > 0 || sub.MinSpeed > 0 {
 		var filteredNodes []Node
 		for _, node := range result {
 			if sub.DelayTime > 0 {
-				if node.DelayTime <= 0 || node.DelayTime > sub.DelayTime {
+				if node.DelayTime <= 0 {
+					trace.exclude(&node, FilterStageDelaySpeed, fmt.Sprintf("没有有效延迟（最大延迟 %dms）", sub.DelayTime))
+					continue
+				}
+				if node.DelayTime > sub.DelayTime {
+					trace.exclude(&node, FilterStageDelaySpeed, fmt.Sprintf("延迟 %dms 超过最大延迟 %dms", node.DelayTime, sub.DelayTime))
 					continue
 				}
 			}
 			if sub.MinSpeed > 0 {
 				if node.Speed < sub.MinSpeed {
+					trace.exclude(&node, FilterStageDelaySpeed, fmt.Sprintf("速度 %.2fMB/s 低于最小速度 %.2fMB/s", node.Speed, sub.MinSpeed))
 					continue
 				}
 			}
 			filteredNodes = append(filteredNodes, node)
 		}
+		trace.stage(FilterStageDelaySpeed, "延迟、速度过滤", len(result), len(filteredNodes))
 		result = filteredNodes
 	}
 
@@ -357,14 +385,17 @@ func (sub *Subcription) ApplyFilters(nodes []Node) []Node {
 			country := strings.ToUpper(node.LinkCountry)
 			// 黑名单优先
 			if len(blacklistMap) > 0 && blacklistMap[country] {
+				trace.exclude(&node, FilterStageCountry, fmt.Sprintf("国家 %s 在国家黑名单中", country))
 				continue
 			}
 			// 白名单
 			if len(whitelistMap) > 0 && !whitelistMap[country] {
+				trace.exclude(&node, FilterStageCountry, fmt.Sprintf("国家 %s 不在国家白名单中", country))
 				continue
 			}
 			filteredNodes = append(filteredNodes, node)
 		}
+		trace.stage(FilterStageCountry, "国家过滤", len(result), len(filteredNodes))
 		result = filteredNodes
 	}
 
@@ -397,14 +428,15 @@ func (sub *Subcription) ApplyFilters(nodes []Node) []Node {
 
 			// 黑名单优先
 			if len(blacklistTags) > 0 {
-				isBlacklisted := false
+				blacklistedTag := ""
 				for _, nt := range nodeTags {
 					if blacklistTags[nt] {
-						isBlacklisted = true
+						blacklistedTag = nt
 						break
 					}
 				}
-				if isBlacklisted {
+				if blacklistedTag != "" {
+					trace.exclude(&node, FilterStageTag, fmt.Sprintf("标签【%s】在标签黑名单中", blacklistedTag))
 					continue
 				}
 			}
@@ -419,12 +451,14 @@ func (sub *Subcription) ApplyFilters(nodes []Node) []Node {
 					}
 				}
 				if !isWhitelisted {
+					trace.exclude(&node, FilterStageTag, "没有标签白名单中的标签")
 					continue
 				}
 			}
 
 			filteredNodes = append(filteredNodes, node)
 		}
+		trace.stage(FilterStageTag, "标签过滤", len(result), len(filteredNodes))
 		result = filteredNodes
 	}
 
@@ -437,14 +471,17 @@ func (sub *Subcription) ApplyFilters(nodes []Node) []Node {
 		for _, node := range result {
 			// 黑名单优先
 			if hasBlacklistRules && utils.MatchesNodeNameFilter(sub.NodeNameBlacklist, node.LinkName) {
+				trace.exclude(&node, FilterStageNodeName, "原始名称匹配节点名称黑名单")
 				continue
 			}
 			// 白名单
 			if hasWhitelistRules && !utils.MatchesNodeNameFilter(sub.NodeNameWhitelist, node.LinkName) {
+				trace.exclude(&node, FilterStageNodeName, "原始名称不匹配节点名称白名单")
 				continue
 			}
 			filteredNodes = append(filteredNodes, node)
 		}
+		trace.stage(FilterStageNodeName, "节点名称过滤", len(result), len(filteredNodes))
 		result = filteredNodes
 	}
 
@@ -476,25 +513,123 @@ func (sub *Subcription) ApplyFilters(nodes []Node) []Node {
 			nodeProto := strings.ToLower(node.Protocol)
 			// 黑名单优先
 			if len(blacklistProtos) > 0 && blacklistProtos[nodeProto] {
+				trace.exclude(&node, FilterStageProtocol, fmt.Sprintf("协议 %s 在协议黑名单中", nodeProto))
 				continue
 			}
 			// 白名单
 			if len(whitelistProtos) > 0 && !whitelistProtos[nodeProto] {
+				trace.exclude(&node, FilterStageProtocol, fmt.Sprintf("协议 %s 不在协议白名单中", nodeProto))
 				continue
 			}
 			filteredNodes = append(filteredNodes, node)
 		}
+		trace.stage(FilterStageProtocol, "协议过滤", len(result), len(filteredNodes))
 		result = filteredNodes
 	}
 
-	// 6. 应用去重规则
-	result = sub.ApplyDeduplication(result)
+	// 6. 应用时间窗口规则
+	result = sub.ApplyTimeRules(result)
+
+	// 7. 应用去重规则
+	if sub.DeduplicationRule != "" {
+		before := result
+		result = sub.ApplyDeduplication(result)
+		for _, drop := range sub.DeduplicationDrops {
+			trace.exclude(&before[drop.Index], FilterStageDeduplication, drop.Reason)
+		}
+		trace.stage(FilterStageDeduplication, "去重", len(before), len(result))
+	}
+
+	// 8. 应用分组精选规则
+	result = sub.ApplySelection(result)
+
+	// 9. 应用输出排序规则
+	result = sub.ApplyOrder(result)
 
 	return result
 }
 
 // 读取订阅
 func (sub *Subcription) GetSub(clientType string) error {
+	return sub.getSub(clientType, nil)
+}
+
+// getSub 读取订阅，path 为引用当前订阅的父订阅链（用于子订阅循环检测）
+func (sub *Subcription) getSub(clientType string, path []int) error {
+	if err := sub.loadFilteredNodes(clientType, path); err != nil {
+		return err
+	}
+
+	// 获取脚本信息及其排序
+	var scriptsWithSort []ScriptWithSort
+	err := database.DB.Table("scripts").
+		Select("scripts.*, subcription_scripts.sort").
+		Joins("LEFT JOIN subcription_scripts ON subcription_scripts.script_id = scripts.id").
+		Where("subcription_scripts.subcription_id = ?", sub.ID).
+		Order("subcription_scripts.sort ASC").
+		Scan(&scriptsWithSort).Error
+	if err != nil {
+		return err
+	}
+	sub.ScriptsWithSort = scriptsWithSort
+
+	// 执行节点过滤脚本
+	sub.Nodes = sub.ApplyNodeFilterScripts(sub.Nodes, scriptsWithSort, clientType)
+
+	return nil
+}
+
+// FinalNodeNames 计算订阅节点在输出中的最终名称（应用预处理和重命名规则）
+func (sub *Subcription) FinalNodeNames() map[int]string {
+	nodeNameMap := make(map[int]string, len(sub.Nodes))
+	for idx, v := range sub.Nodes {
+		finalName := v.LinkName // 默认使用原始名称
+		if sub.NodeNameRule != "" {
+			finalName = sub.finalLinkName(idx, v.Link)
+		}
+		nodeNameMap[v.ID] = finalName
+	}
+	return nodeNameMap
+}
+
+// RenamedLinks 第 idx 个节点应用重命名规则后的链接，包含多条链接的节点拆分为多条
+func (sub *Subcription) RenamedLinks(idx int) []string {
+	links := strings.Split(sub.Nodes[idx].Link, ",")
+	if sub.NodeNameRule == "" {
+		return links
+	}
+	for i, link := range links {
+		links[i] = utils.RenameNodeLink(link, sub.finalLinkName(idx, link))
+	}
+	return links
+}
+
+// finalLinkName 按重命名规则计算第 idx 个节点中一条链接的名称（协议取自该链接）
+func (sub *Subcription) finalLinkName(idx int, link string) string {
+	v := sub.Nodes[idx]
+	return utils.RenameNode(sub.NodeNameRule, utils.NodeInfo{
+		Name:        v.Name,
+		LinkName:    utils.PreprocessNodeName(sub.NodeNamePreprocess, v.LinkName),
+		LinkCountry: v.LinkCountry,
+		Speed:       v.Speed,
+		DelayTime:   v.DelayTime,
+		Group:       v.Group,
+		Source:      v.Source,
+		Index:       idx + 1,
+		Protocol:    protocol.GetProtocolFromLink(link),
+		Tags:        v.Tags,
+	})
+}
+
+// LoadFilteredNodes 按排序加载订阅的节点并应用过滤规则，不执行当前订阅的节点过滤脚本
+// 引用的子订阅仍按自身配置执行脚本
+func (sub *Subcription) LoadFilteredNodes() error {
+	return sub.loadFilteredNodes("none", nil)
+}
+
+// loadFilteredNodes 按排序加载订阅的节点（含子订阅）并应用过滤规则
+// 子订阅使用自身的 GetSub 逻辑（包括脚本）获取节点，clientType 原样传递给子订阅
+func (sub *Subcription) loadFilteredNodes(clientType string, path []int) error {
 	// 定义节点排序项结构
 	type NodeSortItem struct {
 		Node
@@ -526,103 +661,144 @@ func (sub *Subcription) GetSub(clientType string) error {
 		return err
 	}
 
-	// 获取通过分组动态选择的节点
-	groupNodeMap := make(map[string][]Node) // groupName -> nodes
-	for _, group := range groups {
-		var groupNodes []Node
-		err = database.DB.Table("nodes").
-			Where("nodes.`group` = ?", group.GroupName).
-			Order("nodes.id ASC").
-			Find(&groupNodes).Error
-		if err != nil {
-			return err
-		}
-		groupNodeMap[group.GroupName] = groupNodes
-	}
-
-	// 创建一个混合列表，包含节点和分组
-	type MixedItem struct {
-		Node    *Node
-		Group   string
-		Sort    int
-		IsGroup bool
+	// 获取子订阅及其排序
+	includes, err := GetSubcriptionIncludes(sub.ID)
+	if err != nil {
+		return err
 	}
 
-	var mixedItems []MixedItem
-
-	// 添加直接选择的节点
+	// 创建一个混合列表，包含节点、分组和子订阅
+	sources := make([]SubcriptionSource, 0, len(directNodeItems)+len(groups)+len(includes))
 	for _, item := range directNodeItems {
 		node := item.Node
-		mixedItems = append(mixedItems, MixedItem{
-			Node:    &node,
-			Sort:    item.Sort,
-			IsGroup: false,
-		})
+		sources = append(sources, SubcriptionSource{Node: &node, Sort: item.Sort})
 	}
-
-	// 添加分组
 	for _, group := range groups {
-		mixedItems = append(mixedItems, MixedItem{
-			Group:   group.GroupName,
-			Sort:    group.Sort,
-			IsGroup: true,
-		})
+		sources = append(sources, SubcriptionSource{Group: group.GroupName, Sort: group.Sort})
+	}
+	for i := range includes {
+		sources = append(sources, SubcriptionSource{Include: &includes[i], Sort: includes[i].Sort})
 	}
 
-	// 按排序值排序混合列表
-	// 使用简单的冒泡排序
-	for i := 0; i < len(mixedItems); i++ {
-		for j := i + 1; j < len(mixedItems); j++ {
-			if mixedItems[i].Sort > mixedItems[j].Sort {
-				mixedItems[i], mixedItems[j] = mixedItems[j], mixedItems[i]
-			}
-		}
+	sub.Nodes, err = sub.mergeSourceNodes(sources, clientType, path)
+	if err != nil {
+		return err
 	}
 
-	// 按排序后的顺序构建最终节点列表
+	// 调用共用的过滤方法
+	sub.Nodes = sub.ApplyFilters(sub.Nodes)
+
+	return nil
+}
+
+// SubcriptionSource 订阅的一个节点来源：单个节点、分组或子订阅，按 Sort 混合排序
+type SubcriptionSource struct {
+	Node    *Node
+	Group   string
+	Include *SubcriptionInclude
+	Sort    int
+}
+
+// LoadSourceNodes 按排序合并节点来源并追加动态条件节点（不应用过滤规则）
+// 供预览未保存的订阅使用，与 GetSub 的合并逻辑一致
+func (sub *Subcription) LoadSourceNodes(sources []SubcriptionSource, clientType string) ([]Node, error) {
+	return sub.mergeSourceNodes(sources, clientType, nil)
+}
+
+// mergeSourceNodes 按排序合并节点、分组和子订阅的节点，按名称和节点ID去重，最后追加满足动态条件的节点
+// path 为引用当前订阅的父订阅链（用于子订阅循环检测）
+func (sub *Subcription) mergeSourceNodes(sources []SubcriptionSource, clientType string, path []int) ([]Node, error) {
+	sorted := append([]SubcriptionSource(nil), sources...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Sort < sorted[j].Sort })
+	childPath := append(append([]int{}, path...), sub.ID)
+
+	trace := sub.FilterTrace
+	offered := 0
 	nodeMap := make(map[string]bool) // 用于去重
-	sub.Nodes = make([]Node, 0)
+	// 同一节点经不同前缀的子订阅引入时名称不同但ID相同，只保留第一个，避免按节点ID生成的名称映射和置顶规则冲突
+	nodeIDs := make(map[int]string)
+	result := make([]Node, 0)
+	add := func(nodes []Node) {
+		offered += len(nodes)
+		for i := range nodes {
+			node := &nodes[i]
+			if nodeMap[node.Name] {
+				trace.exclude(node, FilterStageSource, "与先合并的节点重名")
+				continue
+			}
+			if kept, exists := nodeIDs[node.ID]; exists && node.ID > 0 {
+				trace.exclude(node, FilterStageSource, fmt.Sprintf("与【%s】是同一节点，保留先合并的节点", kept))
+				continue
+			}
+			result = append(result, *node)
+			nodeMap[node.Name] = true
+			if node.ID > 0 {
+				nodeIDs[node.ID] = node.Name
+			}
+		}
+	}
 
-	for _, item := range mixedItems {
-		if item.IsGroup {
+	for _, item := range sorted {
+		switch {
+		case item.Include != nil:
+			// 添加子订阅的节点
+			add(LoadIncludedNodes(*item.Include, sub, clientType, childPath))
+		case item.Group != "":
 			// 添加分组中的所有节点
-			if nodes, exists := groupNodeMap[item.Group]; exists {
-				for _, node := range nodes {
-					if !nodeMap[node.Name] {
-						sub.Nodes = append(sub.Nodes, node)
-						nodeMap[node.Name] = true
-					}
-				}
+			var groupNodes []Node
+			err := database.DB.Table("nodes").
+				Where("nodes.`group` = ?", item.Group).
+				Order("nodes.id ASC").
+				Find(&groupNodes).Error
+			if err != nil {
+				return nil, err
 			}
-		} else {
+			add(groupNodes)
+		case item.Node != nil:
 			// 添加单个节点
-			if item.Node != nil && !nodeMap[item.Node.Name] {
-				sub.Nodes = append(sub.Nodes, *item.Node)
-				nodeMap[item.Node.Name] = true
-			}
+			add([]Node{*item.Node})
 		}
 	}
 
-	// 调用共用的过滤方法
-	sub.Nodes = sub.ApplyFilters(sub.Nodes)
+	// 添加满足动态条件的节点（排在手动选择的节点和分组之后）
+	if sub.NodeQuery != "" {
+		queryNodes, err := QueryNodes(sub.NodeQuery)
+		if err != nil {
+			utils.Warn("订阅【%s】动态节点条件无效: %v", sub.Name, err)
+		}
+		add(queryNodes)
+	}
+	trace.stage(FilterStageSource, "合并节点来源", offered, len(result))
+	return result, nil
+}
 
-	// 获取脚本信息及其排序
-	var scriptsWithSort []ScriptWithSort
-	err = database.DB.Table("scripts").
-		Select("scripts.*, subcription_scripts.sort").
-		Joins("LEFT JOIN subcription_scripts ON subcription_scripts.script_id = scripts.id").
-		Where("subcription_scripts.subcription_id = ?", sub.ID).
-		Order("subcription_scripts.sort ASC").
-		Scan(&scriptsWithSort).Error
+// ParseNodeQuery 解析订阅的动态节点条件
+func ParseNodeQuery(queryJSON string) (*TagConditions, error) {
+	conditions, err := ParseConditions(queryJSON)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	sub.ScriptsWithSort = scriptsWithSort
-
-	// 执行节点过滤脚本
-	sub.Nodes = sub.ApplyNodeFilterScripts(sub.Nodes, scriptsWithSort, clientType)
+	if len(conditions.Conditions) == 0 {
+		return nil, fmt.Errorf("条件不能为空")
+	}
+	return conditions, nil
+}
 
-	return nil
+// QueryNodes 获取满足动态节点条件的全部节点（按ID排序）
+// 在获取订阅时实时计算，新增的节点满足条件即自动加入
+func QueryNodes(queryJSON string) ([]Node, error) {
+	conditions, err := ParseNodeQuery(queryJSON)
+	if err != nil {
+		return nil, err
+	}
+	var result []Node
+	for _, node := range nodeCache.GetAll() {
+		if conditions.EvaluateNode(node) {
+			result = append(result, node)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
 }
 
 // 订阅列表（从缓存获取，批量加载关联数据解决 N+1）
@@ -791,7 +967,23 @@ func batchLoadSubcriptionRelations(subs []Subcription) error {
 		subs[i].ScriptsWithSort = scriptsWithSort
 	}
 
-	// 4. 批量获取日志（使用缓存）
+	// 4. 批量查询所有订阅的子订阅关联
+	var subIncludes []SubcriptionInclude
+	if err := database.DB.Where("subcription_id IN ?", subIDs).Order("sort ASC").Find(&subIncludes).Error; err != nil {
+		return err
+	}
+	subIncludeMap := make(map[int][]SubcriptionInclude)
+	for _, si := range subIncludes {
+		subIncludeMap[si.SubcriptionID] = append(subIncludeMap[si.SubcriptionID], si)
+	}
+	for i := range subs {
+		subs[i].Includes = subIncludeMap[subs[i].ID]
+		if subs[i].Includes == nil {
+			subs[i].Includes = []SubcriptionInclude{}
+		}
+	}
+
+	// 5. 批量获取日志（使用缓存）
 	for i := range subs {
 		subs[i].SubLogs = GetSubLogsBySubcriptionID(subs[i].ID)
 	}
@@ -817,6 +1009,10 @@ func (sub *Subcription) Del() error {
 	if err := database.DB.Where("subcription_id = ?", sub.ID).Delete(&SubcriptionScript{}).Error; err != nil {
 		return err
 	}
+	// 删除子订阅关联（包括其他订阅对本订阅的引用）
+	if err := DeleteSubcriptionIncludes(sub.ID); err != nil {
+		return err
+	}
 	// 删除关联的订阅分享
 	if err := database.DB.Where("subscription_id = ?", sub.ID).Delete(&SubscriptionShare{}).Error; err != nil {
 		return err
@@ -826,6 +1022,18 @@ func (sub *Subcription) Del() error {
 	if err := DeleteChainRulesBySubscriptionID(sub.ID); err != nil {
 		return err
 	}
+	// 删除链式代理检测结果
+	if err := DeleteSubscriptionChainChecks(sub.ID); err != nil {
+		return err
+	}
+	// 删除订阅快照
+	if err := DeleteSubscriptionSnapshots(sub.ID); err != nil {
+		return err
+	}
+	// 删除最近正常输出
+	if err := DeleteSubscriptionLastGoods(sub.ID); err != nil {
+		return err
+	}
 	// 硬删除订阅本身（Unscoped 绕过软删除）
 	err := database.DB.Unscoped().Delete(sub).Error
 	if err != nil {
@@ -859,6 +1067,13 @@ func (sub *Subcription) Copy() (*Subcription, error) {
 		ProtocolWhitelist:     sub.ProtocolWhitelist,
 		ProtocolBlacklist:     sub.ProtocolBlacklist,
 		DeduplicationRule:     sub.DeduplicationRule,
+		SelectionRule:         sub.SelectionRule,
+		NodeQuery:             sub.NodeQuery,
+		OrderRule:             sub.OrderRule,
+		AutoGroupRule:         sub.AutoGroupRule,
+		TimeRule:              sub.TimeRule,
+		SnapshotRule:          sub.SnapshotRule,
+		HealthGate:            sub.HealthGate,
 		RefreshUsageOnRequest: sub.RefreshUsageOnRequest,
 	}
 
@@ -928,6 +1143,20 @@ func (sub *Subcription) Copy() (*Subcription, error) {
 		}
 	}
 
+	// 复制子订阅关联
+	includes, err := GetSubcriptionIncludes(sub.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("查询子订阅关联失败: %w", err)
+	}
+	for _, include := range includes {
+		include.SubcriptionID = newSub.ID
+		if err := tx.Create(&include).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("复制子订阅关联失败: %w", err)
+		}
+	}
+
 	// 复制链式代理规则
 	chainRules := GetChainRulesBySubscriptionID(sub.ID)
 	for _, rule := range chainRules {
@@ -1108,6 +1337,12 @@ type PreviewResult struct {
 	Nodes         []PreviewNode `json:"Nodes"`
 	TotalCount    int           `json:"TotalCount"`    // 原始节点总数
 	FilteredCount int           `json:"FilteredCount"` // 过滤后节点数
+	// 去重时去掉的重复节点及原因
+	Deduplicated []DeduplicationDrop `json:"Deduplicated"`
+	// 节点来源机场最近一次拉取时高级去重去掉的节点
+	AirportDeduplicated []DeduplicationDrop `json:"AirportDeduplicated"`
+	// 过滤过程解释（请求 Explain 时返回）：各阶段节点数量与被排除的节点
+	Explain *FilterTrace `json:"Explain,omitempty"`
 	// 用量信息
 	UsageUpload   int64 `json:"UsageUpload"`   // 已上传流量（字节）
 	UsageDownload int64 `json:"UsageDownload"` // 已下载流量（字节）
@@ -1117,7 +1352,7 @@ type PreviewResult struct {
 
 // PreviewSub 预览订阅节点
 // 该方法调用共用的 ApplyFilters 方法应用过滤逻辑，同时应用重命名规则生成预览信息
-// 注意：调用前需要先设置 sub.Nodes 为待预览的节点列表
+// 注意：调用前需要先设置 sub.Nodes 为待预览的节点列表；需要解释过滤过程时先设置 sub.FilterTrace
 func (sub *Subcription) PreviewSub() (*PreviewResult, error) {
 	// 记录原始节点数
 	totalCount := len(sub.Nodes)
@@ -1169,13 +1404,16 @@ func (sub *Subcription) PreviewSub() (*PreviewResult, error) {
 	}
 
 	return &PreviewResult{
-		Nodes:         previewNodes,
-		TotalCount:    totalCount,
-		FilteredCount: filteredCount,
-		UsageUpload:   upload,
-		UsageDownload: download,
-		UsageTotal:    total,
-		UsageExpire:   expire,
+		Nodes:               previewNodes,
+		TotalCount:          totalCount,
+		FilteredCount:       filteredCount,
+		Deduplicated:        sub.DeduplicationDrops,
+		AirportDeduplicated: AirportDeduplicationDropsForNodes(sub.Nodes),
+		Explain:             sub.FilterTrace,
+		UsageUpload:         upload,
+		UsageDownload:       download,
+		UsageTotal:          total,
+		UsageExpire:         expire,
 	}, nil
 }
 
@@ -1241,13 +1479,15 @@ func (sub *Subcription) ApplyNodeFilterScripts(nodes []Node, scripts []ScriptWit
 	}
 
 	for _, script := range scripts {
-		resJSON, err := utils.RunNodeFilterScript(script.Content, nodesJSON, clientType)
+		resJSON, err := utils.RunNodeFilterScript(script.Content, nodesJSON, clientType, &utils.ScriptEnv{ScriptID: script.ID, ScriptName: script.Name})
 		if err != nil {
 			// filterNode 函数不存在时跳过，不报错（脚本可能只定义了 subMod）
-			if strings.Contains(err.Error(), "filterNode function not found") {
+			if IsScriptEntryMissing(err) {
 				continue
 			}
-			utils.Error("节点过滤脚本执行失败: %v", err)
+			// 执行失败时使用脚本处理前的节点，并记录失败信息
+			utils.Error("节点过滤脚本【%s】执行失败: %v", script.Name, err)
+			RecordScriptFailure(script.ID, err)
 			continue
 		}
 		var newNodes []Node
@@ -1255,6 +1495,7 @@ func (sub *Subcription) ApplyNodeFilterScripts(nodes []Node, scripts []ScriptWit
 			utils.Error("反序列化过滤后节点失败: %v", err)
 			continue
 		}
+		sub.FilterTrace.RecordScript(script.Name, result, newNodes)
 		result = newNodes
 		nodesJSON = resJSON
 	}
@@ -1266,13 +1507,18 @@ func (sub *Subcription) ApplyNodeFilterScripts(nodes []Node, scripts []ScriptWit
 
 // DeduplicationConfig 去重规则配置
 type DeduplicationConfig struct {
-	Mode          string              `json:"mode"`          // 去重模式: none, common, protocol
-	CommonFields  []string            `json:"commonFields"`  // 通用字段列表
-	ProtocolRules map[string][]string `json:"protocolRules"` // 协议特定规则
+	Mode             string              `json:"mode"`             // 去重模式: none, common, protocol
+	CommonFields     []string            `json:"commonFields"`     // 通用字段列表
+	ProtocolRules    map[string][]string `json:"protocolRules"`    // 协议特定规则
+	KeepStrategy     string              `json:"keepStrategy"`     // 重复节点保留策略，见 DedupKeep* 常量，默认保留先出现的节点
+	PreferredSources []string            `json:"preferredSources"` // source_order 策略的来源优先顺序（机场名称、机场ID 或 manual）
+	PreferredTags    []string            `json:"preferredTags"`    // preferred_tag 策略的标签优先顺序
 }
 
 // ApplyDeduplication 应用去重规则
+// 被去掉的重复节点记录在 sub.DeduplicationDrops 中，供预览展示
 func (sub *Subcription) ApplyDeduplication(nodes []Node) []Node {
+	sub.DeduplicationDrops = nil
 	// 如果没有配置去重规则，直接返回
 	if sub.DeduplicationRule == "" {
 		return nodes
@@ -1286,42 +1532,38 @@ func (sub *Subcription) ApplyDeduplication(nodes []Node) []Node {
 	}
 
 	// 根据模式应用去重
+	var result []Node
 	switch config.Mode {
 	case "common":
-		return deduplicateByCommonFields(nodes, config.CommonFields)
+		result, sub.DeduplicationDrops = deduplicateByCommonFields(nodes, &config)
 	case "protocol":
-		return deduplicateByProtocol(nodes, config.ProtocolRules)
+		result, sub.DeduplicationDrops = deduplicateByProtocol(nodes, &config)
 	default:
 		return nodes
 	}
+	return result
 }
 
 // deduplicateByCommonFields 根据通用字段去重
-func deduplicateByCommonFields(nodes []Node, fields []string) []Node {
-	if len(fields) == 0 {
-		return nodes
+func deduplicateByCommonFields(nodes []Node, config *DeduplicationConfig) ([]Node, []DeduplicationDrop) {
+	if len(config.CommonFields) == 0 {
+		return nodes, nil
 	}
 
-	seen := make(map[string]bool)
-	var result []Node
-
-	for _, node := range nodes {
-		// 生成去重Key
-		key := generateNodeKey(&node, fields)
-		if key == "" {
-			// 如果无法生成Key，保留该节点
-			result = append(result, node)
-			continue
-		}
+	keys := make([]string, len(nodes))
+	for i := range nodes {
+		// 生成去重Key，无法生成时保留该节点
+		keys[i] = generateNodeKey(&nodes[i], config.CommonFields)
+	}
 
-		if !seen[key] {
-			seen[key] = true
-			result = append(result, node)
-		}
+	kept, drops := config.SelectDuplicates(nodes, keys)
+	result := make([]Node, 0, len(kept))
+	for _, idx := range kept {
+		result = append(result, nodes[idx])
 	}
 
 	utils.Info("通用字段去重: 原%d个 -> %d个", len(nodes), len(result))
-	return result
+	return result, drops
 }
 
 // generateNodeKey 根据指定字段生成节点的去重Key
@@ -1335,43 +1577,36 @@ func generateNodeKey(node *Node, fields []string) string {
 }
 
 // deduplicateByProtocol 根据协议特定字段去重
-func deduplicateByProtocol(nodes []Node, protocolRules map[string][]string) []Node {
-	if len(protocolRules) == 0 {
-		return nodes
+func deduplicateByProtocol(nodes []Node, config *DeduplicationConfig) ([]Node, []DeduplicationDrop) {
+	if len(config.ProtocolRules) == 0 {
+		return nodes, nil
 	}
 
-	seen := make(map[string]bool)
-	var result []Node
-
-	for _, node := range nodes {
+	keys := make([]string, len(nodes))
+	for i, node := range nodes {
 		// 获取协议类型
 		protoType := protocol.GetProtocolFromLink(node.Link)
 
-		// 获取该协议的去重字段
-		fields, exists := protocolRules[protoType]
+		// 获取该协议的去重字段，没有配置该协议的去重规则时保留节点
+		fields, exists := config.ProtocolRules[protoType]
 		if !exists || len(fields) == 0 {
-			// 没有配置该协议的去重规则，保留节点
-			result = append(result, node)
 			continue
 		}
 
-		// 生成去重Key
-		key := generateProtocolKey(node.Link, protoType, fields)
-		if key == "" {
-			result = append(result, node)
-			continue
+		// 生成去重Key，加上协议类型前缀，避免不同协议间Key冲突
+		if key := generateProtocolKey(node.Link, protoType, fields); key != "" {
+			keys[i] = protoType + ":" + key
 		}
+	}
 
-		// 加上协议类型前缀，避免不同协议间Key冲突
-		fullKey := protoType + ":" + key
-		if !seen[fullKey] {
-			seen[fullKey] = true
-			result = append(result, node)
-		}
+	kept, drops := config.SelectDuplicates(nodes, keys)
+	result := make([]Node, 0, len(kept))
+	for _, idx := range kept {
+		result = append(result, nodes[idx])
 	}
 
 	utils.Info("协议字段去重: 原%d个 -> %d个", len(nodes), len(result))
-	return result
+	return result, drops
 }
 
 // generateProtocolKey 根据协议解析结果生成去重Key
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"sublink/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SubscriptionChainCheck 链式代理端到端检测结果
+// 按（订阅，节点）保存：同一节点在不同订阅中可能使用不同的链路
+type SubscriptionChainCheck struct {
+	ID             int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	SubscriptionID int       `gorm:"uniqueIndex:idx_sub_chain_check;not null" json:"subscriptionId"`
+	NodeID         int       `gorm:"uniqueIndex:idx_sub_chain_check;not null" json:"nodeId"`
+	NodeName       string    `json:"nodeName"`               // 节点在订阅输出中的名称
+	Path           string    `gorm:"type:text" json:"path"`  // 实际检测的链路，如 入口 → 中转 → 落地
+	Hops           int       `json:"hops"`                   // 链路节点数（含落地节点）
+	DelayTime      int       `json:"delayTime"`              // 链路延迟(ms)，失败为 -1
+	DelayStatus    string    `json:"delayStatus"`            // untested / success / timeout / error
+	Speed          float64   `json:"speed"`                  // 链路速度(MB/s)，未测速为 0，失败为 -1
+	SpeedStatus    string    `json:"speedStatus"`            // untested / success / error
+	LandingIP      string    `json:"landingIp"`              // 链路出口IP
+	LinkCountry    string    `json:"linkCountry"`            // 出口IP所在国家
+	Error          string    `gorm:"type:text" json:"error"` // 失败原因（无法构建链路或检测失败）
+	CheckedAt      time.Time `gorm:"autoCreateTime" json:"checkedAt"`
+}
+
+// TableName 指定表名
+func (SubscriptionChainCheck) TableName() string {
+	return "subscription_chain_checks"
+}
+
+// ChainCheckPath 节点的端到端检测链路
+type ChainCheckPath struct {
+	Node     Node     // 目标（落地）节点
+	NodeName string   // 节点在订阅输出中的名称
+	Hops     []Node   // 上级代理节点，按连接顺序排列（入口在前）
+	Names    []string // 链路中每一跳的名称（代理组显示为 组名[选中节点]），最后一项为落地节点
+	Error    string   // 无法构建链路的原因
+}
+
+// Links 链路中每一跳的节点链接，按连接顺序排列，最后一项为落地节点
+func (p ChainCheckPath) Links() []string {
+	links := make([]string, 0, len(p.Hops)+1)
+	for _, hop := range p.Hops {
+		links = append(links, firstNodeLink(hop.Link))
+	}
+	return append(links, firstNodeLink(p.Node.Link))
+}
+
+// firstNodeLink 多链接节点只检测第一个链接
+func firstNodeLink(link string) string {
+	return strings.TrimSpace(strings.Split(link, ",")[0])
+}
+
+// ResolveChainCheckPaths 根据渲染计划解析订阅中设置了上级代理的节点的完整链路
+// 自定义代理组按组类型选择客户端最可能使用的节点：select 使用第一个节点，其他类型使用延迟最低的节点
+// 模板代理组的成员由客户端决定，服务端无法检测，记录为错误
+func ResolveChainCheckPaths(sub *Subcription, plan *ChainRenderPlan) []ChainCheckPath {
+	nodeByName := make(map[string]Node, len(sub.Nodes))
+	for _, v := range sub.Nodes {
+		if _, exists := nodeByName[plan.NodeNameMap[v.ID]]; !exists {
+			nodeByName[plan.NodeNameMap[v.ID]] = v
+		}
+	}
+	groups := make(map[string]CustomProxyGroup, len(plan.CustomGroups))
+	for _, g := range plan.CustomGroups {
+		groups[g.Name] = g
+	}
+
+	paths := make([]ChainCheckPath, 0)
+	for _, v := range sub.Nodes {
+		dialer, ok := plan.NodeDialers[v.ID]
+		if !ok {
+			continue
+		}
+		path := ChainCheckPath{Node: v, NodeName: plan.NodeNameMap[v.ID]}
+		visited := map[string]bool{path.NodeName: true}
+		var names []string
+		for dialer != "" {
+			if visited[dialer] {
+				path.Error = fmt.Sprintf("上级代理【%s】形成环路", dialer)
+				break
+			}
+			visited[dialer] = true
+
+			hop, isNode := nodeByName[dialer]
+			label := dialer
+			if !isNode {
+				g, isGroup := groups[dialer]
+				if !isGroup {
+					path.Error = fmt.Sprintf("上级代理【%s】是模板代理组或不在订阅中，服务端无法确定实际使用的节点", dialer)
+					break
+				}
+				member, found := selectChainGroupMember(g, nodeByName)
+				if !found {
+					path.Error = fmt.Sprintf("自定义代理组【%s】没有可用节点", dialer)
+					break
+				}
+				hop = member
+				label = fmt.Sprintf("%s[%s]", dialer, plan.NodeNameMap[member.ID])
+				visited[plan.NodeNameMap[member.ID]] = true
+			}
+			path.Hops = append([]Node{hop}, path.Hops...)
+			names = append([]string{label}, names...)
+			dialer = plan.NodeDialers[hop.ID]
+		}
+		path.Names = append(names, path.NodeName)
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// selectChainGroupMember 选择自定义代理组中用于检测的节点
+func selectChainGroupMember(g CustomProxyGroup, nodeByName map[string]Node) (Node, bool) {
+	var selected Node
+	found := false
+	for _, name := range g.Proxies {
+		member, ok := nodeByName[name]
+		if !ok {
+			continue
+		}
+		if g.Type == "" || g.Type == "select" {
+			return member, true
+		}
+		if !found || (member.DelayTime > 0 && (selected.DelayTime <= 0 || member.DelayTime < selected.DelayTime)) {
+			selected = member
+			found = true
+		}
+	}
+	return selected, found
+}
+
+// SaveSubscriptionChainChecks 保存订阅的链式代理检测结果，替换该订阅之前的全部结果
+func SaveSubscriptionChainChecks(subscriptionID int, results []SubscriptionChainCheck) error {
+	return database.WithTransaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id = ?", subscriptionID).Delete(&SubscriptionChainCheck{}).Error; err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return nil
+		}
+		for i := range results {
+			results[i].ID = 0
+			results[i].SubscriptionID = subscriptionID
+		}
+		return tx.CreateInBatches(results, 100).Error
+	})
+}
+
+// ListSubscriptionChainChecks 获取订阅的链式代理检测结果
+func ListSubscriptionChainChecks(subscriptionID int) ([]SubscriptionChainCheck, error) {
+	results := make([]SubscriptionChainCheck, 0)
+	err := database.DB.Where("subscription_id = ?", subscriptionID).Order("node_id ASC").Find(&results).Error
+	return results, err
+}
+
+// DeleteSubscriptionChainChecks 删除订阅的链式代理检测结果
+func DeleteSubscriptionChainChecks(subscriptionID int) error {
+	return database.DB.Where("subscription_id = ?", subscriptionID).Delete(&SubscriptionChainCheck{}).Error
+}
@@ -0,0 +1,235 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"sublink/node/protocol"
+	"sublink/utils"
+)
+
+// 链式代理输出客户端
+const (
+	ChainClientClash = "clash"
+	ChainClientSurge = "surge"
+	ChainClientV2ray = "v2ray"
+)
+
+// ChainRenderPlan 订阅链式代理的渲染计划，Clash 和 Surge 输出共用
+type ChainRenderPlan struct {
+	NodeNameMap  map[int]string     // 节点ID -> 输出中的最终名称
+	CustomGroups []CustomProxyGroup // 需要生成的自定义代理组
+	NodeDialers  map[int]string     // 节点ID -> 上级代理（Clash dialer-proxy / Surge underlying-proxy）
+	Diagnostics  []ChainDiagnostic  // 渲染时发现并已处理的问题（环路）
+}
+
+// BuildChainRenderPlan 解析订阅的链式代理规则，计算每个节点的上级代理和需要生成的自定义代理组
+// 优先级：链路中间节点映射 > 目标节点映射 > 节点自身的 DialerProxyName
+// 上级代理形成环路时忽略环路中一个节点的上级代理，避免输出客户端无法加载的配置
+func BuildChainRenderPlan(sub *Subcription, chainRules []SubscriptionChainRule) *ChainRenderPlan {
+	plan := &ChainRenderPlan{
+		NodeNameMap: sub.FinalNodeNames(),
+		NodeDialers: make(map[int]string),
+	}
+	plan.CustomGroups = CollectCustomProxyGroups(chainRules, sub.Nodes, plan.NodeNameMap)
+
+	// 第一阶段：收集所有链路的中间节点 dialer-proxy 映射（key: 节点名称）
+	chainNodeDialerMap := make(map[string]string)
+	// 同时记录每个目标节点应使用的 FinalDialer
+	targetNodeDialerMap := make(map[int]string)
+
+	if len(chainRules) > 0 {
+		for _, v := range sub.Nodes {
+			chainResult := ApplyChainRulesToNodeV2(v, chainRules, sub.Nodes, plan.NodeNameMap)
+			if chainResult == nil || chainResult.FinalDialer == "" {
+				continue
+			}
+			targetNodeDialerMap[v.ID] = chainResult.FinalDialer
+			// 只处理非代理组类型的中间节点（代理组类型的 dialer-proxy 由组本身处理）
+			for _, link := range chainResult.Links {
+				if !link.IsGroup && link.DialerProxy != "" {
+					// 如果同一节点在多个规则中作为中间节点，使用最先匹配的
+					if _, exists := chainNodeDialerMap[link.ProxyName]; !exists {
+						chainNodeDialerMap[link.ProxyName] = link.DialerProxy
+					}
+				}
+			}
+			// 中间节点自定义代理组内节点的 dialer-proxy 映射
+			for memberName, dialerProxy := range chainResult.GroupMemberDialerMap {
+				if _, exists := chainNodeDialerMap[memberName]; !exists {
+					chainNodeDialerMap[memberName] = dialerProxy
+				}
+			}
+		}
+		utils.Debug("[ChainProxy] 收集完成: 目标节点=%d, 中间节点=%d", len(targetNodeDialerMap), len(chainNodeDialerMap))
+	}
+
+	// 第二阶段：计算每个节点最终的上级代理
+	for _, v := range sub.Nodes {
+		dialerProxy := v.DialerProxyName
+		if chainDialer, exists := chainNodeDialerMap[plan.NodeNameMap[v.ID]]; exists {
+			// 作为链路中间节点（最高优先级）
+			dialerProxy = chainDialer
+		} else if targetDialer, exists := targetNodeDialerMap[v.ID]; exists && dialerProxy == "" {
+			// 作为目标节点
+			dialerProxy = targetDialer
+		}
+		if dialerProxy != "" {
+			plan.NodeDialers[v.ID] = dialerProxy
+		}
+	}
+	plan.Diagnostics = plan.breakCycles(sub.Nodes)
+	return plan
+}
+
+// ProtocolGroups 转换为输出使用的自定义代理组
+func (p *ChainRenderPlan) ProtocolGroups() []protocol.CustomProxyGroup {
+	if len(p.CustomGroups) == 0 {
+		return nil
+	}
+	groups := make([]protocol.CustomProxyGroup, 0, len(p.CustomGroups))
+	for _, g := range p.CustomGroups {
+		cpg := protocol.CustomProxyGroup{
+			Name:    g.Name,
+			Type:    g.Type,
+			Proxies: g.Proxies,
+		}
+		if g.URLTestConfig != nil {
+			cpg.URL = g.URLTestConfig.URL
+			cpg.Interval = g.URLTestConfig.Interval
+			cpg.Tolerance = g.URLTestConfig.Tolerance
+			cpg.Strategy = g.URLTestConfig.Strategy
+		}
+		groups = append(groups, cpg)
+	}
+	return groups
+}
+
+// ChainClientNode 客户端输出中节点的上级代理
+type ChainClientNode struct {
+	NodeID      int    `json:"nodeId"`
+	Name        string `json:"name"`
+	DialerProxy string `json:"dialerProxy"`
+}
+
+// ChainClientPreview 链式代理在某个客户端输出中的渲染结果
+type ChainClientPreview struct {
+	Client       string             `json:"client"`       // clash / surge / v2ray
+	Supported    bool               `json:"supported"`    // 该客户端是否支持链式代理
+	DialerField  string             `json:"dialerField"`  // 输出中使用的字段：dialer-proxy / underlying-proxy
+	Nodes        []ChainClientNode  `json:"nodes"`        // 设置了上级代理的节点
+	CustomGroups []CustomProxyGroup `json:"customGroups"` // 生成的自定义代理组
+	Warnings     []string           `json:"warnings"`     // 无法在该客户端表达的规则
+}
+
+// PreviewChainRender 生成链式代理在指定客户端的渲染结果和警告
+// templateGroups 为该客户端模板中的代理组名称，nil 表示未配置模板
+func PreviewChainRender(sub *Subcription, chainRules []SubscriptionChainRule, plan *ChainRenderPlan, client string, templateGroups []string) ChainClientPreview {
+	preview := ChainClientPreview{
+		Client:       client,
+		Nodes:        []ChainClientNode{},
+		CustomGroups: []CustomProxyGroup{},
+		Warnings:     []string{},
+	}
+
+	if client == ChainClientV2ray {
+		if len(plan.NodeDialers) > 0 {
+			preview.Warnings = append(preview.Warnings, "V2Ray（Base64 链接）输出不支持链式代理，链式代理规则和节点前置代理不会生效")
+		}
+		return preview
+	}
+
+	preview.Supported = true
+	preview.DialerField = "dialer-proxy"
+	if client == ChainClientSurge {
+		preview.DialerField = "underlying-proxy"
+	}
+
+	nodeByName := make(map[string]Node, len(sub.Nodes))
+	for _, v := range sub.Nodes {
+		nodeByName[plan.NodeNameMap[v.ID]] = v
+	}
+	customGroupNames := make(map[string]bool, len(plan.CustomGroups))
+	for _, g := range plan.CustomGroups {
+		customGroupNames[g.Name] = true
+	}
+	templateGroupSet := make(map[string]bool, len(templateGroups))
+	for _, name := range templateGroups {
+		templateGroupSet[name] = true
+	}
+	warned := make(map[string]bool)
+	warn := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		if !warned[msg] {
+			warned[msg] = true
+			preview.Warnings = append(preview.Warnings, msg)
+		}
+	}
+	// supported 判断节点是否会出现在该客户端的输出中
+	supported := func(v Node) bool {
+		if client != ChainClientSurge {
+			return true
+		}
+		return protocol.IsSurgeSupportedLink(v.Link)
+	}
+
+	for _, v := range sub.Nodes {
+		dialer, ok := plan.NodeDialers[v.ID]
+		if !ok {
+			continue
+		}
+		name := plan.NodeNameMap[v.ID]
+		if !supported(v) {
+			warn("节点【%s】的协议 %s 不支持 %s 输出，该节点的链式代理不会生效", name, protocol.GetProtocolFromLink(v.Link), client)
+			continue
+		}
+		if hop, isNode := nodeByName[dialer]; isNode {
+			if !supported(hop) {
+				warn("上级代理【%s】的协议 %s 不支持 %s 输出，引用它的节点将无法连接", dialer, protocol.GetProtocolFromLink(hop.Link), client)
+			}
+		} else if !customGroupNames[dialer] && templateGroups != nil && !templateGroupSet[dialer] {
+			warn("上级代理【%s】不是订阅中的节点或代理组，也不在 %s 模板中", dialer, client)
+		}
+		preview.Nodes = append(preview.Nodes, ChainClientNode{NodeID: v.ID, Name: name, DialerProxy: dialer})
+	}
+
+	for _, g := range plan.CustomGroups {
+		rendered := g
+		if client == ChainClientSurge {
+			members := make([]string, 0, len(g.Proxies))
+			for _, member := range g.Proxies {
+				if hop, isNode := nodeByName[member]; isNode && !supported(hop) {
+					warn("自定义代理组【%s】中的节点【%s】不支持 Surge 输出，已从组内移除", g.Name, member)
+					continue
+				}
+				members = append(members, member)
+			}
+			rendered.Proxies = members
+			if g.Type == "load-balance" && g.URLTestConfig != nil && g.URLTestConfig.Strategy == "round-robin" {
+				warn("自定义代理组【%s】：Surge 的 load-balance 不支持 round-robin 策略，已按默认策略输出", g.Name)
+			}
+		}
+		if len(rendered.Proxies) == 0 {
+			warn("自定义代理组【%s】在 %s 输出中没有可用节点，将使用 DIRECT", g.Name, client)
+		}
+		preview.CustomGroups = append(preview.CustomGroups, rendered)
+	}
+
+	// 模板代理组需要存在于该客户端的模板中
+	for _, rule := range chainRules {
+		if !rule.Enabled {
+			continue
+		}
+		items, err := rule.ParseChainConfig()
+		if err != nil {
+			continue
+		}
+		for _, item := range items {
+			if item.Type == "template_group" && templateGroups != nil && !templateGroupSet[item.GroupName] {
+				warn("规则【%s】引用的模板代理组【%s】不在 %s 模板中", rule.Name, item.GroupName, client)
+			}
+		}
+	}
+
+	sort.Slice(preview.Nodes, func(i, j int) bool { return preview.Nodes[i].NodeID < preview.Nodes[j].NodeID })
+	return preview
+}
@@ -417,6 +417,26 @@ func (r *SubscriptionChainRule) ResolveChainLinks(allNodes []Node, nodeNameMap m
 	return result, nil
 }
 
+// includesProxy 判断链路中是否包含指定代理（链路节点或自定义代理组的成员）
+func (r *ChainLinkResult) includesProxy(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, link := range r.Links {
+		if link.ProxyName == name {
+			return true
+		}
+	}
+	for _, g := range r.CustomGroups {
+		for _, member := range g.Proxies {
+			if member == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // getMatchingNodeNames 获取所有匹配条件的节点名称列表
 func (r *SubscriptionChainRule) getMatchingNodeNames(nodes []Node, conditions *TagConditions, nameMap map[int]string) []string {
 	if conditions == nil {
@@ -521,6 +541,11 @@ func ApplyChainRulesToNodeV2(node Node, rules []SubscriptionChainRule, allNodes
 				utils.Warn("规则 %s 解析失败: %v", rule.Name, err)
 				continue
 			}
+			// 节点本身是该规则链路中的一跳时跳过该规则，避免节点通过自身连接
+			if chainResult != nil && chainResult.includesProxy(nodeNameMap[node.ID]) {
+				utils.Debug("[ChainRule] 节点 #%d 是规则 '%s' 链路中的一跳，跳过该规则", node.ID, rule.Name)
+				continue
+			}
 			if chainResult != nil && chainResult.FinalDialer != "" {
 				utils.Debug("[ChainRule] 返回链路: %d 级, FinalDialer=%s (覆盖节点原 DialerProxyName='%s')",
 					len(chainResult.Links), chainResult.FinalDialer, node.DialerProxyName)
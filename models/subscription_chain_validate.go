@@ -0,0 +1,321 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sublink/utils"
+)
+
+// 链式代理诊断级别
+const (
+	ChainDiagnosticError   = "error"   // 客户端会拒绝配置或规则无法生效，保存时拒绝
+	ChainDiagnosticWarning = "warning" // 规则可以输出，但部分配置不会生效
+)
+
+// 链式代理诊断类型
+const (
+	ChainDiagInvalidConfig        = "invalid_config"         // 配置无法解析或缺少必填项
+	ChainDiagMissingNode          = "missing_node"           // 指定的节点已删除或不在订阅中
+	ChainDiagEmptyGroup           = "empty_group"            // 自定义代理组没有匹配的节点
+	ChainDiagNoMatch              = "no_match"               // 动态节点或目标条件没有匹配的节点
+	ChainDiagMissingTemplateGroup = "missing_template_group" // 模板代理组不在模板中
+	ChainDiagNameConflict         = "name_conflict"          // 自定义代理组与节点或模板代理组重名
+	ChainDiagCycle                = "cycle"                  // 上级代理形成环路
+)
+
+// ChainDiagnostic 链式代理规则诊断信息
+type ChainDiagnostic struct {
+	Level    string   `json:"level"`              // error / warning
+	Code     string   `json:"code"`               // 诊断类型
+	RuleID   int      `json:"ruleId,omitempty"`   // 相关规则，环路诊断可能涉及多条规则，为空
+	RuleName string   `json:"ruleName,omitempty"` // 规则名称
+	Item     int      `json:"item,omitempty"`     // 链路项序号（从 1 开始），0 表示目标配置或整条规则
+	Client   string   `json:"client,omitempty"`   // 仅与某个客户端相关时填写（模板代理组）
+	Nodes    []string `json:"nodes,omitempty"`    // 环路经过的节点和代理组
+	Message  string   `json:"message"`
+}
+
+// HasChainErrors 判断诊断中是否存在错误级别的问题
+func HasChainErrors(diags []ChainDiagnostic) bool {
+	for _, d := range diags {
+		if d.Level == ChainDiagnosticError {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateChainRules 校验订阅的链式代理规则，包括每条规则的配置和启用规则之间的环路
+// sub 需已加载节点；templateGroups 为各客户端模板中的代理组名称，未配置模板的客户端为 nil，不检查
+func ValidateChainRules(sub *Subcription, rules []SubscriptionChainRule, templateGroups map[string][]string) []ChainDiagnostic {
+	nodeNameMap := sub.FinalNodeNames()
+	diags := make([]ChainDiagnostic, 0)
+	enabled := make([]SubscriptionChainRule, 0, len(rules))
+	for _, rule := range rules {
+		diags = append(diags, validateChainRule(rule, sub.Nodes, nodeNameMap, templateGroups)...)
+		if rule.Enabled {
+			enabled = append(enabled, rule)
+		}
+	}
+	plan := BuildChainRenderPlan(sub, enabled)
+	return append(diags, plan.Diagnostics...)
+}
+
+// ValidateChainRuleSave 校验保存（新增、修改、启用）单条规则后的结果
+// 只返回该规则自身的问题和保存后新出现的环路，已有规则的问题不影响本次保存
+func ValidateChainRuleSave(sub *Subcription, rule SubscriptionChainRule, templateGroups map[string][]string) []ChainDiagnostic {
+	existing := GetChainRulesBySubscriptionID(sub.ID)
+	before := make([]SubscriptionChainRule, 0, len(existing))
+	after := make([]SubscriptionChainRule, 0, len(existing)+1)
+	replaced := false
+	for _, r := range existing {
+		if r.Enabled {
+			before = append(before, r)
+		}
+		if rule.ID > 0 && r.ID == rule.ID {
+			r = rule
+			replaced = true
+		}
+		if r.Enabled {
+			after = append(after, r)
+		}
+	}
+	if !replaced && rule.Enabled {
+		after = append(after, rule)
+	}
+
+	diags := validateChainRule(rule, sub.Nodes, sub.FinalNodeNames(), templateGroups)
+	existingCycles := make(map[string]bool)
+	for _, d := range BuildChainRenderPlan(sub, before).Diagnostics {
+		existingCycles[strings.Join(d.Nodes, "\x00")] = true
+	}
+	for _, d := range BuildChainRenderPlan(sub, after).Diagnostics {
+		if !existingCycles[strings.Join(d.Nodes, "\x00")] {
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
+
+// validateChainRule 校验单条规则的链路和目标配置
+func validateChainRule(rule SubscriptionChainRule, nodes []Node, nodeNameMap map[int]string, templateGroups map[string][]string) []ChainDiagnostic {
+	diags := make([]ChainDiagnostic, 0)
+	add := func(level, code string, item int, client string, format string, args ...interface{}) {
+		diags = append(diags, ChainDiagnostic{
+			Level:    level,
+			Code:     code,
+			RuleID:   rule.ID,
+			RuleName: rule.Name,
+			Item:     item,
+			Client:   client,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	nodeNames := make(map[string]bool, len(nodeNameMap))
+	for _, name := range nodeNameMap {
+		nodeNames[name] = true
+	}
+	// checkNode 检查指定节点是否存在于订阅中，已删除为错误，被订阅过滤掉为警告
+	checkNode := func(item int, prefix string, nodeID int) {
+		if _, ok := nodeNameMap[nodeID]; ok {
+			return
+		}
+		if node, ok := GetNodeByID(nodeID); ok {
+			add(ChainDiagnosticWarning, ChainDiagMissingNode, item, "", "%s节点【%s】不在订阅当前的节点中（未加入订阅或被过滤），规则不会生效", prefix, node.Name)
+			return
+		}
+		add(ChainDiagnosticError, ChainDiagMissingNode, item, "", "%s指定的节点 ID %d 不存在", prefix, nodeID)
+	}
+	matchCount := func(conditions *TagConditions) int {
+		if conditions == nil {
+			return 0
+		}
+		count := 0
+		for _, node := range nodes {
+			if conditions.EvaluateNode(node) {
+				count++
+			}
+		}
+		return count
+	}
+
+	items, err := rule.ParseChainConfig()
+	if err != nil {
+		add(ChainDiagnosticError, ChainDiagInvalidConfig, 0, "", "代理链配置解析失败: %v", err)
+	} else if len(items) == 0 {
+		add(ChainDiagnosticWarning, ChainDiagInvalidConfig, 0, "", "代理链为空，规则不会生效")
+	}
+	for i, item := range items {
+		idx := i + 1
+		prefix := fmt.Sprintf("链路第 %d 项：", idx)
+		switch item.Type {
+		case "template_group":
+			if item.GroupName == "" {
+				add(ChainDiagnosticError, ChainDiagInvalidConfig, idx, "", "%s模板代理组名称不能为空", prefix)
+				continue
+			}
+			for _, client := range []string{ChainClientClash, ChainClientSurge} {
+				groups := templateGroups[client]
+				if groups != nil && !containsString(groups, item.GroupName) {
+					add(ChainDiagnosticError, ChainDiagMissingTemplateGroup, idx, client, "%s模板代理组【%s】不在 %s 模板中", prefix, item.GroupName, client)
+				}
+			}
+
+		case "custom_group":
+			if item.GroupName == "" {
+				add(ChainDiagnosticError, ChainDiagInvalidConfig, idx, "", "%s自定义代理组名称不能为空", prefix)
+				continue
+			}
+			if nodeNames[item.GroupName] {
+				add(ChainDiagnosticError, ChainDiagNameConflict, idx, "", "%s自定义代理组【%s】与节点重名", prefix, item.GroupName)
+			}
+			for _, client := range []string{ChainClientClash, ChainClientSurge} {
+				if containsString(templateGroups[client], item.GroupName) {
+					add(ChainDiagnosticError, ChainDiagNameConflict, idx, client, "%s自定义代理组【%s】与 %s 模板中的代理组重名", prefix, item.GroupName, client)
+				}
+			}
+			if matchCount(item.NodeConditions) == 0 {
+				add(ChainDiagnosticWarning, ChainDiagEmptyGroup, idx, "", "%s自定义代理组【%s】没有匹配的节点，该组不会输出，引用它的节点不会设置上级代理", prefix, item.GroupName)
+			}
+
+		case "dynamic_node":
+			if matchCount(item.NodeConditions) == 0 {
+				add(ChainDiagnosticWarning, ChainDiagNoMatch, idx, "", "%s动态条件没有匹配的节点，规则不会生效", prefix)
+			}
+
+		case "specified_node":
+			checkNode(idx, prefix, item.NodeID)
+
+		default:
+			add(ChainDiagnosticError, ChainDiagInvalidConfig, idx, "", "%s未知的代理类型 %s", prefix, item.Type)
+		}
+	}
+
+	target, err := rule.ParseTargetConfig()
+	if err != nil {
+		add(ChainDiagnosticError, ChainDiagInvalidConfig, 0, "", "目标节点条件解析失败: %v", err)
+		return diags
+	}
+	switch target.Type {
+	case "all":
+	case "conditions":
+		if target.Conditions == nil {
+			add(ChainDiagnosticError, ChainDiagInvalidConfig, 0, "", "目标节点：条件不能为空")
+		} else if matchCount(target.Conditions) == 0 {
+			add(ChainDiagnosticWarning, ChainDiagNoMatch, 0, "", "目标节点：条件没有匹配的节点，规则不会生效")
+		}
+	case "specified_node":
+		checkNode(0, "目标节点：", target.NodeID)
+	default:
+		add(ChainDiagnosticError, ChainDiagInvalidConfig, 0, "", "目标节点：未知的目标类型 %s", target.Type)
+	}
+	return diags
+}
+
+// breakCycles 检测上级代理环路（节点 -> 上级代理 -> ... -> 节点），移除环路中第一个节点的上级代理
+// 自定义代理组视为指向组内所有节点；模板代理组的成员未知，不参与检测
+func (p *ChainRenderPlan) breakCycles(nodes []Node) []ChainDiagnostic {
+	idByName := make(map[string]int, len(nodes))
+	for _, v := range nodes {
+		if _, exists := idByName[p.NodeNameMap[v.ID]]; !exists {
+			idByName[p.NodeNameMap[v.ID]] = v.ID
+		}
+	}
+	groupMembers := make(map[string][]string, len(p.CustomGroups))
+	for _, g := range p.CustomGroups {
+		groupMembers[g.Name] = g.Proxies
+	}
+	next := func(name string) []string {
+		if id, isNode := idByName[name]; isNode {
+			if dialer, ok := p.NodeDialers[id]; ok {
+				return []string{dialer}
+			}
+			return nil
+		}
+		return groupMembers[name]
+	}
+
+	var diags []ChainDiagnostic
+	for {
+		cycle := findChainCycle(nodes, p.NodeNameMap, next)
+		if cycle == nil {
+			return diags
+		}
+		// 环路中至少包含一个节点（代理组只指向节点）
+		broken := cycle[0]
+		for _, name := range cycle {
+			if _, isNode := idByName[name]; isNode {
+				broken = name
+				break
+			}
+		}
+		delete(p.NodeDialers, idByName[broken])
+		path := strings.Join(append(append([]string{}, cycle...), cycle[0]), " → ")
+		diag := ChainDiagnostic{
+			Level:   ChainDiagnosticError,
+			Code:    ChainDiagCycle,
+			Nodes:   cycle,
+			Message: fmt.Sprintf("上级代理形成环路：%s，已忽略节点【%s】的上级代理", path, broken),
+		}
+		utils.Warn("[ChainProxy] %s", diag.Message)
+		diags = append(diags, diag)
+	}
+}
+
+// findChainCycle 从订阅节点出发深度优先搜索，返回找到的第一个环路（按访问顺序），没有环路返回 nil
+func findChainCycle(nodes []Node, nodeNameMap map[int]string, next func(string) []string) []string {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var stack []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, to := range next(name) {
+			switch state[to] {
+			case visiting:
+				for i, n := range stack {
+					if n == to {
+						return append([]string{}, stack[i:]...)
+					}
+				}
+			case 0:
+				if cycle := visit(to); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = done
+		return nil
+	}
+
+	names := make([]string, 0, len(nodes))
+	for _, v := range nodes {
+		names = append(names, nodeNameMap[v.ID])
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if state[name] == 0 {
+			if cycle := visit(name); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// containsString 判断字符串列表中是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sublink/database"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+var errSubscriptionLastGoodNotFound = errors.New("没有可用的最近正常输出")
+
+// SubscriptionLastGood 订阅最近一次通过健康门槛的渲染结果（每个客户端类型一份）
+// 实时渲染结果未通过健康门槛时输出该内容，避免客户端拿到空的或节点过少的订阅
+type SubscriptionLastGood struct {
+	ID             int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	SubscriptionID int       `gorm:"uniqueIndex:idx_sub_last_good_client" json:"subscriptionId"`
+	Client         string    `gorm:"uniqueIndex:idx_sub_last_good_client;size:16" json:"client"`
+	Content        string    `gorm:"type:text" json:"-"` // Surge 内容不含托管配置头部
+	Checksum       string    `json:"checksum"`
+	NodeCount      int       `json:"nodeCount"`
+	Nodes          string    `gorm:"type:text" json:"-"` // 节点摘要（SnapshotNode JSON 数组），用于计算流量信息
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// TableName 指定表名
+func (SubscriptionLastGood) TableName() string {
+	return "subscription_last_goods"
+}
+
+// lastGoodSaveInterval 同一订阅同一客户端保存最近正常输出的最短间隔，避免每次请求都渲染和写库
+const lastGoodSaveInterval = 10 * time.Minute
+
+// lastGoodChecksums 已保存内容的校验和（订阅ID:客户端），内容未变化时跳过写库
+var lastGoodChecksums sync.Map
+
+// lastGoodSavedAt 最近一次保存最近正常输出的时间（订阅ID:客户端）
+var lastGoodSavedAt = struct {
+	sync.Mutex
+	times map[string]time.Time
+}{times: make(map[string]time.Time)}
+
+// ParseHealthGate 解析并校验订阅的健康门槛
+func ParseHealthGate(raw string) (*NodeGate, error) {
+	var gate NodeGate
+	if err := json.Unmarshal([]byte(raw), &gate); err != nil {
+		return nil, err
+	}
+	if err := gate.validate(); err != nil {
+		return nil, err
+	}
+	return &gate, nil
+}
+
+// CheckHealthGate 检查输出的节点是否满足订阅的健康门槛，未配置或配置无效时不检查
+func (sub *Subcription) CheckHealthGate(nodes []Node) error {
+	if sub.HealthGate == "" {
+		return nil
+	}
+	gate, err := ParseHealthGate(sub.HealthGate)
+	if err != nil {
+		return nil
+	}
+	return gate.Check(nodes)
+}
+
+// ClaimSubscriptionLastGoodSave 距上次保存超过 lastGoodSaveInterval 时返回 true 并记录本次保存时间
+func ClaimSubscriptionLastGoodSave(subID int, client string) bool {
+	key := lastGoodKey(subID, client)
+	now := time.Now()
+	lastGoodSavedAt.Lock()
+	defer lastGoodSavedAt.Unlock()
+	if savedAt, ok := lastGoodSavedAt.times[key]; ok && now.Sub(savedAt) < lastGoodSaveInterval {
+		return false
+	}
+	lastGoodSavedAt.times[key] = now
+	return true
+}
+
+// SaveSubscriptionLastGood 保存订阅通过健康门槛的渲染结果，内容与已保存的相同时不重复写入
+func SaveSubscriptionLastGood(sub *Subcription, client, content string) error {
+	key := lastGoodKey(sub.ID, client)
+	checksum := ScriptChecksum(content)
+	if saved, ok := lastGoodChecksums.Load(key); ok && saved == checksum {
+		return nil
+	}
+	snapshot := NewSubscriptionSnapshot(sub, "", "")
+	lastGood := SubscriptionLastGood{
+		SubscriptionID: sub.ID,
+		Client:         client,
+		Content:        content,
+		Checksum:       checksum,
+		NodeCount:      snapshot.NodeCount,
+		Nodes:          snapshot.Nodes,
+		UpdatedAt:      time.Now(),
+	}
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subscription_id"}, {Name: "client"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content", "checksum", "node_count", "nodes", "updated_at"}),
+	}).Create(&lastGood).Error
+	if err != nil {
+		return err
+	}
+	lastGoodChecksums.Store(key, checksum)
+	return nil
+}
+
+// GetSubscriptionLastGood 获取订阅指定客户端最近一次通过健康门槛的渲染结果
+func GetSubscriptionLastGood(subID int, client string) (*SubscriptionLastGood, error) {
+	var lastGood SubscriptionLastGood
+	if err := database.DB.Where("subscription_id = ? AND client = ?", subID, client).First(&lastGood).Error; err != nil {
+		return nil, errSubscriptionLastGoodNotFound
+	}
+	return &lastGood, nil
+}
+
+// NodeSummaries 渲染结果中的节点摘要
+func (l *SubscriptionLastGood) NodeSummaries() []SnapshotNode {
+	return (&SubscriptionSnapshot{ID: l.ID, Nodes: l.Nodes}).NodeSummaries()
+}
+
+// DeleteSubscriptionLastGoods 删除订阅保存的全部渲染结果
+func DeleteSubscriptionLastGoods(subID int) error {
+	lastGoodSavedAt.Lock()
+	for _, client := range []string{"v2ray", "clash", "surge"} {
+		lastGoodChecksums.Delete(lastGoodKey(subID, client))
+		delete(lastGoodSavedAt.times, lastGoodKey(subID, client))
+	}
+	lastGoodSavedAt.Unlock()
+	return database.DB.Where("subscription_id = ?", subID).Delete(&SubscriptionLastGood{}).Error
+}
+
+func lastGoodKey(subID int, client string) string {
+	return strconv.Itoa(subID) + ":" + client
+}
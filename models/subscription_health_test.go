@@ -0,0 +1,82 @@
+package models
+
+import (
+	"testing"
+)
+
+// TestCheckHealthGate 测试健康门槛按传入的节点检查
+func TestCheckHealthGate(t *testing.T) {
+	nodes := []Node{
+		{Name: "A", DelayStatus: "success"},
+		{Name: "B", DelayStatus: "timeout"},
+		{Name: "C", DelayStatus: "success"},
+	}
+	cases := []struct {
+		name    string
+		gate    string
+		nodes   []Node
+		wantErr bool
+	}{
+		{"未配置", "", nil, false},
+		{"配置无效", "{", nil, false},
+		{"节点数满足", `{"minNodes":3}`, nodes, false},
+		{"节点数不足", `{"minNodes":3}`, nodes[:2], true},
+		{"健康比例满足", `{"minHealthyRatio":0.6}`, nodes, false},
+		{"健康比例不足", `{"minHealthyRatio":0.6}`, nodes[:2], true},
+		{"没有节点", `{"minHealthyRatio":0.1}`, nil, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sub := &Subcription{HealthGate: tc.gate, Nodes: nodes}
+			if err := sub.CheckHealthGate(tc.nodes); (err != nil) != tc.wantErr {
+				t.Errorf("CheckHealthGate() err = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// TestClaimSubscriptionLastGoodSave 测试保存间隔内只允许保存一次
+func TestClaimSubscriptionLastGoodSave(t *testing.T) {
+	setupTestDB(t, &SubscriptionLastGood{})
+	if !ClaimSubscriptionLastGoodSave(9001, "clash") {
+		t.Fatal("首次保存应被允许")
+	}
+	if ClaimSubscriptionLastGoodSave(9001, "clash") {
+		t.Error("保存间隔内不应重复保存")
+	}
+	if !ClaimSubscriptionLastGoodSave(9001, "surge") {
+		t.Error("不同客户端分别计算保存间隔")
+	}
+	if err := DeleteSubscriptionLastGoods(9001); err != nil {
+		t.Fatalf("删除最近正常输出失败: %v", err)
+	}
+	if !ClaimSubscriptionLastGoodSave(9001, "clash") {
+		t.Error("删除后应允许重新保存")
+	}
+}
+
+// TestSaveSubscriptionLastGood 测试保存和读取最近正常输出
+func TestSaveSubscriptionLastGood(t *testing.T) {
+	setupTestDB(t, &SubscriptionLastGood{})
+	sub := &Subcription{ID: 9002, Nodes: []Node{{Name: "A", Source: "机场", SourceID: 3}}}
+	if err := SaveSubscriptionLastGood(sub, "clash", "proxies: [A]"); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	if err := SaveSubscriptionLastGood(sub, "clash", "proxies: [A, B]"); err != nil {
+		t.Fatalf("更新失败: %v", err)
+	}
+	lastGood, err := GetSubscriptionLastGood(9002, "clash")
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if lastGood.Content != "proxies: [A, B]" || lastGood.NodeCount != 1 {
+		t.Errorf("最近正常输出 = %+v", lastGood)
+	}
+	if summaries := lastGood.NodeSummaries(); len(summaries) != 1 || summaries[0].SourceID != 3 {
+		t.Errorf("节点摘要 = %+v", summaries)
+	}
+	if _, err := GetSubscriptionLastGood(9002, "surge"); err == nil {
+		t.Error("未保存的客户端应返回错误")
+	}
+	DeleteSubscriptionLastGoods(9002)
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sublink/database"
+	"sublink/node/protocol"
+	"sublink/utils"
+)
+
+// SubcriptionInclude 订阅引用的子订阅
+// 子订阅按自身的规则（过滤、去重、脚本）获取节点后并入父订阅，再应用父订阅的规则
+type SubcriptionInclude struct {
+	SubcriptionID int    `gorm:"primaryKey" json:"-"`
+	IncludeID     int    `gorm:"primaryKey" json:"IncludeID"` // 子订阅ID
+	Prefix        string `json:"Prefix"`                      // 子订阅节点名称前缀，为空时不修改名称
+	Sort          int    `gorm:"default:0" json:"Sort"`
+}
+
+// ParseSubcriptionIncludes 解析子订阅列表 JSON（[{"IncludeID":1,"Prefix":"HK-"}]），按数组顺序设置排序
+func ParseSubcriptionIncludes(raw string) ([]SubcriptionInclude, error) {
+	includes := make([]SubcriptionInclude, 0)
+	if strings.TrimSpace(raw) == "" {
+		return includes, nil
+	}
+	var items []SubcriptionInclude
+	if err := json.Unmarshal([]byte(raw), &items); err != nil {
+		return nil, err
+	}
+	seen := make(map[int]bool)
+	for _, item := range items {
+		if item.IncludeID <= 0 || seen[item.IncludeID] {
+			continue
+		}
+		seen[item.IncludeID] = true
+		includes = append(includes, SubcriptionInclude{
+			IncludeID: item.IncludeID,
+			Prefix:    item.Prefix,
+			Sort:      len(includes),
+		})
+	}
+	return includes, nil
+}
+
+// GetSubcriptionIncludes 获取订阅引用的子订阅（按排序）
+func GetSubcriptionIncludes(subID int) ([]SubcriptionInclude, error) {
+	includes := make([]SubcriptionInclude, 0)
+	err := database.DB.Where("subcription_id = ?", subID).Order("sort ASC").Find(&includes).Error
+	return includes, err
+}
+
+// CheckSubcriptionIncludes 检查子订阅是否存在，以及引用后是否形成循环
+func CheckSubcriptionIncludes(subID int, includes []SubcriptionInclude) error {
+	for _, include := range includes {
+		child, err := GetSubcriptionByID(include.IncludeID)
+		if err != nil {
+			return fmt.Errorf("子订阅 ID %d 不存在", include.IncludeID)
+		}
+		if subID > 0 && subcriptionReaches(include.IncludeID, subID, make(map[int]bool)) {
+			return fmt.Errorf("引用子订阅【%s】会形成循环引用", child.Name)
+		}
+	}
+	return nil
+}
+
+// subcriptionReaches 订阅 from 是否直接或间接引用了订阅 target（包括 from 就是 target）
+func subcriptionReaches(from, target int, visited map[int]bool) bool {
+	if from == target {
+		return true
+	}
+	if visited[from] {
+		return false
+	}
+	visited[from] = true
+	includes, err := GetSubcriptionIncludes(from)
+	if err != nil {
+		return false
+	}
+	for _, include := range includes {
+		if subcriptionReaches(include.IncludeID, target, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateIncludes 更新子订阅关联
+func (sub *Subcription) UpdateIncludes(includes []SubcriptionInclude) error {
+	if err := database.DB.Where("subcription_id = ?", sub.ID).Delete(&SubcriptionInclude{}).Error; err != nil {
+		return err
+	}
+	for _, include := range includes {
+		include.SubcriptionID = sub.ID
+		if err := database.DB.Create(&include).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteSubcriptionIncludes 删除订阅的子订阅关联，以及其他订阅对它的引用
+func DeleteSubcriptionIncludes(subID int) error {
+	return database.DB.Where("subcription_id = ? OR include_id = ?", subID, subID).Delete(&SubcriptionInclude{}).Error
+}
+
+// LoadIncludedNodes 使用子订阅的 GetSub 逻辑获取节点，并加上名称前缀
+// parent 为引用子订阅的订阅，子订阅沿用它的请求上下文（客户端国家、渲染时间）
+// path 为当前的引用链（订阅ID），子订阅已在引用链中时跳过，避免循环引用
+func LoadIncludedNodes(include SubcriptionInclude, parent *Subcription, clientType string, path []int) []Node {
+	for _, id := range path {
+		if id == include.IncludeID {
+			utils.Warn("子订阅 ID %d 形成循环引用，已跳过", include.IncludeID)
+			return nil
+		}
+	}
+	child, err := GetSubcriptionByID(include.IncludeID)
+	if err != nil {
+		utils.Warn("子订阅 ID %d 不存在，已跳过", include.IncludeID)
+		return nil
+	}
+	child.ClientCountry = parent.ClientCountry
+	child.RenderAt = parent.RenderAt
+	if parent.FilterTrace != nil {
+		child.FilterTrace = NewFilterTrace()
+	}
+	if err := child.getSub(clientType, path); err != nil {
+		utils.Warn("获取子订阅【%s】节点失败: %v", child.Name, err)
+		return nil
+	}
+	parent.FilterTrace.recordInclude(child.Name, child.FilterTrace)
+
+	nodes := child.Nodes
+	if include.Prefix != "" {
+		for i := range nodes {
+			nodes[i].Name = include.Prefix + nodes[i].Name
+			nodes[i].LinkName = include.Prefix + nodes[i].LinkName
+			// 多节点链接和订阅转换链接无法改名，保持原样
+			link := nodes[i].Link
+			isSubLink := (strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://")) && !protocol.IsHTTPLink(link)
+			if !strings.Contains(link, ",") && !isSubLink {
+				nodes[i].Link = utils.RenameNodeLink(nodes[i].Link, nodes[i].Name)
+			}
+		}
+	}
+	return nodes
+}
@@ -31,6 +31,8 @@ type SubscriptionShare struct {
 	Enabled        bool      `gorm:"default:true" json:"enabled"`         // 是否启用
 	AccessCount    int       `gorm:"default:0" json:"access_count"`       // 访问次数
 	LastAccessAt   time.Time `gorm:"type:datetime" json:"last_access_at"` // 最后访问时间
+	AccessSchedule string    `gorm:"type:text" json:"access_schedule"`    // 可用时段（TimeSchedule JSON），为空表示不限制
+	SnapshotID     int       `gorm:"default:0" json:"snapshot_id"`        // 固定的快照：0 实时渲染，-1 最新发布的快照，其他为快照ID
 	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 }
@@ -124,12 +126,14 @@ func (s *SubscriptionShare) Update() error {
 	}
 
 	err := database.DB.Model(s).Updates(map[string]interface{}{
-		"name":        s.Name,
-		"token":       s.Token,
-		"expire_type": s.ExpireType,
-		"expire_days": s.ExpireDays,
-		"expire_at":   s.ExpireAt,
-		"enabled":     s.Enabled,
+		"name":            s.Name,
+		"token":           s.Token,
+		"expire_type":     s.ExpireType,
+		"expire_days":     s.ExpireDays,
+		"expire_at":       s.ExpireAt,
+		"enabled":         s.Enabled,
+		"access_schedule": s.AccessSchedule,
+		"snapshot_id":     s.SnapshotID,
 	}).Error
 	if err != nil {
 		return err
@@ -232,6 +236,19 @@ func (s *SubscriptionShare) IsExpired() bool {
 	}
 }
 
+// InAccessWindow 检查时间 t 是否在分享的可用时段内，未配置或配置无效时不限制
+func (s *SubscriptionShare) InAccessWindow(t time.Time) bool {
+	if s.AccessSchedule == "" {
+		return true
+	}
+	schedule, err := ParseTimeSchedule(s.AccessSchedule)
+	if err != nil {
+		utils.Warn("分享 %d 的可用时段配置无效: %v", s.ID, err)
+		return true
+	}
+	return schedule.Contains(t)
+}
+
 // RecordAccess 记录一次访问
 func (s *SubscriptionShare) RecordAccess() {
 	s.AccessCount++
@@ -0,0 +1,380 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sublink/database"
+	"sublink/utils"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// subscriptionSnapshotKeep 每个订阅保留的快照数量（被分享固定的快照不计入清理）
+const subscriptionSnapshotKeep = 20
+
+// snapshotAutoPublishDelay 自动发布的合并等待时间，期间多次触发只发布一次
+const snapshotAutoPublishDelay = 30 * time.Second
+
+// 分享固定的快照
+const (
+	ShareSnapshotLive   = 0  // 实时渲染
+	ShareSnapshotLatest = -1 // 最新发布的快照
+)
+
+// 快照发布方式
+const (
+	SnapshotTriggerManual = "manual" // 手动发布
+	SnapshotTriggerAuto   = "auto"   // 机场更新或测速完成后自动发布
+)
+
+var errSubscriptionSnapshotNotFound = errors.New("快照不存在")
+
+// ErrSnapshotUnchanged 快照内容与最新发布的快照相同
+var ErrSnapshotUnchanged = errors.New("内容与最新快照相同")
+
+// SubscriptionSnapshot 订阅快照
+// 发布时按客户端类型分别渲染并保存订阅内容，发布后不再修改；分享可以固定到某个快照，避免机场拉取异常或规则修改直接影响客户端
+type SubscriptionSnapshot struct {
+	ID             int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	SubscriptionID int       `gorm:"uniqueIndex:idx_subscription_snapshot_version" json:"subscriptionId"`
+	Version        int       `gorm:"uniqueIndex:idx_subscription_snapshot_version" json:"version"` // 订阅内递增的版本号
+	Note           string    `json:"note"`
+	Trigger        string    `json:"trigger"` // manual / auto
+	NodeCount      int       `json:"nodeCount"`
+	HealthyCount   int       `json:"healthyCount"`
+	Nodes          string    `gorm:"type:text" json:"-"` // 节点摘要（SnapshotNode JSON 数组）
+	V2ray          string    `gorm:"type:text" json:"-"`
+	Clash          string    `gorm:"type:text" json:"-"`
+	Surge          string    `gorm:"type:text" json:"-"` // 不含托管配置头部，输出时按请求地址插入
+	Checksum       string    `json:"checksum"`           // 节点摘要和各客户端内容的 SHA256
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// TableName 指定表名
+func (SubscriptionSnapshot) TableName() string {
+	return "subscription_snapshots"
+}
+
+// SnapshotNode 快照中的节点摘要，用于比较快照和计算流量信息
+type SnapshotNode struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Source      string `json:"source"`
+	SourceID    int    `json:"sourceId"`
+	LinkCountry string `json:"linkCountry"`
+	Protocol    string `json:"protocol"`
+}
+
+// NodeGate 节点数量校验门槛
+type NodeGate struct {
+	MinNodes        int     `json:"minNodes"`        // 最少节点数，0 表示不限制
+	MinHealthyRatio float64 `json:"minHealthyRatio"` // 最低健康节点比例（0-1，延迟测试成功的节点占比），0 表示不限制
+}
+
+// SnapshotRuleConfig 订阅的快照发布规则
+type SnapshotRuleConfig struct {
+	AutoPublish bool `json:"autoPublish"` // 机场更新或测速完成后自动发布，未通过校验时不发布
+	NodeGate
+}
+
+// ParseSnapshotRule 解析并校验订阅的快照发布规则
+func ParseSnapshotRule(raw string) (*SnapshotRuleConfig, error) {
+	var config SnapshotRuleConfig
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		return nil, err
+	}
+	if err := config.NodeGate.validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (g NodeGate) validate() error {
+	if g.MinNodes < 0 {
+		return fmt.Errorf("最少节点数不能小于 0")
+	}
+	if g.MinHealthyRatio < 0 || g.MinHealthyRatio > 1 {
+		return fmt.Errorf("最低健康比例应在 0 到 1 之间")
+	}
+	return nil
+}
+
+// Check 检查节点是否满足门槛，不满足时返回原因
+func (g NodeGate) Check(nodes []Node) error {
+	if len(nodes) < g.MinNodes {
+		return fmt.Errorf("节点数 %d 少于最少节点数 %d", len(nodes), g.MinNodes)
+	}
+	if g.MinHealthyRatio > 0 {
+		healthy := countHealthyNodes(nodes)
+		if len(nodes) == 0 || float64(healthy)/float64(len(nodes)) < g.MinHealthyRatio {
+			return fmt.Errorf("健康节点 %d/%d 低于最低比例 %.0f%%", healthy, len(nodes), g.MinHealthyRatio*100)
+		}
+	}
+	return nil
+}
+
+// countHealthyNodes 延迟测试成功的节点数量
+func countHealthyNodes(nodes []Node) int {
+	count := 0
+	for _, n := range nodes {
+		if n.DelayStatus == "success" {
+			count++
+		}
+	}
+	return count
+}
+
+// NewSubscriptionSnapshot 根据订阅当前的节点构建快照（不含渲染内容）
+func NewSubscriptionSnapshot(sub *Subcription, trigger, note string) *SubscriptionSnapshot {
+	summaries := make([]SnapshotNode, 0, len(sub.Nodes))
+	for _, n := range sub.Nodes {
+		summaries = append(summaries, SnapshotNode{
+			ID:          n.ID,
+			Name:        n.Name,
+			Source:      n.Source,
+			SourceID:    n.SourceID,
+			LinkCountry: n.LinkCountry,
+			Protocol:    n.Protocol,
+		})
+	}
+	data, _ := json.Marshal(summaries)
+	return &SubscriptionSnapshot{
+		SubscriptionID: sub.ID,
+		Note:           note,
+		Trigger:        trigger,
+		NodeCount:      len(sub.Nodes),
+		HealthyCount:   countHealthyNodes(sub.Nodes),
+		Nodes:          string(data),
+	}
+}
+
+// Content 快照中指定客户端的订阅内容
+func (s *SubscriptionSnapshot) Content(client string) string {
+	switch client {
+	case "clash":
+		return s.Clash
+	case "surge":
+		return s.Surge
+	case "v2ray":
+		return s.V2ray
+	}
+	return ""
+}
+
+// NodeSummaries 快照中的节点摘要
+func (s *SubscriptionSnapshot) NodeSummaries() []SnapshotNode {
+	summaries := make([]SnapshotNode, 0)
+	if s.Nodes != "" {
+		if err := json.Unmarshal([]byte(s.Nodes), &summaries); err != nil {
+			utils.Warn("解析快照 %d 的节点摘要失败: %v", s.ID, err)
+		}
+	}
+	return summaries
+}
+
+// snapshotPublishLocks 每个订阅的发布锁，保证版本号分配和清理不会并发执行
+var snapshotPublishLocks sync.Map
+
+// checksum 计算节点摘要和各客户端内容的 SHA256
+func (s *SubscriptionSnapshot) checksum() string {
+	h := sha256.New()
+	for _, part := range []string{s.Nodes, s.V2ray, s.Clash, s.Surge} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Publish 保存快照，版本号在订阅内递增，并清理超出保留数量且未被分享固定的旧快照
+// skipUnchanged 为 true 时内容与最新快照相同则不保存，返回 ErrSnapshotUnchanged
+func (s *SubscriptionSnapshot) Publish(skipUnchanged bool) error {
+	lock, _ := snapshotPublishLocks.LoadOrStore(s.SubscriptionID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	s.Checksum = s.checksum()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var latest SubscriptionSnapshot
+		if err := tx.Select("version", "checksum").Where("subscription_id = ?", s.SubscriptionID).Order("version DESC").First(&latest).Error; err == nil {
+			if skipUnchanged && latest.Checksum == s.Checksum {
+				return ErrSnapshotUnchanged
+			}
+			s.Version = latest.Version + 1
+		} else {
+			s.Version = 1
+		}
+		return tx.Create(s).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	pinned := make(map[int]bool)
+	for _, share := range GetSharesBySubscriptionID(s.SubscriptionID) {
+		if share.SnapshotID > 0 {
+			pinned[share.SnapshotID] = true
+		}
+	}
+	var ids []int
+	database.DB.Model(&SubscriptionSnapshot{}).Where("subscription_id = ?", s.SubscriptionID).
+		Order("id DESC").Offset(subscriptionSnapshotKeep).Pluck("id", &ids)
+	staleIDs := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !pinned[id] {
+			staleIDs = append(staleIDs, id)
+		}
+	}
+	if len(staleIDs) > 0 {
+		if err := database.DB.Where("id IN ?", staleIDs).Delete(&SubscriptionSnapshot{}).Error; err != nil {
+			utils.Warn("清理订阅快照失败 ID: %d: %v", s.SubscriptionID, err)
+		}
+	}
+	return nil
+}
+
+// ListSubscriptionSnapshots 获取订阅的快照（最新的在前，不含内容）
+func ListSubscriptionSnapshots(subID int) ([]SubscriptionSnapshot, error) {
+	snapshots := make([]SubscriptionSnapshot, 0)
+	err := database.DB.Select("id", "subscription_id", "version", "note", "trigger", "node_count", "healthy_count", "checksum", "created_at").
+		Where("subscription_id = ?", subID).Order("id DESC").Find(&snapshots).Error
+	return snapshots, err
+}
+
+// GetSubscriptionSnapshot 获取订阅的指定快照
+func GetSubscriptionSnapshot(subID, snapshotID int) (*SubscriptionSnapshot, error) {
+	var snapshot SubscriptionSnapshot
+	if err := database.DB.First(&snapshot, snapshotID).Error; err != nil || snapshot.SubscriptionID != subID {
+		return nil, errSubscriptionSnapshotNotFound
+	}
+	return &snapshot, nil
+}
+
+// GetLatestSubscriptionSnapshot 获取订阅最新发布的快照
+func GetLatestSubscriptionSnapshot(subID int) (*SubscriptionSnapshot, error) {
+	var snapshot SubscriptionSnapshot
+	if err := database.DB.Where("subscription_id = ?", subID).Order("id DESC").First(&snapshot).Error; err != nil {
+		return nil, errSubscriptionSnapshotNotFound
+	}
+	return &snapshot, nil
+}
+
+// PinnedSnapshot 获取分享固定的快照，固定为实时渲染时返回 nil
+func (s *SubscriptionShare) PinnedSnapshot() (*SubscriptionSnapshot, error) {
+	switch {
+	case s.SnapshotID == ShareSnapshotLatest:
+		return GetLatestSubscriptionSnapshot(s.SubscriptionID)
+	case s.SnapshotID > 0:
+		return GetSubscriptionSnapshot(s.SubscriptionID, s.SnapshotID)
+	}
+	return nil, nil
+}
+
+// DeleteSubscriptionSnapshot 删除订阅的指定快照，被分享固定的快照不能删除
+func DeleteSubscriptionSnapshot(subID, snapshotID int) error {
+	if _, err := GetSubscriptionSnapshot(subID, snapshotID); err != nil {
+		return err
+	}
+	for _, share := range GetSharesBySubscriptionID(subID) {
+		if share.SnapshotID == snapshotID {
+			return fmt.Errorf("快照已被分享【%s】固定，请先修改分享", share.Name)
+		}
+	}
+	return database.DB.Delete(&SubscriptionSnapshot{}, snapshotID).Error
+}
+
+// DeleteSubscriptionSnapshots 删除订阅的全部快照
+func DeleteSubscriptionSnapshots(subID int) error {
+	return database.DB.Where("subscription_id = ?", subID).Delete(&SubscriptionSnapshot{}).Error
+}
+
+// SnapshotNodeDiff 两个快照之间的节点差异（按节点名称比较）
+type SnapshotNodeDiff struct {
+	Added   []SnapshotNode `json:"added"`
+	Removed []SnapshotNode `json:"removed"`
+	Kept    int            `json:"kept"`
+}
+
+// DiffSnapshotNodes 比较两个快照的节点
+func DiffSnapshotNodes(before, after []SnapshotNode) SnapshotNodeDiff {
+	diff := SnapshotNodeDiff{Added: []SnapshotNode{}, Removed: []SnapshotNode{}}
+	beforeNames := make(map[string]bool, len(before))
+	for _, n := range before {
+		beforeNames[n.Name] = true
+	}
+	afterNames := make(map[string]bool, len(after))
+	for _, n := range after {
+		afterNames[n.Name] = true
+		if beforeNames[n.Name] {
+			diff.Kept++
+		} else {
+			diff.Added = append(diff.Added, n)
+		}
+	}
+	for _, n := range before {
+		if !afterNames[n.Name] {
+			diff.Removed = append(diff.Removed, n)
+		}
+	}
+	return diff
+}
+
+// 快照自动发布回调，由 api 层注册（渲染逻辑在 api 层）
+var (
+	snapshotAutoPublisherMu sync.RWMutex
+	snapshotAutoPublisher   func(subID int)
+)
+
+// 等待中的自动发布，非空时新的触发合并到这次发布
+var (
+	snapshotAutoPublishMu    sync.Mutex
+	snapshotAutoPublishTimer *time.Timer
+)
+
+// RegisterSnapshotAutoPublisher 注册快照自动发布函数
+func RegisterSnapshotAutoPublisher(publisher func(subID int)) {
+	snapshotAutoPublisherMu.Lock()
+	defer snapshotAutoPublisherMu.Unlock()
+	snapshotAutoPublisher = publisher
+}
+
+// TriggerSnapshotAutoPublish 在机场更新或测速完成后调用，等待 snapshotAutoPublishDelay 后为开启自动发布的订阅依次发布快照
+// 等待期间的多次触发合并为一次发布
+func TriggerSnapshotAutoPublish() {
+	snapshotAutoPublishMu.Lock()
+	defer snapshotAutoPublishMu.Unlock()
+	if snapshotAutoPublishTimer != nil {
+		return
+	}
+	snapshotAutoPublishTimer = time.AfterFunc(snapshotAutoPublishDelay, func() {
+		snapshotAutoPublishMu.Lock()
+		snapshotAutoPublishTimer = nil
+		snapshotAutoPublishMu.Unlock()
+		runSnapshotAutoPublish()
+	})
+}
+
+// runSnapshotAutoPublish 为开启自动发布的订阅依次发布快照
+func runSnapshotAutoPublish() {
+	snapshotAutoPublisherMu.RLock()
+	publisher := snapshotAutoPublisher
+	snapshotAutoPublisherMu.RUnlock()
+	if publisher == nil {
+		return
+	}
+
+	var subs []Subcription
+	if err := database.DB.Select("id", "snapshot_rule").Where("snapshot_rule <> ''").Find(&subs).Error; err != nil {
+		utils.Warn("查询自动发布快照的订阅失败: %v", err)
+		return
+	}
+	for _, sub := range subs {
+		if config, err := ParseSnapshotRule(sub.SnapshotRule); err == nil && config.AutoPublish {
+			publisher(sub.ID)
+		}
+	}
+}
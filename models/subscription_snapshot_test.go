@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"sublink/database"
+	"sync"
+	"testing"
+)
+
+// TestSubscriptionSnapshotPublishVersion 测试快照版本号在订阅内递增，内容未变化时可跳过发布
+func TestSubscriptionSnapshotPublishVersion(t *testing.T) {
+	setupTestDB(t, &SubscriptionSnapshot{})
+
+	first := &SubscriptionSnapshot{SubscriptionID: 1, Clash: "proxies: []"}
+	if err := first.Publish(true); err != nil {
+		t.Fatalf("发布快照失败: %v", err)
+	}
+	if first.Version != 1 || first.Checksum == "" {
+		t.Fatalf("版本 = %d，校验值 = %q", first.Version, first.Checksum)
+	}
+
+	same := &SubscriptionSnapshot{SubscriptionID: 1, Clash: "proxies: []"}
+	if err := same.Publish(true); !errors.Is(err, ErrSnapshotUnchanged) {
+		t.Fatalf("内容未变化时应跳过发布, err = %v", err)
+	}
+	// 手动发布不跳过
+	if err := same.Publish(false); err != nil || same.Version != 2 {
+		t.Fatalf("手动发布: 版本 = %d, err = %v", same.Version, err)
+	}
+
+	other := &SubscriptionSnapshot{SubscriptionID: 2, Clash: "proxies: []"}
+	if err := other.Publish(true); err != nil || other.Version != 1 {
+		t.Fatalf("其他订阅: 版本 = %d, err = %v", other.Version, err)
+	}
+
+	// 重复的版本号由唯一索引拒绝
+	duplicate := &SubscriptionSnapshot{SubscriptionID: 1, Version: 2}
+	if err := database.DB.Create(duplicate).Error; err == nil {
+		t.Fatal("同一订阅的重复版本号应被拒绝")
+	}
+}
+
+// TestSubscriptionSnapshotPublishConcurrent 测试并发发布时版本号不重复
+func TestSubscriptionSnapshotPublishConcurrent(t *testing.T) {
+	setupTestDB(t, &SubscriptionSnapshot{})
+
+	const count = 8
+	versions := make([]int, count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			snapshot := &SubscriptionSnapshot{SubscriptionID: 1}
+			errs[i] = snapshot.Publish(false)
+			versions[i] = snapshot.Version
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("发布快照失败: %v", err)
+		}
+	}
+	sort.Ints(versions)
+	for i, v := range versions {
+		if v != i+1 {
+			t.Fatalf("版本号 = %v, want 1..%d", versions, count)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"reflect"
+	"sublink/database"
+	"testing"
+)
+
+// TestLoadSourceNodes 测试节点来源按排序合并并按名称和节点ID去重
+func TestLoadSourceNodes(t *testing.T) {
+	setupTestDB(t, &Node{})
+	stored := []Node{
+		{Name: "香港01", Link: "ss://hk1", Group: "香港"},
+		{Name: "香港02", Link: "ss://hk2", Group: "香港"},
+		{Name: "日本01", Link: "ss://jp1", Group: "日本"},
+	}
+	if err := database.DB.Create(&stored).Error; err != nil {
+		t.Fatalf("创建节点失败: %v", err)
+	}
+
+	direct := Node{Name: "香港02", Link: "ss://direct"}
+	sources := []SubcriptionSource{
+		{Group: "香港", Sort: 2},
+		{Node: &direct, Sort: 1},
+		{Group: "日本", Sort: 0},
+		{Group: "不存在", Sort: 3},
+		// 同一节点经不同前缀引入，名称不同但ID相同
+		{Node: &Node{ID: stored[2].ID, Name: "JP-日本01", Link: "ss://jp1-prefixed"}, Sort: 4},
+	}
+	sub := &Subcription{FilterTrace: NewFilterTrace()}
+	nodes, err := sub.LoadSourceNodes(sources, "preview")
+	if err != nil {
+		t.Fatalf("合并节点失败: %v", err)
+	}
+
+	var links []string
+	for _, node := range nodes {
+		links = append(links, node.Link)
+	}
+	// 排序靠前的来源先加入，同名或同ID的节点只保留第一个
+	if want := []string{"ss://jp1", "ss://direct", "ss://hk1"}; !reflect.DeepEqual(links, want) {
+		t.Fatalf("节点 = %v, want %v", links, want)
+	}
+
+	trace := sub.FilterTrace
+	if want := (FilterStageCount{Stage: FilterStageSource, Name: "合并节点来源", Before: 5, After: 3}); len(trace.Stages) != 1 || trace.Stages[0] != want {
+		t.Fatalf("阶段 = %+v, want %+v", trace.Stages, want)
+	}
+	if len(trace.Excluded) != 2 || trace.Excluded[0].Name != "香港02" || trace.Excluded[1].Name != "JP-日本01" {
+		t.Fatalf("排除的节点 = %+v", trace.Excluded)
+	}
+	for _, excluded := range trace.Excluded {
+		if excluded.Stage != FilterStageSource {
+			t.Errorf("排除阶段 = %s, want %s", excluded.Stage, FilterStageSource)
+		}
+	}
+}
+
+// TestFilterTraceRecordInclude 测试子订阅内部排除的节点并入父订阅的解释
+func TestFilterTraceRecordInclude(t *testing.T) {
+	child := NewFilterTrace()
+	child.exclude(&Node{ID: 3, Name: "美国01"}, FilterStageCountry, "国家 US 在国家黑名单中")
+
+	parent := NewFilterTrace()
+	parent.recordInclude("基础订阅", child)
+	if len(parent.Excluded) != 1 {
+		t.Fatalf("排除的节点数 = %d, want 1", len(parent.Excluded))
+	}
+	excluded := parent.Excluded[0]
+	if excluded.Stage != FilterStageInclude || excluded.ID != 3 {
+		t.Fatalf("排除记录 = %+v", excluded)
+	}
+	if want := "在子订阅【基础订阅】中被排除（country）：国家 US 在国家黑名单中"; excluded.Rule != want {
+		t.Errorf("Rule = %s, want %s", excluded.Rule, want)
+	}
+
+	var none *FilterTrace
+	none.recordInclude("基础订阅", child) // 未开启解释时不记录
+}
@@ -350,7 +350,14 @@ func (tc *TagConditions) EvaluateNode(node Node) bool {
 
 // evaluateCondition 评估单个条件
 func evaluateCondition(node Node, cond TagCondition) bool {
-	fieldValue := getNodeFieldValue(node, cond.Field)
+	if cond.Field == "tag" {
+		return evaluateTagCondition(node, cond)
+	}
+	return matchConditionValue(getNodeFieldValue(node, cond.Field), cond)
+}
+
+// matchConditionValue 使用条件的操作符比较字段值
+func matchConditionValue(fieldValue interface{}, cond TagCondition) bool {
 	compareValue := cond.Value
 
 	switch cond.Operator {
@@ -383,6 +390,31 @@ func evaluateCondition(node Node, cond TagCondition) bool {
 	}
 }
 
+// evaluateTagCondition 评估单个标签条件
+// equals / not_equals 判断节点是否带有该标签，not_contains 要求所有标签都不包含，其他操作符只要有一个标签满足即成立
+func evaluateTagCondition(node Node, cond TagCondition) bool {
+	tagName := fmt.Sprintf("%v", cond.Value)
+	switch cond.Operator {
+	case "equals":
+		return node.HasTagName(tagName)
+	case "not_equals":
+		return !node.HasTagName(tagName)
+	case "not_contains":
+		for _, name := range node.GetTagNames() {
+			if strings.Contains(strings.ToLower(name), strings.ToLower(tagName)) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, name := range node.GetTagNames() {
+		if matchConditionValue(name, cond) {
+			return true
+		}
+	}
+	return false
+}
+
 // getNodeFieldValue 获取节点字段值
 func getNodeFieldValue(node Node, field string) interface{} {
 	switch field {
@@ -402,6 +434,8 @@ func getNodeFieldValue(node Node, field string) interface{} {
 		return node.Protocol
 	case "source":
 		return node.Source
+	case "source_id":
+		return node.SourceID
 	case "group":
 		return node.Group
 	case "speed":
@@ -24,9 +24,10 @@ const (
 type TaskType string
 
 const (
-	TaskTypeSpeedTest TaskType = "speed_test" // 节点测速
-	TaskTypeSubUpdate TaskType = "sub_update" // 订阅更新
-	TaskTypeTagRule   TaskType = "tag_rule"   // 标签规则
+	TaskTypeSpeedTest  TaskType = "speed_test"  // 节点测速
+	TaskTypeSubUpdate  TaskType = "sub_update"  // 订阅更新
+	TaskTypeTagRule    TaskType = "tag_rule"    // 标签规则
+	TaskTypeChainCheck TaskType = "chain_check" // 链式代理检测
 )
 
 // TaskTrigger 任务触发方式
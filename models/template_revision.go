@@ -0,0 +1,193 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"sublink/database"
+	"sublink/utils"
+	"time"
+)
+
+// templateRevisionKeep 每个模板保留的历史版本数量
+const templateRevisionKeep = 30
+
+// templateDiffMaxCells 逐行比较的最大计算量（行数乘积），超过时中间部分按整体替换显示
+const templateDiffMaxCells = 4000000
+
+var errTemplateRevisionNotFound = errors.New("历史版本不存在")
+
+// TemplateRevision 模板历史版本
+// 模板内容被修改或回滚前保存旧内容，用于比较和回滚
+type TemplateRevision struct {
+	ID         int       `gorm:"primaryKey;autoIncrement" json:"id"`
+	TemplateID int       `gorm:"index" json:"templateId"`
+	Name       string    `json:"name"` // 保存时的模板文件名
+	Content    string    `gorm:"type:text" json:"content"`
+	Checksum   string    `json:"checksum"`
+	Reason     string    `json:"reason"` // update / rollback
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// TableName 指定表名
+func (TemplateRevision) TableName() string {
+	return "template_revisions"
+}
+
+// 保存历史版本的原因
+const (
+	TemplateRevisionReasonUpdate   = "update"   // 手动编辑
+	TemplateRevisionReasonRollback = "rollback" // 回滚
+)
+
+// SaveTemplateRevision 保存模板修改前的内容为历史版本，并清理超出保留数量的旧版本
+// 内容与最近一个历史版本相同时不重复保存
+func SaveTemplateRevision(templateID int, name, content, reason string) error {
+	checksum := ScriptChecksum(content)
+	var latest TemplateRevision
+	if err := database.DB.Where("template_id = ?", templateID).Order("id DESC").First(&latest).Error; err == nil && latest.Checksum == checksum {
+		return nil
+	}
+	revision := TemplateRevision{
+		TemplateID: templateID,
+		Name:       name,
+		Content:    content,
+		Checksum:   checksum,
+		Reason:     reason,
+	}
+	if err := database.DB.Create(&revision).Error; err != nil {
+		return err
+	}
+
+	var staleIDs []int
+	database.DB.Model(&TemplateRevision{}).Where("template_id = ?", templateID).
+		Order("id DESC").Offset(templateRevisionKeep).Pluck("id", &staleIDs)
+	if len(staleIDs) > 0 {
+		if err := database.DB.Where("id IN ?", staleIDs).Delete(&TemplateRevision{}).Error; err != nil {
+			utils.Warn("清理模板历史版本失败 ID: %d: %v", templateID, err)
+		}
+	}
+	return nil
+}
+
+// ListTemplateRevisions 获取模板的历史版本（最新的在前，不含内容）
+func ListTemplateRevisions(templateID int) ([]TemplateRevision, error) {
+	revisions := make([]TemplateRevision, 0)
+	err := database.DB.Select("id", "template_id", "name", "checksum", "reason", "created_at").
+		Where("template_id = ?", templateID).Order("id DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+// GetTemplateRevision 获取模板的指定历史版本
+func GetTemplateRevision(templateID, revisionID int) (*TemplateRevision, error) {
+	var revision TemplateRevision
+	if err := database.DB.First(&revision, revisionID).Error; err != nil || revision.TemplateID != templateID {
+		return nil, errTemplateRevisionNotFound
+	}
+	return &revision, nil
+}
+
+// DeleteTemplateRevisions 删除模板的全部历史版本
+func DeleteTemplateRevisions(templateID int) error {
+	return database.DB.Where("template_id = ?", templateID).Delete(&TemplateRevision{}).Error
+}
+
+// TemplateDiffLine 模板差异中的一行
+type TemplateDiffLine struct {
+	Op      string `json:"op"`      // equal / add / remove
+	Text    string `json:"text"`    // 行内容
+	OldLine int    `json:"oldLine"` // 旧内容中的行号，新增行为 0
+	NewLine int    `json:"newLine"` // 新内容中的行号，删除行为 0
+}
+
+// TemplateDiff 两个版本之间的差异
+type TemplateDiff struct {
+	Added   int                `json:"added"`
+	Removed int                `json:"removed"`
+	Lines   []TemplateDiffLine `json:"lines"`
+}
+
+// DiffTemplateContent 按行比较两个版本的模板内容（保持行顺序）
+func DiffTemplateContent(before, after string) TemplateDiff {
+	a := strings.Split(strings.ReplaceAll(before, "\r\n", "\n"), "\n")
+	b := strings.Split(strings.ReplaceAll(after, "\r\n", "\n"), "\n")
+	diff := TemplateDiff{Lines: make([]TemplateDiffLine, 0, len(b))}
+
+	// 跳过相同的开头和结尾，只比较中间部分
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	for i := 0; i < prefix; i++ {
+		diff.Lines = append(diff.Lines, TemplateDiffLine{Op: "equal", Text: a[i], OldLine: i + 1, NewLine: i + 1})
+	}
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+	for _, line := range diffTemplateLines(midA, midB, prefix) {
+		switch line.Op {
+		case "add":
+			diff.Added++
+		case "remove":
+			diff.Removed++
+		}
+		diff.Lines = append(diff.Lines, line)
+	}
+	for i := 0; i < suffix; i++ {
+		oldIdx := len(a) - suffix + i
+		newIdx := len(b) - suffix + i
+		diff.Lines = append(diff.Lines, TemplateDiffLine{Op: "equal", Text: a[oldIdx], OldLine: oldIdx + 1, NewLine: newIdx + 1})
+	}
+	return diff
+}
+
+// diffTemplateLines 使用最长公共子序列比较两段内容，offset 为两段内容在原文中的起始行
+func diffTemplateLines(a, b []string, offset int) []TemplateDiffLine {
+	lines := make([]TemplateDiffLine, 0, len(a)+len(b))
+	if len(a)*len(b) > templateDiffMaxCells {
+		for i, text := range a {
+			lines = append(lines, TemplateDiffLine{Op: "remove", Text: text, OldLine: offset + i + 1})
+		}
+		for j, text := range b {
+			lines = append(lines, TemplateDiffLine{Op: "add", Text: text, NewLine: offset + j + 1})
+		}
+		return lines
+	}
+
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, TemplateDiffLine{Op: "equal", Text: a[i], OldLine: offset + i + 1, NewLine: offset + j + 1})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, TemplateDiffLine{Op: "add", Text: b[j], NewLine: offset + j + 1})
+			j++
+		default:
+			lines = append(lines, TemplateDiffLine{Op: "remove", Text: a[i], OldLine: offset + i + 1})
+			i++
+		}
+	}
+	return lines
+}
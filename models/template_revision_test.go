@@ -0,0 +1,121 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// diffOps 将差异行转换为 "op:text" 形式便于比较
+func diffOps(diff TemplateDiff) []string {
+	ops := make([]string, 0, len(diff.Lines))
+	for _, line := range diff.Lines {
+		ops = append(ops, line.Op+":"+line.Text)
+	}
+	return ops
+}
+
+// TestDiffTemplateContent 测试按行比较模板内容
+func TestDiffTemplateContent(t *testing.T) {
+	cases := []struct {
+		name    string
+		before  string
+		after   string
+		ops     []string
+		added   int
+		removed int
+	}{
+		{
+			name:   "内容相同",
+			before: "a\nb",
+			after:  "a\nb",
+			ops:    []string{"equal:a", "equal:b"},
+		},
+		{
+			name:   "末尾新增",
+			before: "a\nb",
+			after:  "a\nb\nc",
+			ops:    []string{"equal:a", "equal:b", "add:c"},
+			added:  1,
+		},
+		{
+			name:    "中间删除",
+			before:  "a\nb\nc",
+			after:   "a\nc",
+			ops:     []string{"equal:a", "remove:b", "equal:c"},
+			removed: 1,
+		},
+		{
+			name:    "修改一行",
+			before:  "port: 7890\nmode: rule\nlog-level: info",
+			after:   "port: 7890\nmode: global\nlog-level: info",
+			ops:     []string{"equal:port: 7890", "remove:mode: rule", "add:mode: global", "equal:log-level: info"},
+			added:   1,
+			removed: 1,
+		},
+		{
+			name:   "忽略换行符差异",
+			before: "a\r\nb",
+			after:  "a\nb",
+			ops:    []string{"equal:a", "equal:b"},
+		},
+		{
+			name:    "保持行顺序",
+			before:  "a\nb\nc\nd",
+			after:   "b\na\nc\ne\nd",
+			ops:     []string{"remove:a", "equal:b", "add:a", "equal:c", "add:e", "equal:d"},
+			added:   2,
+			removed: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			diff := DiffTemplateContent(tc.before, tc.after)
+			if got := diffOps(diff); strings.Join(got, "|") != strings.Join(tc.ops, "|") {
+				t.Errorf("差异行 = %v, want %v", got, tc.ops)
+			}
+			if diff.Added != tc.added || diff.Removed != tc.removed {
+				t.Errorf("新增/删除 = %d/%d, want %d/%d", diff.Added, diff.Removed, tc.added, tc.removed)
+			}
+		})
+	}
+}
+
+// TestDiffTemplateContentLineNumbers 测试差异行的新旧行号
+func TestDiffTemplateContentLineNumbers(t *testing.T) {
+	diff := DiffTemplateContent("a\nb\nc\nd", "a\nx\nc\nd\ne")
+	want := []TemplateDiffLine{
+		{Op: "equal", Text: "a", OldLine: 1, NewLine: 1},
+		{Op: "remove", Text: "b", OldLine: 2},
+		{Op: "add", Text: "x", NewLine: 2},
+		{Op: "equal", Text: "c", OldLine: 3, NewLine: 3},
+		{Op: "equal", Text: "d", OldLine: 4, NewLine: 4},
+		{Op: "add", Text: "e", NewLine: 5},
+	}
+	if len(diff.Lines) != len(want) {
+		t.Fatalf("差异行数 = %d, want %d: %+v", len(diff.Lines), len(want), diff.Lines)
+	}
+	for i, line := range diff.Lines {
+		if line != want[i] {
+			t.Errorf("第 %d 行 = %+v, want %+v", i, line, want[i])
+		}
+	}
+}
+
+// TestDiffTemplateContentLarge 测试超过比较规模上限时整体按删除和新增输出
+func TestDiffTemplateContentLarge(t *testing.T) {
+	before := make([]string, 0, 2100)
+	after := make([]string, 0, 2100)
+	for i := 0; i < 2100; i++ {
+		before = append(before, fmt.Sprintf("old-%d", i))
+		after = append(after, fmt.Sprintf("new-%d", i))
+	}
+	diff := DiffTemplateContent("head\n"+strings.Join(before, "\n")+"\ntail", "head\n"+strings.Join(after, "\n")+"\ntail")
+	if diff.Added != 2100 || diff.Removed != 2100 {
+		t.Errorf("新增/删除 = %d/%d, want 2100/2100", diff.Added, diff.Removed)
+	}
+	first, last := diff.Lines[0], diff.Lines[len(diff.Lines)-1]
+	if first.Op != "equal" || first.Text != "head" || last.Op != "equal" || last.Text != "tail" || last.OldLine != 2102 || last.NewLine != 2102 {
+		t.Errorf("相同的开头和结尾应保持不变: %+v %+v", first, last)
+	}
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sublink/utils"
+	"time"
+	_ "time/tzdata" // 内嵌时区数据，系统没有时区数据（如精简的容器镜像）时也能加载时区
+)
+
+// 时间窗口规则动作
+const (
+	TimeRuleActionOnly    = "only"    // 匹配的节点只在时间窗口内提供
+	TimeRuleActionExclude = "exclude" // 匹配的节点在时间窗口内不提供
+)
+
+// TimeWindow 时间窗口
+// Days 为空表示每天，Start、End 为空表示全天；End 不晚于 Start 时窗口跨越午夜，星期按开始时间所在日期计算
+type TimeWindow struct {
+	Days  []int  `json:"days"`  // 星期几：0 周日，1 周一 ... 6 周六
+	Start string `json:"start"` // 开始时间 HH:MM
+	End   string `json:"end"`   // 结束时间 HH:MM（不含）
+}
+
+// TimeSchedule 带时区的时间窗口集合，任意窗口包含该时间即视为在时段内
+type TimeSchedule struct {
+	Timezone string       `json:"timezone"` // IANA 时区，如 Asia/Shanghai，为空时使用服务器时区
+	Windows  []TimeWindow `json:"windows"`
+}
+
+// TimeRuleConfig 订阅的时间窗口规则配置
+type TimeRuleConfig struct {
+	Timezone string     `json:"timezone"` // IANA 时区，为空时使用服务器时区
+	Rules    []TimeRule `json:"rules"`
+}
+
+// TimeRule 时间窗口规则，按节点ID或标签匹配节点
+type TimeRule struct {
+	Name    string       `json:"name"`
+	Action  string       `json:"action"`  // only / exclude
+	NodeIDs []int        `json:"nodeIds"` // 匹配的节点ID
+	Tags    []string     `json:"tags"`    // 匹配的标签（带有任一标签即匹配）
+	Windows []TimeWindow `json:"windows"`
+}
+
+// ParseTimeSchedule 解析并校验时间窗口集合
+func ParseTimeSchedule(raw string) (*TimeSchedule, error) {
+	var schedule TimeSchedule
+	if err := json.Unmarshal([]byte(raw), &schedule); err != nil {
+		return nil, err
+	}
+	if _, err := loadTimezone(schedule.Timezone); err != nil {
+		return nil, err
+	}
+	if err := validateTimeWindows(schedule.Windows); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// ParseTimeRule 解析并校验订阅的时间窗口规则
+func ParseTimeRule(raw string) (*TimeRuleConfig, error) {
+	var config TimeRuleConfig
+	if err := json.Unmarshal([]byte(raw), &config); err != nil {
+		return nil, err
+	}
+	if _, err := loadTimezone(config.Timezone); err != nil {
+		return nil, err
+	}
+	for _, rule := range config.Rules {
+		if rule.Action != TimeRuleActionOnly && rule.Action != TimeRuleActionExclude {
+			return nil, fmt.Errorf("规则【%s】的动作 %q 无效，可选 only、exclude", rule.Name, rule.Action)
+		}
+		if err := validateTimeWindows(rule.Windows); err != nil {
+			return nil, fmt.Errorf("规则【%s】: %v", rule.Name, err)
+		}
+	}
+	return &config, nil
+}
+
+// Contains 时间 t 是否在时段内，没有配置窗口时视为始终在时段内
+func (s *TimeSchedule) Contains(t time.Time) bool {
+	if len(s.Windows) == 0 {
+		return true
+	}
+	loc, err := loadTimezone(s.Timezone)
+	if err != nil {
+		return true
+	}
+	return windowsContain(s.Windows, t.In(loc))
+}
+
+// ApplyTimeRules 按时间窗口规则排除当前不提供的节点，时间使用 sub.RenderAt（为空时使用当前时间）
+func (sub *Subcription) ApplyTimeRules(nodes []Node) []Node {
+	if sub.TimeRule == "" || len(nodes) == 0 {
+		return nodes
+	}
+	config, err := ParseTimeRule(sub.TimeRule)
+	if err != nil {
+		utils.Warn("解析时间窗口规则失败: %v", err)
+		return nodes
+	}
+	loc, _ := loadTimezone(config.Timezone)
+	now := sub.RenderAt
+	if now.IsZero() {
+		now = time.Now()
+	}
+	now = now.In(loc)
+
+	result := make([]Node, 0, len(nodes))
+	for i := range nodes {
+		if rule := config.blockingRule(&nodes[i], now); rule != nil {
+			name := rule.Name
+			if name == "" {
+				name = "未命名"
+			}
+			reason := fmt.Sprintf("时间规则【%s】：仅在指定时段内提供", name)
+			if rule.Action == TimeRuleActionExclude {
+				reason = fmt.Sprintf("时间规则【%s】：当前时段不提供", name)
+			}
+			sub.FilterTrace.exclude(&nodes[i], FilterStageTime, reason)
+			continue
+		}
+		result = append(result, nodes[i])
+	}
+	sub.FilterTrace.stage(FilterStageTime, "时间窗口", len(nodes), len(result))
+	return result
+}
+
+// blockingRule 返回在时间 now 排除该节点的第一条规则，节点可用时返回 nil
+func (c *TimeRuleConfig) blockingRule(node *Node, now time.Time) *TimeRule {
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		if !rule.matches(node) {
+			continue
+		}
+		inWindow := windowsContain(rule.Windows, now)
+		if (rule.Action == TimeRuleActionOnly && !inWindow) || (rule.Action == TimeRuleActionExclude && inWindow) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// matches 节点是否匹配规则
+func (r *TimeRule) matches(node *Node) bool {
+	for _, id := range r.NodeIDs {
+		if id > 0 && id == node.ID {
+			return true
+		}
+	}
+	for _, tag := range r.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" && node.HasTagName(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// windowsContain 任意窗口是否包含时间 t（t 已转换到规则时区）
+func windowsContain(windows []TimeWindow, t time.Time) bool {
+	for _, w := range windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w TimeWindow) contains(t time.Time) bool {
+	start, _ := parseClock(w.Start, 0)
+	end, _ := parseClock(w.End, 24*60)
+	minute := t.Hour()*60 + t.Minute()
+	if start < end {
+		return w.onDay(t.Weekday()) && minute >= start && minute < end
+	}
+	// 跨越午夜：当天开始时间之后，或前一天开始的窗口延续到当天结束时间之前
+	if minute >= start {
+		return w.onDay(t.Weekday())
+	}
+	return minute < end && w.onDay((t.Weekday()+6)%7)
+}
+
+func (w TimeWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+func validateTimeWindows(windows []TimeWindow) error {
+	for _, w := range windows {
+		if _, err := parseClock(w.Start, 0); err != nil {
+			return err
+		}
+		if _, err := parseClock(w.End, 24*60); err != nil {
+			return err
+		}
+		for _, d := range w.Days {
+			if d < 0 || d > 6 {
+				return fmt.Errorf("星期 %d 无效，应为 0（周日）到 6（周六）", d)
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock 解析 HH:MM 为当天的分钟数，为空时返回默认值
+func parseClock(value string, def int) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return def, nil
+	}
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return def, fmt.Errorf("时间 %q 格式错误，应为 HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// loadTimezone 加载时区，为空时使用服务器时区
+func loadTimezone(name string) (*time.Location, error) {
+	if strings.TrimSpace(name) == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(strings.TrimSpace(name))
+	if err != nil {
+		return time.Local, fmt.Errorf("时区 %q 无效", name)
+	}
+	return loc, nil
+}
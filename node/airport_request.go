@@ -0,0 +1,261 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sublink/models"
+	"sublink/utils"
+)
+
+// maxLoginResponseSize 登录响应体最大读取长度
+const maxLoginResponseSize = 1 << 20
+
+// airportSession 一次拉取的请求会话：Cookie Jar 和登录获取的 Token，同一次拉取的多个请求共用，只登录一次
+type airportSession struct {
+	cfg   *models.AirportRequestConfig
+	token string
+}
+
+// applyAirportRequestConfig 将机场请求配置应用到订阅请求
+// 依次处理：Cookie Jar 与初始 Cookie、登录流程获取 Token、自定义请求头、Basic Auth
+// 会修改 client（设置 Cookie Jar）与 req（请求头、URL）
+func applyAirportRequestConfig(client *http.Client, req *http.Request, cfg *models.AirportRequestConfig) error {
+	session, err := startAirportSession(client, req.URL, cfg)
+	if err != nil {
+		return err
+	}
+	return session.apply(req)
+}
+
+// startAirportSession 为 client 设置 Cookie Jar 和初始 Cookie，并执行登录流程
+// cfg 为空时返回 nil，nil 会话的 apply 不做任何处理
+func startAirportSession(client *http.Client, target *url.URL, cfg *models.AirportRequestConfig) (*airportSession, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	// 使用 Cookie Jar 保存初始 Cookie 与登录响应设置的 Cookie
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Cookie Jar 失败: %v", err)
+	}
+	client.Jar = jar
+
+	if cfg.Cookies != "" {
+		cookies, err := http.ParseCookie(cfg.Cookies)
+		if err != nil {
+			return nil, fmt.Errorf("Cookie 格式错误: %v", err)
+		}
+		jar.SetCookies(target, cookies)
+		if cfg.Login != nil {
+			if loginURL, err := url.Parse(cfg.Login.URL); err == nil {
+				jar.SetCookies(loginURL, cookies)
+			}
+		}
+	}
+
+	session := &airportSession{cfg: cfg}
+	// 登录流程
+	if cfg.Login != nil {
+		token, err := performAirportLogin(client, cfg.Login)
+		if err != nil {
+			return nil, err
+		}
+		session.token = token
+	}
+	return session, nil
+}
+
+// apply 将登录 Token、自定义请求头和 Basic Auth 应用到请求
+func (s *airportSession) apply(req *http.Request) error {
+	if s == nil {
+		return nil
+	}
+	cfg := s.cfg
+	if s.token != "" {
+		if err := injectAirportToken(req, cfg.Login, s.token); err != nil {
+			return err
+		}
+	}
+
+	// 自定义请求头（覆盖默认请求头，如 User-Agent）
+	for key, value := range cfg.Headers {
+		if key == "" {
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+
+	if cfg.BasicAuth != nil && cfg.BasicAuth.Username != "" {
+		req.SetBasicAuth(cfg.BasicAuth.Username, cfg.BasicAuth.Password)
+	}
+
+	return nil
+}
+
+// performAirportLogin 执行登录请求并按配置提取 Token
+// 未配置 Token 提取方式时返回空字符串，仅依赖登录设置的 Cookie
+func performAirportLogin(client *http.Client, login *models.AirportLoginConfig) (string, error) {
+	method := strings.ToUpper(login.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	var body io.Reader
+	if login.Body != "" {
+		body = strings.NewReader(login.Body)
+	}
+
+	req, err := http.NewRequest(method, login.URL, body)
+	if err != nil {
+		return "", fmt.Errorf("创建登录请求失败: %v", err)
+	}
+	if login.Body != "" {
+		contentType := login.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	for key, value := range login.Headers {
+		if key == "" {
+			continue
+		}
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("登录请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("登录请求返回状态码 %d", resp.StatusCode)
+	}
+
+	var token string
+	switch login.TokenFrom {
+	case "":
+		return "", nil
+	case models.TokenFromHeader:
+		token = resp.Header.Get(login.TokenKey)
+	case models.TokenFromCookie:
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == login.TokenKey {
+				token = cookie.Value
+				break
+			}
+		}
+	case models.TokenFromJSON, models.TokenFromRegex:
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxLoginResponseSize))
+		if err != nil {
+			return "", fmt.Errorf("读取登录响应失败: %v", err)
+		}
+		if login.TokenFrom == models.TokenFromJSON {
+			token, err = extractJSONToken(data, login.TokenKey)
+		} else {
+			token, err = extractRegexToken(data, login.TokenKey)
+		}
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("不支持的 Token 提取方式: %s", login.TokenFrom)
+	}
+
+	if token == "" {
+		return "", fmt.Errorf("登录响应中未找到 Token")
+	}
+	utils.Debug("机场登录成功，已获取 Token")
+	return token, nil
+}
+
+// extractJSONToken 按点分路径从 JSON 中提取 Token，数组使用数字下标（如 data.list.0.token）
+func extractJSONToken(data []byte, path string) (string, error) {
+	var current interface{}
+	if err := json.Unmarshal(data, &current); err != nil {
+		return "", fmt.Errorf("登录响应不是有效的 JSON: %v", err)
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case map[string]interface{}:
+			current = v[key]
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return "", fmt.Errorf("JSON 路径 %s 无效", path)
+			}
+			current = v[idx]
+		default:
+			return "", fmt.Errorf("JSON 路径 %s 无效", path)
+		}
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("JSON 路径 %s 对应的值不是字符串", path)
+	}
+}
+
+// extractRegexToken 按正则从响应体提取 Token，有捕获组时取第一个捕获组
+func extractRegexToken(data []byte, pattern string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("Token 正则表达式错误: %v", err)
+	}
+	match := re.FindSubmatch(data)
+	if match == nil {
+		return "", nil
+	}
+	if len(match) > 1 {
+		return string(match[1]), nil
+	}
+	return string(match[0]), nil
+}
+
+// injectAirportToken 按配置将 Token 注入订阅请求
+func injectAirportToken(req *http.Request, login *models.AirportLoginConfig, token string) error {
+	format := login.InjectFormat
+	if format == "" {
+		format = "{token}"
+	}
+	value := strings.ReplaceAll(format, "{token}", token)
+
+	switch login.InjectTo {
+	case models.TokenInjectHeader:
+		req.Header.Set(login.InjectName, value)
+	case models.TokenInjectQuery:
+		query := req.URL.Query()
+		query.Set(login.InjectName, value)
+		req.URL.RawQuery = query.Encode()
+	case models.TokenInjectURL:
+		// 占位符在 URL 中可能已被转义
+		raw := req.URL.String()
+		raw = strings.ReplaceAll(raw, "%7Btoken%7D", url.QueryEscape(value))
+		raw = strings.ReplaceAll(raw, "{token}", url.QueryEscape(value))
+		newURL, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("注入 Token 后的订阅地址无效: %v", err)
+		}
+		req.URL = newURL
+		req.Host = newURL.Host
+	default:
+		return fmt.Errorf("不支持的 Token 注入方式: %s", login.InjectTo)
+	}
+	return nil
+}
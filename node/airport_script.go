@@ -0,0 +1,180 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sublink/models"
+	"sublink/node/protocol"
+	"sublink/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 导入脚本可在节点对象上设置的附加字段（以下划线开头，避免与 Clash 字段冲突）
+const (
+	importScriptGroupKey = "_group" // 节点分组，覆盖机场默认分组
+	importScriptTagsKey  = "_tags"  // 节点标签名称数组（或逗号分隔字符串）
+)
+
+// airportImportMeta 导入脚本为节点指定的分组与标签
+type airportImportMeta struct {
+	Group string
+	Tags  []string
+}
+
+// applyAirportImportScripts 依次执行机场配置的导入脚本
+// 脚本通过 airportImport(proxies, airport) 处理 Clash 格式的节点列表，可过滤节点、修改字段，
+// 并通过 _group / _tags 字段为节点指定分组和标签
+// 返回处理后的节点列表与逐个对应的分组/标签信息；未配置脚本时 metas 为 nil
+// 单个脚本执行失败时记录日志并跳过该脚本，不影响订阅更新
+func applyAirportImportScripts(airport *models.Airport, proxys []protocol.Proxy, usageInfo *UsageInfo) ([]protocol.Proxy, []airportImportMeta) {
+	if airport == nil || airport.ScriptIDs == "" {
+		return proxys, nil
+	}
+	scripts := airport.GetImportScripts()
+	if len(scripts) == 0 {
+		return proxys, nil
+	}
+
+	airportJSON, err := json.Marshal(buildAirportScriptContext(airport, usageInfo))
+	if err != nil {
+		utils.Error("序列化机场信息失败: %v", err)
+		return proxys, nil
+	}
+
+	items, err := proxiesToScriptItems(proxys)
+	if err != nil {
+		utils.Error("机场【%s】节点转换为脚本输入失败: %v", airport.Name, err)
+		return proxys, nil
+	}
+
+	for _, script := range scripts {
+		itemsJSON, err := json.Marshal(items)
+		if err != nil {
+			utils.Error("序列化节点失败: %v", err)
+			break
+		}
+		resJSON, err := utils.RunAirportImportScript(script.Content, itemsJSON, airportJSON, &utils.ScriptEnv{ScriptID: script.ID, ScriptName: script.Name})
+		if err != nil {
+			utils.Error("机场【%s】导入脚本【%s】执行失败: %v", airport.Name, script.Name, err)
+			if !models.IsScriptEntryMissing(err) {
+				models.RecordScriptFailure(script.ID, err)
+			}
+			continue
+		}
+		var newItems []map[string]interface{}
+		if err := json.Unmarshal(resJSON, &newItems); err != nil {
+			utils.Error("机场【%s】导入脚本【%s】返回值不是节点数组: %v", airport.Name, script.Name, err)
+			continue
+		}
+		utils.Info("📜机场【%s】导入脚本【%s】执行完成，节点数量：%d → %d", airport.Name, script.Name, len(items), len(newItems))
+		items = newItems
+	}
+
+	result := make([]protocol.Proxy, 0, len(items))
+	metas := make([]airportImportMeta, 0, len(items))
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		meta := extractAirportImportMeta(item)
+		proxy, err := scriptItemToProxy(item)
+		if err != nil {
+			utils.Warn("机场【%s】导入脚本返回的节点无效，跳过: %v", airport.Name, err)
+			continue
+		}
+		result = append(result, proxy)
+		metas = append(metas, meta)
+	}
+	return result, metas
+}
+
+// buildAirportScriptContext 构建传给导入脚本的机场信息
+// 优先使用本次拉取获取到的用量信息，否则使用上次保存的用量
+func buildAirportScriptContext(airport *models.Airport, usageInfo *UsageInfo) map[string]interface{} {
+	usage := map[string]interface{}{
+		"upload":   airport.UsageUpload,
+		"download": airport.UsageDownload,
+		"total":    airport.UsageTotal,
+		"expire":   airport.UsageExpire,
+	}
+	if usageInfo != nil && usageInfo.Total != -1 {
+		usage["upload"] = usageInfo.Upload
+		usage["download"] = usageInfo.Download
+		usage["total"] = usageInfo.Total
+		usage["expire"] = usageInfo.Expire
+	}
+	return map[string]interface{}{
+		"id":     airport.ID,
+		"name":   airport.Name,
+		"group":  airport.Group,
+		"remark": airport.Remark,
+		"usage":  usage,
+	}
+}
+
+// proxiesToScriptItems 将节点转换为 Clash 字段名的对象（如 server、ws-opts），便于脚本处理
+func proxiesToScriptItems(proxys []protocol.Proxy) ([]map[string]interface{}, error) {
+	data, err := yaml.Marshal(proxys)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]map[string]interface{}, 0, len(proxys))
+	if err := yaml.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// scriptItemToProxy 将脚本返回的对象转换回节点
+func scriptItemToProxy(item map[string]interface{}) (protocol.Proxy, error) {
+	var proxy protocol.Proxy
+	data, err := yaml.Marshal(item)
+	if err != nil {
+		return proxy, err
+	}
+	if err := yaml.Unmarshal(data, &proxy); err != nil {
+		return proxy, err
+	}
+	if proxy.Name == "" || proxy.Type == "" || proxy.Server == "" {
+		return proxy, fmt.Errorf("缺少 name、type 或 server 字段")
+	}
+	return proxy, nil
+}
+
+// extractAirportImportMeta 取出并移除脚本设置的 _group / _tags 字段
+func extractAirportImportMeta(item map[string]interface{}) airportImportMeta {
+	var meta airportImportMeta
+	if group, ok := item[importScriptGroupKey].(string); ok {
+		meta.Group = strings.TrimSpace(group)
+	}
+	switch tags := item[importScriptTagsKey].(type) {
+	case []interface{}:
+		for _, t := range tags {
+			if name, ok := t.(string); ok && strings.TrimSpace(name) != "" {
+				meta.Tags = append(meta.Tags, strings.TrimSpace(name))
+			}
+		}
+	case string:
+		for _, name := range strings.Split(tags, ",") {
+			if strings.TrimSpace(name) != "" {
+				meta.Tags = append(meta.Tags, strings.TrimSpace(name))
+			}
+		}
+	}
+	delete(item, importScriptGroupKey)
+	delete(item, importScriptTagsKey)
+
+	// 仅保留已存在的标签
+	validTags := make([]string, 0, len(meta.Tags))
+	for _, name := range meta.Tags {
+		if !models.TagExists(name) {
+			utils.Warn("导入脚本指定的标签【%s】不存在，已忽略", name)
+			continue
+		}
+		validTags = append(validTags, name)
+	}
+	meta.Tags = validTags
+	return meta
+}
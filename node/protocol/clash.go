@@ -655,14 +655,18 @@ func EncodeClash(urls []Urls, config OutputConfig) ([]byte, error) {
 	}
 
 	// 生成Clash配置文件
-	return DecodeClash(proxys, config.Clash, config.CustomProxyGroups)
+	if config.TemplateContent != "" {
+		return decodeClashData(proxys, []byte(config.TemplateContent), config.Clash, config.TemplateContext, config.CustomProxyGroups)
+	}
+	return DecodeClash(proxys, config.Clash, config.TemplateContext, config.CustomProxyGroups)
 }
 
 // DecodeClash 用于解析 Clash 配置文件并合并新节点
 // proxys: 新增的节点列表
 // yamlfile: 模板文件路径或 URL
+// templateCtx: 模板渲染上下文，为空时模板按原样使用
 // customGroups: 自定义代理组列表（可选，由链式代理规则生成）
-func DecodeClash(proxys []Proxy, yamlfile string, customGroups ...[]CustomProxyGroup) ([]byte, error) {
+func DecodeClash(proxys []Proxy, yamlfile string, templateCtx *TemplateContext, customGroups ...[]CustomProxyGroup) ([]byte, error) {
 	// 读取 YAML 文件
 	var data []byte
 	var err error
@@ -693,9 +697,16 @@ func DecodeClash(proxys []Proxy, yamlfile string, customGroups ...[]CustomProxyG
 			cache.SetTemplateContent(filename, string(data))
 		}
 	}
+	return decodeClashData(proxys, data, yamlfile, templateCtx, customGroups...)
+}
+
+// decodeClashData 使用模板内容生成 Clash 配置
+func decodeClashData(proxys []Proxy, data []byte, yamlfile string, templateCtx *TemplateContext, customGroups ...[]CustomProxyGroup) ([]byte, error) {
+	// 渲染模板变量和条件段落
+	data = renderTemplateData(data, yamlfile, templateCtx)
 	// 解析 YAML 文件
 	config := make(map[interface{}]interface{})
-	err = yaml.Unmarshal(data, &config)
+	err := yaml.Unmarshal(data, &config)
 	if err != nil {
 		utils.Error("error: %v", err)
 		return nil, err
@@ -707,6 +718,13 @@ func DecodeClash(proxys []Proxy, yamlfile string, customGroups ...[]CustomProxyG
 		// 如果 "proxies" 键不存在，创建一个新的切片
 		proxies = []interface{}{}
 	}
+	// 往ProxyGroup中插入代理列表
+	proxyGroups := config["proxy-groups"].([]interface{})
+
+	// 清除引用不存在代理的 dialer-proxy，Clash 遇到无法解析的 dialer-proxy 会拒绝加载配置
+	knownProxies := clashKnownProxyNames(proxies, proxyGroups, proxys, customGroups...)
+	proxys = dropDanglingDialerProxy(proxys, knownProxies)
+
 	// 定义一个代理列表名字
 	ProxiesNameList := []string{}
 	// 添加新代理
@@ -716,18 +734,21 @@ func DecodeClash(proxys []Proxy, yamlfile string, customGroups ...[]CustomProxyG
 	}
 	// proxies = append(proxies, newProxy)
 	config["proxies"] = proxies
-	// 往ProxyGroup中插入代理列表
-	proxyGroups := config["proxy-groups"].([]interface{})
 
 	// 插入自定义代理组（在模板组之后）
 	// 使用 _custom_group 标记来标识自定义代理组，后续循环时跳过节点追加
 	if len(customGroups) > 0 && len(customGroups[0]) > 0 {
 		for _, cg := range customGroups[0] {
 			// 构建代理组 map
+			// 空代理组会导致客户端拒绝配置，使用 DIRECT 占位
+			groupProxies := cg.Proxies
+			if len(groupProxies) == 0 {
+				groupProxies = []string{"DIRECT"}
+			}
 			groupMap := map[string]interface{}{
 				"name":          cg.Name,
 				"type":          cg.Type,
-				"proxies":       cg.Proxies,
+				"proxies":       groupProxies,
 				"_custom_group": true, // 标记为自定义代理组，不追加所有节点
 			}
 
@@ -834,3 +855,45 @@ func DecodeClash(proxys []Proxy, yamlfile string, customGroups ...[]CustomProxyG
 	}
 	return newData, nil
 }
+
+// clashBuiltinProxies Clash 内置策略，可以作为 dialer-proxy 或代理组成员
+var clashBuiltinProxies = []string{"DIRECT", "REJECT", "REJECT-DROP", "PASS", "COMPATIBLE"}
+
+// clashKnownProxyNames 收集配置中可被引用的代理名称：模板代理、模板代理组、新增节点、自定义代理组和内置策略
+func clashKnownProxyNames(templateProxies, templateGroups []interface{}, proxys []Proxy, customGroups ...[]CustomProxyGroup) map[string]bool {
+	known := make(map[string]bool)
+	for _, name := range clashBuiltinProxies {
+		known[name] = true
+	}
+	for _, list := range [][]interface{}{templateProxies, templateGroups} {
+		for _, item := range list {
+			if m, ok := item.(map[string]interface{}); ok {
+				if name, ok := m["name"].(string); ok {
+					known[name] = true
+				}
+			}
+		}
+	}
+	for _, p := range proxys {
+		known[p.Name] = true
+	}
+	if len(customGroups) > 0 {
+		for _, cg := range customGroups[0] {
+			known[cg.Name] = true
+		}
+	}
+	return known
+}
+
+// dropDanglingDialerProxy 清除引用不存在的代理或引用自身的 dialer-proxy
+func dropDanglingDialerProxy(proxys []Proxy, known map[string]bool) []Proxy {
+	result := make([]Proxy, len(proxys))
+	for i, p := range proxys {
+		if p.Dialer_proxy != "" && (p.Dialer_proxy == p.Name || !known[p.Dialer_proxy]) {
+			utils.Warn("节点【%s】的前置代理【%s】不存在或指向自身，已忽略", p.Name, p.Dialer_proxy)
+			p.Dialer_proxy = ""
+		}
+		result[i] = p
+	}
+	return result
+}
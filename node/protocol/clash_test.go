@@ -1,6 +1,8 @@
 package protocol
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -310,3 +312,154 @@ func TestLinkToProxy_HostReplacement(t *testing.T) {
 
 	t.Log("✓ Host 替换配置测试通过")
 }
+
+// TestEncodeClash_DanglingDialerProxy 测试引用不存在代理或自身的 dialer-proxy 会被清除
+func TestEncodeClash_DanglingDialerProxy(t *testing.T) {
+	template := "proxies: []\nproxy-groups:\n  - name: 模板组\n    type: select\n    proxies: []\n"
+	file := filepath.Join(t.TempDir(), "clash_dangling_dialer_test.yaml")
+	if err := os.WriteFile(file, []byte(template), 0644); err != nil {
+		t.Fatalf("写入模板失败: %v", err)
+	}
+
+	newSS := func(name string) string {
+		return EncodeSSURL(Ss{Name: name, Server: name + ".example.com", Port: 8388, Param: Param{Cipher: "aes-256-gcm", Password: "p"}})
+	}
+	urls := []Urls{
+		{Url: newSS("a"), DialerProxyName: "模板组"},
+		{Url: newSS("b"), DialerProxyName: "已删除节点"},
+		{Url: newSS("c"), DialerProxyName: "c"},
+		{Url: newSS("d"), DialerProxyName: "空组"},
+	}
+	config := OutputConfig{
+		Clash:             file,
+		CustomProxyGroups: []CustomProxyGroup{{Name: "空组", Type: "select"}},
+	}
+
+	data, err := EncodeClash(urls, config)
+	if err != nil {
+		t.Fatalf("EncodeClash 失败: %v", err)
+	}
+	result := string(data)
+
+	assertContains(t, "模板代理组", result, "dialer-proxy: 模板组")
+	assertContains(t, "自定义代理组", result, "dialer-proxy: 空组")
+	if strings.Contains(result, "已删除节点") {
+		t.Errorf("不应输出引用不存在代理的 dialer-proxy: %s", result)
+	}
+	if strings.Contains(result, "dialer-proxy: c") {
+		t.Errorf("不应输出指向自身的 dialer-proxy: %s", result)
+	}
+	if !strings.Contains(result, "- DIRECT") {
+		t.Errorf("空的自定义代理组应使用 DIRECT 占位: %s", result)
+	}
+}
+
+func TestEncodeClash_TemplateVariables(t *testing.T) {
+	template := `#!template
+mode: {{ param "mode" "rule" }}
+proxies: []
+proxy-groups:
+  - name: 节点选择
+    type: select
+    proxies: []
+{{- if hasCountry "hk" }}
+  - name: 香港节点
+    type: url-test
+    proxies: []
+{{- end }}
+{{- if hasTag "流媒体" }}
+  - name: 流媒体
+    type: select
+    proxies: []
+{{- end }}
+# {{ .Subscription }} {{ .Client }} {{ .NodeCount }} {{ formatBytes .Usage.Remaining }}
+`
+	file := filepath.Join(t.TempDir(), "clash_template_vars_test.yaml")
+	if err := os.WriteFile(file, []byte(template), 0644); err != nil {
+		t.Fatalf("写入模板失败: %v", err)
+	}
+	urls := []Urls{{Url: EncodeSSURL(Ss{Name: "a", Server: "a.example.com", Port: 8388, Param: Param{Cipher: "aes-256-gcm", Password: "p"}})}}
+	config := OutputConfig{
+		Clash: file,
+		TemplateContext: &TemplateContext{
+			Subscription: "测试订阅",
+			Client:       "clash",
+			NodeCount:    1,
+			Countries:    map[string]int{"HK": 1},
+			Tags:         map[string]int{},
+			Usage:        TemplateUsage{Upload: 512, Download: 512, Total: 3 * 1024 * 1024 * 1024},
+			Params:       map[string]string{"mode": "global"},
+		},
+	}
+
+	data, err := EncodeClash(urls, config)
+	if err != nil {
+		t.Fatalf("EncodeClash 失败: %v", err)
+	}
+	result := string(data)
+	assertContains(t, "请求参数", result, "mode: global")
+	assertContains(t, "条件代理组", result, "name: 香港节点")
+	if strings.Contains(result, TemplateMarker) {
+		t.Errorf("输出不应包含模板标记行: %s", result)
+	}
+	if strings.Contains(result, "name: 流媒体") {
+		t.Errorf("条件不满足时不应输出代理组: %s", result)
+	}
+
+	// 语法错误时返回错误（输出时回退为原始模板）
+	if _, err := RenderTemplate(TemplateMarker+"\n{{ if }}", config.TemplateContext); err == nil {
+		t.Errorf("模板语法错误时应返回错误")
+	}
+	// 未设置上下文时原样返回
+	if out, _ := RenderTemplate(template, nil); out != template {
+		t.Errorf("未设置上下文时应原样返回模板")
+	}
+}
+
+// TestRenderTemplateLegacy 测试未带标记的旧模板即使包含 {{ 也按原样输出
+func TestRenderTemplateLegacy(t *testing.T) {
+	legacy := `mode: rule
+proxies: []
+proxy-groups:
+  - name: 节点选择
+    type: select
+    proxies: []
+rules:
+  # 旧模板中的注释 {{ 不是模板语法 }}
+  - DOMAIN-KEYWORD,{{,DIRECT
+  - MATCH,节点选择
+script:
+  code: |
+    def main(ctx, md):
+      return {{"a": 1}}.get("a")
+`
+	ctx := &TemplateContext{Subscription: "测试订阅", Client: "clash", Params: map[string]string{}}
+	out, err := RenderTemplate(legacy, ctx)
+	if err != nil {
+		t.Fatalf("旧模板不应按模板语法解析: %v", err)
+	}
+	if out != legacy {
+		t.Errorf("旧模板应原样输出:\n%s", out)
+	}
+
+	if data := renderTemplateData([]byte(legacy), "legacy.yaml", ctx); string(data) != legacy {
+		t.Errorf("旧模板文件应原样输出:\n%s", data)
+	}
+}
+
+func TestEncodeClash_TemplateContent(t *testing.T) {
+	urls := []Urls{{Url: EncodeSSURL(Ss{Name: "a", Server: "a.example.com", Port: 8388, Param: Param{Cipher: "aes-256-gcm", Password: "p"}})}}
+	config := OutputConfig{
+		Clash:           "not-exists.yaml",
+		TemplateContent: "mode: rule\nproxies: []\nproxy-groups:\n  - name: 节点选择\n    type: select\n    proxies: []\n",
+	}
+
+	data, err := EncodeClash(urls, config)
+	if err != nil {
+		t.Fatalf("EncodeClash 失败: %v", err)
+	}
+	result := string(data)
+	assertContains(t, "模板内容", result, "mode: rule")
+	assertContains(t, "代理组节点", result, "name: 节点选择")
+	assertContains(t, "节点", result, "server: a.example.com")
+}
@@ -52,7 +52,24 @@ func appendSurgeSSPlugin(proxy string, plugin SsPlugin) string {
 	return proxy
 }
 
-func EncodeSurge(urls []string, config OutputConfig) (string, error) {
+// surgeProtocols Surge 输出支持的协议（GetProtocolFromLink 返回的名称），其他协议的节点不会出现在 Surge 配置中
+var surgeProtocols = map[string]bool{
+	"ss":        true,
+	"vmess":     true,
+	"trojan":    true,
+	"hysteria2": true,
+	"tuic":      true,
+}
+
+// IsSurgeSupportedLink 判断节点链接能否输出到 Surge 配置
+func IsSurgeSupportedLink(link string) bool {
+	return surgeProtocols[GetProtocolFromLink(link)]
+}
+
+// EncodeSurge 将节点链接转换为 Surge 配置
+// urls 中的 DialerProxyName 输出为 underlying-proxy（链式代理）
+// 只输出 IsSurgeSupportedLink 支持的协议，其他节点跳过
+func EncodeSurge(urls []Urls, config OutputConfig) (string, error) {
 	var proxys, groups []string
 
 	// 辅助函数：根据 HostMap 替换服务器地址
@@ -65,10 +82,13 @@ func EncodeSurge(urls []string, config OutputConfig) (string, error) {
 		return server
 	}
 
-	for _, link := range urls {
-		Scheme := strings.Split(link, "://")[0]
-		switch {
-		case Scheme == "ss":
+	for _, item := range urls {
+		link := item.Url
+		if !IsSurgeSupportedLink(link) {
+			continue
+		}
+		switch GetProtocolFromLink(link) {
+		case "ss":
 			ss, err := DecodeSSURL(link)
 			if err != nil {
 				log.Println(err)
@@ -91,9 +111,9 @@ func EncodeSurge(urls []string, config OutputConfig) (string, error) {
 			}
 
 			groups = append(groups, ss.Name)
-			proxys = append(proxys, ssproxy)
+			proxys = append(proxys, appendSurgeUnderlyingProxy(ssproxy, item.DialerProxyName))
 
-		case Scheme == "vmess":
+		case "vmess":
 			vmess, err := DecodeVMESSURL(link)
 			if err != nil {
 				log.Println(err)
@@ -129,8 +149,8 @@ func EncodeSurge(urls []string, config OutputConfig) (string, error) {
 				vmessproxy = fmt.Sprintf("%s, sni=%s", vmessproxy, vmess.Sni)
 			}
 			groups = append(groups, vmess.Ps)
-			proxys = append(proxys, vmessproxy)
-		case Scheme == "trojan":
+			proxys = append(proxys, appendSurgeUnderlyingProxy(vmessproxy, item.DialerProxyName))
+		case "trojan":
 			trojan, err := DecodeTrojanURL(link)
 			if err != nil {
 				log.Println(err)
@@ -154,8 +174,8 @@ func EncodeSurge(urls []string, config OutputConfig) (string, error) {
 
 			}
 			groups = append(groups, trojan.Name)
-			proxys = append(proxys, trojanproxy)
-		case Scheme == "hysteria2" || Scheme == "hy2":
+			proxys = append(proxys, appendSurgeUnderlyingProxy(trojanproxy, item.DialerProxyName))
+		case "hysteria2":
 			hy2, err := DecodeHY2URL(link)
 			if err != nil {
 				log.Println(err)
@@ -179,8 +199,8 @@ func EncodeSurge(urls []string, config OutputConfig) (string, error) {
 
 			}
 			groups = append(groups, hy2.Name)
-			proxys = append(proxys, hy2proxy)
-		case Scheme == "tuic":
+			proxys = append(proxys, appendSurgeUnderlyingProxy(hy2proxy, item.DialerProxyName))
+		case "tuic":
 			tuic, err := DecodeTuicURL(link)
 			if err != nil {
 				log.Println(err)
@@ -208,12 +228,94 @@ func EncodeSurge(urls []string, config OutputConfig) (string, error) {
 			}
 
 			groups = append(groups, tuic.Name)
-			proxys = append(proxys, tuicproxy)
+			proxys = append(proxys, appendSurgeUnderlyingProxy(tuicproxy, item.DialerProxyName))
 		}
 	}
-	return DecodeSurge(proxys, groups, config.Surge)
+	if config.TemplateContent != "" {
+		return decodeSurgeData(proxys, groups, []byte(config.TemplateContent), config.Surge, config.TemplateContext, surgeCustomGroups(config.CustomProxyGroups, groups))
+	}
+	return DecodeSurge(proxys, groups, config.Surge, config.TemplateContext, surgeCustomGroups(config.CustomProxyGroups, groups))
 }
-func DecodeSurge(proxys, groups []string, file string) (string, error) {
+
+// appendSurgeUnderlyingProxy 为代理行追加 underlying-proxy（通过上级代理连接）
+func appendSurgeUnderlyingProxy(proxy string, dialerProxy string) string {
+	dialerProxy = strings.TrimSpace(dialerProxy)
+	if dialerProxy == "" {
+		return proxy
+	}
+	return fmt.Sprintf("%s, underlying-proxy=%s", proxy, dialerProxy)
+}
+
+// surgeCustomGroups 过滤自定义代理组成员，移除未输出到 Surge 配置的节点（协议不支持等）
+// 成员可以是已输出的节点或其他自定义代理组
+func surgeCustomGroups(customGroups []CustomProxyGroup, rendered []string) []CustomProxyGroup {
+	if len(customGroups) == 0 {
+		return nil
+	}
+	valid := make(map[string]bool, len(rendered)+len(customGroups))
+	for _, name := range rendered {
+		valid[name] = true
+	}
+	for _, g := range customGroups {
+		valid[g.Name] = true
+	}
+	result := make([]CustomProxyGroup, 0, len(customGroups))
+	for _, g := range customGroups {
+		members := make([]string, 0, len(g.Proxies))
+		for _, name := range g.Proxies {
+			if valid[name] {
+				members = append(members, name)
+			}
+		}
+		g.Proxies = members
+		result = append(result, g)
+	}
+	return result
+}
+
+// surgeCustomGroupLine 生成 Surge 自定义代理组行
+// 格式: GroupName = type, proxy1, proxy2, url=xxx, interval=xxx
+func surgeCustomGroupLine(g CustomProxyGroup) string {
+	groupType := g.Type
+	if groupType == "" {
+		groupType = "select"
+	}
+	members := g.Proxies
+	if len(members) == 0 {
+		members = []string{"DIRECT"}
+	}
+	line := fmt.Sprintf("%s = %s, %s", g.Name, groupType, strings.Join(members, ", "))
+
+	switch groupType {
+	case "url-test", "fallback", "load-balance":
+		url := g.URL
+		if url == "" {
+			url = "http://www.gstatic.com/generate_204"
+		}
+		interval := g.Interval
+		if interval <= 0 {
+			interval = 300
+		}
+		line = fmt.Sprintf("%s, url=%s, interval=%d", line, url, interval)
+		if groupType == "url-test" {
+			tolerance := g.Tolerance
+			if tolerance <= 0 {
+				tolerance = 50
+			}
+			line = fmt.Sprintf("%s, tolerance=%d", line, tolerance)
+		}
+		// Surge 的 load-balance 只支持随机和持久化（相同目标使用相同节点）两种方式
+		if groupType == "load-balance" && g.Strategy == "consistent-hashing" {
+			line += ", persistent=true"
+		}
+	}
+	return line
+}
+
+// DecodeSurge 读取 Surge 模板并插入节点
+// templateCtx: 模板渲染上下文，为空时模板按原样使用
+// customGroups: 自定义代理组列表（可选，由链式代理规则生成），插入到 [Proxy Group] 开头
+func DecodeSurge(proxys, groups []string, file string, templateCtx *TemplateContext, customGroups ...[]CustomProxyGroup) (string, error) {
 	var surge []byte
 	var err error
 	if strings.Contains(file, "://") {
@@ -243,6 +345,13 @@ func DecodeSurge(proxys, groups []string, file string) (string, error) {
 			cache.SetTemplateContent(filename, string(surge))
 		}
 	}
+	return decodeSurgeData(proxys, groups, surge, file, templateCtx, customGroups...)
+}
+
+// decodeSurgeData 使用模板内容生成 Surge 配置
+func decodeSurgeData(proxys, groups []string, surge []byte, file string, templateCtx *TemplateContext, customGroups ...[]CustomProxyGroup) (string, error) {
+	// 渲染模板变量和条件段落
+	surge = renderTemplateData(surge, file, templateCtx)
 
 	// 按行处理模板文件
 	lines := strings.Split(string(surge), "\n")
@@ -250,6 +359,10 @@ func DecodeSurge(proxys, groups []string, file string) (string, error) {
 	currentSection := ""
 	grouplist := strings.Join(groups, ", ")
 
+	// 清除引用不存在代理的 underlying-proxy，Surge 遇到无法解析的策略会拒绝加载配置
+	known := surgeKnownProxyNames(lines, groups, customGroups...)
+	proxys = dropDanglingUnderlyingProxy(proxys, known)
+
 	for _, line := range lines {
 		trimmedLine := strings.TrimSpace(line)
 
@@ -264,6 +377,12 @@ func DecodeSurge(proxys, groups []string, file string) (string, error) {
 					result = append(result, proxy)
 				}
 			}
+			// 在 [Proxy Group] section 后插入自定义代理组
+			if currentSection == "[Proxy Group]" && len(customGroups) > 0 {
+				for _, cg := range customGroups[0] {
+					result = append(result, surgeCustomGroupLine(cg))
+				}
+			}
 			continue
 		}
 
@@ -296,6 +415,61 @@ func DecodeSurge(proxys, groups []string, file string) (string, error) {
 	return strings.Join(result, "\n"), nil
 }
 
+// surgeBuiltinProxies Surge 内置策略
+var surgeBuiltinProxies = []string{"DIRECT", "REJECT", "REJECT-TINYGIF", "REJECT-DROP", "REJECT-NO-DROP"}
+
+// surgeKnownProxyNames 收集配置中可被引用的策略名称：模板 [Proxy] / [Proxy Group]、新增节点、自定义代理组和内置策略
+func surgeKnownProxyNames(templateLines, proxyNames []string, customGroups ...[]CustomProxyGroup) map[string]bool {
+	known := make(map[string]bool)
+	for _, name := range surgeBuiltinProxies {
+		known[name] = true
+	}
+	for _, name := range proxyNames {
+		known[name] = true
+	}
+	if len(customGroups) > 0 {
+		for _, cg := range customGroups[0] {
+			known[cg.Name] = true
+		}
+	}
+	section := ""
+	for _, line := range templateLines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = trimmed
+			continue
+		}
+		if section != "[Proxy]" && section != "[Proxy Group]" {
+			continue
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//") {
+			continue
+		}
+		if idx := strings.Index(trimmed, "="); idx > 0 {
+			known[strings.TrimSpace(trimmed[:idx])] = true
+		}
+	}
+	return known
+}
+
+// dropDanglingUnderlyingProxy 移除引用不存在的策略或引用自身的 underlying-proxy
+func dropDanglingUnderlyingProxy(proxys []string, known map[string]bool) []string {
+	const marker = ", underlying-proxy="
+	result := make([]string, 0, len(proxys))
+	for _, proxy := range proxys {
+		if idx := strings.LastIndex(proxy, marker); idx >= 0 {
+			name := strings.TrimSpace(strings.SplitN(proxy, "=", 2)[0])
+			dialer := strings.TrimSpace(proxy[idx+len(marker):])
+			if dialer == name || !known[dialer] {
+				utils.Warn("节点【%s】的前置代理【%s】不存在或指向自身，已忽略", name, dialer)
+				proxy = proxy[:idx]
+			}
+		}
+		result = append(result, proxy)
+	}
+	return result
+}
+
 // surgeGroupHasProxies 检查 Surge 代理组行是否已有代理
 // 格式: GroupName = type, proxy1, proxy2, ... 或 GroupName = type, url=xxx, ...
 // 返回 true 如果已有代理（不包括 url= 等参数）
@@ -1,6 +1,8 @@
 package protocol
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -357,3 +359,107 @@ func TestAllProtocolsToProxy(t *testing.T) {
 		})
 	}
 }
+
+// TestEncodeSurge_ChainProxy 测试链式代理输出 underlying-proxy 和自定义代理组
+func TestEncodeSurge_ChainProxy(t *testing.T) {
+	template := "[Proxy]\n\n[Proxy Group]\nProxy = select\n"
+	file := filepath.Join(t.TempDir(), "surge_chain_test.conf")
+	if err := os.WriteFile(file, []byte(template), 0644); err != nil {
+		t.Fatalf("写入模板失败: %v", err)
+	}
+
+	entry := EncodeSSURL(Ss{Name: "入口", Server: "entry.example.com", Port: 8388, Param: Param{Cipher: "aes-256-gcm", Password: "p"}})
+	landing := EncodeSSURL(Ss{Name: "落地", Server: "landing.example.com", Port: 8388, Param: Param{Cipher: "aes-256-gcm", Password: "p"}})
+	urls := []Urls{
+		{Url: entry},
+		{Url: landing, DialerProxyName: "中转组"},
+	}
+	config := OutputConfig{
+		Surge: file,
+		CustomProxyGroups: []CustomProxyGroup{
+			{Name: "中转组", Type: "load-balance", Proxies: []string{"入口", "不存在"}, Strategy: "consistent-hashing"},
+		},
+	}
+
+	result, err := EncodeSurge(urls, config)
+	if err != nil {
+		t.Fatalf("EncodeSurge 失败: %v", err)
+	}
+
+	assertContains(t, "落地节点", result, "underlying-proxy=中转组")
+	assertContains(t, "自定义代理组", result, "中转组 = load-balance, 入口, url=")
+	assertContains(t, "持久化负载均衡", result, "persistent=true")
+	if strings.Contains(result, "不存在") {
+		t.Errorf("自定义代理组不应包含未输出的节点: %s", result)
+	}
+	for _, line := range strings.Split(result, "\n") {
+		if strings.HasPrefix(line, "入口 = ") && strings.Contains(line, "underlying-proxy") {
+			t.Errorf("入口节点不应设置 underlying-proxy: %s", line)
+		}
+	}
+}
+
+// TestEncodeSurge_DanglingUnderlyingProxy 测试引用不存在策略或自身的 underlying-proxy 会被移除
+func TestEncodeSurge_DanglingUnderlyingProxy(t *testing.T) {
+	template := "[Proxy]\n\n[Proxy Group]\n模板组 = select, DIRECT\n"
+	file := filepath.Join(t.TempDir(), "surge_dangling_test.conf")
+	if err := os.WriteFile(file, []byte(template), 0644); err != nil {
+		t.Fatalf("写入模板失败: %v", err)
+	}
+
+	newSS := func(name string) string {
+		return EncodeSSURL(Ss{Name: name, Server: name + ".example.com", Port: 8388, Param: Param{Cipher: "aes-256-gcm", Password: "p"}})
+	}
+	urls := []Urls{
+		{Url: newSS("a"), DialerProxyName: "模板组"},
+		{Url: newSS("b"), DialerProxyName: "已删除节点"},
+		{Url: newSS("c"), DialerProxyName: "c"},
+	}
+
+	result, err := EncodeSurge(urls, OutputConfig{Surge: file})
+	if err != nil {
+		t.Fatalf("EncodeSurge 失败: %v", err)
+	}
+
+	assertContains(t, "模板代理组", result, "underlying-proxy=模板组")
+	for _, line := range strings.Split(result, "\n") {
+		if (strings.HasPrefix(line, "b = ") || strings.HasPrefix(line, "c = ")) && strings.Contains(line, "underlying-proxy") {
+			t.Errorf("不应输出无效的 underlying-proxy: %s", line)
+		}
+	}
+}
+
+// TestIsSurgeSupportedLink 测试 Surge 支持的协议判断与 EncodeSurge 的输出一致
+func TestIsSurgeSupportedLink(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "surge_supported_test.conf")
+	if err := os.WriteFile(file, []byte("[Proxy]\n\n[Proxy Group]\n"), 0644); err != nil {
+		t.Fatalf("写入模板失败: %v", err)
+	}
+
+	cases := []struct {
+		link      string
+		supported bool
+	}{
+		{EncodeSSURL(Ss{Name: "ss", Server: "ss.example.com", Port: 8388, Param: Param{Cipher: "aes-256-gcm", Password: "p"}}), true},
+		{"hy2://password@hy2.example.com:443#hy2", true},
+		{"vless://12345678-1234-1234-1234-123456789abc@vless.example.com:443#vless", false},
+		{"https://example.com/sub", false},
+	}
+	for _, tc := range cases {
+		if got := IsSurgeSupportedLink(tc.link); got != tc.supported {
+			t.Errorf("IsSurgeSupportedLink(%s) = %v, want %v", tc.link, got, tc.supported)
+		}
+		result, err := EncodeSurge([]Urls{{Url: tc.link}}, OutputConfig{Surge: file})
+		if err != nil {
+			t.Fatalf("EncodeSurge 失败: %v", err)
+		}
+		name := tc.link[strings.LastIndex(tc.link, "#")+1:]
+		rendered := strings.Contains(result, name+" = ")
+		if tc.supported && !rendered {
+			t.Errorf("支持的协议应输出到 Surge 配置: %s", tc.link)
+		}
+		if !tc.supported && rendered {
+			t.Errorf("不支持的协议不应输出到 Surge 配置: %s", tc.link)
+		}
+	}
+}
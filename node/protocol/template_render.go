@@ -0,0 +1,176 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sublink/utils"
+	"text/template"
+	"time"
+)
+
+// TemplateUsage 订阅的流量使用情况（与 subscription-userinfo 响应头一致）
+type TemplateUsage struct {
+	Upload   int64 // 已上传字节数
+	Download int64 // 已下载字节数
+	Total    int64 // 总流量字节数
+	Expire   int64 // 最近的过期时间（Unix 时间戳），0 表示未知
+}
+
+// Used 已使用的流量
+func (u TemplateUsage) Used() int64 {
+	return u.Upload + u.Download
+}
+
+// Remaining 剩余流量，总流量未知时为 0
+func (u TemplateUsage) Remaining() int64 {
+	if u.Total <= 0 || u.Used() >= u.Total {
+		return 0
+	}
+	return u.Total - u.Used()
+}
+
+// TemplateMarker 模板第一行为该标记时才按模板语法渲染，输出时去掉标记行
+// 未标记的模板（包括升级前已有的、在注释或脚本中包含 {{ 的模板）按原样使用
+const TemplateMarker = "#!template"
+
+// TemplateContext 模板渲染上下文
+// 带有 TemplateMarker 标记的模板按 Go text/template 语法渲染，未设置上下文（如预览、脚本试运行）时按原样使用
+type TemplateContext struct {
+	Subscription string            // 订阅名称
+	Client       string            // 客户端类型：clash / surge
+	Share        string            // 分享名称
+	NodeCount    int               // 节点数量
+	Countries    map[string]int    // 国家/地区代码 -> 节点数量
+	Tags         map[string]int    // 标签名称 -> 节点数量
+	Usage        TemplateUsage     // 流量使用情况
+	Params       map[string]string // 请求参数（不含 token）
+	AutoGroups   []string          // 订阅自动生成的代理组名称
+}
+
+// templateFuncs 模板可用的函数，只包含无副作用的字符串、数值处理函数
+func templateFuncs(ctx *TemplateContext) template.FuncMap {
+	return template.FuncMap{
+		// param 获取请求参数，不存在时返回默认值
+		"param": func(key string, def ...string) string {
+			if v, ok := ctx.Params[key]; ok && v != "" {
+				return v
+			}
+			if len(def) > 0 {
+				return def[0]
+			}
+			return ""
+		},
+		"hasParam": func(key string) bool {
+			_, ok := ctx.Params[key]
+			return ok
+		},
+		"hasCountry":   func(code string) bool { return ctx.Countries[strings.ToUpper(code)] > 0 },
+		"countryCount": func(code string) int { return ctx.Countries[strings.ToUpper(code)] },
+		"hasTag":       func(name string) bool { return ctx.Tags[name] > 0 },
+		"tagCount":     func(name string) int { return ctx.Tags[name] },
+		// autoGroups 订阅自动生成的代理组名称，用于在模板的选择组中引用
+		"autoGroups": func() []string { return ctx.AutoGroups },
+		// countries 按节点数量从多到少返回国家代码
+		"countries": func() []string { return sortedKeysByCount(ctx.Countries) },
+		"tags":      func() []string { return sortedKeysByCount(ctx.Tags) },
+		"contains":  strings.Contains,
+		"hasPrefix": strings.HasPrefix,
+		"hasSuffix": strings.HasSuffix,
+		"lower":     strings.ToLower,
+		"upper":     strings.ToUpper,
+		"trim":      strings.TrimSpace,
+		"replace":   strings.ReplaceAll,
+		"split":     strings.Split,
+		"join":      func(sep string, items []string) string { return strings.Join(items, sep) },
+		// default 值为空时使用默认值：{{ param "dns" | default "1.1.1.1" }}
+		"default": func(def string, value string) string {
+			if value == "" {
+				return def
+			}
+			return value
+		},
+		"formatBytes": formatTemplateBytes,
+		// formatTime 格式化 Unix 时间戳，0 返回空字符串
+		"formatTime": func(ts int64, layout ...string) string {
+			if ts <= 0 {
+				return ""
+			}
+			l := "2006-01-02"
+			if len(layout) > 0 && layout[0] != "" {
+				l = layout[0]
+			}
+			return time.Unix(ts, 0).Format(l)
+		},
+	}
+}
+
+// stripTemplateMarker 去掉模板第一行的 TemplateMarker 标记，返回剩余内容和是否带有标记
+func stripTemplateMarker(content string) (string, bool) {
+	first, rest, _ := strings.Cut(strings.TrimPrefix(content, "\ufeff"), "\n")
+	if strings.TrimSpace(first) != TemplateMarker {
+		return content, false
+	}
+	return rest, true
+}
+
+// RenderTemplate 使用上下文渲染模板内容
+// ctx 为 nil 或模板未带 TemplateMarker 标记时原样返回
+func RenderTemplate(content string, ctx *TemplateContext) (string, error) {
+	if ctx == nil {
+		return content, nil
+	}
+	body, ok := stripTemplateMarker(content)
+	if !ok {
+		return content, nil
+	}
+	tmpl, err := template.New("template").Option("missingkey=zero").Funcs(templateFuncs(ctx)).Parse(body)
+	if err != nil {
+		return content, fmt.Errorf("模板语法错误: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ctx); err != nil {
+		return content, fmt.Errorf("模板渲染失败: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// renderTemplateData 渲染模板文件内容，失败时记录日志并使用原始内容
+func renderTemplateData(data []byte, file string, ctx *TemplateContext) []byte {
+	rendered, err := RenderTemplate(string(data), ctx)
+	if err != nil {
+		utils.Warn("模板 %s %v，使用原始内容", file, err)
+		return data
+	}
+	return []byte(rendered)
+}
+
+// sortedKeysByCount 按数量从多到少排序，数量相同时按名称排序
+func sortedKeysByCount(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// formatTemplateBytes 格式化字节数，如 1.50 GB
+func formatTemplateBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -10,9 +10,11 @@ type OutputConfig struct {
 	ReplaceServerWithHost bool               `json:"replaceServerWithHost"` // 是否使用 Host 替换服务器地址
 	HostMap               map[string]string  `json:"-"`                     // 运行时填充的 Host 映射，不序列化
 	CustomProxyGroups     []CustomProxyGroup `json:"-"`                     // 运行时填充的自定义代理组，不序列化
+	TemplateContext       *TemplateContext   `json:"-"`                     // 运行时填充的模板渲染上下文，为空时模板按原样使用
+	TemplateContent       string             `json:"-"`                     // 运行时提供的模板内容，不为空时不读取模板文件（用于发布前校验）
 }
 
-// CustomProxyGroup 自定义代理组（由链式代理规则生成）
+// CustomProxyGroup 自定义代理组（由链式代理规则或订阅的自动代理组规则生成）
 type CustomProxyGroup struct {
 	Name      string   `json:"name"`                // 代理组名称
 	Type      string   `json:"type"`                // select, url-test, fallback, load-balance
@@ -22,3 +24,12 @@ type CustomProxyGroup struct {
 	Tolerance int      `json:"tolerance,omitempty"` // 容差毫秒数 (url-test, fallback)
 	Strategy  string   `json:"strategy,omitempty"`  // 负载均衡策略 (load-balance): consistent-hashing, round-robin
 }
+
+// CustomGroupNames 返回代理组名称列表
+func CustomGroupNames(groups []CustomProxyGroup) []string {
+	names := make([]string, 0, len(groups))
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+	return names
+}
@@ -139,14 +139,15 @@ func isTLSError(err error) bool {
 // proxyLink: 代理链接 (可选)
 // userAgent: 请求的 User-Agent (可选，默认 Clash)
 func LoadClashConfigFromURL(id int, urlStr string, subName string, downloadWithProxy bool, proxyLink string, userAgent string) (*UsageInfo, error) {
-	return LoadClashConfigFromURLWithReporter(id, urlStr, subName, downloadWithProxy, proxyLink, userAgent, nil, false, true)
+	return LoadClashConfigFromURLWithReporter(id, urlStr, subName, downloadWithProxy, proxyLink, userAgent, nil, false, true, nil)
 }
 
 // LoadClashConfigFromURLWithReporter 从指定 URL 加载 Clash 配置（带任务报告器）
 // reporter: 任务进度报告器，用于TaskManager集成
 // fetchUsageInfo: 是否获取用量信息
 // skipTLSVerify: 是否跳过TLS证书验证
-func LoadClashConfigFromURLWithReporter(id int, urlStr string, subName string, downloadWithProxy bool, proxyLink string, userAgent string, reporter TaskReporter, fetchUsageInfo bool, skipTLSVerify bool) (*UsageInfo, error) {
+// requestConfig: 机场请求配置（自定义请求头、Basic Auth、Cookie、登录流程，可选）
+func LoadClashConfigFromURLWithReporter(id int, urlStr string, subName string, downloadWithProxy bool, proxyLink string, userAgent string, reporter TaskReporter, fetchUsageInfo bool, skipTLSVerify bool, requestConfig *models.AirportRequestConfig) (*UsageInfo, error) {
 	// 创建 HTTP 客户端，配置 TLS
 	client := &http.Client{
 		Timeout: 30 * time.Second,
@@ -227,6 +228,23 @@ func LoadClashConfigFromURLWithReporter(id int, urlStr string, subName string, d
 		req.Header.Set("User-Agent", userAgent)
 	}
 
+	// 应用机场请求配置（登录流程、自定义请求头等）
+	if err := applyAirportRequestConfig(client, req, requestConfig); err != nil {
+		utils.Error("订阅【%s】应用请求配置失败: %v", subName, err)
+		sse.GetSSEBroker().BroadcastEvent("sub_update", sse.NotificationPayload{
+			Event:   "sub_update",
+			Title:   "订阅更新失败",
+			Message: fmt.Sprintf("❌订阅【%s】认证失败: %v", subName, err),
+			Data: map[string]interface{}{
+				"id":     id,
+				"name":   subName,
+				"status": "failed",
+				"error":  err.Error(),
+			},
+		})
+		return nil, err
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
 		utils.Error("URL %s，获取Clash配置失败:  %v", urlStr, err)
@@ -393,6 +411,7 @@ func scheduleClashToNodeLinks(id int, proxys []protocol.Proxy, subName string, r
 	}
 
 	// 应用机场节点过滤和重命名规则
+	var dedupDrops []models.DeduplicationDrop // 高级去重去掉的节点
 	if airport != nil {
 		originalCount := len(proxys)
 		proxys = applyAirportNodeFilter(airport, proxys)
@@ -401,7 +420,8 @@ func scheduleClashToNodeLinks(id int, proxys []protocol.Proxy, subName string, r
 		}
 		// 应用高级去重规则
 		beforeDedup := len(proxys)
-		proxys = applyAirportDeduplication(airport, proxys)
+		proxys, dedupDrops = applyAirportDeduplication(airport, proxys)
+		models.SetAirportDeduplicationDrops(airport.ID, dedupDrops)
 		if len(proxys) < beforeDedup {
 			utils.Info("🔄订阅【%s】去重后节点数量：%d（去重前：%d，去重掉：%d）", subName, len(proxys), beforeDedup, beforeDedup-len(proxys))
 		}
@@ -411,6 +431,43 @@ func scheduleClashToNodeLinks(id int, proxys []protocol.Proxy, subName string, r
 		proxys = applyAirportNodeUniquify(airport, proxys)
 	}
 
+	// 执行机场导入脚本（可过滤、改写节点，指定分组和标签）
+	proxys, importMetas := applyAirportImportScripts(airport, proxys, usageInfo)
+	// 已存在节点需要更新的分组和标签（仅限本机场节点）
+	groupUpdates := make(map[string][]int)
+	tagUpdates := make(map[string][]int)
+	newNodeTags := make(map[string][]string) // 新节点 ContentHash -> 导入脚本指定的标签
+
+	// 跨机场重复节点处理策略
+	duplicatePolicy := models.DuplicatePolicyFirst
+	if airport != nil && airport.DuplicatePolicy != "" {
+		duplicatePolicy = airport.DuplicatePolicy
+	}
+	// 本次拉取中本机场作为附加来源的节点ID
+	claimedNodeIDs := make(map[int]bool)
+	// 本机场已有的附加来源记录
+	sourceRows, err := models.ListNodeSourcesByAirport(id)
+	if err != nil {
+		utils.Warn("获取订阅【%s】附加来源记录失败: %v", subName, err)
+	}
+	existingSourceNodeIDs := make(map[int]bool, len(sourceRows))
+	for _, source := range sourceRows {
+		existingSourceNodeIDs[source.NodeID] = true
+	}
+	// 机场健康度评分（按需计算并缓存）
+	healthScores := make(map[int]float64)
+	airportHealthScore := func(airportID int) float64 {
+		if score, ok := healthScores[airportID]; ok {
+			return score
+		}
+		var score float64
+		if a, err := models.GetAirportByID(airportID); err == nil {
+			score = models.GetAirportHealthScore(a)
+		}
+		healthScores[airportID] = score
+		return score
+	}
+
 	// 1. 获取该订阅当前在数据库中的所有节点
 	existingNodes, err := models.ListBySourceID(id)
 	if err != nil {
@@ -439,9 +496,13 @@ func scheduleClashToNodeLinks(id int, proxys []protocol.Proxy, subName string, r
 	nodesToAdd := make([]models.Node, 0)
 
 	// 2. 遍历新获取的节点，插入或更新
-	for _, proxy := range proxys {
+	for i, proxy := range proxys {
 		utils.Info("💾准备存储节点【%s】", proxy.Name)
 		var Node models.Node
+		var importMeta airportImportMeta
+		if importMetas != nil {
+			importMeta = importMetas[i]
+		}
 
 		// 预处理：去除名称空格，处理 IPv6 地址
 		proxy.Name = strings.TrimSpace(proxy.Name)
@@ -472,6 +533,13 @@ func scheduleClashToNodeLinks(id int, proxys []protocol.Proxy, subName string, r
 		Node.Group = airport.Group
 		Node.Protocol = proxy.Type
 		Node.ContentHash = contentHash
+		if importMeta.Group != "" {
+			Node.Group = importMeta.Group
+		}
+		if len(importMeta.Tags) > 0 {
+			// 新节点写入后再按标签名添加，以遵循标签组的互斥规则
+			newNodeTags[contentHash] = importMeta.Tags
+		}
 
 		// 记录本次获取到的节点 ContentHash
 		currentHashes[contentHash] = true
@@ -485,6 +553,15 @@ func scheduleClashToNodeLinks(id int, proxys []protocol.Proxy, subName string, r
 			if existingNode, exists := models.GetNodeByContentHash(contentHash); exists {
 				// 判断是本机场重复还是跨机场重复
 				if existingNode.SourceID == id {
+					// 导入脚本指定的分组和标签同步到已有节点
+					if importMeta.Group != "" && existingNode.Group != importMeta.Group {
+						groupUpdates[importMeta.Group] = append(groupUpdates[importMeta.Group], existingNode.ID)
+					}
+					for _, tagName := range importMeta.Tags {
+						if !existingNode.HasTagName(tagName) {
+							tagUpdates[tagName] = append(tagUpdates[tagName], existingNode.ID)
+						}
+					}
 					// 检查是否名称相同
 					if existingNode.Name == proxy.Name {
 						utils.Debug("⏭️ 节点【%s】在本机场已存在，跳过", proxy.Name)
@@ -494,6 +571,32 @@ func scheduleClashToNodeLinks(id int, proxys []protocol.Proxy, subName string, r
 						jsonBytes, _ := json.Marshal(hashData)
 						utils.Warn("🔀 节点【%s】与已有节点【%s】配置相同，跳过\n    HashData: %s", proxy.Name, existingNode.Name, string(jsonBytes))
 					}
+				} else if duplicatePolicy != models.DuplicatePolicyFirst && existingNode.Source != "manual" && existingNode.SourceID > 0 {
+					// 跨机场重复：合并来源，本机场成为该节点的来源之一
+					claimedNodeIDs[existingNode.ID] = true
+					// 健康度明显更好时才转移归属，原归属机场成为附加来源；否则本机场作为附加来源
+					takeOver := duplicatePolicy == models.DuplicatePolicyHealthier &&
+						models.IsHealthierSource(airportHealthScore(id), airportHealthScore(existingNode.SourceID))
+					if takeOver {
+						previousSource := existingNode.Source
+						if err := models.TransferNodeSource(existingNode, airport, Node.Group, true); err != nil {
+							utils.Error("❌节点【%s】转移归属失败：%v", existingNode.Name, err)
+							takeOver = false
+						} else {
+							utils.Info("🔁 节点【%s】与机场【%s】重复，本机场健康度更好，节点已归属本机场", proxy.Name, previousSource)
+						}
+					}
+					if !takeOver {
+						if err := models.AddNodeSource(existingNode.ID, id); err != nil {
+							utils.Error("❌节点【%s】合并来源失败：%v", existingNode.Name, err)
+						} else {
+							utils.Debug("🔗 节点【%s】与机场【%s】重复，已合并来源", proxy.Name, existingNode.Source)
+						}
+					}
+				} else if existingSourceNodeIDs[existingNode.ID] {
+					// first 策略下不新增来源，但保留已有的来源记录（如节点曾被其他机场接管），原归属不再提供时仍可转移回本机场
+					claimedNodeIDs[existingNode.ID] = true
+					utils.Debug("⏭️ 节点【%s】已记录本机场为附加来源，跳过", proxy.Name)
 				} else {
 					utils.Warn("⚠️ 节点【%s】与其他机场重复，跳过 [现有节点: %s] [来源: %s] [分组: %s] [SourceID: %d]", proxy.Name, existingNode.Name, existingNode.Source, existingNode.Group, existingNode.SourceID)
 				}
@@ -530,6 +633,29 @@ func scheduleClashToNodeLinks(id int, proxys []protocol.Proxy, subName string, r
 		}
 	}
 
+	// 仍由其他机场提供的节点转移给其他机场，不删除
+	if transferred := models.HandoverNodesFromAirport(nodeIDsToDelete); len(transferred) > 0 {
+		transferredSet := make(map[int]bool, len(transferred))
+		for _, nodeID := range transferred {
+			transferredSet[nodeID] = true
+		}
+		remaining := make([]int, 0, len(nodeIDsToDelete)-len(transferred))
+		for _, nodeID := range nodeIDsToDelete {
+			if !transferredSet[nodeID] {
+				remaining = append(remaining, nodeID)
+			}
+		}
+		nodeIDsToDelete = remaining
+		utils.Info("🔁订阅【%s】有 %d 个节点仍由其他机场提供，已转移归属", subName, len(transferred))
+	}
+
+	// 移除本机场不再提供的附加来源记录
+	for _, source := range sourceRows {
+		if !claimedNodeIDs[source.NodeID] {
+			models.RemoveNodeSource(source.NodeID, id)
+		}
+	}
+
 	// 4. 批量写入数据库（一次性操作，减少数据库I/O）
 	// 批量添加新节点
 	if len(nodesToAdd) > 0 {
@@ -553,6 +679,29 @@ func scheduleClashToNodeLinks(id int, proxys []protocol.Proxy, subName string, r
 		}
 	}
 
+	// 新增节点写入后取得ID，与已有节点一起添加导入脚本指定的标签
+	for contentHash, tags := range newNodeTags {
+		addedNode, ok := models.GetNodeByContentHash(contentHash)
+		if !ok {
+			continue
+		}
+		for _, tagName := range tags {
+			tagUpdates[tagName] = append(tagUpdates[tagName], addedNode.ID)
+		}
+	}
+
+	// 同步导入脚本指定的分组和标签到节点
+	for group, ids := range groupUpdates {
+		if err := models.BatchUpdateGroup(ids, group); err != nil {
+			utils.Error("❌更新节点分组【%s】失败：%v", group, err)
+		}
+	}
+	for tagName, ids := range tagUpdates {
+		if err := models.BatchAddTagToNodes(ids, tagName); err != nil {
+			utils.Error("❌添加节点标签【%s】失败：%v", tagName, err)
+		}
+	}
+
 	utils.Info("✅订阅【%s】节点同步完成，总节点【%d】个，成功处理【%d】个，新增节点【%d】个，已存在节点【%d】个，删除失效【%d】个", subName, len(proxys), addSuccessCount+skipCount, addSuccessCount, skipCount, deleteCount)
 	// 重新查找机场以获取最新信息并更新成功次数
 	airport, err = models.GetAirportByID(id)
@@ -570,9 +719,10 @@ func scheduleClashToNodeLinks(id int, proxys []protocol.Proxy, subName string, r
 	}
 	// 通过 reporter 报告任务完成
 	reporter.ReportComplete(fmt.Sprintf("订阅更新完成 (新增: %d, 已存在: %d, 删除: %d)", addSuccessCount, skipCount, deleteCount), map[string]interface{}{
-		"added":   addSuccessCount,
-		"skipped": skipCount,
-		"deleted": deleteCount,
+		"added":        addSuccessCount,
+		"skipped":      skipCount,
+		"deleted":      deleteCount,
+		"deduplicated": dedupDrops,
 	})
 
 	// 触发webhook的完成事件
@@ -613,6 +763,8 @@ func scheduleClashToNodeLinks(id int, proxys []protocol.Proxy, subName string, r
 		Message: fmt.Sprintf("✅订阅【%s】节点同步完成，耗时 %s，总节点【%d】个，成功处理【%d】个，新增节点【%d】个，已存在节点【%d】个，删除失效【%d】个%s", subName, durationStr, len(proxys), addSuccessCount+skipCount, addSuccessCount, skipCount, deleteCount, usageText),
 		Data:    nData,
 	})
+	// 为开启自动发布的订阅发布快照（未通过校验的不发布）
+	models.TriggerSnapshotAutoPublish()
 	return nil
 
 }
@@ -720,52 +872,74 @@ func applyAirportNodeRename(airport *models.Airport, proxys []protocol.Proxy) []
 
 // applyAirportDeduplication 应用机场高级去重规则
 // 根据机场配置的去重规则对代理节点进行去重
-func applyAirportDeduplication(airport *models.Airport, proxys []protocol.Proxy) []protocol.Proxy {
+// 刚拉取的节点没有测速数据，按保留策略比较时使用库中内容相同节点的延迟、速度、检测时间和标签
+// 返回去重后的节点和被去掉的节点
+func applyAirportDeduplication(airport *models.Airport, proxys []protocol.Proxy) ([]protocol.Proxy, []models.DeduplicationDrop) {
 	if airport == nil || airport.DeduplicationRule == "" {
-		return proxys
+		return proxys, nil
 	}
 
 	// 解析去重配置
 	var config models.DeduplicationConfig
 	if err := json.Unmarshal([]byte(airport.DeduplicationRule), &config); err != nil {
 		utils.Warn("解析机场去重规则失败: %v", err)
-		return proxys
+		return proxys, nil
 	}
 
 	// 只有 protocol 模式才进行高级去重
 	if config.Mode != "protocol" || len(config.ProtocolRules) == 0 {
-		return proxys
+		return proxys, nil
 	}
 
 	// 按协议字段去重
-	seen := make(map[string]bool)
-	var result []protocol.Proxy
+	keys := make([]string, len(proxys))
+	nodes := make([]models.Node, len(proxys))
+	for i, proxy := range proxys {
+		nodes[i] = airportDeduplicationNode(airport, proxy, config.KeepStrategy)
 
-	for _, proxy := range proxys {
 		protoType := strings.ToLower(proxy.Type)
 		fields, exists := config.ProtocolRules[protoType]
 		if !exists || len(fields) == 0 {
 			// 该协议未配置去重规则，保留节点
-			result = append(result, proxy)
 			continue
 		}
 
-		// 生成去重Key（需传入协议类型用于解析）
-		key := generateProxyDeduplicationKey(proxy, protoType, fields)
-		if key == "" {
-			result = append(result, proxy)
-			continue
+		// 生成去重Key（需传入协议类型用于解析），加上协议类型前缀，避免不同协议间Key冲突
+		if key := generateProxyDeduplicationKey(proxy, protoType, fields); key != "" {
+			keys[i] = protoType + ":" + key
 		}
+	}
 
-		// 加上协议类型前缀，避免不同协议间Key冲突
-		fullKey := protoType + ":" + key
-		if !seen[fullKey] {
-			seen[fullKey] = true
-			result = append(result, proxy)
-		}
+	kept, drops := config.SelectDuplicates(nodes, keys)
+	for _, drop := range drops {
+		utils.Debug("机场【%s】去重: 去掉节点【%s】，%s", airport.Name, drop.Name, drop.Reason)
+	}
+	result := make([]protocol.Proxy, 0, len(kept))
+	for _, idx := range kept {
+		result = append(result, proxys[idx])
 	}
+	return result, drops
+}
 
-	return result
+// airportDeduplicationNode 构造用于比较重复节点的节点信息
+// 保留策略需要质量数据时，按内容哈希查找库中已有的节点，找不到时只有名称和来源
+func airportDeduplicationNode(airport *models.Airport, proxy protocol.Proxy, keepStrategy string) models.Node {
+	node := models.Node{Name: proxy.Name, Source: airport.Name, SourceID: airport.ID}
+	if keepStrategy == "" || keepStrategy == models.DedupKeepFirst || keepStrategy == models.DedupKeepSourceOrder {
+		return node
+	}
+	// 与入库时一致，先处理 IPv6 地址再计算哈希
+	proxy.Server = utils.WrapIPv6Host(proxy.Server)
+	if existing, ok := models.GetNodeByContentHash(protocol.GenerateProxyContentHash(proxy)); ok {
+		node.Speed = existing.Speed
+		node.SpeedStatus = existing.SpeedStatus
+		node.DelayTime = existing.DelayTime
+		node.DelayStatus = existing.DelayStatus
+		node.LatencyCheckAt = existing.LatencyCheckAt
+		node.SpeedCheckAt = existing.SpeedCheckAt
+		node.Tags = existing.Tags
+	}
+	return node
 }
 
 // generateProxyDeduplicationKey 根据指定字段生成代理的去重Key
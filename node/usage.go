@@ -97,6 +97,14 @@ func FetchAirportUsageInfo(airport *models.Airport) (*UsageInfo, error) {
 		return nil, fmt.Errorf("创建请求失败: %v", err)
 	}
 	headReq.Header.Set("User-Agent", userAgent)
+	// HEAD 与回退的 GET 请求共用同一个会话，只登录一次
+	session, err := startAirportSession(client, headReq.URL, airport.GetRequestConfig())
+	if err != nil {
+		return nil, fmt.Errorf("应用请求配置失败: %v", err)
+	}
+	if err := session.apply(headReq); err != nil {
+		return nil, fmt.Errorf("应用请求配置失败: %v", err)
+	}
 
 	resp, err = client.Do(headReq)
 	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
@@ -115,6 +123,9 @@ func FetchAirportUsageInfo(airport *models.Airport) (*UsageInfo, error) {
 			return nil, fmt.Errorf("创建请求失败: %v", err)
 		}
 		getReq.Header.Set("User-Agent", userAgent)
+		if err := session.apply(getReq); err != nil {
+			return nil, fmt.Errorf("应用请求配置失败: %v", err)
+		}
 
 		resp, err = client.Do(getReq)
 		if err != nil {
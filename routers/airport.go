@@ -14,7 +14,13 @@ func Airport(r *gin.Engine) {
 	{
 		// 列表和详情
 		airportGroup.GET("", api.AirportList)
+		// 健康度对比（必须在 :id 路由前定义）
+		airportGroup.GET("/health", api.AirportHealthList)
 		airportGroup.GET("/:id", api.AirportGet)
+		// 用量历史和预测
+		airportGroup.GET("/:id/usage-history", api.AirportUsageHistory)
+		// 健康度明细
+		airportGroup.GET("/:id/health", api.AirportHealthDetail)
 		// 增删改（演示模式下限制）
 		airportGroup.POST("", middlewares.DemoModeRestrict, api.AirportAdd)
 		airportGroup.PUT("/:id", middlewares.DemoModeRestrict, api.AirportUpdate)
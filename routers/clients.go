@@ -18,4 +18,7 @@ func Clients(r *gin.Engine) {
 		ClientsGroup.HEAD("/", api.GetClient)
 	}
 
+	// 本地规则集（rule-provider），不记录订阅访问日志
+	r.GET("/c/rules/:key", api.GetRuleSetContent)
+
 }
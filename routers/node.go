@@ -30,6 +30,7 @@ func Nodes(r *gin.Engine) {
 		NodesGroup.POST("/update", api.NodeUpdadte)
 		NodesGroup.GET("/groups", api.GetGroups)
 		NodesGroup.GET("/sources", api.GetSources)
+		NodesGroup.GET("/source-list", api.GetNodeSourceList)
 		NodesGroup.GET("/countries", api.GetNodeCountries)
 		NodesGroup.GET("/ip-info", api.GetIPDetails)
 		NodesGroup.GET("/ip-cache/stats", api.GetIPCacheStats)
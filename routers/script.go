@@ -16,5 +16,23 @@ func Script(r *gin.Engine) {
 		ScriptGroup.DELETE("/delete", middlewares.DemoModeRestrict, api.ScriptDel)
 		ScriptGroup.POST("/update", middlewares.DemoModeRestrict, api.ScriptUpdate)
 		ScriptGroup.GET("/list", api.ScriptList)
+		ScriptGroup.GET("/logs", api.ScriptLogs)
+		ScriptGroup.DELETE("/logs", middlewares.DemoModeRestrict, api.ScriptLogsClear)
+
+		// 脚本试运行与测试用例
+		ScriptGroup.POST("/test", middlewares.DemoModeRestrict, api.ScriptTest)
+		ScriptGroup.GET("/fixtures", api.ScriptFixtureList)
+		ScriptGroup.POST("/fixtures/add", middlewares.DemoModeRestrict, api.ScriptFixtureAdd)
+		ScriptGroup.POST("/fixtures/update", middlewares.DemoModeRestrict, api.ScriptFixtureUpdate)
+		ScriptGroup.DELETE("/fixtures/delete", middlewares.DemoModeRestrict, api.ScriptFixtureDel)
+		ScriptGroup.POST("/fixtures/run", middlewares.DemoModeRestrict, api.ScriptFixtureRun)
+
+		// 远程脚本与历史版本
+		ScriptGroup.POST("/import", middlewares.DemoModeRestrict, api.ScriptImport)
+		ScriptGroup.POST("/check-update", middlewares.DemoModeRestrict, api.ScriptCheckUpdate)
+		ScriptGroup.POST("/upgrade", middlewares.DemoModeRestrict, api.ScriptUpgrade)
+		ScriptGroup.POST("/pin", middlewares.DemoModeRestrict, api.ScriptPin)
+		ScriptGroup.GET("/versions", api.ScriptVersions)
+		ScriptGroup.POST("/rollback", middlewares.DemoModeRestrict, api.ScriptRollback)
 	}
 }
@@ -21,6 +21,8 @@ func Settings(r *gin.Engine) {
 		// 系统域名配置
 		SettingsGroup.GET("/system-domain", api.GetSystemDomain)
 		SettingsGroup.POST("/system-domain", middlewares.DemoModeRestrict, api.UpdateSystemDomain)
+		SettingsGroup.GET("/script-runtime", api.GetScriptRuntimeConfig)
+		SettingsGroup.POST("/script-runtime", middlewares.DemoModeRestrict, api.UpdateScriptRuntimeConfig)
 
 		// Telegram 机器人设置
 		SettingsGroup.GET("/telegram", api.GetTelegramConfig)
@@ -23,14 +23,24 @@ func Subcription(r *gin.Engine) {
 		SubcriptionGroup.GET("/node-fields-meta", api.GetNodeFieldsMeta) // 节点字段元数据接口
 
 		// 链式代理规则相关接口
-		SubcriptionGroup.GET("/:id/chain-rules", api.GetChainRules)                  // 获取规则列表
-		SubcriptionGroup.POST("/:id/chain-rules", api.CreateChainRule)               // 创建规则
-		SubcriptionGroup.PUT("/:id/chain-rules/sort", api.SortChainRules)            // 批量排序（必须在 :ruleId 路由前定义）
-		SubcriptionGroup.PUT("/:id/chain-rules/:ruleId", api.UpdateChainRule)        // 更新规则
-		SubcriptionGroup.DELETE("/:id/chain-rules/:ruleId", api.DeleteChainRule)     // 删除规则
-		SubcriptionGroup.PUT("/:id/chain-rules/:ruleId/toggle", api.ToggleChainRule) // 切换启用状态
-		SubcriptionGroup.GET("/:id/chain-options", api.GetChainOptions)              // 获取可用选项
-		SubcriptionGroup.GET("/:id/chain-rules/preview", api.PreviewChainLinks)      // 预览链路（整体）
+		SubcriptionGroup.GET("/:id/chain-rules", api.GetChainRules)                                // 获取规则列表
+		SubcriptionGroup.POST("/:id/chain-rules", api.CreateChainRule)                             // 创建规则
+		SubcriptionGroup.PUT("/:id/chain-rules/sort", api.SortChainRules)                          // 批量排序（必须在 :ruleId 路由前定义）
+		SubcriptionGroup.GET("/:id/chain-rules/validate", api.ValidateChainRules)                  // 校验规则
+		SubcriptionGroup.PUT("/:id/chain-rules/:ruleId", api.UpdateChainRule)                      // 更新规则
+		SubcriptionGroup.DELETE("/:id/chain-rules/:ruleId", api.DeleteChainRule)                   // 删除规则
+		SubcriptionGroup.PUT("/:id/chain-rules/:ruleId/toggle", api.ToggleChainRule)               // 切换启用状态
+		SubcriptionGroup.GET("/:id/chain-options", api.GetChainOptions)                            // 获取可用选项
+		SubcriptionGroup.GET("/:id/chain-rules/preview", api.PreviewChainLinks)                    // 预览链路（整体）
+		SubcriptionGroup.POST("/:id/chain-check", middlewares.DemoModeRestrict, api.RunChainCheck) // 链路端到端检测
+		SubcriptionGroup.GET("/:id/chain-check", api.GetChainCheckResults)                         // 链路检测结果
+
+		// 订阅快照相关接口
+		SubcriptionGroup.GET("/:id/snapshots", api.SubscriptionSnapshots)                                                   // 快照列表
+		SubcriptionGroup.POST("/:id/snapshots", middlewares.DemoModeRestrict, api.PublishSubscriptionSnapshot)              // 发布快照
+		SubcriptionGroup.GET("/:id/snapshots/diff", api.SubscriptionSnapshotDiff)                                           // 比较快照（必须在 :snapshotId 路由前定义）
+		SubcriptionGroup.GET("/:id/snapshots/:snapshotId", api.SubscriptionSnapshotContent)                                 // 快照内容
+		SubcriptionGroup.DELETE("/:id/snapshots/:snapshotId", middlewares.DemoModeRestrict, api.DeleteSubscriptionSnapshot) // 删除快照
 	}
 
 }
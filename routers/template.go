@@ -17,6 +17,19 @@ func Templates(r *gin.Engine) {
 		TempsGroup.POST("/update", api.UpdateTemp)
 		TempsGroup.GET("/presets", api.GetACL4SSRPresets)
 		TempsGroup.POST("/convert", api.ConvertRules)
+
+		// 发布前校验与历史版本
+		TempsGroup.POST("/validate", api.TemplateValidate)
+		TempsGroup.GET("/revisions", api.TemplateRevisions)
+		TempsGroup.GET("/revisions/diff", api.TemplateRevisionDiff)
+		TempsGroup.POST("/rollback", middlewares.DemoModeRestrict, api.TemplateRollback)
+
+		// 本地规则集
+		TempsGroup.GET("/rulesets", api.RuleSetList)
+		TempsGroup.POST("/rulesets/add", middlewares.DemoModeRestrict, api.RuleSetAdd)
+		TempsGroup.POST("/rulesets/update", middlewares.DemoModeRestrict, api.RuleSetUpdate)
+		TempsGroup.POST("/rulesets/refresh", middlewares.DemoModeRestrict, api.RuleSetRefresh)
+		TempsGroup.DELETE("/rulesets/delete", middlewares.DemoModeRestrict, api.RuleSetDel)
 	}
 
 }
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/metacubex/mihomo/adapter"
+	"github.com/metacubex/mihomo/component/proxydialer"
 	"github.com/metacubex/mihomo/component/resolver"
 	"github.com/metacubex/mihomo/constant"
 	"gopkg.in/yaml.v3"
@@ -34,6 +35,49 @@ func SetIPv6(enable bool) {
 
 // GetMihomoAdapter creates a Mihomo Proxy Adapter from a node link
 func GetMihomoAdapter(nodeLink string) (constant.Proxy, error) {
+	proxyMap, err := proxyMappingFromLink(nodeLink)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Create Mihomo Proxy Adapter
+	proxyAdapter, err := adapter.ParseProxy(proxyMap)
+	if err != nil {
+		return nil, fmt.Errorf("create mihomo adapter error: %v", err)
+	}
+	return proxyAdapter, nil
+}
+
+// GetMihomoChainAdapter 创建链式代理 adapter，links 按连接顺序排列（入口 -> 中转 -> 落地）
+// 每一跳都通过上一跳建立连接，等同于 Clash 配置中的 dialer-proxy，返回最后一跳（落地）的 adapter
+func GetMihomoChainAdapter(links []string) (constant.Proxy, error) {
+	if len(links) == 0 {
+		return nil, fmt.Errorf("empty proxy chain")
+	}
+	var prev constant.Proxy
+	for i, link := range links {
+		proxyMap, err := proxyMappingFromLink(link)
+		if err != nil {
+			return nil, fmt.Errorf("hop %d: %v", i+1, err)
+		}
+		// 上级代理由链路决定，忽略节点自身的 dialer-proxy
+		delete(proxyMap, "dialer-proxy")
+
+		var options []adapter.ProxyOption
+		if prev != nil {
+			options = append(options, adapter.WithDialerForAPI(proxydialer.New(prev, false)))
+		}
+		proxyAdapter, err := adapter.ParseProxy(proxyMap, options...)
+		if err != nil {
+			return nil, fmt.Errorf("hop %d: create mihomo adapter error: %v", i+1, err)
+		}
+		prev = proxyAdapter
+	}
+	return prev, nil
+}
+
+// proxyMappingFromLink 将节点链接转换为 adapter.ParseProxy 需要的配置 map
+func proxyMappingFromLink(nodeLink string) (map[string]interface{}, error) {
 	// 1. Parse node link to Proxy struct
 	// We use a default OutputConfig as we only need the proxy connection info
 	outputConfig := protocol.OutputConfig{
@@ -67,13 +111,7 @@ func GetMihomoAdapter(nodeLink string) (constant.Proxy, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal proxy map error: %v", err)
 	}
-
-	// 3. Create Mihomo Proxy Adapter
-	proxyAdapter, err := adapter.ParseProxy(proxyMap)
-	if err != nil {
-		return nil, fmt.Errorf("create mihomo adapter error: %v", err)
-	}
-	return proxyAdapter, nil
+	return proxyMap, nil
 }
 
 // MihomoDelayWithAdapter 使用 Mihomo 内置 URLTest 进行延迟测试
@@ -135,6 +173,24 @@ func MihomoDelayTest(nodeLink string, testUrl string, timeout time.Duration, inc
 		return 0, "", err
 	}
 
+	return MihomoDelayTestWithAdapter(proxyAdapter, testUrl, timeout, includeHandshake, detectLandingIP, landingIPUrl)
+}
+
+// MihomoDelayTestWithAdapter 使用已创建的 adapter（如链式代理 adapter）执行延迟测试，可选检测落地IP
+func MihomoDelayTestWithAdapter(proxyAdapter constant.Proxy, testUrl string, timeout time.Duration, includeHandshake bool, detectLandingIP bool, landingIPUrl string) (latency int, landingIP string, err error) {
+	// Recover from any panics
+	defer func() {
+		if r := recover(); r != nil {
+			latency = 0
+			landingIP = ""
+			err = fmt.Errorf("panic in MihomoDelayTestWithAdapter: %v", r)
+		}
+	}()
+
+	if testUrl == "" {
+		testUrl = "http://cp.cloudflare.com/generate_204"
+	}
+
 	// 执行延迟测试（使用 URLTest）
 	latency, err = MihomoDelayWithAdapter(proxyAdapter, testUrl, timeout, includeHandshake)
 	if err != nil {
@@ -182,6 +238,32 @@ func MihomoSpeedTest(nodeLink string, testUrl string, timeout time.Duration, det
 		return 0, 0, 0, "", err
 	}
 
+	return MihomoSpeedTestWithAdapter(proxyAdapter, testUrl, timeout, detectLandingIP, landingIPUrl, speedRecordMode, peakSampleInterval)
+}
+
+// MihomoSpeedTestWithAdapter 使用已创建的 adapter（如链式代理 adapter）执行速度测试，可选检测落地IP
+func MihomoSpeedTestWithAdapter(proxyAdapter constant.Proxy, testUrl string, timeout time.Duration, detectLandingIP bool, landingIPUrl string, speedRecordMode string, peakSampleInterval int) (speed float64, latency int, bytesDownloaded int64, landingIP string, err error) {
+	// Recover from any panics and return error with zero values
+	defer func() {
+		if r := recover(); r != nil {
+			speed = 0
+			latency = 0
+			bytesDownloaded = 0
+			landingIP = ""
+			err = fmt.Errorf("panic in MihomoSpeedTestWithAdapter: %v", r)
+		}
+	}()
+
+	// 默认值处理
+	if speedRecordMode == "" {
+		speedRecordMode = "average"
+	}
+	if peakSampleInterval < 50 {
+		peakSampleInterval = 50
+	} else if peakSampleInterval > 200 {
+		peakSampleInterval = 200
+	}
+
 	// 4. Perform Speed Test
 	// We will try to download from testUrl
 	if testUrl == "" {
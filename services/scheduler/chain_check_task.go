@@ -0,0 +1,203 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"sublink/constants"
+	"sublink/models"
+	"sublink/services/geoip"
+	"sublink/services/mihomo"
+	"sublink/services/sse"
+	"sublink/utils"
+	"sync"
+	"time"
+)
+
+// chainCheckDefaultConcurrency 链式代理检测的默认并发数（每条链路会同时占用多个节点）
+const chainCheckDefaultConcurrency = 8
+
+// RunChainCheck 对订阅执行链式代理端到端检测
+// 按订阅的链式代理规则组合完整链路（入口 -> 中转 -> 落地），通过链路测量延迟、速度和出口IP
+// 检测参数使用指定的节点检测策略，结果按（订阅，节点）保存，不修改节点自身的检测结果
+func RunChainCheck(subscriptionID int, profileID int, trigger models.TaskTrigger) {
+	profile, err := models.GetNodeCheckProfileByID(profileID)
+	if err != nil {
+		utils.Error("获取节点检测策略失败: %v", err)
+		return
+	}
+	config := SpeedTestConfigFromProfile(profile)
+
+	var sub models.Subcription
+	sub.ID = subscriptionID
+	if err := sub.Find(); err != nil {
+		utils.Error("链式代理检测: 订阅 %d 不存在: %v", subscriptionID, err)
+		return
+	}
+	if err := sub.LoadFilteredNodes(); err != nil {
+		utils.Error("链式代理检测: 获取订阅【%s】节点失败: %v", sub.Name, err)
+		return
+	}
+
+	plan := models.BuildChainRenderPlan(&sub, models.GetEnabledChainRulesBySubscriptionID(sub.ID))
+	paths := models.ResolveChainCheckPaths(&sub, plan)
+	if len(paths) == 0 {
+		utils.Warn("订阅【%s】没有设置链式代理的节点", sub.Name)
+		return
+	}
+
+	tm := getTaskManager()
+	task, ctx, err := tm.CreateTask(models.TaskTypeChainCheck, sub.Name, trigger, len(paths))
+	if err != nil {
+		utils.Error("创建链式代理检测任务失败: %v", err)
+		return
+	}
+	taskID := task.ID
+	defer func() {
+		if r := recover(); r != nil {
+			utils.Error("链式代理检测任务执行过程中发生严重错误: %v", r)
+			tm.FailTask(taskID, fmt.Sprintf("任务执行异常: %v", r))
+		}
+	}()
+
+	concurrency := config.LatencyConcurrency
+	if concurrency <= 0 {
+		concurrency = chainCheckDefaultConcurrency
+	}
+	if config.Mode != "tcp" && config.SpeedConcurrency > 0 && config.SpeedConcurrency < concurrency {
+		concurrency = config.SpeedConcurrency
+	}
+	utils.Info("开始链式代理检测，订阅: %s, 链路数: %d, 策略: %s, 并发数: %d", sub.Name, len(paths), profile.Name, concurrency)
+
+	results := make([]models.SubscriptionChainCheck, len(paths))
+	var successCount, failCount, completed int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for i, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(idx int, path models.ChainCheckPath) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				return
+			}
+
+			result := checkChainPath(path, config)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[idx] = result
+			completed++
+			status := "success"
+			if result.DelayStatus != constants.StatusSuccess {
+				status = "failed"
+				failCount++
+			} else {
+				successCount++
+			}
+			tm.UpdateProgress(taskID, completed, result.Path, map[string]interface{}{
+				"status":  status,
+				"phase":   "chain",
+				"latency": result.DelayTime,
+				"speed":   result.Speed,
+			})
+		}(i, path)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		utils.Info("链式代理检测任务被取消: %s", sub.Name)
+		return
+	}
+
+	if err := models.SaveSubscriptionChainChecks(sub.ID, results); err != nil {
+		utils.Error("保存链式代理检测结果失败: %v", err)
+		tm.FailTask(taskID, "保存检测结果失败: "+err.Error())
+		return
+	}
+
+	message := fmt.Sprintf("链式代理检测完成 (成功: %d, 失败: %d)", successCount, failCount)
+	utils.Info("订阅【%s】%s", sub.Name, message)
+	tm.CompleteTask(taskID, message, map[string]interface{}{
+		"subscriptionId": sub.ID,
+		"success":        successCount,
+		"fail":           failCount,
+		"total":          len(paths),
+	})
+	sse.GetSSEBroker().BroadcastEvent("task_update", sse.NotificationPayload{
+		Event:   "chain_check",
+		Title:   "链式代理检测完成",
+		Message: fmt.Sprintf("订阅【%s】%s", sub.Name, message),
+		Data: map[string]interface{}{
+			"status":         "success",
+			"subscriptionId": sub.ID,
+			"success":        successCount,
+			"fail":           failCount,
+			"total":          len(paths),
+		},
+	})
+}
+
+// checkChainPath 通过完整链路检测单个节点
+// tcp 模式只检测延迟（可选出口IP），mihomo 模式延迟成功后继续测速
+func checkChainPath(path models.ChainCheckPath, config *SpeedTestConfig) models.SubscriptionChainCheck {
+	result := models.SubscriptionChainCheck{
+		NodeID:      path.Node.ID,
+		NodeName:    path.NodeName,
+		Path:        strings.Join(path.Names, " → "),
+		Hops:        len(path.Names),
+		DelayTime:   -1,
+		DelayStatus: constants.StatusError,
+		SpeedStatus: constants.StatusUntested,
+	}
+	if path.Error != "" {
+		result.Error = path.Error
+		return result
+	}
+
+	proxyAdapter, err := mihomo.GetMihomoChainAdapter(path.Links())
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	detectIPInLatency := config.DetectCountry && config.Mode == "tcp"
+	latency, landingIP, err := mihomo.MihomoDelayTestWithAdapter(proxyAdapter, config.LatencyTestURL, timeout, config.IncludeHandshake, detectIPInLatency, config.LandingIPURL)
+	if err != nil {
+		result.DelayStatus = constants.StatusTimeout
+		result.Error = err.Error()
+		return result
+	}
+	result.DelayTime = latency
+	result.DelayStatus = constants.StatusSuccess
+
+	if config.Mode != "tcp" {
+		speed, _, _, speedIP, err := mihomo.MihomoSpeedTestWithAdapter(proxyAdapter, config.SpeedTestURL, timeout, config.DetectCountry, config.LandingIPURL, config.SpeedRecordMode, config.PeakSampleInterval)
+		if err != nil {
+			result.Speed = -1
+			result.SpeedStatus = constants.StatusError
+			result.Error = err.Error()
+		} else {
+			result.Speed = speed
+			result.SpeedStatus = constants.StatusSuccess
+			landingIP = speedIP
+		}
+	}
+
+	if landingIP != "" {
+		result.LandingIP = landingIP
+		if countryCode, geoErr := geoip.GetCountryISOCode(landingIP); geoErr == nil {
+			result.LinkCountry = countryCode
+		}
+	}
+	return result
+}
@@ -9,7 +9,13 @@ const (
 	// JobIDHostCleanup Host过期清理任务ID
 	JobIDHostCleanup = -101
 
-	// 预留区间 -102 ~ -199 用于未来系统任务
+	// JobIDScriptUpdateCheck 远程脚本更新检查任务ID
+	JobIDScriptUpdateCheck = -102
+
+	// JobIDRuleSetRefresh 规则集刷新任务ID
+	JobIDRuleSetRefresh = -103
+
+	// 预留区间 -104 ~ -199 用于未来系统任务
 	// 新增系统任务时按顺序递减分配ID
 )
 
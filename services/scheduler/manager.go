@@ -92,6 +92,16 @@ func (sm *SchedulerManager) LoadFromDatabase() error {
 		utils.Error("创建Host过期清理任务失败: %v", err)
 	}
 
+	// 启动远程脚本更新检查任务
+	if err := sm.StartScriptUpdateCheckTask(); err != nil {
+		utils.Error("创建脚本更新检查任务失败: %v", err)
+	}
+
+	// 启动规则集刷新任务
+	if err := sm.StartRuleSetRefreshTask(); err != nil {
+		utils.Error("创建规则集刷新任务失败: %v", err)
+	}
+
 	return nil
 }
 
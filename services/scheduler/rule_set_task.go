@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"sublink/models"
+	"sublink/utils"
+)
+
+// StartRuleSetRefreshTask 启动规则集刷新定时任务
+// 每小时检查一次，只刷新超过各自刷新间隔的规则集
+func (sm *SchedulerManager) StartRuleSetRefreshTask() error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	const ruleSetRefreshCron = "30 * * * *" // 每小时第30分钟执行
+
+	// 如果任务已存在，先删除
+	if entryID, exists := sm.jobs[JobIDRuleSetRefresh]; exists {
+		sm.cron.Remove(entryID)
+		delete(sm.jobs, JobIDRuleSetRefresh)
+	}
+
+	entryID, err := sm.cron.AddFunc(ruleSetRefreshCron, func() {
+		ExecuteRuleSetRefreshTask()
+	})
+
+	if err != nil {
+		utils.Error("添加规则集刷新任务失败 - Cron: %s, Error: %v", ruleSetRefreshCron, err)
+		return err
+	}
+
+	sm.jobs[JobIDRuleSetRefresh] = entryID
+	utils.Info("成功添加规则集刷新任务 - Cron: %s", ruleSetRefreshCron)
+	return nil
+}
+
+// ExecuteRuleSetRefreshTask 刷新到期的规则集
+func ExecuteRuleSetRefreshTask() {
+	refreshed, failed := models.RefreshDueRuleSets()
+	if refreshed > 0 || failed > 0 {
+		utils.Info("规则集刷新完成 (成功: %d, 失败: %d)", refreshed, failed)
+	}
+}
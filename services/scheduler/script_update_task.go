@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"sublink/models"
+	"sublink/utils"
+)
+
+// StartScriptUpdateCheckTask 启动远程脚本更新检查定时任务
+// 每6小时检查一次，只记录可用升级，不会自动替换脚本内容
+func (sm *SchedulerManager) StartScriptUpdateCheckTask() error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	const scriptUpdateCheckCron = "0 */6 * * *" // 每6小时执行一次
+
+	// 如果任务已存在，先删除
+	if entryID, exists := sm.jobs[JobIDScriptUpdateCheck]; exists {
+		sm.cron.Remove(entryID)
+		delete(sm.jobs, JobIDScriptUpdateCheck)
+	}
+
+	entryID, err := sm.cron.AddFunc(scriptUpdateCheckCron, func() {
+		ExecuteScriptUpdateCheckTask()
+	})
+
+	if err != nil {
+		utils.Error("添加脚本更新检查任务失败 - Cron: %s, Error: %v", scriptUpdateCheckCron, err)
+		return err
+	}
+
+	sm.jobs[JobIDScriptUpdateCheck] = entryID
+	utils.Info("成功添加脚本更新检查任务 - Cron: %s", scriptUpdateCheckCron)
+	return nil
+}
+
+// ExecuteScriptUpdateCheckTask 执行远程脚本更新检查
+func ExecuteScriptUpdateCheckTask() {
+	updatable := models.CheckAllScriptUpdates()
+	for _, script := range updatable {
+		utils.Info("📜脚本【%s】有可用升级: %s → %s (%s)", script.Name, script.Version, script.LatestVersion, script.UpdateType)
+	}
+}
@@ -615,6 +615,8 @@ func RunSpeedTestWithConfig(nodes []models.Node, trigger models.TaskTrigger, pro
 		} else {
 			utils.Debug("批量更新测速结果成功，共 %d 条记录", len(speedTestResults))
 		}
+		// 记录机场节点质量快照，用于机场健康度统计
+		go models.RecordAirportQualitySnapshots(nodes)
 	}
 
 	// 批量保存Host映射到数据库（如果开启了持久化）
@@ -709,6 +711,9 @@ applyTags:
 	// 应用自动标签规则 - 测速完成后触发
 	// 重新获取已测速节点的最新数据（包含更新后的速度/延迟值）
 	go func() {
+		// 标签更新后为开启自动发布的订阅发布快照（未通过校验的不发布）
+		defer models.TriggerSnapshotAutoPublish()
+
 		// 收集测速节点的ID
 		testedNodeIDs := make([]int, 0, len(nodes))
 		for _, n := range nodes {
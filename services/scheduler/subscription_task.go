@@ -6,6 +6,7 @@ import (
 	"sublink/node"
 	"sublink/services/sse"
 	"sublink/utils"
+	"time"
 )
 
 // ExecuteSubscriptionTask 执行订阅任务的具体业务逻辑
@@ -23,6 +24,7 @@ func ExecuteSubscriptionTaskWithTrigger(id int, url string, subName string, trig
 	var userAgent string
 	var fetchUsageInfo bool
 	var skipTLSVerify bool
+	var requestConfig *models.AirportRequestConfig
 
 	airport, err := models.GetAirportByID(id)
 	if err != nil {
@@ -33,6 +35,7 @@ func ExecuteSubscriptionTaskWithTrigger(id int, url string, subName string, trig
 		userAgent = airport.UserAgent
 		fetchUsageInfo = airport.FetchUsageInfo
 		skipTLSVerify = airport.SkipTLSVerify
+		requestConfig = airport.GetRequestConfig()
 	}
 
 	// 创建 TaskManager 任务和报告器
@@ -47,7 +50,18 @@ func ExecuteSubscriptionTaskWithTrigger(id int, url string, subName string, trig
 		reporter = NewTaskManagerReporter(tm, task.ID)
 	}
 
-	usageInfo, err := node.LoadClashConfigFromURLWithReporter(id, url, subName, downloadWithProxy, proxyLink, userAgent, reporter, fetchUsageInfo, skipTLSVerify)
+	pullStart := time.Now()
+	usageInfo, err := node.LoadClashConfigFromURLWithReporter(id, url, subName, downloadWithProxy, proxyLink, userAgent, reporter, fetchUsageInfo, skipTLSVerify, requestConfig)
+
+	// 记录拉取结果，用于机场健康度统计
+	var pullErrMsg string
+	if err != nil {
+		pullErrMsg = err.Error()
+	}
+	if recordErr := models.RecordAirportPull(id, err == nil, time.Since(pullStart), pullErrMsg); recordErr != nil {
+		utils.Warn("记录机场拉取结果失败 ID: %d: %v", id, recordErr)
+	}
+
 	if err != nil {
 		// 仅在失败时发送通知，成功通知由 node/sub.go 中的 scheduleClashToNodeLinks 发送
 		// 这样可以避免重复通知，且成功通知包含更详细的节点统计信息
@@ -332,6 +332,23 @@ func buildAirportUsageOverview(text *strings.Builder) {
 		}
 	}
 
+	// 按当前消耗速度预测会在到期前耗尽流量的机场
+	type exhaustForecast struct {
+		name     string
+		forecast models.AirportUsageForecast
+	}
+	var exhaustSoon []exhaustForecast
+	for i := range airportsWithUsage {
+		a := &airportsWithUsage[i]
+		forecast := models.GetAirportUsageForecast(a, 7)
+		if forecast.ExhaustBeforeExpire {
+			exhaustSoon = append(exhaustSoon, exhaustForecast{name: a.Name, forecast: forecast})
+		}
+	}
+	sort.Slice(exhaustSoon, func(i, j int) bool {
+		return exhaustSoon[i].forecast.ExhaustAt < exhaustSoon[j].forecast.ExhaustAt
+	})
+
 	// 构建输出
 	text.WriteString("\n✈️ *机场流量概览*\n")
 	text.WriteString(fmt.Sprintf("├ 机场数量: %d 个\n", len(airportsWithUsage)))
@@ -343,6 +360,19 @@ func buildAirportUsageOverview(text *strings.Builder) {
 		text.WriteString(fmt.Sprintf("│    └ %s\n", formatExpireTimeLocal(nearestExpireAirport.UsageExpire)))
 	}
 
+	if len(exhaustSoon) > 0 {
+		text.WriteString(fmt.Sprintf("├ 📉 预计提前耗尽: %d 个\n", len(exhaustSoon)))
+		for i, e := range exhaustSoon {
+			if i >= 3 { // 最多显示3个
+				text.WriteString(fmt.Sprintf("│    └ ...等%d个\n", len(exhaustSoon)-3))
+				break
+			}
+			text.WriteString(fmt.Sprintf("│    ├ %s: %s/天\n", truncateName(e.name, 15), formatBytesLocal(e.forecast.DailyRate)))
+			text.WriteString(fmt.Sprintf("│    │  └ 耗尽 %s，到期 %s\n",
+				formatExpireTimeLocal(e.forecast.ExhaustAt), formatExpireTimeLocal(e.forecast.ExpireAt)))
+		}
+	}
+
 	if len(lowUsageAirports) > 0 {
 		text.WriteString(fmt.Sprintf("└ ⚠️ 流量不足: %d 个\n", len(lowUsageAirports)))
 		for i, a := range lowUsageAirports {
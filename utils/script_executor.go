@@ -2,107 +2,468 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"time"
 
 	"github.com/dop251/goja"
 )
 
-// RunScript executes a JavaScript script with the given input and client type.
-// The script is expected to define a function `main(node, clientType)` that returns a string.
-func RunScript(scriptContent string, input string, clientType string) (string, error) {
-	vm := goja.New()
+// ScriptLimits defines the execution limits applied to every user script run.
+type ScriptLimits struct {
+	Timeout        time.Duration // max execution time per run (enforced via vm.Interrupt)
+	MaxOutputSize  int           // max size of the script output in bytes
+	MaxArrayLength int           // max length of arrays created with the Array constructor or returned by the script
+	MaxCallStack   int           // max JS call stack depth
+	MaxRuntimeData int           // max bytes a single run may load through runtime APIs (fetch, kv, sublink) and guarded allocations
+}
 
-	// Inject console object
-	vm.Set("console", map[string]interface{}{
-		"log":   fmt.Println,
-		"info":  fmt.Println,
-		"warn":  fmt.Println,
-		"error": fmt.Println,
-	})
+// DefaultScriptLimits is used until limits are configured in the system settings.
+var DefaultScriptLimits = ScriptLimits{
+	Timeout:        5 * time.Second,
+	MaxOutputSize:  32 << 20,
+	MaxArrayLength: 1000000,
+	MaxCallStack:   1024,
+	MaxRuntimeData: 64 << 20,
+}
 
-	// Inject polyfills
-	_, err := vm.RunString(polyfills)
-	if err != nil {
-		return "", fmt.Errorf("polyfill injection error: %w", err)
-	}
+// scriptLimits holds the limits used by all script runners.
+var (
+	scriptLimits   = DefaultScriptLimits
+	scriptLimitsMu sync.RWMutex
+)
 
-	// Execute the script to load definitions
-	_, err = vm.RunString(scriptContent)
-	if err != nil {
-		return "", fmt.Errorf("script compilation error: %w", err)
+var (
+	ErrScriptTimeout        = errors.New("script execution timed out")
+	ErrScriptMemoryLimit    = errors.New("script exceeded runtime data limit")
+	ErrScriptOutputTooLarge = errors.New("script output exceeds size limit")
+	ErrScriptArrayTooLarge  = errors.New("script result exceeds array length limit")
+)
+
+// GetScriptLimits returns the limits applied to user scripts.
+func GetScriptLimits() ScriptLimits {
+	scriptLimitsMu.RLock()
+	defer scriptLimitsMu.RUnlock()
+	return scriptLimits
+}
+
+// SetScriptLimits replaces the limits applied to subsequent script runs.
+func SetScriptLimits(limits ScriptLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
 	}
+	scriptLimitsMu.Lock()
+	defer scriptLimitsMu.Unlock()
+	scriptLimits = limits
+	return nil
+}
 
-	// Get the main function
-	mainFn, ok := goja.AssertFunction(vm.Get("subMod"))
-	if !ok {
-		return "", fmt.Errorf("subMod function not found in script")
+// Validate checks that every limit is positive.
+func (l ScriptLimits) Validate() error {
+	if l.Timeout <= 0 || l.MaxOutputSize <= 0 || l.MaxArrayLength <= 0 || l.MaxCallStack <= 0 || l.MaxRuntimeData <= 0 {
+		return errors.New("script limits must be positive")
 	}
+	return nil
+}
 
-	// Call the main function
-	result, err := mainFn(goja.Undefined(), vm.ToValue(input), vm.ToValue(clientType))
-	if err != nil {
-		return "", fmt.Errorf("script execution error: %w", err)
+// scriptBudget tracks the bytes loaded into a single VM run.
+// Only data entering the VM through the runtime hooks and the allocation guards is counted;
+// allocations the guards cannot see are left to the heap backstop.
+type scriptBudget struct {
+	vm    *goja.Runtime
+	limit int
+	used  int
+}
+
+// charge records n bytes and aborts the run once the budget is exhausted.
+// The interrupt makes the abort uncatchable by try/catch in the script.
+func (b *scriptBudget) charge(n int) {
+	if n <= 0 {
+		return
 	}
+	b.used += n
+	if b.used > b.limit {
+		b.vm.Interrupt(ErrScriptMemoryLimit)
+		panic(b.vm.NewGoError(ErrScriptMemoryLimit))
+	}
+}
 
-	return result.String(), nil
+// heapCheckInterval is how often the heap backstop samples the process heap while scripts run.
+const heapCheckInterval = 50 * time.Millisecond
+
+// heapObjectsMetric is the runtime metric for the bytes occupied by heap objects, live or not yet collected.
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+// heapBackstopFactor is how far above the combined data budget of the running scripts
+// the process heap may grow before the backstop interrupts them.
+const heapBackstopFactor = 2
+
+// heapBackstop catches script allocations the guards cannot see, such as string concatenation with +
+// or index assignment loops. The process heap is shared with the rest of the service, so it only acts
+// when the heap grows to several times the combined budget of all running scripts, and it confirms
+// the growth is live data with a GC before interrupting. Guarded allocations are still accounted per run.
+type heapBackstop struct {
+	mu       sync.Mutex
+	runs     map[*goja.Runtime]int
+	baseline uint64
+	watching bool
 }
 
-// RunNodeFilterScript executes a JavaScript script to filter nodes.
-// The script is expected to define a function `filterNode(nodes, clientType)` that returns a modified nodes array.
-func RunNodeFilterScript(scriptContent string, nodesJSON []byte, clientType string) ([]byte, error) {
-	vm := goja.New()
+var scriptHeap = &heapBackstop{runs: make(map[*goja.Runtime]int)}
 
-	// Inject console object
-	vm.Set("console", map[string]interface{}{
-		"log":   fmt.Println,
-		"info":  fmt.Println,
-		"warn":  fmt.Println,
-		"error": fmt.Println,
-	})
+// register adds a run with its data budget and returns a function that removes it.
+func (h *heapBackstop) register(vm *goja.Runtime, limit int) func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.runs) == 0 {
+		// Includes garbage not yet collected, which only makes the backstop more lenient
+		h.baseline = readHeapMetric(heapObjectsMetric)
+	}
+	h.runs[vm] = limit
+	if !h.watching {
+		h.watching = true
+		go h.watch()
+	}
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.runs, vm)
+	}
+}
 
-	// Inject polyfills
-	_, err := vm.RunString(polyfills)
-	if err != nil {
-		return nil, fmt.Errorf("polyfill injection error: %w", err)
+// ceiling returns the heap size above which the running scripts are interrupted.
+func (h *heapBackstop) ceiling() (uint64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.runs) == 0 {
+		h.watching = false
+		return 0, false
+	}
+	var budget uint64
+	for _, limit := range h.runs {
+		budget += uint64(limit)
 	}
+	return h.baseline + budget*heapBackstopFactor, true
+}
 
-	// Execute the script to load definitions
-	_, err = vm.RunString(scriptContent)
-	if err != nil {
-		return nil, fmt.Errorf("script compilation error: %w", err)
+// watch samples the heap until no script is running.
+func (h *heapBackstop) watch() {
+	ticker := time.NewTicker(heapCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ceiling, ok := h.ceiling()
+		if !ok {
+			return
+		}
+		if readHeapMetric(heapObjectsMetric) <= ceiling {
+			continue
+		}
+		// Unreclaimed garbage also counts as heap objects; only live growth interrupts scripts
+		runtime.GC()
+		if readHeapMetric(heapObjectsMetric) <= ceiling {
+			continue
+		}
+		h.mu.Lock()
+		for vm := range h.runs {
+			vm.Interrupt(ErrScriptMemoryLimit)
+		}
+		h.mu.Unlock()
 	}
+}
 
-	// Get the filterNode function
-	filterFn, ok := goja.AssertFunction(vm.Get("filterNode"))
-	if !ok {
-		// If function not found, return original nodes (or error? Plan said error, but maybe better to just return nil error and original nodes if we want to be lenient.
-		// However, explicit error is better for debugging.
-		return nil, fmt.Errorf("filterNode function not found in script")
+// readHeapMetric reads a uint64 runtime metric in bytes.
+func readHeapMetric(name string) uint64 {
+	sample := []metrics.Sample{{Name: name}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
 	}
+	return sample[0].Value.Uint64()
+}
 
+// RunScript executes a JavaScript script with the given input and client type.
+// The script is expected to define a function `main(node, clientType)` that returns a string.
+// env identifies the script and collects its console output; it may be nil.
+func RunScript(scriptContent string, input string, clientType string, env *ScriptEnv) (string, error) {
+	var output string
+	err := runSandboxed(scriptContent, env, func(vm *goja.Runtime) error {
+		// Get the main function
+		mainFn, ok := goja.AssertFunction(vm.Get("subMod"))
+		if !ok {
+			return fmt.Errorf("subMod function not found in script")
+		}
+
+		// Call the main function
+		result, err := mainFn(goja.Undefined(), vm.ToValue(input), vm.ToValue(clientType))
+		if err != nil {
+			return fmt.Errorf("script execution error: %w", err)
+		}
+		output = result.String()
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(output) > GetScriptLimits().MaxOutputSize {
+		return "", fmt.Errorf("%w: %d bytes", ErrScriptOutputTooLarge, len(output))
+	}
+	return output, nil
+}
+
+// RunNodeFilterScript executes a JavaScript script to filter nodes.
+// The script is expected to define a function `filterNode(nodes, clientType)` that returns a modified nodes array.
+func RunNodeFilterScript(scriptContent string, nodesJSON []byte, clientType string, env *ScriptEnv) ([]byte, error) {
 	// Unmarshal nodes
 	var nodes interface{}
 	if err := json.Unmarshal(nodesJSON, &nodes); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal nodes: %w", err)
 	}
 
-	// Call the function
-	result, err := filterFn(goja.Undefined(), vm.ToValue(nodes), vm.ToValue(clientType))
+	return runArrayScript(scriptContent, env, "filterNode", nodes, clientType)
+}
+
+// RunAirportImportScript executes a JavaScript script on proxies pulled from an airport.
+// The script is expected to define a function `airportImport(proxies, airport)` that returns a modified proxies array.
+func RunAirportImportScript(scriptContent string, proxiesJSON []byte, airportJSON []byte, env *ScriptEnv) ([]byte, error) {
+	// Unmarshal proxies and airport info
+	var proxies interface{}
+	if err := json.Unmarshal(proxiesJSON, &proxies); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal proxies: %w", err)
+	}
+	var airport interface{}
+	if err := json.Unmarshal(airportJSON, &airport); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal airport: %w", err)
+	}
+
+	return runArrayScript(scriptContent, env, "airportImport", proxies, airport)
+}
+
+// runArrayScript calls fnName with the given arguments and returns the resulting array as JSON.
+func runArrayScript(scriptContent string, env *ScriptEnv, fnName string, args ...interface{}) ([]byte, error) {
+	var resItems interface{}
+	err := runSandboxed(scriptContent, env, func(vm *goja.Runtime) error {
+		fn, ok := goja.AssertFunction(vm.Get(fnName))
+		if !ok {
+			return fmt.Errorf("%s function not found in script", fnName)
+		}
+
+		values := make([]goja.Value, 0, len(args))
+		for _, arg := range args {
+			values = append(values, vm.ToValue(arg))
+		}
+
+		// Call the function
+		result, err := fn(goja.Undefined(), values...)
+		if err != nil {
+			return fmt.Errorf("script execution error: %w", err)
+		}
+		resItems = result.Export()
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("script execution error: %w", err)
+		return nil, err
+	}
+
+	limits := GetScriptLimits()
+	if items, ok := resItems.([]interface{}); ok && len(items) > limits.MaxArrayLength {
+		return nil, fmt.Errorf("%w: %d items", ErrScriptArrayTooLarge, len(items))
 	}
 
 	// Marshal result back to JSON
-	// The result should be the modified nodes array
-	resNodes := result.Export()
-	newJSON, err := json.Marshal(resNodes)
+	newJSON, err := json.Marshal(resItems)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal result: %w", err)
 	}
+	if len(newJSON) > limits.MaxOutputSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrScriptOutputTooLarge, len(newJSON))
+	}
 
 	return newJSON, nil
 }
 
+// runSandboxed creates a fresh VM, loads the script and runs call under the execution limits.
+// A timer interrupts the VM when the time budget is exceeded; the data budget is enforced by the
+// runtime hooks and allocation guards, with the heap backstop covering unguarded allocations.
+func runSandboxed(scriptContent string, env *ScriptEnv, call func(vm *goja.Runtime) error) (err error) {
+	if env == nil {
+		env = &ScriptEnv{}
+	}
+	limits := GetScriptLimits()
+	deadline := time.Now().Add(limits.Timeout)
+	vm := goja.New()
+	vm.SetMaxCallStackSize(limits.MaxCallStack)
+	budget := &scriptBudget{vm: vm, limit: limits.MaxRuntimeData}
+
+	// Inject runtime library (console, fetch, kv, sublink)
+	injectScriptRuntime(vm, env, deadline, budget)
+
+	// Inject polyfills
+	if _, err := vm.RunString(polyfills); err != nil {
+		return fmt.Errorf("polyfill injection error: %w", err)
+	}
+
+	// Inject allocation guards
+	vm.Set("__maxArrayLength", limits.MaxArrayLength)
+	vm.Set("__maxStringLength", limits.MaxOutputSize)
+	vm.Set("__chargeAllocation", func(call goja.FunctionCall) goja.Value {
+		budget.charge(int(call.Argument(0).ToInteger()))
+		return goja.Undefined()
+	})
+	if _, err := vm.RunString(sandboxGuards); err != nil {
+		return fmt.Errorf("sandbox injection error: %w", err)
+	}
+	guardArrayPush(vm, budget)
+
+	timer := time.AfterFunc(time.Until(deadline), func() { vm.Interrupt(ErrScriptTimeout) })
+	defer timer.Stop()
+	defer scriptHeap.register(vm, limits.MaxRuntimeData)()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("script panic: %v", r)
+		}
+		err = unwrapInterrupt(err)
+	}()
+
+	// Execute the script to load definitions
+	if _, err := vm.RunString(scriptContent); err != nil {
+		return fmt.Errorf("script compilation error: %w", err)
+	}
+
+	return call(vm)
+}
+
+// guardArrayPush charges 8 bytes per added item to Array.prototype.push and unshift.
+// They are the hot path of most scripts, so the wrappers are native to avoid the cost of a JS wrapper.
+func guardArrayPush(vm *goja.Runtime, budget *scriptBudget) {
+	proto := vm.Get("Array").ToObject(vm).Get("prototype").ToObject(vm)
+	for _, name := range []string{"push", "unshift"} {
+		native, ok := goja.AssertFunction(proto.Get(name))
+		if !ok {
+			continue
+		}
+		proto.DefineDataProperty(name, vm.ToValue(func(call goja.FunctionCall) goja.Value {
+			budget.charge(len(call.Arguments) * 8)
+			result, err := native(call.This, call.Arguments...)
+			if err != nil {
+				panic(err)
+			}
+			return result
+		}), goja.FLAG_TRUE, goja.FLAG_TRUE, goja.FLAG_FALSE)
+	}
+}
+
+// unwrapInterrupt converts a goja interrupt into the limit error that caused it.
+func unwrapInterrupt(err error) error {
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		if limitErr, ok := interrupted.Value().(error); ok {
+			return limitErr
+		}
+	}
+	return err
+}
+
+// sandboxGuards rejects single allocations that exceed the configured limits
+// and charges the size of guarded allocations to the run's data budget.
+// Array.prototype.constructor points at the guarded Array so [].constructor(n) cannot reach the native one,
+// and the builtins that grow strings or arrays by a caller-chosen amount charge the budget before allocating.
+// push and unshift are wrapped natively by guardArrayPush.
+const sandboxGuards = `
+(function() {
+  var maxArrayLength = __maxArrayLength;
+  var maxStringLength = __maxStringLength;
+  var chargeAllocation = __chargeAllocation;
+  var NativeArray = Array;
+  var ArrayProto = NativeArray.prototype;
+  var StringProto = String.prototype;
+  var nativeFrom = NativeArray.from;
+  var nativeOf = NativeArray.of;
+  var checkArrayLength = function(n) {
+    if (n > maxArrayLength) {
+      throw new RangeError('Array length exceeds limit: ' + n);
+    }
+    chargeAllocation(n * 8);
+  };
+  var checkStringLength = function(n) {
+    if (n > maxStringLength) {
+      throw new RangeError('String length exceeds limit');
+    }
+    chargeAllocation(n * 2);
+  };
+  var define = function(target, name, value) {
+    Object.defineProperty(target, name, { value: value, writable: true, configurable: true, enumerable: false });
+  };
+  var wrap = function(target, name, size) {
+    var native = target[name];
+    define(target, name, function() {
+      size.apply(this, arguments);
+      return native.apply(this, arguments);
+    });
+  };
+
+  var SafeArray = function Array() {
+    if (arguments.length === 1 && typeof arguments[0] === 'number') {
+      checkArrayLength(arguments[0]);
+    } else {
+      chargeAllocation(arguments.length * 8);
+    }
+    return NativeArray.apply(null, arguments);
+  };
+  SafeArray.prototype = ArrayProto;
+  define(SafeArray, 'isArray', NativeArray.isArray);
+  define(SafeArray, 'from', function(items) {
+    if (items != null && typeof items.length === 'number') {
+      checkArrayLength(items.length);
+    }
+    return nativeFrom.apply(NativeArray, arguments);
+  });
+  define(SafeArray, 'of', function() {
+    chargeAllocation(arguments.length * 8);
+    return nativeOf.apply(NativeArray, arguments);
+  });
+  define(ArrayProto, 'constructor', SafeArray);
+  Array = SafeArray;
+
+  wrap(ArrayProto, 'splice', function() { chargeAllocation(Math.max(arguments.length - 2, 0) * 8); });
+  wrap(ArrayProto, 'concat', function() {
+    var n = this.length >>> 0;
+    for (var i = 0; i < arguments.length; i++) {
+      n += NativeArray.isArray(arguments[i]) ? arguments[i].length : 1;
+    }
+    checkArrayLength(n);
+  });
+  wrap(ArrayProto, 'join', function(separator) {
+    var n = this.length >>> 0;
+    var total = Math.max(n - 1, 0) * (separator === undefined ? 1 : String(separator).length);
+    for (var i = 0; i < n && total <= maxStringLength; i++) {
+      if (typeof this[i] === 'string') {
+        total += this[i].length;
+      }
+    }
+    checkStringLength(total);
+  });
+
+  wrap(StringProto, 'repeat', function(count) { checkStringLength(this.length * count); });
+  wrap(StringProto, 'padStart', function(targetLength) { checkStringLength(Number(targetLength) || 0); });
+  wrap(StringProto, 'padEnd', function(targetLength) { checkStringLength(Number(targetLength) || 0); });
+  wrap(StringProto, 'concat', function() {
+    var total = this.length;
+    for (var i = 0; i < arguments.length; i++) {
+      total += String(arguments[i]).length;
+    }
+    checkStringLength(total);
+  });
+
+  delete this.__maxArrayLength;
+  delete this.__maxStringLength;
+  delete this.__chargeAllocation;
+})();
+`
+
 const polyfills = `
 if (!String.prototype.includes) {
   String.prototype.includes = function(search, start) {
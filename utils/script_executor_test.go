@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// withScriptLimits 在测试期间替换脚本执行限制
+func withScriptLimits(t *testing.T, limits ScriptLimits) {
+	t.Helper()
+	previous := GetScriptLimits()
+	if err := SetScriptLimits(limits); err != nil {
+		t.Fatalf("设置脚本限制失败: %v", err)
+	}
+	t.Cleanup(func() { SetScriptLimits(previous) })
+}
+
+// TestSandboxGuardsKeepBuiltins 测试分配保护不改变内置方法的行为
+func TestSandboxGuardsKeepBuiltins(t *testing.T) {
+	script := `function subMod(input, clientType) {
+  var a = [1, 2];
+  a.push(3);
+  a.unshift(0);
+  a.splice(1, 0, 'x');
+  var b = a.concat([4], 5);
+  return [
+    [].constructor === Array,
+    [] instanceof Array,
+    Array.isArray(new Array(2)),
+    Array.from({length: 2}).length,
+    Array.of(7, 8).join('+'),
+    b.join(','),
+    'ab'.repeat(2),
+    '7'.padStart(3, '0'),
+    '7'.padEnd(3, '-'),
+    'a'.concat('b', 1)
+  ].join('|');
+}`
+	output, err := RunScript(script, "", "clash", nil)
+	if err != nil {
+		t.Fatalf("执行脚本失败: %v", err)
+	}
+	want := "true|true|true|2|7+8|0,x,1,2,3,4,5|abab|007|7--|ab1"
+	if output != want {
+		t.Errorf("output = %q, want %q", output, want)
+	}
+}
+
+// TestSandboxGuardsChargeAllocations 测试绕过全局 Array 或通过其他内置方法分配时同样计入数据量
+func TestSandboxGuardsChargeAllocations(t *testing.T) {
+	limits := DefaultScriptLimits
+	limits.MaxRuntimeData = 8 << 20
+	withScriptLimits(t, limits)
+
+	cases := []struct {
+		name string
+		body string
+	}{
+		{"[].constructor 绕过", `var keep = []; for (;;) { keep[keep.length] = [].constructor(100000); }`},
+		{"Array.prototype.constructor", `var C = Object.getPrototypeOf([]).constructor; var keep = []; for (;;) { keep[keep.length] = new C(100000); }`},
+		{"Array.from", `var keep = []; for (;;) { keep[keep.length] = Array.from({length: 100000}); }`},
+		{"padEnd 循环", `var s = ''; for (;;) { s = 'x'.padEnd(1 << 20); }`},
+		{"padStart 循环", `var s = ''; for (;;) { s = 'x'.padStart(1 << 20); }`},
+		{"push 循环", `var chunk = new Array(1000); for (;;) { [].push.apply([], chunk); }`},
+		{"concat 循环", `var a = [1]; for (;;) { a = a.concat(a.length < 1000 ? a : [1]); }`},
+		{"join 循环", `var s = 'x'.repeat(10000); var a = [s, s, s, s]; for (;;) { a.join(''); }`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			script := "function subMod(input, clientType) { " + tc.body + " }"
+			_, err := RunScript(script, "", "clash", nil)
+			if !errors.Is(err, ErrScriptMemoryLimit) {
+				t.Errorf("err = %v, want %v", err, ErrScriptMemoryLimit)
+			}
+		})
+	}
+}
+
+// TestSandboxGuardsRejectLargeArray 测试通过 [].constructor 创建超长数组时同样被拒绝
+func TestSandboxGuardsRejectLargeArray(t *testing.T) {
+	_, err := RunScript(`function subMod() { return [].constructor(1e9).length; }`, "", "clash", nil)
+	if err == nil {
+		t.Fatal("超过长度上限的数组应被拒绝")
+	}
+}
+
+// TestHeapBackstop 测试保护之外的分配（字符串拼接）持续增长时由堆检查中断脚本
+func TestHeapBackstop(t *testing.T) {
+	limits := DefaultScriptLimits
+	limits.MaxRuntimeData = 4 << 20
+	limits.Timeout = 10 * time.Second
+	withScriptLimits(t, limits)
+
+	script := `function subMod() {
+  var s = 'x';
+  for (var i = 0; i < 20; i++) { s += s; }
+  var keep = {};
+  for (var n = 0; ; n++) { keep['k' + n] = s + n; }
+}`
+	start := time.Now()
+	_, err := RunScript(script, "", "clash", nil)
+	if !errors.Is(err, ErrScriptMemoryLimit) {
+		t.Fatalf("err = %v, want %v", err, ErrScriptMemoryLimit)
+	}
+	if elapsed := time.Since(start); elapsed >= limits.Timeout {
+		t.Errorf("应由堆检查中断而不是超时: %v", elapsed)
+	}
+}
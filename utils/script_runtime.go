@@ -0,0 +1,437 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// 脚本运行时依赖，需要在 main.go 中设置（避免 utils 依赖 models）
+var (
+	// ScriptFetchAllowListFunc 获取 fetch 允许访问的域名列表，为空时禁用 fetch
+	ScriptFetchAllowListFunc func() []string
+	// ScriptKVGetFunc / ScriptKVSetFunc / ScriptKVDeleteFunc / ScriptKVKeysFunc 脚本持久化键值存储
+	ScriptKVGetFunc    func(scriptID int, key string) (string, bool, error)
+	ScriptKVSetFunc    func(scriptID int, key string, value string) error
+	ScriptKVDeleteFunc func(scriptID int, key string) error
+	ScriptKVKeysFunc   func(scriptID int) ([]string, error)
+	// ScriptLookupFunc 只读数据查询（节点、标签、机场）
+	ScriptLookupFunc func(kind string, query map[string]interface{}) (interface{}, error)
+)
+
+const (
+	scriptFetchDefaultTimeout = 10 * time.Second
+	scriptFetchMaxBodySize    = 5 << 20
+	scriptLogMaxMessageLength = 4096
+	scriptLogBufferSize       = 200
+)
+
+// ScriptLogEntry 脚本 console 输出记录
+type ScriptLogEntry struct {
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// ScriptEnv 脚本执行环境：标识当前执行的脚本，并收集本次执行的 console 输出
+// ScriptID 为 0 时 kv 存储不可用，console 输出不会记录到脚本日志
+// DryRun 为 true 时（脚本测试）kv 写入只在本次执行内生效，console 输出不记录到脚本日志
+type ScriptEnv struct {
+	ScriptID   int
+	ScriptName string
+	DryRun     bool
+	Logs       []ScriptLogEntry
+
+	kvOverlay map[string]*string // 试运行时的 kv 写入，nil 值表示已删除
+}
+
+// scriptLogs 每个脚本最近的 console 输出，供界面查看
+var (
+	scriptLogs   = make(map[int][]ScriptLogEntry)
+	scriptLogsMu sync.RWMutex
+)
+
+// GetScriptLogs 获取脚本最近的 console 输出（按时间升序）
+func GetScriptLogs(scriptID int) []ScriptLogEntry {
+	scriptLogsMu.RLock()
+	defer scriptLogsMu.RUnlock()
+	logs := make([]ScriptLogEntry, len(scriptLogs[scriptID]))
+	copy(logs, scriptLogs[scriptID])
+	return logs
+}
+
+// ClearScriptLogs 清空脚本的 console 输出记录
+func ClearScriptLogs(scriptID int) {
+	scriptLogsMu.Lock()
+	defer scriptLogsMu.Unlock()
+	delete(scriptLogs, scriptID)
+}
+
+// appendLog 记录一条 console 输出，同时写入系统日志和脚本日志
+func (env *ScriptEnv) appendLog(level string, message string) {
+	if len(message) > scriptLogMaxMessageLength {
+		message = message[:scriptLogMaxMessageLength] + "..."
+	}
+	entry := ScriptLogEntry{Level: level, Message: message, Time: time.Now()}
+	env.Logs = append(env.Logs, entry)
+
+	name := env.ScriptName
+	if name == "" {
+		name = "未命名"
+	}
+	switch level {
+	case "warn":
+		Warn("[脚本 %s] %s", name, message)
+	case "error":
+		Error("[脚本 %s] %s", name, message)
+	default:
+		Info("[脚本 %s] %s", name, message)
+	}
+
+	if env.ScriptID == 0 || env.DryRun {
+		return
+	}
+	scriptLogsMu.Lock()
+	defer scriptLogsMu.Unlock()
+	logs := append(scriptLogs[env.ScriptID], entry)
+	if len(logs) > scriptLogBufferSize {
+		logs = logs[len(logs)-scriptLogBufferSize:]
+	}
+	scriptLogs[env.ScriptID] = logs
+}
+
+// injectScriptRuntime 注入脚本运行时 API：console、fetch、kv、sublink
+// deadline 为本次执行的截止时间，fetch 超时不会超过该时间
+// budget 统计本次执行通过 fetch、kv、数据查询载入的数据量，超出限制时中断脚本
+func injectScriptRuntime(vm *goja.Runtime, env *ScriptEnv, deadline time.Time, budget *scriptBudget) {
+	console := vm.NewObject()
+	for _, level := range []string{"log", "info", "warn", "error", "debug"} {
+		level := level
+		console.Set(level, func(call goja.FunctionCall) goja.Value {
+			parts := make([]string, 0, len(call.Arguments))
+			for _, arg := range call.Arguments {
+				parts = append(parts, formatScriptValue(arg))
+			}
+			env.appendLog(level, strings.Join(parts, " "))
+			return goja.Undefined()
+		})
+	}
+	vm.Set("console", console)
+
+	vm.Set("fetch", func(call goja.FunctionCall) goja.Value {
+		return scriptFetch(vm, call, deadline, budget)
+	})
+
+	kv := vm.NewObject()
+	kv.Set("get", func(key string) goja.Value {
+		requireScriptKV(vm, env)
+		value, ok, err := env.kvGet(key)
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		if !ok {
+			return goja.Null()
+		}
+		budget.charge(len(value))
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+			return vm.ToValue(value)
+		}
+		return vm.ToValue(decoded)
+	})
+	kv.Set("set", func(key string, value goja.Value) {
+		requireScriptKV(vm, env)
+		data, err := json.Marshal(value.Export())
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		if env.DryRun {
+			env.kvOverlaySet(key, string(data))
+			return
+		}
+		if err := ScriptKVSetFunc(env.ScriptID, key, string(data)); err != nil {
+			panic(vm.NewGoError(err))
+		}
+	})
+	kv.Set("delete", func(key string) {
+		requireScriptKV(vm, env)
+		if env.DryRun {
+			env.kvOverlayDelete(key)
+			return
+		}
+		if err := ScriptKVDeleteFunc(env.ScriptID, key); err != nil {
+			panic(vm.NewGoError(err))
+		}
+	})
+	kv.Set("keys", func() goja.Value {
+		requireScriptKV(vm, env)
+		keys, err := env.kvKeys()
+		if err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return vm.ToValue(keys)
+	})
+	vm.Set("kv", kv)
+
+	lookup := func(kind string) func(goja.FunctionCall) goja.Value {
+		return func(call goja.FunctionCall) goja.Value {
+			if ScriptLookupFunc == nil {
+				panic(vm.NewTypeError("数据查询不可用"))
+			}
+			var query map[string]interface{}
+			if arg := call.Argument(0); !goja.IsUndefined(arg) && !goja.IsNull(arg) {
+				if kind == "node" {
+					query = map[string]interface{}{"name": arg.String()}
+				} else if m, ok := arg.Export().(map[string]interface{}); ok {
+					query = m
+				}
+			}
+			result, err := ScriptLookupFunc(kind, query)
+			if err != nil {
+				panic(vm.NewGoError(err))
+			}
+			return toPlainScriptValue(vm, result, budget)
+		}
+	}
+	sublink := vm.NewObject()
+	sublink.Set("getNodes", lookup("nodes"))
+	sublink.Set("getNode", lookup("node"))
+	sublink.Set("getTags", lookup("tags"))
+	sublink.Set("getAirports", lookup("airports"))
+	vm.Set("sublink", sublink)
+}
+
+// kvGet 读取 kv，试运行时优先读取本次执行的写入
+func (env *ScriptEnv) kvGet(key string) (string, bool, error) {
+	if value, ok := env.kvOverlay[key]; ok {
+		if value == nil {
+			return "", false, nil
+		}
+		return *value, true, nil
+	}
+	return ScriptKVGetFunc(env.ScriptID, key)
+}
+
+// kvOverlaySet 记录试运行时的 kv 写入
+func (env *ScriptEnv) kvOverlaySet(key string, value string) {
+	if env.kvOverlay == nil {
+		env.kvOverlay = make(map[string]*string)
+	}
+	env.kvOverlay[key] = &value
+}
+
+// kvOverlayDelete 记录试运行时的 kv 删除
+func (env *ScriptEnv) kvOverlayDelete(key string) {
+	if env.kvOverlay == nil {
+		env.kvOverlay = make(map[string]*string)
+	}
+	env.kvOverlay[key] = nil
+}
+
+// kvKeys 获取 kv 键列表，试运行时合并本次执行的写入
+func (env *ScriptEnv) kvKeys() ([]string, error) {
+	keys, err := ScriptKVKeysFunc(env.ScriptID)
+	if err != nil || len(env.kvOverlay) == 0 {
+		return keys, err
+	}
+	merged := make([]string, 0, len(keys)+len(env.kvOverlay))
+	for _, key := range keys {
+		if value, ok := env.kvOverlay[key]; !ok || value != nil {
+			merged = append(merged, key)
+		}
+	}
+	for key, value := range env.kvOverlay {
+		if value == nil {
+			continue
+		}
+		if _, exists, _ := ScriptKVGetFunc(env.ScriptID, key); !exists {
+			merged = append(merged, key)
+		}
+	}
+	sort.Strings(merged)
+	return merged, nil
+}
+
+// requireScriptKV 检查 kv 存储是否可用
+func requireScriptKV(vm *goja.Runtime, env *ScriptEnv) {
+	if env.ScriptID == 0 || ScriptKVGetFunc == nil || ScriptKVSetFunc == nil || ScriptKVDeleteFunc == nil || ScriptKVKeysFunc == nil {
+		panic(vm.NewTypeError("kv 存储不可用（脚本未保存或运行时未初始化）"))
+	}
+}
+
+// scriptFetch 实现同步的 fetch(url, options)
+// options: method、headers、body、timeout（毫秒）、proxy（true 自动选择代理节点，或节点链接）
+func scriptFetch(vm *goja.Runtime, call goja.FunctionCall, deadline time.Time, budget *scriptBudget) goja.Value {
+	rawURL := call.Argument(0).String()
+	var options map[string]interface{}
+	if m, ok := call.Argument(1).Export().(map[string]interface{}); ok {
+		options = m
+	}
+
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		panic(vm.NewTypeError("fetch 地址无效: " + rawURL))
+	}
+	if !isScriptFetchAllowed(target.Hostname()) {
+		panic(vm.NewTypeError("fetch 地址不在允许列表中: " + target.Hostname()))
+	}
+
+	timeout := scriptFetchDefaultTimeout
+	if ms, ok := options["timeout"].(int64); ok && ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	} else if ms, ok := options["timeout"].(float64); ok && ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	if remaining := time.Until(deadline); remaining < timeout {
+		timeout = remaining
+	}
+	if timeout <= 0 {
+		panic(vm.NewGoError(ErrScriptTimeout))
+	}
+
+	var useProxy bool
+	var proxyLink string
+	switch proxy := options["proxy"].(type) {
+	case bool:
+		useProxy = proxy
+	case string:
+		useProxy = proxy != ""
+		proxyLink = proxy
+	}
+	client, _, err := CreateProxyHTTPClient(useProxy, proxyLink, timeout)
+	if err != nil {
+		panic(vm.NewGoError(err))
+	}
+	// 重定向的每一跳都需要在允许列表中，避免通过允许的域名跳转访问其他地址
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("重定向次数过多")
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("重定向地址无效: %s", req.URL.String())
+		}
+		if !isScriptFetchAllowed(req.URL.Hostname()) {
+			return fmt.Errorf("重定向地址不在允许列表中: %s", req.URL.Hostname())
+		}
+		return nil
+	}
+
+	method := "GET"
+	if m, ok := options["method"].(string); ok && m != "" {
+		method = strings.ToUpper(m)
+	}
+	var body io.Reader
+	if b, ok := options["body"].(string); ok && b != "" {
+		body = strings.NewReader(b)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		panic(vm.NewGoError(err))
+	}
+	if headers, ok := options["headers"].(map[string]interface{}); ok {
+		for key, value := range headers {
+			req.Header.Set(key, fmt.Sprint(value))
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		panic(vm.NewGoError(fmt.Errorf("fetch 请求失败: %w", err)))
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, scriptFetchMaxBodySize))
+	if err != nil {
+		panic(vm.NewGoError(fmt.Errorf("fetch 读取响应失败: %w", err)))
+	}
+	budget.charge(len(data))
+
+	respHeaders := make(map[string]interface{}, len(resp.Header))
+	for key := range resp.Header {
+		respHeaders[strings.ToLower(key)] = resp.Header.Get(key)
+	}
+	text := string(data)
+
+	result := vm.NewObject()
+	result.Set("status", resp.StatusCode)
+	result.Set("ok", resp.StatusCode >= 200 && resp.StatusCode < 300)
+	result.Set("headers", respHeaders)
+	result.Set("body", text)
+	result.Set("text", func() string { return text })
+	result.Set("json", func() goja.Value {
+		var decoded interface{}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			panic(vm.NewTypeError("响应不是有效的 JSON: " + err.Error()))
+		}
+		return vm.ToValue(decoded)
+	})
+	return result
+}
+
+// isScriptFetchAllowed 检查域名是否在 fetch 允许列表中
+// 支持精确匹配和 *.example.com 形式的子域名匹配
+func isScriptFetchAllowed(host string) bool {
+	if ScriptFetchAllowListFunc == nil {
+		return false
+	}
+	host = strings.ToLower(host)
+	for _, pattern := range ScriptFetchAllowListFunc() {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if pattern == "*" || pattern == host {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatScriptValue 将 console 参数格式化为字符串，对象使用 JSON 表示
+func formatScriptValue(v goja.Value) string {
+	if v == nil || goja.IsUndefined(v) {
+		return "undefined"
+	}
+	if goja.IsNull(v) {
+		return "null"
+	}
+	switch exported := v.Export().(type) {
+	case map[string]interface{}, []interface{}:
+		if data, err := json.Marshal(exported); err == nil {
+			return string(data)
+		}
+	}
+	return v.String()
+}
+
+// toPlainScriptValue 将 Go 值通过 JSON 转换为普通 JS 对象（字段名与接口返回一致）
+func toPlainScriptValue(vm *goja.Runtime, value interface{}, budget *scriptBudget) goja.Value {
+	if value == nil {
+		return goja.Null()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		panic(vm.NewGoError(err))
+	}
+	budget.charge(len(data))
+	var plain interface{}
+	if err := json.Unmarshal(data, &plain); err != nil {
+		panic(vm.NewGoError(err))
+	}
+	return vm.ToValue(plain)
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// encryptedPrefix 加密字符串前缀，用于区分明文和密文
+const encryptedPrefix = "enc:"
+
+// IsEncryptedString 判断字符串是否为 EncryptString 生成的密文
+func IsEncryptedString(s string) bool {
+	return strings.HasPrefix(s, encryptedPrefix)
+}
+
+// EncryptString 使用 AES-GCM 加密字符串
+// 密钥通过 SHA256 派生，输出格式为 enc:<base64(nonce+ciphertext)>
+func EncryptString(plain string, key []byte) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	if len(key) == 0 {
+		return "", fmt.Errorf("加密密钥为空")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString 解密 EncryptString 生成的密文
+// 不带加密前缀的字符串视为明文原样返回，兼容加密前保存的数据
+func DecryptString(encrypted string, key []byte) (string, error) {
+	if !IsEncryptedString(encrypted) {
+		return encrypted, nil
+	}
+	if len(key) == 0 {
+		return "", fmt.Errorf("加密密钥为空")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("密文解码失败: %w", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("密文长度无效")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败: %w", err)
+	}
+	return string(plain), nil
+}
+
+// newGCM 根据任意长度密钥派生 AES-256 密钥并创建 GCM
+func newGCM(key []byte) (cipher.AEAD, error) {
+	derived := sha256.Sum256(key)
+	block, err := aes.NewCipher(derived[:])
+	if err != nil {
+		return nil, fmt.Errorf("创建加密器失败: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 版本升级类型
+const (
+	VersionUpdateMajor = "major"
+	VersionUpdateMinor = "minor"
+	VersionUpdatePatch = "patch"
+)
+
+// ParseSemver 解析语义化版本号（支持 v 前缀，忽略预发布和构建信息）
+// 缺少的次版本号和修订号视为 0
+func ParseSemver(version string) ([3]int, bool) {
+	var parts [3]int
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	if version == "" {
+		return parts, false
+	}
+	fields := strings.Split(version, ".")
+	if len(fields) > 3 {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// CompareSemver 比较两个版本号，a < b 返回 -1，a == b 返回 0，a > b 返回 1
+// 无法解析的版本号视为最低版本
+func CompareSemver(a, b string) int {
+	va, okA := ParseSemver(a)
+	vb, okB := ParseSemver(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	for i := 0; i < 3; i++ {
+		if va[i] != vb[i] {
+			if va[i] < vb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// SemverUpdateType 判断从 current 升级到 latest 的升级类型，latest 不高于 current 时返回空字符串
+func SemverUpdateType(current, latest string) string {
+	if CompareSemver(latest, current) <= 0 {
+		return ""
+	}
+	vc, okC := ParseSemver(current)
+	vl, _ := ParseSemver(latest)
+	switch {
+	case !okC || vl[0] != vc[0]:
+		return VersionUpdateMajor
+	case vl[1] != vc[1]:
+		return VersionUpdateMinor
+	default:
+		return VersionUpdatePatch
+	}
+}
@@ -191,7 +191,8 @@ export default function TemplateList() {
     });
   };
 
-  const handleSubmit = async () => {
+  // force 为 true 时跳过服务端的模板校验
+  const handleSubmit = async (force = false) => {
     try {
       if (isEdit) {
         await updateTemplate({
@@ -202,7 +203,8 @@ export default function TemplateList() {
           ruleSource: formData.ruleSource,
           useProxy: useProxy,
           proxyLink: proxyLink,
-          enableIncludeAll: formData.enableIncludeAll
+          enableIncludeAll: formData.enableIncludeAll,
+          force: force ? 'true' : undefined
         });
         showMessage('更新成功');
       } else {
@@ -213,7 +215,8 @@ export default function TemplateList() {
           ruleSource: formData.ruleSource,
           useProxy: useProxy,
           proxyLink: proxyLink,
-          enableIncludeAll: formData.enableIncludeAll
+          enableIncludeAll: formData.enableIncludeAll,
+          force: force ? 'true' : undefined
         });
         showMessage('添加成功');
       }
@@ -221,6 +224,12 @@ export default function TemplateList() {
       fetchTemplates(page, rowsPerPage);
     } catch (error) {
       console.log(error);
+      // 模板校验未通过：展示校验错误，确认后跳过校验重新保存
+      const validationErrors = error.data?.data?.errors;
+      if (!force && Array.isArray(validationErrors) && validationErrors.length > 0) {
+        openConfirm('模板校验失败', `${validationErrors.join('\n')}\n\n确定要忽略校验结果继续保存吗？`, () => handleSubmit(true));
+        return;
+      }
       showMessage(error.message || (isEdit ? '更新失败' : '添加失败'), 'error');
     }
   };
@@ -694,7 +703,7 @@ export default function TemplateList() {
         </DialogContent>
         <DialogActions>
           <Button onClick={() => setDialogOpen(false)}>取消</Button>
-          <Button variant="contained" onClick={handleSubmit}>
+          <Button variant="contained" onClick={() => handleSubmit()}>
             确定
           </Button>
         </DialogActions>
@@ -719,7 +728,7 @@ export default function TemplateList() {
       >
         <DialogTitle id="alert-dialog-title">{confirmInfo.title}</DialogTitle>
         <DialogContent>
-          <DialogContentText id="alert-dialog-description">{confirmInfo.content}</DialogContentText>
+          <DialogContentText id="alert-dialog-description" sx={{ whiteSpace: 'pre-line' }}>{confirmInfo.content}</DialogContentText>
         </DialogContent>
         <DialogActions>
           <Button onClick={handleConfirmClose}>取消</Button>